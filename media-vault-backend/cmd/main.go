@@ -2,111 +2,405 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"log/slog"
 	"os"
+	"strings"
+	"time"
 
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/monitor"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 
 	"github.com/wronai/media-vault-backend/internal/auth"
+	"github.com/wronai/media-vault-backend/internal/config"
 	"github.com/wronai/media-vault-backend/internal/database"
+	"github.com/wronai/media-vault-backend/internal/encryption"
 	"github.com/wronai/media-vault-backend/internal/handlers"
+	"github.com/wronai/media-vault-backend/internal/lifecycle"
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/metrics"
+	"github.com/wronai/media-vault-backend/internal/problem"
+	"github.com/wronai/media-vault-backend/internal/ratelimit"
+	"github.com/wronai/media-vault-backend/internal/security"
 	"github.com/wronai/media-vault-backend/internal/services"
+	"github.com/wronai/media-vault-backend/internal/storage"
+	"github.com/wronai/media-vault-backend/internal/tracing"
 )
 
 func main() {
+	// Configuration from the environment, an optional CONFIG_FILE and flags;
+	// see internal/config and .env.example. Insecure settings are refused,
+	// logged as JSON like everything else.
+	slog.SetDefault(logging.New(os.Stderr, slog.LevelInfo))
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logging.Fatal("Invalid configuration", logging.Err(err))
+	}
+
+	// Structured JSON logs on stderr at LOG_LEVEL (debug, info, warn or
+	// error), copied to LOG_FILE if set
+	logFile, err := logging.Setup(logging.Config{
+		Level: cfg.LogLevel,
+		File:  cfg.LogFile,
+	})
+	if err != nil {
+		logging.Fatal("Failed to initialize logging", logging.Err(err))
+	}
+	defer logFile.Close()
+
+	// Everything started from here on registers how to stop it; on shutdown
+	// the parts are stopped in reverse order
+	lc := lifecycle.New()
+
+	// Tracing. OTEL_TRACES_EXPORTER=otlp exports spans to the collector at
+	// OTEL_EXPORTER_OTLP_ENDPOINT; spans are no-ops otherwise.
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter: cfg.TracesExporter,
+	})
+	if err != nil {
+		logging.Fatal("Failed to initialize tracing", logging.Err(err))
+	}
+	// Spans still buffered are exported at shutdown
+	lc.OnStop("tracing", shutdownTracing)
+
 	// Initialize database
-	db, err := database.Initialize()
+	db, err := database.Initialize(cfg.DatabasePath)
 	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
+		logging.Fatal("Failed to initialize database", logging.Err(err))
 	}
-	defer db.Close()
+	lc.OnStop("database", func(context.Context) error {
+		return db.Close()
+	})
 
 	// Initialize Keycloak authentication
-	if os.Getenv("OAUTH2_ENABLED") == "true" {
+	if cfg.OAuth2Enabled {
 		if err := auth.InitKeycloak(); err != nil {
-			log.Printf("Warning: Failed to initialize Keycloak: %v", err)
-			log.Println("Running without authentication")
+			slog.Warn("Failed to initialize Keycloak, running without authentication", logging.Err(err))
 		} else {
-			log.Println("Keycloak authentication enabled")
+			slog.Info("Keycloak authentication enabled")
 		}
 	}
 
-	// Initialize services
-	vaultService := services.NewVaultService(db)
-	photoService := services.NewPhotoService(db)
-	descriptionService := services.NewDescriptionService()
+	// Descriptions are stored in the default language and machine-translated
+	// into others when a translation service is configured
+	var translator services.Translator
+	if cfg.TranslationServiceURL != "" {
+		translator = services.NewHTTPTranslator(cfg.TranslationServiceURL, cfg.TranslationAPIKey)
+	}
+
+	// Initialize file storage
+	localStore, err := storage.NewLocalStorage(cfg.UploadPath)
+	if err != nil {
+		logging.Fatal("Failed to initialize storage", logging.Err(err))
+	}
+	store := tracing.InstrumentStorage(metrics.InstrumentStorage(localStore))
+
+	// Signed media URLs. URL_SIGNING_KEYS lists "id:secret" pairs, active key
+	// first; keep retired keys listed until the URLs they signed have expired.
+	// Without keys, which only development allows, a key is generated.
+	signingKeys := strings.Join(cfg.URLSigningKeys, ",")
+	if signingKeys == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logging.Fatal("Failed to generate URL signing key", logging.Err(err))
+		}
+		signingKeys = "ephemeral:base64:" + base64.StdEncoding.EncodeToString(secret)
+		slog.Warn("URL_SIGNING_KEYS is not set, signed URLs will not survive a restart")
+	}
+	keys, activeKeyID, err := services.ParseSigningKeys(signingKeys)
+	if err != nil {
+		logging.Fatal("Invalid URL_SIGNING_KEYS", logging.Err(err))
+	}
+	urlSigner, err := services.NewURLSigner(keys, activeKeyID)
+	if err != nil {
+		logging.Fatal("Invalid URL_SIGNING_KEYS", logging.Err(err))
+	}
+
+	// Vault file encryption. VAULT_MASTER_KEYS (or a file named by
+	// VAULT_MASTER_KEYS_FILE) lists 32-byte master keys in the same "id:secret"
+	// form as URL_SIGNING_KEYS, active key first. Run "rotate-keys" after
+	// adding a new active key, then remove the old one.
+	var keyProvider encryption.KeyProvider
+	if masterKeys := strings.Join(cfg.VaultMasterKeys, ","); masterKeys != "" {
+		keys, activeKeyID, err := services.ParseSigningKeys(masterKeys)
+		if err != nil {
+			logging.Fatal("Invalid vault master keys", logging.Err(err))
+		}
+		if keyProvider, err = encryption.NewStaticKeyProvider(keys, activeKeyID); err != nil {
+			logging.Fatal("Invalid vault master keys", logging.Err(err))
+		}
+	} else {
+		slog.Warn("VAULT_MASTER_KEYS is not set, vault files are stored unencrypted")
+	}
+
+	// Audit log. AUDIT_HASH_CHAIN=true links every event to the previous one
+	// by hash so that tampering shows up in /admin/audit-logs/verify.
+	auditService := services.NewAuditService(db, cfg.AuditHashChain)
+
+	// Initialize services. Users without a quota of their own get
+	// DEFAULT_STORAGE_QUOTA_MB.
+	vaultService := services.NewVaultService(db, cfg.DefaultStorageQuotaMB<<20)
+	photoService := services.NewPhotoService(db, store, cfg.DefaultLanguage)
+	tagService := services.NewTagService(db)
+	searchService := services.NewSearchService(db)
+	descriptionService := services.NewDescriptionService(nil, translator, cfg.DefaultLanguage)
 	sharingService := services.NewSharingService(db)
+	albumService := services.NewAlbumService(db, photoService)
+	fileService := services.NewFileService(db, store, services.ParseAllowedFileTypes(cfg.VaultAllowedFileTypes), keyProvider)
+
+	// "rotate-keys" rewraps vault file data keys with the active master key
+	if len(args) > 0 && args[0] == "rotate-keys" {
+		rewrapped, err := fileService.RewrapKeys(context.Background())
+		if err != nil {
+			logging.Fatal("Key rotation failed", "rewrapped", rewrapped, logging.Err(err))
+		}
+		slog.Info("Rewrapped the data keys of vault files", "rewrapped", rewrapped)
+		event := &services.AuditEvent{
+			ActorID:    services.AuditSystemActor,
+			Action:     services.AuditKeysRotate,
+			TargetType: "vault_keys",
+		}
+		if err := event.SetChange(nil, map[string]int{"rewrapped": rewrapped}); err == nil {
+			err = auditService.Record(context.Background(), event)
+		}
+		if err != nil {
+			slog.Error("Failed to audit key rotation", logging.Err(err))
+		}
+		if err := lc.Shutdown(context.Background()); err != nil {
+			logging.Fatal("Shutdown failed", logging.Err(err))
+		}
+		return
+	}
+	exportService := services.NewExportService(db, store, photoService, albumService, sharingService)
+	exportService.Start(context.Background())
+	// Deleted photos stay in the trash for TRASH_RETENTION_DAYS before they
+	// are purged along with their files
+	trashService := services.NewTrashService(db, store, cfg.TrashRetention(), auditService)
+	trashService.Start(context.Background())
+	// Workers finish the job in progress at shutdown; an export cut short
+	// resumes on the next start
+	lc.OnStop("export worker", exportService.Stop)
+	lc.OnStop("trash purger", trashService.Stop)
+	userDataService := services.NewUserDataService(db, store, trashService)
+
+	statsService := services.NewStatsService(db)
+
+	// Health checks. HEALTH_MIN_FREE_DISK_MB is the disk headroom below which
+	// /admin/system/health fails; it warns below twice as much.
+	healthConfig := services.HealthConfig{
+		DataPath: cfg.UploadPath,
+		Analyzers: map[string]string{
+			"analyzer":      services.AnalyzerHealthURL(cfg.AnalyzerURL),
+			"nsfw_analyzer": services.AnalyzerHealthURL(cfg.NSFWServiceURL),
+		},
+		MinFreeDisk: cfg.HealthMinFreeDiskMB << 20,
+	}
+	healthService := services.NewHealthService(db, store, healthConfig)
+
+	// Users are managed in Keycloak when USER_DIRECTORY=keycloak, and in the
+	// local users table otherwise
+	var userDirectory services.UserDirectory
+	if cfg.UserDirectory == "keycloak" {
+		userDirectory = services.NewKeycloakUserDirectory(services.KeycloakConfig{
+			URL:          cfg.KeycloakURL,
+			Realm:        cfg.KeycloakRealm,
+			ClientID:     cfg.KeycloakClientID,
+			ClientSecret: cfg.KeycloakClientSecret,
+		})
+	} else {
+		userDirectory = services.NewLocalUserDirectory(db)
+	}
 
-	// Initialize auth middleware
+	// Initialize auth middleware. JWT_SECRET is at least MinJWTSecretLength
+	// bytes; config refuses to start without it.
 	authMiddleware := auth.NewAuthMiddleware(auth.JWTConfig{
-		SigningKey: []byte(os.Getenv("JWT_SECRET")),
+		SigningKey: []byte(cfg.JWTSecret),
 	})
 
+	// Rate limits per route group, as RATE_LIMIT_<GROUP>=<limit>/<period>
+	// (e.g. 10/1m) or "off"; RATE_LIMIT_ENABLED=false disables them all.
+	// Signed-in users are limited by user, anonymous clients by IP.
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore())
+	rateLimits, err := cfg.RateLimits()
+	if err != nil {
+		logging.Fatal("Invalid rate limits", logging.Err(err))
+	}
+	authLimit := limiter.Limit(rateLimits["auth"], ratelimit.ByIP)
+	shareLimit := limiter.Limit(rateLimits["share"], ratelimit.ByIP)
+	uploadLimit := limiter.Limit(rateLimits["upload"], ratelimit.ByPrincipal)
+	renderLimit := limiter.Limit(rateLimits["render"], ratelimit.ByPrincipal)
+
 	// Initialize handlers
 	vaultHandler := handlers.NewVaultHandler(vaultService)
-	adminHandler := handlers.NewAdminHandler()
-	partnerHandler := handlers.NewPartnerHandler(photoService, sharingService)
-	uploadHandler := handlers.NewUploadHandler(*vaultService, *photoService, *descriptionService)
-	photoHandler := handlers.NewPhotoHandler(photoService)
+	adminHandler := handlers.NewAdminHandler(vaultService, userDirectory, userDataService, statsService, healthService, auditService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	healthHandler := handlers.NewHealthHandler(healthService)
+	partnerHandler := handlers.NewPartnerHandler(photoService, sharingService, descriptionService, auditService)
+	uploadHandler := handlers.NewUploadHandler(*vaultService, *photoService, *descriptionService, auditService)
+	photoHandler := handlers.NewPhotoHandler(photoService, descriptionService, tagService, sharingService, auditService)
+	tagHandler := handlers.NewTagHandler(tagService, auditService)
+	searchHandler := handlers.NewSearchHandler(searchService, photoService)
+	albumHandler := handlers.NewAlbumHandler(albumService, photoService, sharingService, auditService)
+	shareLinkHandler := handlers.NewShareLinkHandler(sharingService, photoService, albumService, auditService)
+	mediaHandler := handlers.NewMediaHandler(photoService, sharingService, urlSigner)
+	exportHandler := handlers.NewExportHandler(exportService, urlSigner, auditService)
+	fileHandler := handlers.NewFileHandler(fileService, vaultService, sharingService, auditService)
+	trashHandler := handlers.NewTrashHandler(trashService, auditService)
+	versionHandler := handlers.NewVersionHandler(photoService, vaultService, auditService)
+	configHandler := handlers.NewConfigHandler(cfg)
 
-	// Create Fiber app
-	app := fiber.New(fiber.Config{
+	// Create Fiber app. Behind a reverse proxy, list it in TRUSTED_PROXIES
+	// (comma-separated IPs or CIDRs) so that the client IP, which rate limits
+	// and audit events use, is taken from X-Forwarded-For: the rightmost hop
+	// that is not a trusted proxy.
+	fiberConfig := fiber.Config{
 		AppName:       "Media Vault API",
 		Prefork:       false,
 		CaseSensitive: true,
 		StrictRouting: true,
+		// The startup banner is not JSON; startup is logged instead
+		DisableStartupMessage: true,
+		// Errors are rendered as problem details (application/problem+json)
+		ErrorHandler: problem.ErrorHandler,
+	}
+	var proxies *security.Proxies
+	if len(cfg.TrustedProxies) > 0 {
+		if proxies, err = security.ParseProxies(cfg.TrustedProxies); err != nil {
+			logging.Fatal("Invalid TRUSTED_PROXIES", logging.Err(err))
+		}
+		// c.IP() returns the hop ForwardedFor picks, never what the client
+		// wrote at the start of X-Forwarded-For
+		fiberConfig.ProxyHeader = security.ClientIPHeader
+		fiberConfig.EnableIPValidation = true
+		fiberConfig.EnableTrustedProxyCheck = true
+		fiberConfig.TrustedProxies = cfg.TrustedProxies
+	}
+	app := fiber.New(fiberConfig)
+	if proxies != nil {
+		app.Use(security.ForwardedFor(proxies))
+	}
+
+	// At shutdown, readiness fails first for SHUTDOWN_DRAIN_DELAY so that load
+	// balancers stop sending requests; then the server stops accepting
+	// connections and waits for the requests in flight, uploads included.
+	lc.OnStop("HTTP server", func(ctx context.Context) error {
+		healthService.Drain()
+		select {
+		case <-time.After(cfg.ShutdownDrainDelay):
+		case <-ctx.Done():
+		}
+		return app.ShutdownWithContext(ctx)
 	})
 
-	// Middleware
+	// Prometheus metrics, unless METRICS_ENABLED=false. The middleware comes
+	// first so that requests that panic are counted as 500s.
+	if cfg.MetricsEnabled {
+		metrics.RegisterDB(db, "media_vault")
+		metrics.RegisterDisk(cfg.UploadPath)
+		metrics.RegisterJobQueue("export", exportService.QueueDepth)
+		app.Use(metrics.Middleware())
+	}
+
+	// Middleware. Every request gets an ID, echoed in X-Request-ID, and a
+	// span, and is logged as JSON once served, panics included.
+	app.Use(logging.RequestID())
+	app.Use(tracing.Middleware())
+	app.Use(logging.AccessLog())
 	app.Use(recover.New())
-	app.Use(logger.New())
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "*",
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
-		AllowCredentials: true,
-	}))
 
-	// Health check
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.SendString("OK")
+	// Security headers on every response. HSTS_ENABLED adds
+	// Strict-Transport-Security; CONTENT_SECURITY_POLICY overrides the policy
+	// of the admin monitor page, the only page that runs scripts.
+	headerConfig := security.HeaderConfig{}
+	if cfg.HSTSEnabled {
+		headerConfig.HSTSMaxAge = cfg.HSTSMaxAge
+	}
+	app.Use(security.Headers(headerConfig))
+	monitorPolicy := cfg.ContentSecurityPolicy
+	if monitorPolicy == "" {
+		monitorPolicy = security.MonitorContentSecurityPolicy
+	}
+
+	// CORS per route group: the API answers the CORS_ORIGINS of its
+	// frontends, with credentials; share links, signed media and exports
+	// answer CORS_PUBLIC_ORIGINS, without, and may be embedded as CORP_MEDIA
+	// allows.
+	apiOrigins, err := security.ParseOrigins(cfg.CORSOrigins)
+	if err != nil {
+		logging.Fatal("Invalid CORS_ORIGINS", logging.Err(err))
+	}
+	publicOrigins, err := security.ParseOrigins(cfg.CORSPublicOrigins)
+	if err != nil {
+		logging.Fatal("Invalid CORS_PUBLIC_ORIGINS", logging.Err(err))
+	}
+	exposeHeaders := []string{"X-Request-ID", "Content-Disposition", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"}
+	apiCORS := security.CORS(security.CORSPolicy{
+		Origins:          apiOrigins,
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Accept-Language", "Authorization", "X-Request-ID"},
+		ExposeHeaders:    exposeHeaders,
+		AllowCredentials: true,
+		MaxAge:           cfg.CORSMaxAge,
+	})
+	publicCORS := security.CORS(security.CORSPolicy{
+		Origins:       publicOrigins,
+		AllowMethods:  []string{"GET", "HEAD", "POST"},
+		AllowHeaders:  []string{"Content-Type", "Accept", "Accept-Language", "X-Request-ID"},
+		ExposeHeaders: exposeHeaders,
+		MaxAge:        cfg.CORSMaxAge,
 	})
+	mediaPolicy := security.ResourcePolicy(cfg.CORPMedia)
 
+	// Health checks: liveness only needs the process to answer, readiness
+	// needs the database. /health is kept as liveness for docker-compose.
+	app.Get("/health", healthHandler.Live)
+	app.Get("/health/live", healthHandler.Live)
+	app.Get("/health/ready", healthHandler.Ready)
 
-	// Metrics
-	app.Get("/metrics", monitor.New(monitor.Config{Title: "Media Vault Metrics"}))
+	// Metrics for Prometheus; the Fiber monitor page is under /admin/monitor
+	if cfg.MetricsEnabled {
+		app.Get("/metrics", metrics.Handler())
+	}
+
+	// Public share links, limited by IP against password guessing
+	share := app.Group("/s", publicCORS, mediaPolicy)
+	share.Get("/:token", shareLimit, shareLinkHandler.OpenShareLink)
+	share.Post("/:token", shareLimit, shareLinkHandler.OpenShareLink)
+	share.Get("/:token/photos/:photoId", shareLimit, shareLinkHandler.OpenShareLinkPhoto)
+
+	// Signed media URLs
+	app.Group("/media", publicCORS, mediaPolicy).Get("/:id/:rendition", renderLimit, mediaHandler.ServeSignedMedia)
+
+	// Signed export downloads
+	app.Group("/exports", publicCORS, mediaPolicy).Get("/:id", exportHandler.DownloadExport)
 
 	// API v1 routes
-	api := app.Group("/api/v1")
+	api := app.Group("/api/v1", apiCORS)
 
 
 	// Auth routes (placeholder - implement these handlers)
-	authGroup := api.Group("/auth")
+	authGroup := api.Group("/auth", authLimit)
 	{
 		authGroup.Post("/login", func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-				"error": "Login endpoint not implemented",
-			})
+			return fiber.NewError(fiber.StatusNotImplemented, "Login endpoint not implemented")
 		})
 		authGroup.Post("/register", func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-				"error": "Register endpoint not implemented",
-			})
+			return fiber.NewError(fiber.StatusNotImplemented, "Register endpoint not implemented")
 		})
 		authGroup.Post("/refresh", func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-				"error": "Refresh token endpoint not implemented",
-			})
+			return fiber.NewError(fiber.StatusNotImplemented, "Refresh token endpoint not implemented")
 		})
 		authGroup.Post("/logout", func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-				"error": "Logout endpoint not implemented",
-			})
+			return fiber.NewError(fiber.StatusNotImplemented, "Logout endpoint not implemented")
 		})
 	}
 
@@ -118,27 +412,101 @@ func main() {
 		{
 			// Vault routes
 			vault.Get("", vaultHandler.GetVault)
-			vault.Post("/upload", uploadHandler.UploadSingle)
-			vault.Post("/upload/bulk", uploadHandler.BulkUpload)
+			vault.Post("/upload", uploadLimit, uploadHandler.UploadSingle)
+			vault.Post("/upload/bulk", uploadLimit, uploadHandler.BulkUpload)
 		}
 
 		// Photo routes
 		photos := protected.Group("/photos")
 		{
 			photos.Get("", photoHandler.ListPhotos)
+			photos.Get("/search", searchHandler.SearchPhotos)
+			photos.Post("/tags", tagHandler.BatchTagPhotos)
+			photos.Post("/export", exportHandler.LimitRenditions(renderLimit), exportHandler.ExportPhotos)
+			photos.Get("/export/:id", exportHandler.GetExport)
 			photos.Get("/:id", photoHandler.GetPhoto)
 			photos.Put("/:id", photoHandler.UpdatePhoto)
 			photos.Delete("/:id", photoHandler.DeletePhoto)
-			photos.Get("/:id/thumbnail", photoHandler.GetThumbnail)
+			photos.Get("/:id/thumbnail", renderLimit, photoHandler.GetThumbnail)
+			photos.Post("/:id/signed-url", mediaHandler.CreateSignedURL)
+			photos.Get("/:id/download", photoHandler.DownloadPhoto)
+			photos.Put("/:id/original", uploadLimit, versionHandler.ReplaceOriginal)
+			photos.Get("/:id/versions", versionHandler.ListVersions)
+			photos.Get("/:id/versions/:version/download", versionHandler.DownloadVersion)
+			photos.Post("/:id/versions/:version/restore", versionHandler.RestoreVersion)
 			photos.Post("/:id/description", photoHandler.UpdateDescription)
 			photos.Post("/:id/generate-description", photoHandler.GenerateDescription)
+			photos.Get("/:id/translations", photoHandler.GetTranslations)
+			photos.Delete("/:id/translations/:lang", photoHandler.DeleteTranslation)
 			photos.Get("/:id/shared-with", photoHandler.GetSharedWith)
 		}
 
+		// Trash routes
+		trash := protected.Group("/trash")
+		{
+			trash.Get("", trashHandler.ListTrash)
+			trash.Delete("", trashHandler.EmptyTrash)
+			trash.Post("/restore", trashHandler.RestorePhotos)
+			trash.Post("/:id/restore", trashHandler.RestorePhoto)
+			trash.Delete("/:id", trashHandler.DeletePhoto)
+		}
+
+		// File vault routes
+		files := protected.Group("/files")
+		{
+			files.Get("", fileHandler.ListFiles)
+			files.Post("", uploadLimit, fileHandler.UploadFile)
+			files.Get("/shared", fileHandler.ListSharedFiles)
+			files.Post("/folders/move", fileHandler.MoveFolder)
+			files.Get("/:id", fileHandler.GetFile)
+			files.Put("/:id", fileHandler.UpdateFile)
+			files.Delete("/:id", fileHandler.DeleteFile)
+			files.Get("/:id/download", fileHandler.DownloadFile)
+			files.Get("/:id/shares", fileHandler.ListFileShares)
+			files.Post("/:id/shares", fileHandler.ShareFile)
+			files.Delete("/:id/shares/:shareId", fileHandler.RevokeFileShare)
+		}
+
+		// Tag routes
+		tags := protected.Group("/tags")
+		{
+			tags.Get("", tagHandler.ListTags)
+			tags.Post("/merge", tagHandler.MergeTags)
+			tags.Put("/:slug", tagHandler.RenameTag)
+			tags.Delete("/:slug", tagHandler.DeleteTag)
+		}
+
+		// Album routes
+		albums := protected.Group("/albums")
+		{
+			albums.Get("", albumHandler.ListAlbums)
+			albums.Post("", albumHandler.CreateAlbum)
+			albums.Get("/shared", albumHandler.ListSharedAlbums)
+			albums.Get("/:id", albumHandler.GetAlbum)
+			albums.Put("/:id", albumHandler.UpdateAlbum)
+			albums.Delete("/:id", albumHandler.DeleteAlbum)
+			albums.Get("/:id/photos", albumHandler.GetAlbumPhotos)
+			albums.Post("/:id/photos", albumHandler.AddAlbumPhotos)
+			albums.Delete("/:id/photos", albumHandler.RemoveAlbumPhotos)
+			albums.Put("/:id/photos/order", albumHandler.ReorderAlbumPhotos)
+			albums.Get("/:id/shares", albumHandler.ListAlbumShares)
+			albums.Post("/:id/shares", albumHandler.ShareAlbum)
+			albums.Delete("/:id/shares/:shareId", albumHandler.RevokeAlbumShare)
+		}
+
+		// Share link routes
+		shareLinks := protected.Group("/share-links")
+		{
+			shareLinks.Get("", shareLinkHandler.ListShareLinks)
+			shareLinks.Post("", shareLinkHandler.CreateShareLink)
+			shareLinks.Get("/:id", shareLinkHandler.GetShareLink)
+			shareLinks.Delete("/:id", shareLinkHandler.RevokeShareLink)
+		}
+
 		// Partner routes
 		partner := protected.Group("/partner")
 		{
-			partner.Post("/upload", partnerHandler.BulkUpload)
+			partner.Post("/upload", uploadLimit, partnerHandler.BulkUpload)
 			partner.Get("/photos", partnerHandler.GetPartnerPhotos)
 			partner.Put("/photos/descriptions", partnerHandler.BatchUpdateDescriptions)
 			partner.Post("/photos/share", partnerHandler.BatchSharePhotos)
@@ -156,14 +524,45 @@ func main() {
 			admin.Get("/users/:id", adminHandler.GetUser)
 			admin.Put("/users/:id", adminHandler.UpdateUser)
 			admin.Delete("/users/:id", adminHandler.DeleteUser)
+			admin.Post("/users/:id/enable", adminHandler.EnableUser)
+			admin.Post("/users/:id/disable", adminHandler.DisableUser)
+			admin.Put("/users/:id/roles", adminHandler.SetUserRoles)
+			admin.Post("/users/:id/reset-password", adminHandler.ResetUserPassword)
+			admin.Get("/users/:id/usage", adminHandler.GetUserUsage)
+			admin.Put("/users/:id/quota", adminHandler.SetUserQuota)
+			admin.Get("/system/stats", adminHandler.GetSystemStats)
+			admin.Get("/system/health", adminHandler.GetSystemHealth)
+			admin.Get("/system/config", configHandler.GetConfig)
+			admin.Get("/monitor", security.ContentSecurityPolicy(monitorPolicy), monitor.New(monitor.Config{Title: "Media Vault Monitor"}))
+			admin.Get("/audit-logs", auditHandler.ListAuditLogs)
+			admin.Get("/audit-logs/export", auditHandler.ExportAuditLogs)
+			admin.Get("/audit-logs/verify", auditHandler.VerifyAuditChain)
 		}
 	}
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Serve until SIGINT or SIGTERM, or until the server fails, then shut
+	// down within SHUTDOWN_DRAIN_DELAY plus SHUTDOWN_TIMEOUT. Metrics are
+	// scraped rather than pushed, so there are none to flush.
+	serving, stopWaiting := context.WithCancel(context.Background())
+	var serveErr error
+	go func() {
+		defer stopWaiting()
+		slog.Info("Starting Media Vault API", "port", cfg.Port, "environment", cfg.Env)
+		serveErr = app.Listen(":" + cfg.Port)
+	}()
+	if sig := lifecycle.WaitForSignal(serving); sig != nil {
+		slog.Info("Shutting down", "signal", sig.String(),
+			"drain_delay", cfg.ShutdownDrainDelay.String(), "timeout", cfg.ShutdownTimeout.String())
 	}
 
-	log.Fatal(app.Listen(":" + port))
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownDrainDelay+cfg.ShutdownTimeout)
+	defer cancel()
+	if err := lc.Shutdown(ctx); err != nil {
+		logging.Fatal("Shutdown failed", logging.Err(err))
+	}
+	<-serving.Done()
+	if serveErr != nil {
+		logging.Fatal("Server stopped", logging.Err(serveErr))
+	}
+	slog.Info("Shutdown complete")
 }
@@ -0,0 +1,207 @@
+// Package apperr defines the errors services return when a request cannot be
+// served as asked: something is not found, not allowed, conflicts with the
+// current state or is invalid. Each error has a kind, which the API maps to an
+// HTTP status, and a stable code clients can rely on, e.g. photo_not_found.
+//
+// Services declare their errors as sentinels and wrap them to add details:
+//
+//	var ErrAlbumNotFound = apperr.NotFound("album_not_found", "album not found")
+//
+//	return fmt.Errorf("%w: title is required", ErrInvalidAlbum)
+//
+// The cause of an error, e.g. the response of another service, can be
+// attached with WithCause: it is logged with the error but not shown to
+// clients. Any other error is internal: its text is logged, never shown.
+package apperr
+
+import (
+	"errors"
+	"strings"
+)
+
+// Kind is the category of an error
+type Kind string
+
+const (
+	// KindInvalid is a request that is malformed or fails validation
+	KindInvalid Kind = "invalid"
+	// KindUnauthorized is a request without valid credentials
+	KindUnauthorized Kind = "unauthorized"
+	// KindForbidden is a request the caller is not allowed to make
+	KindForbidden Kind = "forbidden"
+	// KindNotFound is a request for something that does not exist
+	KindNotFound Kind = "not_found"
+	// KindConflict is a request that conflicts with the current state
+	KindConflict Kind = "conflict"
+	// KindGone is a request for something that no longer exists
+	KindGone Kind = "gone"
+	// KindUnsupported is a request for a media type that is not supported
+	KindUnsupported Kind = "unsupported"
+	// KindTooLarge is a request whose content is larger than allowed
+	KindTooLarge Kind = "too_large"
+	// KindQuotaExceeded is a request that would exceed a storage quota
+	KindQuotaExceeded Kind = "quota_exceeded"
+	// KindRateLimited is a request over a rate limit
+	KindRateLimited Kind = "rate_limited"
+	// KindUnavailable is a request for a feature that is not available,
+	// e.g. not configured
+	KindUnavailable Kind = "unavailable"
+	// KindUpstream is a request that failed because a service this one
+	// relies on, such as the translator, failed
+	KindUpstream Kind = "upstream"
+)
+
+// FieldError describes what is wrong with a field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error the caller can act upon
+type Error struct {
+	Kind Kind
+	// Code identifies the error, e.g. photo_not_found. Codes are part of the
+	// API and must not change.
+	Code string
+	// Message describes the error, without details of the request
+	Message string
+	// Fields lists the invalid fields of the request, if any
+	Fields []FieldError
+	// Extra holds more data for clients, e.g. what a request conflicts with
+	Extra map[string]any
+
+	cause error
+}
+
+// New creates an error of kind
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// Invalid creates an error for a malformed or invalid request
+func Invalid(code, message string) *Error {
+	return New(KindInvalid, code, message)
+}
+
+// Unauthorized creates an error for a request without valid credentials
+func Unauthorized(code, message string) *Error {
+	return New(KindUnauthorized, code, message)
+}
+
+// Forbidden creates an error for a request the caller is not allowed to make
+func Forbidden(code, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+// NotFound creates an error for something that does not exist
+func NotFound(code, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+// Conflict creates an error for a request conflicting with the current state
+func Conflict(code, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+// Gone creates an error for something that no longer exists
+func Gone(code, message string) *Error {
+	return New(KindGone, code, message)
+}
+
+// Unsupported creates an error for a media type that is not supported
+func Unsupported(code, message string) *Error {
+	return New(KindUnsupported, code, message)
+}
+
+// QuotaExceeded creates an error for a request exceeding a quota
+func QuotaExceeded(code, message string) *Error {
+	return New(KindQuotaExceeded, code, message)
+}
+
+// Unavailable creates an error for a feature that is not available
+func Unavailable(code, message string) *Error {
+	return New(KindUnavailable, code, message)
+}
+
+// WithMessage returns a copy of e with another message, e.g. saying what was
+// not allowed. The copy still matches e with errors.Is.
+func (e *Error) WithMessage(message string) *Error {
+	c := *e
+	c.Message = message
+	return &c
+}
+
+// WithField returns a copy of e reporting that field is invalid. The copy
+// still matches e with errors.Is.
+func (e *Error) WithField(field, message string) *Error {
+	c := *e
+	c.Fields = append(append([]FieldError(nil), e.Fields...), FieldError{Field: field, Message: message})
+	return &c
+}
+
+// WithExtra returns a copy of e carrying value under key in Extra
+func (e *Error) WithExtra(key string, value any) *Error {
+	c := *e
+	c.Extra = make(map[string]any, len(e.Extra)+1)
+	for k, v := range e.Extra {
+		c.Extra[k] = v
+	}
+	c.Extra[key] = value
+	return &c
+}
+
+// WithCause returns a copy of e caused by err. The copy still matches e with
+// errors.Is.
+func (e *Error) WithCause(err error) *Error {
+	c := *e
+	c.cause = err
+	return &c
+}
+
+// Error returns the detail of e, followed by its cause
+func (e *Error) Error() string {
+	if e.cause == nil {
+		return e.Detail()
+	}
+	return e.Detail() + ": " + e.cause.Error()
+}
+
+// Detail returns the message, followed by the invalid fields: what clients
+// may be told about e
+func (e *Error) Detail() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	var b strings.Builder
+	b.WriteString(e.Message)
+	for i, f := range e.Fields {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		b.WriteString(f.Field + " " + f.Message)
+	}
+	return b.String()
+}
+
+// Unwrap returns the cause of e, if any
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether target is an error with the same code, so that errors
+// made with WithField match their sentinel
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// As returns the first *Error in the chain of err
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
@@ -3,6 +3,16 @@ package auth
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+)
+
+var (
+	// ErrMissingToken is returned for requests without a bearer token
+	ErrMissingToken = apperr.Unauthorized("missing_token", "Missing Authorization header")
+	// ErrInvalidToken is returned for invalid or expired tokens
+	ErrInvalidToken = apperr.Unauthorized("invalid_token", "Invalid or expired token")
+	// ErrInsufficientRole is returned when the token lacks a required role
+	ErrInsufficientRole = apperr.Forbidden("insufficient_role", "Insufficient permissions")
 )
 
 // JWTConfig defines the configuration for JWT middleware
@@ -15,9 +25,7 @@ func NewAuthMiddleware(config JWTConfig) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Missing Authorization header",
-			})
+			return ErrMissingToken
 		}
 
 		tokenString := authHeader[len("Bearer "):]
@@ -29,9 +37,7 @@ func NewAuthMiddleware(config JWTConfig) fiber.Handler {
 		})
 
 		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid or expired token",
-			})
+			return ErrInvalidToken
 		}
 
 		// Add user info to context
@@ -49,9 +55,7 @@ func RequireRole(role string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userRoles, ok := c.Locals("roles").([]interface{})
 		if !ok {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "No roles found in token",
-			})
+			return ErrInsufficientRole.WithMessage("No roles found in token")
 		}
 
 		for _, r := range userRoles {
@@ -60,8 +64,6 @@ func RequireRole(role string) fiber.Handler {
 			}
 		}
 
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Insufficient permissions",
-		})
+		return ErrInsufficientRole
 	}
 }
\ No newline at end of file
@@ -0,0 +1,256 @@
+// Package config loads the configuration of the service. Every setting is
+// named by its environment variable, e.g. PORT, and has a default. In
+// increasing order of precedence, settings are read from a YAML or TOML file
+// named by CONFIG_FILE or -config, with lowercase keys (port: 8080), from the
+// environment, and from flags (-port 8080). Secrets can instead be read from
+// the file named by the setting with a _FILE suffix, e.g. JWT_SECRET_FILE,
+// which is how Docker and Kubernetes mount them.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/ratelimit"
+	"github.com/wronai/media-vault-backend/internal/security"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+var (
+	// ErrInvalid is returned when a setting cannot be parsed or is out of range
+	ErrInvalid = errors.New("invalid configuration")
+	// ErrInsecure is returned for settings the service refuses to run with
+	ErrInsecure = errors.New("insecure configuration")
+)
+
+// Environments. Production refuses settings that lose data or weaken security
+// in ways that are only acceptable on a developer's machine.
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// MinJWTSecretLength is the minimum length of JWT_SECRET in bytes, the size of
+// the HS256 hash
+const MinJWTSecretLength = 32
+
+// Config is the configuration of the service. The config tag names the
+// setting, and secret settings are redacted from dumps.
+type Config struct {
+	Env string `config:"APP_ENV" default:"production" usage:"development or production; production refuses insecure settings"`
+
+	Port         string `config:"PORT" default:"8080" usage:"HTTP port"`
+	DatabasePath string `config:"DATABASE_PATH" default:"./data/media.db" usage:"SQLite database file"`
+	UploadPath   string `config:"UPLOAD_PATH" default:"./data/uploads" usage:"directory media and vault files are stored in"`
+	// TrustedProxies are the reverse proxies (IPs or CIDRs) whose
+	// X-Forwarded-For is trusted for the client IP
+	TrustedProxies []string `config:"TRUSTED_PROXIES" usage:"reverse proxies (IPs or CIDRs) trusted to set X-Forwarded-For"`
+	// ShutdownDrainDelay is how long readiness fails before the server stops
+	// accepting requests, for load balancers to notice; ShutdownTimeout is how
+	// long requests and jobs in progress then have to finish
+	ShutdownDrainDelay time.Duration `config:"SHUTDOWN_DRAIN_DELAY" default:"0s" usage:"time readiness fails before the server stops accepting requests"`
+	ShutdownTimeout    time.Duration `config:"SHUTDOWN_TIMEOUT" default:"25s" usage:"time requests and jobs in progress have to finish at shutdown"`
+
+	// CORSOrigins may call the API with credentials; CORSPublicOrigins may
+	// fetch share links, signed media and exports without
+	CORSOrigins           []string      `config:"CORS_ORIGINS" usage:"frontend origins allowed to call the API, e.g. https://app.example.com or https://*.example.com"`
+	CORSPublicOrigins     []string      `config:"CORS_PUBLIC_ORIGINS" default:"*" usage:"origins allowed to fetch share links, signed media and exports"`
+	CORSMaxAge            time.Duration `config:"CORS_MAX_AGE" default:"10m" usage:"time browsers may cache preflight responses"`
+	ContentSecurityPolicy string        `config:"CONTENT_SECURITY_POLICY" usage:"Content-Security-Policy of the admin monitor page; empty for the built-in policy"`
+	HSTSEnabled           bool          `config:"HSTS_ENABLED" usage:"send Strict-Transport-Security; only once the service is always reached over HTTPS"`
+	HSTSMaxAge            time.Duration `config:"HSTS_MAX_AGE" default:"8760h" usage:"time browsers only use HTTPS after a response"`
+	CORPMedia             string        `config:"CORP_MEDIA" default:"cross-origin" usage:"Cross-Origin-Resource-Policy of share links, signed media and exports: same-origin, same-site or cross-origin"`
+
+	LogLevel       string `config:"LOG_LEVEL" default:"info" usage:"debug, info, warn or error"`
+	LogFile        string `config:"LOG_FILE" usage:"file logs are also written to"`
+	TracesExporter string `config:"OTEL_TRACES_EXPORTER" default:"none" usage:"otlp to export spans to OTEL_EXPORTER_OTLP_ENDPOINT, or none"`
+	MetricsEnabled bool   `config:"METRICS_ENABLED" default:"true" usage:"serve Prometheus metrics on /metrics"`
+
+	JWTSecret            string `config:"JWT_SECRET" secret:"true" usage:"HMAC key access tokens are signed with, at least 32 bytes"`
+	OAuth2Enabled        bool   `config:"OAUTH2_ENABLED" usage:"authenticate with Keycloak"`
+	UserDirectory        string `config:"USER_DIRECTORY" default:"local" usage:"where admins manage users: local or keycloak"`
+	KeycloakURL          string `config:"KEYCLOAK_URL" usage:"Keycloak base URL"`
+	KeycloakRealm        string `config:"KEYCLOAK_REALM" usage:"Keycloak realm"`
+	KeycloakClientID     string `config:"KEYCLOAK_CLIENT_ID" usage:"Keycloak client ID"`
+	KeycloakClientSecret string `config:"KEYCLOAK_CLIENT_SECRET" secret:"true" usage:"Keycloak client secret"`
+
+	// URLSigningKeys and VaultMasterKeys are "id:secret" pairs, active key
+	// first
+	URLSigningKeys        []string `config:"URL_SIGNING_KEYS" secret:"true" usage:"id:secret keys signing media URLs, active key first"`
+	VaultMasterKeys       []string `config:"VAULT_MASTER_KEYS" secret:"true" usage:"id:secret 32-byte keys encrypting vault files, active key first"`
+	VaultAllowedFileTypes string   `config:"VAULT_ALLOWED_FILE_TYPES" usage:"MIME types accepted in the file vault; empty for the built-in list"`
+	DefaultStorageQuotaMB int64    `config:"DEFAULT_STORAGE_QUOTA_MB" default:"1024" usage:"storage quota of users without their own, in MB; 0 is unlimited"`
+	TrashRetentionDays    int      `config:"TRASH_RETENTION_DAYS" default:"30" usage:"days deleted photos stay in the trash"`
+	AuditHashChain        bool     `config:"AUDIT_HASH_CHAIN" usage:"chain audit events by hash"`
+
+	DefaultLanguage       string `config:"DEFAULT_LANGUAGE" default:"en" usage:"language descriptions are stored in"`
+	TranslationServiceURL string `config:"TRANSLATION_SERVICE_URL" usage:"machine translation service"`
+	TranslationAPIKey     string `config:"TRANSLATION_API_KEY" secret:"true" usage:"translation service API key"`
+	AnalyzerURL           string `config:"ANALYZER_URL" usage:"image analyzer"`
+	NSFWServiceURL        string `config:"NSFW_SERVICE_URL" usage:"NSFW analyzer"`
+	HealthMinFreeDiskMB   uint64 `config:"HEALTH_MIN_FREE_DISK_MB" default:"1024" usage:"free disk in MB below which the health check fails"`
+
+	RateLimitEnabled bool   `config:"RATE_LIMIT_ENABLED" default:"true" usage:"apply the rate limits"`
+	RateLimitAuth    string `config:"RATE_LIMIT_AUTH" default:"10/1m" usage:"auth requests per IP, as <limit>/<period> or off"`
+	RateLimitShare   string `config:"RATE_LIMIT_SHARE" default:"30/1m" usage:"public share link requests per IP"`
+	RateLimitUpload  string `config:"RATE_LIMIT_UPLOAD" default:"60/1m" usage:"uploads per user"`
+	RateLimitRender  string `config:"RATE_LIMIT_RENDER" default:"600/1m" usage:"thumbnails, signed media and thumbnail exports per user"`
+
+	// sources records where each setting came from
+	sources map[string]source
+}
+
+// Production reports whether the service runs in production
+func (c *Config) Production() bool {
+	return c.Env == EnvProduction
+}
+
+// TrashRetention is how long deleted photos stay in the trash
+func (c *Config) TrashRetention() time.Duration {
+	return time.Duration(c.TrashRetentionDays) * 24 * time.Hour
+}
+
+// RateLimits returns the rate limit policies by route group, all disabled if
+// RATE_LIMIT_ENABLED is false
+func (c *Config) RateLimits() (map[string]ratelimit.Policy, error) {
+	policies := map[string]ratelimit.Policy{}
+	var errs []error
+	for _, group := range []struct{ name, value string }{
+		{"auth", c.RateLimitAuth},
+		{"share", c.RateLimitShare},
+		{"upload", c.RateLimitUpload},
+		{"render", c.RateLimitRender},
+	} {
+		name, value := group.name, group.value
+		if !c.RateLimitEnabled {
+			value = "off"
+		}
+		policy, err := ratelimit.ParsePolicy(name, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("RATE_LIMIT_%s: %w", strings.ToUpper(name), err))
+		}
+		policies[name] = policy
+	}
+	return policies, errors.Join(errs...)
+}
+
+// Validate checks that the settings are in range and secure. All problems are
+// reported at once, so that a deployment can be fixed in one go.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s %s", ErrInvalid, key, fmt.Sprintf(format, args...)))
+	}
+	insecure := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s %s", ErrInsecure, key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		invalid("APP_ENV", "must be %s or %s, not %q", EnvDevelopment, EnvProduction, c.Env)
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		invalid("PORT", "must be a port number, not %q", c.Port)
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		invalid("LOG_LEVEL", "must be debug, info, warn or error, not %q", c.LogLevel)
+	}
+	switch c.TracesExporter {
+	case "", "none", "otlp":
+	default:
+		invalid("OTEL_TRACES_EXPORTER", "must be otlp or none, not %q", c.TracesExporter)
+	}
+	if utils.NormalizeLanguageTag(c.DefaultLanguage) == "" {
+		invalid("DEFAULT_LANGUAGE", "must be a language tag, not %q", c.DefaultLanguage)
+	}
+	if c.DefaultStorageQuotaMB < 0 {
+		invalid("DEFAULT_STORAGE_QUOTA_MB", "must not be negative")
+	}
+	if c.TrashRetentionDays < 1 {
+		invalid("TRASH_RETENTION_DAYS", "must be at least 1")
+	}
+	if c.ShutdownDrainDelay < 0 {
+		invalid("SHUTDOWN_DRAIN_DELAY", "must not be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		invalid("SHUTDOWN_TIMEOUT", "must be positive")
+	}
+	if c.HealthMinFreeDiskMB == 0 {
+		invalid("HEALTH_MIN_FREE_DISK_MB", "must be at least 1")
+	}
+	if _, err := c.RateLimits(); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrInvalid, err))
+	}
+
+	if origins, err := security.ParseOrigins(c.CORSOrigins); err != nil {
+		invalid("CORS_ORIGINS", "%v", err)
+	} else if origins.Any() {
+		insecure("CORS_ORIGINS", "must not be *: the API accepts credentials, which any site could then use; list the frontends' origins, e.g. https://*.example.com")
+	}
+	if _, err := security.ParseOrigins(c.CORSPublicOrigins); err != nil {
+		invalid("CORS_PUBLIC_ORIGINS", "%v", err)
+	}
+	switch c.CORPMedia {
+	case security.ResourceSameOrigin, security.ResourceSameSite, security.ResourceCrossOrigin:
+	default:
+		invalid("CORP_MEDIA", "must be same-origin, same-site or cross-origin, not %q", c.CORPMedia)
+	}
+	if c.HSTSEnabled && c.HSTSMaxAge < time.Second {
+		invalid("HSTS_MAX_AGE", "must be at least 1s when HSTS_ENABLED is true")
+	}
+
+	switch c.UserDirectory {
+	case "local":
+	case "keycloak":
+		for _, setting := range []struct{ key, value string }{
+			{"KEYCLOAK_URL", c.KeycloakURL},
+			{"KEYCLOAK_REALM", c.KeycloakRealm},
+			{"KEYCLOAK_CLIENT_ID", c.KeycloakClientID},
+			{"KEYCLOAK_CLIENT_SECRET", c.KeycloakClientSecret},
+		} {
+			if setting.value == "" {
+				invalid(setting.key, "must be set when USER_DIRECTORY is keycloak")
+			}
+		}
+	default:
+		invalid("USER_DIRECTORY", "must be local or keycloak, not %q", c.UserDirectory)
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			if net.ParseIP(proxy) == nil {
+				invalid("TRUSTED_PROXIES", "must list IPs or CIDRs, not %q", proxy)
+			}
+			continue
+		}
+		if ones, _ := network.Mask.Size(); ones == 0 {
+			insecure("TRUSTED_PROXIES", "must not trust every address (%s): any client could spoof its IP past rate limits and audit logs", proxy)
+		}
+	}
+
+	// An empty HMAC key is still a key: tokens signed with it would verify
+	switch {
+	case c.JWTSecret == "":
+		insecure("JWT_SECRET", "must be set")
+	case len(c.JWTSecret) < MinJWTSecretLength:
+		insecure("JWT_SECRET", "must be at least %d bytes", MinJWTSecretLength)
+	}
+
+	// Development may get by with keys that don't survive a restart and
+	// unencrypted vault files; production may not
+	if c.Production() {
+		if len(c.URLSigningKeys) == 0 {
+			insecure("URL_SIGNING_KEYS", "must be set in production, or signed URLs break on every restart")
+		}
+		if len(c.VaultMasterKeys) == 0 {
+			insecure("VAULT_MASTER_KEYS", "must be set in production, or vault files are stored unencrypted")
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"reflect"
+	"time"
+)
+
+// Redacted replaces the value of secrets that are set in dumps
+const Redacted = "[redacted]"
+
+// Setting is a setting as shown to admins
+type Setting struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+	// Source is where the value came from: default, file, env or flag
+	Source string `json:"source"`
+	// SecretFile is the file a secret was read from
+	SecretFile string `json:"secret_file,omitempty"`
+	Secret     bool   `json:"secret,omitempty"`
+}
+
+// Dump lists the settings with secrets redacted, so that admins can check
+// what a deployment runs with without reading its secrets
+func (c *Config) Dump() []Setting {
+	v := reflect.ValueOf(c).Elem()
+	var settings []Setting
+	for _, f := range fields() {
+		value, src := v.Field(f.index), c.sources[f.key]
+		setting := Setting{
+			Key:        f.key,
+			Value:      value.Interface(),
+			Source:     src.name,
+			SecretFile: src.file,
+			Secret:     f.secret,
+		}
+		if d, ok := setting.Value.(time.Duration); ok {
+			setting.Value = d.String()
+		}
+		if f.secret {
+			// Only whether a secret is set is shown
+			setting.Value = ""
+			if value.Kind() == reflect.Slice && value.Len() > 0 || value.Kind() != reflect.Slice && !value.IsZero() {
+				setting.Value = Redacted
+			}
+		}
+		if setting.Source == "" {
+			setting.Source = SourceDefault
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
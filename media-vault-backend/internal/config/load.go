@@ -0,0 +1,287 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Where a setting came from, in increasing order of precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// secretFileSuffix names the setting holding the path of a secret's file
+const secretFileSuffix = "_FILE"
+
+// source is where a setting came from, and the file a secret was read from
+type source struct {
+	name string
+	file string
+}
+
+// field is a setting of Config
+type field struct {
+	key    string
+	def    string
+	usage  string
+	secret bool
+	index  int
+}
+
+// fields lists the settings of Config in declaration order
+func fields() []field {
+	t := reflect.TypeOf(Config{})
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := f.Tag.Get("config")
+		if key == "" {
+			continue
+		}
+		fields = append(fields, field{
+			key:    key,
+			def:    f.Tag.Get("default"),
+			usage:  f.Tag.Get("usage"),
+			secret: f.Tag.Get("secret") == "true",
+			index:  i,
+		})
+	}
+	return fields
+}
+
+// Load loads the configuration from the defaults, the configuration file, the
+// environment and the command-line arguments args, and validates it. It also
+// returns the arguments left after the flags, such as a command to run.
+func Load(args []string) (*Config, []string, error) {
+	c, rest, err := load(args, os.LookupEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return c, rest, nil
+}
+
+func load(args []string, lookupEnv func(string) (string, bool)) (*Config, []string, error) {
+	fields := fields()
+
+	// Flags are named after the settings, e.g. -jwt-secret-file for
+	// JWT_SECRET_FILE. Only flags given on the command line are applied.
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configFile := flags.String("config", "", "YAML or TOML configuration file (CONFIG_FILE)")
+	for _, f := range fields {
+		flags.String(flagName(f.key), "", f.usage+" ("+f.key+")")
+		if f.secret {
+			flags.String(flagName(f.key+secretFileSuffix), "", "file holding "+f.key)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	flagValues := map[string]string{}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			flagValues[keyName(f.Name)] = f.Value.String()
+		}
+	})
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	var fileValues map[string]string
+	if path != "" {
+		var err error
+		if fileValues, err = readFile(path, fields); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Empty variables count as unset, as env files list every setting
+	envValues := map[string]string{}
+	for _, f := range fields {
+		keys := []string{f.key}
+		if f.secret {
+			keys = append(keys, f.key+secretFileSuffix)
+		}
+		for _, key := range keys {
+			if value, ok := lookupEnv(key); ok && value != "" {
+				envValues[key] = value
+			}
+		}
+	}
+
+	c := &Config{sources: map[string]source{}}
+	v := reflect.ValueOf(c).Elem()
+	var errs []error
+	for _, f := range fields {
+		value, src := f.def, source{name: SourceDefault}
+		for _, layer := range []struct {
+			name   string
+			values map[string]string
+		}{
+			{SourceFile, fileValues},
+			{SourceEnv, envValues},
+			{SourceFlag, flagValues},
+		} {
+			direct, hasDirect := layer.values[f.key]
+			path, hasFile := layer.values[f.key+secretFileSuffix]
+			switch {
+			case hasDirect && hasFile:
+				errs = append(errs, fmt.Errorf("%w: both %s and %s are set in %s", ErrInvalid, f.key, f.key+secretFileSuffix, layer.name))
+			case hasFile:
+				data, err := os.ReadFile(path)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%w: %s: %w", ErrInvalid, f.key+secretFileSuffix, err))
+					continue
+				}
+				value, src = strings.TrimSpace(string(data)), source{name: layer.name, file: path}
+			case hasDirect:
+				value, src = direct, source{name: layer.name}
+			}
+		}
+		if err := setField(v.Field(f.index), value); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s %w", ErrInvalid, f.key, err))
+		}
+		c.sources[f.key] = src
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+	return c, flags.Args(), nil
+}
+
+// readFile reads the settings in a YAML or TOML file. Keys are the lowercase
+// names of the settings; lists are accepted for list settings.
+func readFile(path string, fields []field) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	var raw map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("%w: configuration file %s must be .yaml, .yml or .toml", ErrInvalid, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalid, path, err)
+	}
+
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f.key] = true
+		if f.secret {
+			known[f.key+secretFileSuffix] = true
+		}
+	}
+
+	values := make(map[string]string, len(raw))
+	var errs []error
+	for name, value := range raw {
+		key := strings.ToUpper(name)
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("%w: %s: unknown setting %q", ErrInvalid, path, name))
+			continue
+		}
+		switch value := value.(type) {
+		case nil:
+			values[key] = ""
+		case []any:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case map[string]any:
+			errs = append(errs, fmt.Errorf("%w: %s: %s must not be a table", ErrInvalid, path, name))
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	// Sorted so that the report doesn't depend on map order
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// setField parses value into a field of Config. Durations are written like
+// 30s, and lists are separated by commas or whitespace, so that a secret file
+// may hold one key per line.
+func setField(v reflect.Value, value string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 30s, not %q", value)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(strings.TrimSpace(value))
+	case reflect.Bool:
+		if value == "" {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be true or false, not %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer, not %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be a non-negative integer, not %q", value)
+		}
+		v.SetUint(n)
+	case reflect.Slice:
+		v.Set(reflect.ValueOf(strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})))
+	default:
+		return fmt.Errorf("has unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// flagName turns a setting name into a flag name, e.g. JWT_SECRET into
+// jwt-secret
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// keyName turns a flag name back into a setting name
+func keyName(flag string) string {
+	return strings.ReplaceAll(strings.ToUpper(flag), "-", "_")
+}
@@ -1,26 +1,46 @@
 package database
 
 import (
+    "context"
     "database/sql"
+    "database/sql/driver"
+    "fmt"
+    "log/slog"
     "os"
     "path/filepath"
+    "strings"
 
+    "github.com/XSAM/otelsql"
+    "github.com/google/uuid"
     _ "github.com/mattn/go-sqlite3"
-)
+    semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+    "go.opentelemetry.io/otel/trace"
 
-func Initialize() (*sql.DB, error) {
-    dbPath := os.Getenv("DATABASE_PATH")
-    if dbPath == "" {
-        dbPath = "./data/media.db"
-    }
+    "github.com/wronai/media-vault-backend/internal/utils"
+)
 
+// Initialize opens the database at dbPath, creating it if needed, and
+// migrates it
+func Initialize(dbPath string) (*sql.DB, error) {
     // Ensure directory exists
     dir := filepath.Dir(dbPath)
     if err := os.MkdirAll(dir, 0755); err != nil {
         return nil, err
     }
 
-    db, err := sql.Open("sqlite3", dbPath)
+    // foreign_keys is set in the DSN so that it applies to every pooled connection.
+    // Statements are traced when they run within a traced request or job.
+    db, err := otelsql.Open("sqlite3", dbPath+"?_foreign_keys=on",
+        otelsql.WithAttributes(semconv.DBSystemSqlite),
+        otelsql.WithSpanOptions(otelsql.SpanOptions{
+            OmitConnResetSession: true,
+            OmitConnectorConnect: true,
+            OmitRows:             true,
+            SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+                return trace.SpanContextFromContext(ctx).IsValid()
+            },
+        }),
+    )
     if err != nil {
         return nil, err
     }
@@ -93,12 +113,251 @@ func runMigrations(db *sql.DB) error {
             FOREIGN KEY (photo_id) REFERENCES photos (id) ON DELETE CASCADE
         )`,
 
+        `CREATE TABLE IF NOT EXISTS photo_translations (
+            photo_id TEXT NOT NULL,
+            language TEXT NOT NULL,
+            description TEXT,
+            ai_description TEXT,
+            tags TEXT,
+            source TEXT NOT NULL DEFAULT 'user',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (photo_id, language),
+            FOREIGN KEY (photo_id) REFERENCES photos (id) ON DELETE CASCADE
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS tags (
+            id TEXT PRIMARY KEY,
+            user_id TEXT NOT NULL,
+            slug TEXT NOT NULL,
+            name TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (user_id, slug)
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS photo_tags (
+            photo_id TEXT NOT NULL,
+            tag_id TEXT NOT NULL,
+            source TEXT NOT NULL DEFAULT 'user',
+            confidence REAL,
+            created_by TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (photo_id, tag_id),
+            FOREIGN KEY (photo_id) REFERENCES photos (id) ON DELETE CASCADE,
+            FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS albums (
+            id TEXT PRIMARY KEY,
+            user_id TEXT NOT NULL,
+            parent_id TEXT,
+            title TEXT NOT NULL,
+            description TEXT,
+            cover_photo_id TEXT,
+            kind TEXT NOT NULL DEFAULT 'manual',
+            query TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (parent_id) REFERENCES albums (id) ON DELETE CASCADE,
+            FOREIGN KEY (cover_photo_id) REFERENCES photos (id) ON DELETE SET NULL
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS album_photos (
+            album_id TEXT NOT NULL,
+            photo_id TEXT NOT NULL,
+            position INTEGER NOT NULL,
+            added_by TEXT,
+            added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (album_id, photo_id),
+            FOREIGN KEY (album_id) REFERENCES albums (id) ON DELETE CASCADE,
+            FOREIGN KEY (photo_id) REFERENCES photos (id) ON DELETE CASCADE
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS album_sharing (
+            id TEXT PRIMARY KEY,
+            album_id TEXT NOT NULL,
+            shared_by TEXT NOT NULL,
+            shared_with TEXT NOT NULL,
+            permission TEXT NOT NULL DEFAULT 'view',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            expires_at DATETIME,
+            FOREIGN KEY (album_id) REFERENCES albums (id) ON DELETE CASCADE
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS share_links (
+            id TEXT PRIMARY KEY,
+            token_hash TEXT NOT NULL UNIQUE,
+            token_prefix TEXT NOT NULL,
+            photo_id TEXT,
+            album_id TEXT,
+            created_by TEXT NOT NULL,
+            permission TEXT NOT NULL DEFAULT 'view',
+            password_hash TEXT,
+            expires_at DATETIME,
+            max_views INTEGER,
+            max_downloads INTEGER,
+            view_count INTEGER NOT NULL DEFAULT 0,
+            download_count INTEGER NOT NULL DEFAULT 0,
+            last_accessed_at DATETIME,
+            revoked_at DATETIME,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            CHECK ((photo_id IS NULL) != (album_id IS NULL)),
+            FOREIGN KEY (photo_id) REFERENCES photos (id) ON DELETE CASCADE,
+            FOREIGN KEY (album_id) REFERENCES albums (id) ON DELETE CASCADE
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS photo_renditions (
+            photo_id TEXT NOT NULL,
+            rendition TEXT NOT NULL,
+            storage_key TEXT NOT NULL,
+            size INTEGER NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (photo_id, rendition),
+            FOREIGN KEY (photo_id) REFERENCES photos (id) ON DELETE CASCADE
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS user_settings (
+            user_id TEXT PRIMARY KEY,
+            theme TEXT NOT NULL DEFAULT 'light',
+            notifications BOOLEAN NOT NULL DEFAULT 1,
+            email_alerts BOOLEAN NOT NULL DEFAULT 1,
+            storage_quota INTEGER,
+            last_backup DATETIME,
+            auto_save BOOLEAN NOT NULL DEFAULT 1,
+            auto_tagging BOOLEAN NOT NULL DEFAULT 0,
+            auto_categorize BOOLEAN NOT NULL DEFAULT 0,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS vault_files (
+            id TEXT PRIMARY KEY,
+            user_id TEXT NOT NULL,
+            name TEXT NOT NULL,
+            path TEXT NOT NULL DEFAULT '/',
+            storage_key TEXT NOT NULL,
+            size INTEGER NOT NULL,
+            mime_type TEXT NOT NULL,
+            hash TEXT NOT NULL,
+            is_public BOOLEAN NOT NULL DEFAULT 0,
+            is_encrypted BOOLEAN NOT NULL DEFAULT 0,
+            metadata TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (user_id, path, name)
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS file_sharing (
+            id TEXT PRIMARY KEY,
+            file_id TEXT NOT NULL,
+            shared_by TEXT NOT NULL,
+            shared_with TEXT NOT NULL,
+            permission TEXT NOT NULL DEFAULT 'view',
+            expires_at DATETIME,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (file_id) REFERENCES vault_files (id) ON DELETE CASCADE
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS export_jobs (
+            id TEXT PRIMARY KEY,
+            user_id TEXT NOT NULL,
+            status TEXT NOT NULL DEFAULT 'pending',
+            format TEXT NOT NULL,
+            request TEXT NOT NULL,
+            photo_count INTEGER NOT NULL DEFAULT 0,
+            size INTEGER,
+            error TEXT,
+            storage_key TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            completed_at DATETIME,
+            expires_at DATETIME
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS photo_versions (
+            photo_id TEXT NOT NULL,
+            version INTEGER NOT NULL,
+            storage_key TEXT NOT NULL,
+            original_name TEXT NOT NULL,
+            file_size INTEGER NOT NULL,
+            mime_type TEXT NOT NULL,
+            width INTEGER,
+            height INTEGER,
+            hash TEXT NOT NULL,
+            restored_from INTEGER,
+            created_by TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (photo_id, version),
+            FOREIGN KEY (photo_id) REFERENCES photos (id) ON DELETE CASCADE
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS users (
+            id TEXT PRIMARY KEY,
+            username TEXT NOT NULL UNIQUE,
+            email TEXT NOT NULL UNIQUE,
+            full_name TEXT,
+            avatar_url TEXT,
+            password_hash TEXT,
+            password_temporary BOOLEAN NOT NULL DEFAULT 0,
+            is_active BOOLEAN NOT NULL DEFAULT 1,
+            last_login DATETIME,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS user_roles (
+            user_id TEXT NOT NULL,
+            role TEXT NOT NULL,
+            PRIMARY KEY (user_id, role),
+            FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+        )`,
+
+        // Audit events are append-only; the triggers reject edits and deletes
+        `CREATE TABLE IF NOT EXISTS audit_events (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            time DATETIME NOT NULL,
+            actor_id TEXT NOT NULL,
+            action TEXT NOT NULL,
+            target_type TEXT NOT NULL,
+            target_id TEXT,
+            ip TEXT,
+            user_agent TEXT,
+            request_id TEXT,
+            before TEXT,
+            after TEXT,
+            prev_hash TEXT,
+            hash TEXT
+        )`,
+
+        `CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events BEGIN
+            SELECT RAISE(ABORT, 'audit_events is append-only');
+        END`,
+
+        `CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events BEGIN
+            SELECT RAISE(ABORT, 'audit_events is append-only');
+        END`,
+
         `CREATE INDEX IF NOT EXISTS idx_photos_user_id ON photos (user_id)`,
         `CREATE INDEX IF NOT EXISTS idx_photos_partner_id ON photos (partner_id)`,
         `CREATE INDEX IF NOT EXISTS idx_photos_created_at ON photos (created_at)`,
         `CREATE INDEX IF NOT EXISTS idx_photos_moderation_status ON photos (moderation_status)`,
         `CREATE INDEX IF NOT EXISTS idx_photo_sharing_photo_id ON photo_sharing (photo_id)`,
         `CREATE INDEX IF NOT EXISTS idx_photo_sharing_shared_with ON photo_sharing (shared_with)`,
+        `CREATE INDEX IF NOT EXISTS idx_photo_tags_tag_id ON photo_tags (tag_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_albums_user_id ON albums (user_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_albums_parent_id ON albums (parent_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_album_photos_photo_id ON album_photos (photo_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_album_sharing_album_id ON album_sharing (album_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_album_sharing_shared_with ON album_sharing (shared_with)`,
+        `CREATE INDEX IF NOT EXISTS idx_share_links_created_by ON share_links (created_by)`,
+        `CREATE INDEX IF NOT EXISTS idx_file_sharing_file_id ON file_sharing (file_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_file_sharing_shared_with ON file_sharing (shared_with)`,
+        `CREATE INDEX IF NOT EXISTS idx_export_jobs_user_id ON export_jobs (user_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_user_roles_role ON user_roles (role)`,
+        `CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action)`,
+        `CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events (target_type, target_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_audit_events_time ON audit_events (time)`,
+        `CREATE INDEX IF NOT EXISTS idx_audit_events_request_id ON audit_events (request_id)`,
     }
 
     for _, migration := range migrations {
@@ -107,6 +366,261 @@ func runMigrations(db *sql.DB) error {
         }
     }
 
+    if err := addColumns(db); err != nil {
+        return err
+    }
+
+    if err := migrateLegacyTags(db); err != nil {
+        return err
+    }
+
+    return setupSearch(db)
+}
+
+// columnMigrations add columns to tables created by earlier versions
+var columnMigrations = []struct {
+    table, column, definition string
+}{
+    {"vault_files", "key_id", "TEXT"},
+    {"vault_files", "wrapped_key", "BLOB"},
+    {"photos", "deleted_at", "DATETIME"},
+}
+
+// columnIndexes index columns added by columnMigrations
+var columnIndexes = []string{
+    `CREATE INDEX IF NOT EXISTS idx_photos_deleted_at ON photos (deleted_at) WHERE deleted_at IS NOT NULL`,
+}
+
+// addColumns applies columnMigrations, skipping columns that already exist,
+// then creates columnIndexes
+func addColumns(db *sql.DB) error {
+    for _, m := range columnMigrations {
+        var count int
+        err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, m.table, m.column).Scan(&count)
+        if err != nil {
+            return err
+        }
+        if count > 0 {
+            continue
+        }
+        if _, err := db.Exec(`ALTER TABLE ` + m.table + ` ADD COLUMN ` + m.column + ` ` + m.definition); err != nil {
+            return err
+        }
+    }
+    for _, index := range columnIndexes {
+        if _, err := db.Exec(index); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// searchMigrations create the photos_fts full-text index and the triggers that
+// keep it in sync with the photos table. Index rows share the rowid of their
+// photo, so that the triggers find them without scanning the index. photos
+// has no INTEGER PRIMARY KEY, so VACUUM may renumber its rowids: drop
+// photos_fts after a VACUUM and it is rebuilt at the next start.
+var searchMigrations = []string{
+    `CREATE VIRTUAL TABLE IF NOT EXISTS photos_fts USING fts5(
+        original_name,
+        description,
+        ai_description,
+        tags,
+        camera,
+        location,
+        tokenize = 'unicode61 remove_diacritics 2'
+    )`,
+
+    `CREATE TRIGGER IF NOT EXISTS photos_fts_insert AFTER INSERT ON photos BEGIN
+        INSERT INTO photos_fts (rowid, original_name, description, ai_description, tags, camera, location)
+        VALUES (
+            new.rowid, new.original_name, new.description, new.ai_description, new.tags,
+            trim(coalesce(new.camera_make, '') || ' ' || coalesce(new.camera_model, '')),
+            new.location
+        );
+    END`,
+
+    `CREATE TRIGGER IF NOT EXISTS photos_fts_update
+    AFTER UPDATE OF original_name, description, ai_description, tags, camera_make, camera_model, location ON photos BEGIN
+        UPDATE photos_fts SET
+            original_name = new.original_name,
+            description = new.description,
+            ai_description = new.ai_description,
+            tags = new.tags,
+            camera = trim(coalesce(new.camera_make, '') || ' ' || coalesce(new.camera_model, '')),
+            location = new.location
+        WHERE rowid = old.rowid;
+    END`,
+
+    `CREATE TRIGGER IF NOT EXISTS photos_fts_delete AFTER DELETE ON photos BEGIN
+        DELETE FROM photos_fts WHERE rowid = old.rowid;
+    END`,
+
+    // Index photos that existed before the search index was created
+    `INSERT INTO photos_fts (rowid, original_name, description, ai_description, tags, camera, location)
+    SELECT rowid, original_name, description, ai_description, tags,
+        trim(coalesce(camera_make, '') || ' ' || coalesce(camera_model, '')),
+        location
+    FROM photos
+    WHERE rowid NOT IN (SELECT rowid FROM photos_fts)`,
+}
+
+// legacySearchMigrations drop the first version of the search index, whose
+// rows were keyed by an unindexed photo_id column, so that it is rebuilt
+var legacySearchMigrations = []string{
+    `DROP TRIGGER IF EXISTS photos_fts_insert`,
+    `DROP TRIGGER IF EXISTS photos_fts_update`,
+    `DROP TRIGGER IF EXISTS photos_fts_delete`,
+    `DROP TABLE IF EXISTS photos_fts`,
+}
+
+// setupSearch creates the full-text search index. SQLite must be built with
+// FTS5 (go build -tags sqlite_fts5); without it search is disabled rather
+// than failing startup.
+func setupSearch(db *sql.DB) error {
+    var legacy int
+    if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('photos_fts') WHERE name = 'photo_id'`).Scan(&legacy); err != nil {
+        return err
+    }
+    migrations := searchMigrations
+    if legacy > 0 {
+        slog.Info("Rebuilding the photo search index")
+        migrations = append(append([]string{}, legacySearchMigrations...), searchMigrations...)
+    }
+
+    for _, migration := range migrations {
+        if _, err := db.Exec(migration); err != nil {
+            if strings.Contains(err.Error(), "no such module: fts5") {
+                slog.Warn("SQLite was built without FTS5, photo search is disabled")
+                return nil
+            }
+            return err
+        }
+    }
+    return nil
+}
+
+// SearchEnabled reports whether the full-text search index exists
+func SearchEnabled(db *sql.DB) bool {
+    var name string
+    err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'photos_fts'`).Scan(&name)
+    return err == nil
+}
+
+// schemaTables are the tables created by runMigrations
+var schemaTables = []string{
+    "photos", "photo_sharing", "photo_analytics", "photo_translations", "tags", "photo_tags",
+    "albums", "album_photos", "album_sharing", "share_links", "photo_renditions", "user_settings",
+    "vault_files", "file_sharing", "export_jobs", "photo_versions", "users", "user_roles", "audit_events",
+}
+
+// CheckMigrations reports an error if a table or an added column of the
+// current schema is missing, for example because the database was replaced
+// or restored from an old backup after startup
+func CheckMigrations(db *sql.DB) error {
+    rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table'`)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    tables := make(map[string]bool)
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            return err
+        }
+        tables[name] = true
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    var missing []string
+    for _, table := range schemaTables {
+        if !tables[table] {
+            missing = append(missing, table)
+        }
+    }
+    for _, m := range columnMigrations {
+        var count int
+        err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, m.table, m.column).Scan(&count)
+        if err != nil {
+            return err
+        }
+        if count == 0 {
+            missing = append(missing, m.table+"."+m.column)
+        }
+    }
+    if len(missing) > 0 {
+        return fmt.Errorf("schema is missing %s", strings.Join(missing, ", "))
+    }
+    return nil
+}
+
+// migrateLegacyTags moves comma-separated photos.tags values into the tags and
+// photo_tags tables. photos.tags is kept as a read-only cache of the tag names,
+// so only photos that have cached tags but no photo_tags rows are migrated.
+func migrateLegacyTags(db *sql.DB) error {
+    rows, err := db.Query(`
+        SELECT id, user_id, tags FROM photos
+        WHERE tags IS NOT NULL AND tags != ''
+          AND NOT EXISTS (SELECT 1 FROM photo_tags WHERE photo_tags.photo_id = photos.id)
+    `)
+    if err != nil {
+        return err
+    }
+
+    type legacyPhoto struct {
+        id, userID, tags string
+    }
+    var pending []legacyPhoto
+    for rows.Next() {
+        var p legacyPhoto
+        if err := rows.Scan(&p.id, &p.userID, &p.tags); err != nil {
+            rows.Close()
+            return err
+        }
+        pending = append(pending, p)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    for _, p := range pending {
+        tx, err := db.Begin()
+        if err != nil {
+            return err
+        }
+
+        for _, name := range strings.Split(p.tags, ",") {
+            name = utils.CleanTagName(name)
+            slug := utils.Slugify(name)
+            if slug == "" {
+                continue
+            }
+
+            if _, err := tx.Exec(`
+                INSERT OR IGNORE INTO tags (id, user_id, slug, name) VALUES (?, ?, ?, ?)
+            `, uuid.New().String(), p.userID, slug, name); err != nil {
+                tx.Rollback()
+                return err
+            }
+            if _, err := tx.Exec(`
+                INSERT OR IGNORE INTO photo_tags (photo_id, tag_id, source, created_by)
+                SELECT ?, id, 'user', ? FROM tags WHERE user_id = ? AND slug = ?
+            `, p.id, p.userID, p.userID, slug); err != nil {
+                tx.Rollback()
+                return err
+            }
+        }
+
+        if err := tx.Commit(); err != nil {
+            return err
+        }
+    }
+
     return nil
 }
 
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// openSearchTestDB initializes a database at path, skipping the test when
+// SQLite was built without FTS5
+func openSearchTestDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := Initialize(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if !SearchEnabled(db) {
+		t.Skip("SQLite was built without FTS5; run with -tags sqlite_fts5")
+	}
+	return db
+}
+
+func insertTestPhoto(t *testing.T, db *sql.DB, id, name, description string) {
+	t.Helper()
+	if _, err := db.Exec(`
+		INSERT INTO photos (id, user_id, filename, original_name, file_path, file_size, mime_type, hash, description)
+		VALUES (?, 'u1', ?, ?, ?, 1, 'image/png', 'hash', ?)
+	`, id, id+".png", name, "originals/u1/"+id+".png", description); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// searchPhotos returns the IDs of the photos matching an FTS5 query
+func searchPhotos(t *testing.T, db *sql.DB, match string) []string {
+	t.Helper()
+	rows, err := db.Query(`
+		SELECT p.id FROM photos_fts f JOIN photos p ON p.rowid = f.rowid
+		WHERE photos_fts MATCH ?
+	`, match)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func assertIndexed(t *testing.T, db *sql.DB) {
+	t.Helper()
+	var photos, indexed int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM photos`).Scan(&photos); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM photos_fts f JOIN photos p ON p.rowid = f.rowid`).Scan(&indexed); err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM photos_fts`).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if indexed != photos || rows != photos {
+		t.Errorf("%d photos, %d index rows of which %d match a photo", photos, rows, indexed)
+	}
+}
+
+func TestSearchIndexFollowsPhotos(t *testing.T) {
+	db := openSearchTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	insertTestPhoto(t, db, "a", "beach.jpg", "Sunset over the sea")
+	insertTestPhoto(t, db, "b", "forest.jpg", "Pine trees")
+	insertTestPhoto(t, db, "c", "city.jpg", "Sunset behind towers")
+
+	if got, want := searchPhotos(t, db, "sunset"), []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sunset = %q, want %q", got, want)
+	}
+
+	if _, err := db.Exec(`UPDATE photos SET description = 'Sunrise', camera_make = 'Canon' WHERE id = 'a'`); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := searchPhotos(t, db, "sunset"), []string{"c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sunset after update = %q, want %q", got, want)
+	}
+	if got, want := searchPhotos(t, db, "camera:canon"), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("camera:canon = %q, want %q", got, want)
+	}
+
+	if _, err := db.Exec(`DELETE FROM photos WHERE id = 'c'`); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchPhotos(t, db, "sunset"); len(got) != 0 {
+		t.Errorf("sunset after delete = %q, want none", got)
+	}
+	assertIndexed(t, db)
+}
+
+func TestSearchIndexRebuildsLegacyLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openSearchTestDB(t, path)
+	insertTestPhoto(t, db, "a", "beach.jpg", "Sunset over the sea")
+
+	// The first index, keyed by an unindexed photo_id, with its triggers
+	for _, stmt := range append(append([]string{}, legacySearchMigrations...),
+		`CREATE VIRTUAL TABLE photos_fts USING fts5(photo_id UNINDEXED, original_name, description, ai_description, tags, camera, location)`,
+		`CREATE TRIGGER photos_fts_delete AFTER DELETE ON photos BEGIN
+			DELETE FROM photos_fts WHERE photo_id = old.id;
+		END`,
+		`INSERT INTO photos_fts (photo_id, original_name, description) VALUES ('x', 'stale.jpg', 'Sunset'), ('a', 'beach.jpg', 'Sunset over the sea')`,
+	) {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	db = openSearchTestDB(t, path)
+	var legacy int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('photos_fts') WHERE name = 'photo_id'`).Scan(&legacy); err != nil {
+		t.Fatal(err)
+	}
+	if legacy != 0 {
+		t.Error("photos_fts still has a photo_id column")
+	}
+	if got, want := searchPhotos(t, db, "sunset"), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sunset = %q, want %q", got, want)
+	}
+	insertTestPhoto(t, db, "b", "city.jpg", "Sunset behind towers")
+	if _, err := db.Exec(`DELETE FROM photos WHERE id = 'a'`); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := searchPhotos(t, db, "sunset"), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sunset after changes = %q, want %q", got, want)
+	}
+	assertIndexed(t, db)
+}
@@ -0,0 +1,275 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func encrypt(t *testing.T, plain, dataKey []byte) []byte {
+	t.Helper()
+	r, err := NewEncryptReader(bytes.NewReader(plain), dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed
+}
+
+// openSealed stores sealed and opens it for decryption under dataKey
+func openSealed(t *testing.T, sealed, dataKey []byte) (*Object, error) {
+	t.Helper()
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := store.Put(ctx, "file", bytes.NewReader(sealed)); err != nil {
+		t.Fatal(err)
+	}
+	src, err := store.Open(ctx, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := OpenObject(src, dataKey)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	t.Cleanup(func() { o.Close() })
+	return o, nil
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	dataKey := testKey(7)
+	sizes := map[string]int{
+		"empty":            0,
+		"small":            100,
+		"one chunk":        ChunkSize,
+		"chunk and a byte": ChunkSize + 1,
+		"several chunks":   3*ChunkSize + 12345,
+		"whole chunks":     2 * ChunkSize,
+	}
+	for name, size := range sizes {
+		t.Run(name, func(t *testing.T) {
+			plain := randomBytes(t, size)
+			sealed := encrypt(t, plain, dataKey)
+
+			if got, err := PlaintextSize(int64(len(sealed))); err != nil || got != int64(size) {
+				t.Errorf("PlaintextSize(%d) = %d, %v, want %d", len(sealed), got, err, size)
+			}
+			if size > 0 && bytes.Contains(sealed, plain[:min(size, 64)]) {
+				t.Error("ciphertext contains the plaintext")
+			}
+
+			o, err := openSealed(t, sealed, dataKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.Info().Size != int64(size) {
+				t.Errorf("Info().Size = %d, want %d", o.Info().Size, size)
+			}
+			got, err := io.ReadAll(o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("decrypted %d bytes that differ from the %d encrypted", len(got), size)
+			}
+		})
+	}
+}
+
+func TestObjectSeek(t *testing.T) {
+	dataKey := testKey(7)
+	plain := randomBytes(t, 3*ChunkSize+500)
+	o, err := openSealed(t, encrypt(t, plain, dataKey), dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		whence int
+		start  int64
+		length int
+	}{
+		{"start", 0, io.SeekStart, 0, 10},
+		{"within a chunk", 1000, io.SeekStart, 1000, 2000},
+		{"across chunks", ChunkSize - 10, io.SeekStart, ChunkSize - 10, 20},
+		{"spanning a chunk", ChunkSize - 1, io.SeekStart, ChunkSize - 1, ChunkSize + 2},
+		{"from the end", -100, io.SeekEnd, int64(len(plain)) - 100, 100},
+		{"back to the first chunk", 5, io.SeekStart, 5, 5},
+	}
+	for _, tt := range tests {
+		pos, err := o.Seek(tt.offset, tt.whence)
+		if err != nil || pos != tt.start {
+			t.Fatalf("%s: Seek = %d, %v, want %d", tt.name, pos, err, tt.start)
+		}
+		got := make([]byte, tt.length)
+		if _, err := io.ReadFull(o, got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if want := plain[tt.start : tt.start+int64(tt.length)]; !bytes.Equal(got, want) {
+			t.Errorf("%s: read the wrong bytes", tt.name)
+		}
+	}
+
+	if _, err := o.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := o.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read at the end = %d, %v, want io.EOF", n, err)
+	}
+	if _, err := o.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seeking before the start succeeded")
+	}
+}
+
+func TestObjectRejectsTampering(t *testing.T) {
+	dataKey := testKey(7)
+	plain := randomBytes(t, 2*ChunkSize+100)
+	sealed := encrypt(t, plain, dataKey)
+	chunk := ChunkSize + tagSize
+
+	tests := []struct {
+		name   string
+		tamper func([]byte) []byte
+	}{
+		{"flipped header", func(b []byte) []byte { b[5] ^= 1; return b }},
+		{"flipped last chunk", func(b []byte) []byte { b[len(b)-1] ^= 1; return b }},
+		{"truncated to whole chunks", func(b []byte) []byte { return b[:headerSize+2*chunk] }},
+		{"truncated mid-chunk", func(b []byte) []byte { return b[:len(b)-50] }},
+		{"trailing chunk dropped", func(b []byte) []byte { return b[:headerSize+chunk] }},
+		{"chunks swapped", func(b []byte) []byte {
+			first := append([]byte(nil), b[headerSize:headerSize+chunk]...)
+			copy(b[headerSize:], b[headerSize+chunk:headerSize+2*chunk])
+			copy(b[headerSize+chunk:], first)
+			return b
+		}},
+		{"header only", func(b []byte) []byte { return b[:headerSize] }},
+		{"empty", func(b []byte) []byte { return b[:0] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := tt.tamper(append([]byte(nil), sealed...))
+			o, err := openSealed(t, tampered, dataKey)
+			if err == nil {
+				_, err = io.ReadAll(o)
+			}
+			if !errors.Is(err, ErrCorrupt) {
+				t.Errorf("error = %v, want ErrCorrupt", err)
+			}
+		})
+	}
+
+	// A flipped bit in an early chunk is only noticed when that chunk is read
+	t.Run("flipped first chunk", func(t *testing.T) {
+		tampered := append([]byte(nil), sealed...)
+		tampered[headerSize+10] ^= 1
+		o, err := openSealed(t, tampered, dataKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(o); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("error = %v, want ErrCorrupt", err)
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		if _, err := openSealed(t, sealed, testKey(8)); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("error = %v, want ErrCorrupt", err)
+		}
+	})
+}
+
+func TestStaticKeyProviderWrapsKeys(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewStaticKeyProvider(map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataKey, wrapped, keyID, err := NewDataKey(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != "k1" || len(dataKey) != KeySize {
+		t.Fatalf("NewDataKey = %d byte key wrapped with %q, want %d bytes with k1", len(dataKey), keyID, KeySize)
+	}
+	if bytes.Contains(wrapped, dataKey) {
+		t.Error("wrapped key contains the data key")
+	}
+	got, err := p.UnwrapKey(ctx, "k1", wrapped)
+	if err != nil || !bytes.Equal(got, dataKey) {
+		t.Errorf("UnwrapKey = %x, %v, want %x", got, err, dataKey)
+	}
+
+	// The key ID is authenticated, so a wrapped key can't be relabelled
+	if _, err := p.UnwrapKey(ctx, "k2", wrapped); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("unwrap with another key: error = %v, want ErrCorrupt", err)
+	}
+	if _, err := p.UnwrapKey(ctx, "k3", wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unwrap with an unknown key: error = %v, want ErrUnknownKey", err)
+	}
+	tampered := append([]byte(nil), wrapped...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := p.UnwrapKey(ctx, "k1", tampered); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("unwrap tampered key: error = %v, want ErrCorrupt", err)
+	}
+	if _, err := p.UnwrapKey(ctx, "k1", wrapped[:4]); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("unwrap short key: error = %v, want ErrCorrupt", err)
+	}
+
+	// After rotation, keys wrapped with the retired master key still unwrap
+	rotated, err := NewStaticKeyProvider(map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rotated.UnwrapKey(ctx, "k1", wrapped); err != nil || !bytes.Equal(got, dataKey) {
+		t.Errorf("unwrap after rotation = %x, %v, want %x", got, err, dataKey)
+	}
+	if _, keyID, err := rotated.WrapKey(ctx, dataKey); err != nil || keyID != "k2" {
+		t.Errorf("WrapKey after rotation used %q, %v, want k2", keyID, err)
+	}
+}
+
+func TestNewStaticKeyProviderRejectsBadKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     map[string][]byte
+		activeID string
+	}{
+		{"short key", map[string][]byte{"k1": testKey(1)[:16]}, "k1"},
+		{"short retired key", map[string][]byte{"k1": testKey(1), "k0": []byte("secret")}, "k1"},
+		{"missing active key", map[string][]byte{"k1": testKey(1)}, "k2"},
+		{"no keys", nil, ""},
+	}
+	for _, tt := range tests {
+		if _, err := NewStaticKeyProvider(tt.keys, tt.activeID); err == nil {
+			t.Errorf("%s: NewStaticKeyProvider succeeded", tt.name)
+		}
+	}
+}
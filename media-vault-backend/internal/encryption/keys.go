@@ -0,0 +1,121 @@
+// Package encryption implements envelope encryption for stored files. Each
+// file is encrypted with its own random data key; data keys are stored
+// wrapped by a master key held by a KeyProvider.
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the size of master and data keys in bytes (AES-256)
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned when a wrapped key names a master key the
+	// provider doesn't have
+	ErrUnknownKey = errors.New("unknown master key")
+	// ErrCorrupt is returned when ciphertext or a wrapped key fails
+	// authentication
+	ErrCorrupt = errors.New("encrypted data is corrupt or was tampered with")
+)
+
+// KeyProvider wraps and unwraps data keys with master keys. It mirrors the
+// Encrypt/Decrypt operations of cloud KMS services, so a KMS-backed provider
+// can replace the static one without changing callers.
+type KeyProvider interface {
+	// ActiveKeyID names the master key used for new data keys
+	ActiveKeyID() string
+	// WrapKey encrypts a data key with the active master key
+	WrapKey(ctx context.Context, dataKey []byte) (wrapped []byte, keyID string, err error)
+	// UnwrapKey decrypts a data key wrapped with the named master key
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// NewDataKey generates a random data key and wraps it with the provider's
+// active master key
+func NewDataKey(ctx context.Context, p KeyProvider) (dataKey, wrapped []byte, keyID string, err error) {
+	dataKey = make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, "", err
+	}
+	wrapped, keyID, err = p.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return dataKey, wrapped, keyID, nil
+}
+
+// StaticKeyProvider holds master keys in memory, typically loaded from the
+// environment or a key file. Retired keys stay configured so that data keys
+// wrapped with them can still be unwrapped until they are rotated.
+type StaticKeyProvider struct {
+	keys     map[string]cipher.AEAD
+	activeID string
+}
+
+// NewStaticKeyProvider creates a StaticKeyProvider. Every key must be
+// KeySize bytes and activeID must name one of them.
+func NewStaticKeyProvider(keys map[string][]byte, activeID string) (*StaticKeyProvider, error) {
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("master key %q is not configured", activeID)
+	}
+
+	p := &StaticKeyProvider{keys: make(map[string]cipher.AEAD, len(keys)), activeID: activeID}
+	for id, key := range keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("master key %q must be %d bytes", id, KeySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		p.keys[id] = aead
+	}
+	return p, nil
+}
+
+// ActiveKeyID implements KeyProvider
+func (p *StaticKeyProvider) ActiveKeyID() string {
+	return p.activeID
+}
+
+// WrapKey implements KeyProvider. The wrapped key is the GCM nonce followed by
+// the sealed data key, bound to the master key ID.
+func (p *StaticKeyProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	aead := p.keys[p.activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(p.activeID)), p.activeID, nil
+}
+
+// UnwrapKey implements KeyProvider
+func (p *StaticKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(keyID))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return dataKey, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
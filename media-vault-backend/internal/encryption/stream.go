@@ -0,0 +1,241 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+// ChunkSize is the amount of plaintext sealed in each chunk
+const ChunkSize = 64 << 10
+
+// Encrypted files start with a header holding a magic number and the chunk
+// size, followed by the chunks. Each chunk is sealed with AES-GCM under a
+// nonce made of the chunk index and a flag marking the last chunk, so chunks
+// cannot be reordered and truncation is detected. The header is authenticated
+// as additional data with every chunk.
+const (
+	headerSize = 8
+	tagSize    = 16
+	magic      = "MVE1"
+)
+
+// NewEncryptReader returns a reader producing the encryption of src under
+// dataKey
+func NewEncryptReader(src io.Reader, dataKey []byte) (io.Reader, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[4:], ChunkSize)
+
+	return &encryptReader{
+		src:    bufio.NewReaderSize(src, ChunkSize),
+		aead:   aead,
+		header: header,
+		chunk:  make([]byte, ChunkSize),
+		out:    append([]byte(nil), header...),
+	}, nil
+}
+
+type encryptReader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	chunk  []byte
+	out    []byte // sealed bytes not yet returned
+	index  uint64
+	done   bool
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(r.src, r.chunk)
+		final := false
+		switch err {
+		case nil:
+			// A full chunk is the last one if nothing follows it
+			if _, err := r.src.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				return 0, err
+			}
+		case io.EOF, io.ErrUnexpectedEOF:
+			final = true
+		default:
+			return 0, err
+		}
+
+		r.out = r.aead.Seal(r.out[:0], chunkNonce(r.index, final), r.chunk[:n], r.header)
+		r.index++
+		r.done = final
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// PlaintextSize returns the size of the plaintext of an encrypted file of the
+// given size
+func PlaintextSize(encryptedSize int64) (int64, error) {
+	chunks, err := chunkCount(encryptedSize)
+	if err != nil {
+		return 0, err
+	}
+	return encryptedSize - headerSize - chunks*tagSize, nil
+}
+
+func chunkCount(encryptedSize int64) (int64, error) {
+	body := encryptedSize - headerSize
+	if body < tagSize {
+		return 0, ErrCorrupt
+	}
+	chunks := (body + ChunkSize + tagSize - 1) / (ChunkSize + tagSize)
+	if rest := body % (ChunkSize + tagSize); rest != 0 && rest < tagSize {
+		return 0, ErrCorrupt
+	}
+	return chunks, nil
+}
+
+// Object is a decrypting view of an encrypted storage object. Seeking only
+// decrypts the chunks that are read, so byte ranges are cheap.
+type Object struct {
+	src     storage.Object
+	aead    cipher.AEAD
+	header  []byte
+	chunks  int64
+	size    int64
+	pos     int64
+	current int64 // index of the chunk in plain, or -1
+	plain   []byte
+	sealed  []byte
+}
+
+// OpenObject returns a decrypting view of src. The last chunk is checked
+// immediately, so truncated files are rejected before any data is served.
+// Closing the returned object closes src.
+func OpenObject(src storage.Object, dataKey []byte) (*Object, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, ErrCorrupt
+	}
+	if !bytes.Equal(header[:4], []byte(magic)) || binary.BigEndian.Uint32(header[4:]) != ChunkSize {
+		return nil, ErrCorrupt
+	}
+
+	chunks, err := chunkCount(src.Info().Size)
+	if err != nil {
+		return nil, err
+	}
+	size, _ := PlaintextSize(src.Info().Size)
+
+	o := &Object{
+		src:     src,
+		aead:    aead,
+		header:  header,
+		chunks:  chunks,
+		size:    size,
+		current: -1,
+		sealed:  make([]byte, ChunkSize+tagSize),
+	}
+	if err := o.load(chunks - 1); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Info returns the object's info with the plaintext size
+func (o *Object) Info() storage.Info {
+	info := o.src.Info()
+	info.Size = o.size
+	return info
+}
+
+// Read implements io.Reader
+func (o *Object) Read(p []byte) (int, error) {
+	if o.pos >= o.size {
+		return 0, io.EOF
+	}
+
+	index := o.pos / ChunkSize
+	if index != o.current {
+		if err := o.load(index); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, o.plain[o.pos-index*ChunkSize:])
+	o.pos += int64(n)
+	return n, nil
+}
+
+// Seek implements io.Seeker over the plaintext
+func (o *Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.pos
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	o.pos = offset
+	return offset, nil
+}
+
+// Close closes the underlying object
+func (o *Object) Close() error {
+	return o.src.Close()
+}
+
+// load decrypts one chunk into o.plain
+func (o *Object) load(index int64) error {
+	start := headerSize + index*(ChunkSize+tagSize)
+	length := min(int64(ChunkSize+tagSize), o.src.Info().Size-start)
+	if _, err := o.src.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	sealed := o.sealed[:length]
+	if _, err := io.ReadFull(o.src, sealed); err != nil {
+		return err
+	}
+
+	plain, err := o.aead.Open(o.plain[:0], chunkNonce(uint64(index), index == o.chunks-1), sealed, o.header)
+	if err != nil {
+		o.current = -1
+		return ErrCorrupt
+	}
+	o.plain, o.current = plain, index
+	return nil
+}
+
+func chunkNonce(index uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, index)
+	if final {
+		nonce[8] = 1
+	}
+	return nonce
+}
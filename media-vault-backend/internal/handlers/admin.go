@@ -1,61 +1,469 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/services"
 )
 
 // AdminHandler handles admin-related HTTP requests
 type AdminHandler struct {
-	// Add any dependencies here
+	vaultService    *services.VaultService
+	directory       services.UserDirectory
+	userDataService *services.UserDataService
+	statsService    *services.StatsService
+	healthService   *services.HealthService
+	auditService    *services.AuditService
 }
 
 // NewAdminHandler creates a new AdminHandler
-func NewAdminHandler() *AdminHandler {
-	return &AdminHandler{}
+func NewAdminHandler(vaultService *services.VaultService, directory services.UserDirectory, userDataService *services.UserDataService, statsService *services.StatsService, healthService *services.HealthService, auditService *services.AuditService) *AdminHandler {
+	return &AdminHandler{
+		vaultService:    vaultService,
+		directory:       directory,
+		userDataService: userDataService,
+		statsService:    statsService,
+		healthService:   healthService,
+		auditService:    auditService,
+	}
 }
 
-// ListUsers returns a list of all users
+// ListUsers returns a page of users
+// @Summary List users
+// @Tags admin
+// @Produce json
+// @Param search query string false "Match the username, email or full name"
+// @Param enabled query bool false "Only enabled or disabled users"
+// @Param role query string false "Only users with this role"
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Success 200 {object} services.UserPage
+// @Failure 400 {object} problem.Problem
+// @Router /admin/users [get]
 func (h *AdminHandler) ListUsers(c *fiber.Ctx) error {
-	// TODO: Implement user listing
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"error": "List users endpoint not implemented",
-	})
+	query := services.UserQuery{
+		Search: c.Query("search"),
+		Role:   c.Query("role"),
+		Page:   c.QueryInt("page", 1),
+		Limit:  c.QueryInt("limit", services.DefaultPageSize),
+	}
+	if v := c.Query("enabled"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return invalidRequest("Invalid enabled filter: " + v)
+		}
+		query.Enabled = &enabled
+	}
+
+	page, err := h.directory.ListUsers(c.UserContext(), query)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
 }
 
 // GetUser returns a specific user by ID
+// @Summary Get a user
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.User
+// @Failure 404 {object} problem.Problem
+// @Router /admin/users/{id} [get]
 func (h *AdminHandler) GetUser(c *fiber.Ctx) error {
-	// TODO: Implement get user by ID
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"error": "Get user endpoint not implemented",
-	})
+	user, err := h.directory.GetUser(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(user)
 }
 
 // CreateUser creates a new user
+// @Summary Create a user
+// @Description Users created without a password can sign in once one is set with reset-password
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param user body models.CreateUserRequest true "User"
+// @Success 201 {object} models.User
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /admin/users [post]
 func (h *AdminHandler) CreateUser(c *fiber.Ctx) error {
-	// TODO: Implement user creation
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"error": "Create user endpoint not implemented",
-	})
+	var request models.CreateUserRequest
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	user, err := h.directory.CreateUser(c.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditUserCreate,
+		TargetType: "user",
+		TargetID:   user.ID,
+	}, nil, user)
+
+	return c.Status(fiber.StatusCreated).JSON(user)
 }
 
 // UpdateUser updates an existing user
+// @Summary Update a user
+// @Description Change the username, email, full name or enabled state; omitted fields are kept
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param user body models.UserUpdate true "Changes"
+// @Success 200 {object} models.User
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /admin/users/{id} [put]
 func (h *AdminHandler) UpdateUser(c *fiber.Ctx) error {
-	// TODO: Implement user update
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"error": "Update user endpoint not implemented",
-	})
+	var update models.UserUpdate
+	if err := c.BodyParser(&update); err != nil {
+		return invalidBody(err)
+	}
+
+	user, err := h.updateUser(c, services.AuditUserUpdate, update)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(user)
+}
+
+// EnableUser allows a user to sign in again
+// @Summary Enable a user
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.User
+// @Failure 404 {object} problem.Problem
+// @Router /admin/users/{id}/enable [post]
+func (h *AdminHandler) EnableUser(c *fiber.Ctx) error {
+	return h.setEnabled(c, true)
+}
+
+// DisableUser stops a user from signing in, keeping their content
+// @Summary Disable a user
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.User
+// @Failure 404 {object} problem.Problem
+// @Router /admin/users/{id}/disable [post]
+func (h *AdminHandler) DisableUser(c *fiber.Ctx) error {
+	return h.setEnabled(c, false)
+}
+
+func (h *AdminHandler) setEnabled(c *fiber.Ctx, enabled bool) error {
+	action := services.AuditUserDisable
+	if enabled {
+		action = services.AuditUserEnable
+	}
+
+	user, err := h.updateUser(c, action, models.UserUpdate{Enabled: &enabled})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(user)
+}
+
+// updateUser applies update to the user in the path and audits the change
+func (h *AdminHandler) updateUser(c *fiber.Ctx, action string, update models.UserUpdate) (*models.User, error) {
+	userID := c.Params("id")
+
+	before, err := h.directory.GetUser(c.UserContext(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.directory.UpdateUser(c.UserContext(), userID, update)
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   userID,
+	}, before, user)
+
+	return user, nil
+}
+
+// SetUserRoles replaces a user's roles
+// @Summary Set a user's roles
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/users/{id}/roles [put]
+func (h *AdminHandler) SetUserRoles(c *fiber.Ctx) error {
+	userID := c.Params("id")
+
+	var request struct {
+		Roles []string `json:"roles"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	before, err := h.directory.GetUser(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+
+	if err := h.directory.SetRoles(c.UserContext(), userID, request.Roles); err != nil {
+		return err
+	}
+
+	user, err := h.directory.GetUser(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditUserRoles,
+		TargetType: "user",
+		TargetID:   userID,
+	}, fiber.Map{"roles": before.Roles}, fiber.Map{"roles": user.Roles})
+
+	return c.JSON(user)
+}
+
+// ResetUserPassword sets a new password for a user
+// @Summary Reset a user's password
+// @Description A temporary password must be changed at the next sign-in
+// @Tags admin
+// @Accept json
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/users/{id}/reset-password [post]
+func (h *AdminHandler) ResetUserPassword(c *fiber.Ctx) error {
+	userID := c.Params("id")
+
+	var request struct {
+		Password  string `json:"password"`
+		Temporary bool   `json:"temporary"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := h.directory.ResetPassword(c.UserContext(), userID, request.Password, request.Temporary); err != nil {
+		return err
+	}
+
+	// The password itself is never logged
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditUserPasswordReset,
+		TargetType: "user",
+		TargetID:   userID,
+	}, nil, fiber.Map{"temporary": request.Temporary})
+
+	return c.SendStatus(fiber.StatusNoContent)
 }
 
 // DeleteUser deletes a user
+// @Summary Delete a user
+// @Description Users who own photos, albums, files or tags can only be deleted with data=transfer, which gives their content to the user given by to, or data=purge, which deletes it permanently
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Param data query string false "transfer or purge"
+// @Param to query string false "User ID to transfer the content to"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /admin/users/{id} [delete]
 func (h *AdminHandler) DeleteUser(c *fiber.Ctx) error {
-	// TODO: Implement user deletion
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"error": "Delete user endpoint not implemented",
-	})
+	userID := c.Params("id")
+	mode := c.Query("data")
+	to := c.Query("to")
+
+	switch mode {
+	case "", "purge":
+	case "transfer":
+		if to == "" {
+			return invalidRequest("Transferring requires the ID of the user to transfer to")
+		}
+		if _, err := h.directory.GetUser(c.UserContext(), to); err != nil {
+			return transferError(err)
+		}
+	default:
+		return invalidRequest("Invalid data option: " + mode + ", use transfer or purge")
+	}
+
+	// Content can outlive its owner in the directory, for example when the
+	// account was removed in the Keycloak console, so it is handled even when
+	// the user is gone
+	user, err := h.directory.GetUser(c.UserContext(), userID)
+	if err != nil && !errors.Is(err, services.ErrUserNotFound) {
+		return err
+	}
+
+	content, err := h.userDataService.CountContent(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+	if user == nil && content.Empty() {
+		return services.ErrUserNotFound
+	}
+	if mode == "" && !content.Empty() {
+		return services.ErrUserHasContent.
+			WithMessage("The user owns content; delete with data=transfer&to=<user ID> or data=purge").
+			WithExtra("content", content)
+	}
+
+	switch mode {
+	case "transfer":
+		content, err = h.userDataService.Transfer(c.UserContext(), userID, to)
+	case "purge":
+		content, err = h.userDataService.Purge(c.UserContext(), userID)
+	}
+	if err != nil {
+		return transferError(err)
+	}
+
+	if user != nil {
+		if err := h.directory.DeleteUser(c.UserContext(), userID); err != nil && !errors.Is(err, services.ErrUserNotFound) {
+			return err
+		}
+	}
+
+	after := fiber.Map{"data": mode, "content": content}
+	if mode == "transfer" {
+		after["transferred_to"] = to
+	}
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditUserDelete,
+		TargetType: "user",
+		TargetID:   userID,
+	}, user, after)
+
+	response := fiber.Map{
+		"message": "User deleted",
+		"content": content,
+	}
+	if mode != "" {
+		response["data"] = mode
+	}
+	return c.JSON(response)
+}
+
+// GetUserUsage returns a user's storage usage and quota
+// @Summary Get a user's storage usage
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} services.StorageUsage
+// @Router /admin/users/{id}/usage [get]
+func (h *AdminHandler) GetUserUsage(c *fiber.Ctx) error {
+	usage, err := h.vaultService.GetUsage(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(usage)
+}
+
+// SetUserQuota sets a user's storage quota
+// @Summary Set a user's storage quota
+// @Description Set the quota in bytes; 0 means unlimited and null restores the default
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} services.StorageUsage
+// @Failure 400 {object} problem.Problem
+// @Router /admin/users/{id}/quota [put]
+func (h *AdminHandler) SetUserQuota(c *fiber.Ctx) error {
+	userID := c.Params("id")
+
+	var request struct {
+		StorageQuota *int64 `json:"storage_quota"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	before, err := h.vaultService.GetUsage(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+
+	if err := h.vaultService.SetQuota(c.UserContext(), userID, request.StorageQuota); err != nil {
+		return err
+	}
+
+	usage, err := h.vaultService.GetUsage(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditUserQuota,
+		TargetType: "user",
+		TargetID:   userID,
+	},
+		fiber.Map{"quota_bytes": before.QuotaBytes, "quota_is_default": before.QuotaIsDefault},
+		fiber.Map{"quota_bytes": usage.QuotaBytes, "quota_is_default": usage.QuotaIsDefault},
+	)
+
+	return c.JSON(usage)
 }
 
 // GetSystemStats returns system statistics
+// @Summary Get system statistics
+// @Description Users, photos, files, bytes stored, moderation states, job queues and daily growth
+// @Tags admin
+// @Produce json
+// @Param days query int false "Days of growth to return (default 30, max 365)"
+// @Success 200 {object} services.SystemStats
+// @Router /admin/system/stats [get]
 func (h *AdminHandler) GetSystemStats(c *fiber.Ctx) error {
-	// TODO: Implement system stats retrieval
-	return c.JSON(fiber.Map{"status": "ok"})
-}
\ No newline at end of file
+	stats, err := h.statsService.SystemStats(c.UserContext(), c.QueryInt("days", services.DefaultStatsDays))
+	if err != nil {
+		return err
+	}
+	return c.JSON(stats)
+}
+
+// GetSystemHealth checks every dependency of the service
+// @Summary Get system health
+// @Description Check the database and its schema, storage reads and writes, disk headroom and the analysis services
+// @Tags admin
+// @Produce json
+// @Success 200 {object} services.HealthReport
+// @Failure 503 {object} services.HealthReport
+// @Router /admin/system/health [get]
+func (h *AdminHandler) GetSystemHealth(c *fiber.Ctx) error {
+	report := h.healthService.Check(c.UserContext())
+	return c.Status(healthStatus(report)).JSON(report)
+}
+
+// transferError reports a missing recipient of a content transfer as an
+// invalid request rather than the user in the path not being found
+func transferError(err error) error {
+	if errors.Is(err, services.ErrUserNotFound) {
+		return fmt.Errorf("%w: the user to transfer to does not exist", services.ErrInvalidTransfer)
+	}
+	return err
+}
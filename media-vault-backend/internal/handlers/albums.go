@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// AlbumHandler handles album-related HTTP requests
+type AlbumHandler struct {
+	albumService   *services.AlbumService
+	photoService   *services.PhotoService
+	sharingService *services.SharingService
+	auditService   *services.AuditService
+}
+
+// NewAlbumHandler creates a new AlbumHandler
+func NewAlbumHandler(albumService *services.AlbumService, photoService *services.PhotoService, sharingService *services.SharingService, auditService *services.AuditService) *AlbumHandler {
+	return &AlbumHandler{
+		albumService:   albumService,
+		photoService:   photoService,
+		sharingService: sharingService,
+		auditService:   auditService,
+	}
+}
+
+// ListAlbums returns the user's albums
+// @Summary List albums
+// @Description List the user's top-level albums, or the sub-albums of parent_id
+// @Tags albums
+// @Produce json
+// @Param parent_id query string false "Parent album ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /albums [get]
+func (h *AlbumHandler) ListAlbums(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	albums, err := h.albumService.ListAlbums(c.UserContext(), userID, c.Query("parent_id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  albums,
+		"total": len(albums),
+	})
+}
+
+// ListSharedAlbums returns albums shared with the user
+// @Summary List albums shared with me
+// @Tags albums
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /albums/shared [get]
+func (h *AlbumHandler) ListSharedAlbums(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	albums, err := h.albumService.ListSharedAlbums(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  albums,
+		"total": len(albums),
+	})
+}
+
+// CreateAlbum creates an album
+// @Summary Create an album
+// @Description Create an album; a request with a query creates a smart album whose photos are selected by the saved filter
+// @Tags albums
+// @Accept json
+// @Produce json
+// @Param request body models.AlbumRequest true "Album"
+// @Success 201 {object} models.Album
+// @Failure 400 {object} problem.Problem
+// @Router /albums [post]
+func (h *AlbumHandler) CreateAlbum(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var request models.AlbumRequest
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	album, err := h.albumService.CreateAlbum(c.UserContext(), userID, request)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditAlbumCreate,
+		TargetType: "album",
+		TargetID:   album.ID,
+	}, nil, album)
+
+	return c.Status(fiber.StatusCreated).JSON(album)
+}
+
+// GetAlbum returns an album with its sub-albums
+// @Summary Get an album
+// @Tags albums
+// @Produce json
+// @Param id path string true "Album ID"
+// @Success 200 {object} models.Album
+// @Router /albums/{id} [get]
+func (h *AlbumHandler) GetAlbum(c *fiber.Ctx) error {
+	album, err := h.loadAlbum(c, false)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(album)
+}
+
+// UpdateAlbum updates an album's details
+// @Summary Update an album
+// @Tags albums
+// @Accept json
+// @Produce json
+// @Param id path string true "Album ID"
+// @Param request body models.AlbumRequest true "Fields to change"
+// @Success 200 {object} models.Album
+// @Router /albums/{id} [put]
+func (h *AlbumHandler) UpdateAlbum(c *fiber.Ctx) error {
+	album, err := h.loadAlbum(c, true)
+	if err != nil {
+		return err
+	}
+
+	var request models.AlbumRequest
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	before := album
+	album, err = h.albumService.UpdateAlbum(c.UserContext(), album.ID, request)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditAlbumUpdate,
+		TargetType: "album",
+		TargetID:   album.ID,
+	}, before, album)
+
+	return c.JSON(album)
+}
+
+// DeleteAlbum deletes an album and its sub-albums; photos are kept
+// @Summary Delete an album
+// @Tags albums
+// @Param id path string true "Album ID"
+// @Success 204
+// @Router /albums/{id} [delete]
+func (h *AlbumHandler) DeleteAlbum(c *fiber.Ctx) error {
+	album, err := h.loadAlbum(c, true)
+	if err != nil {
+		return err
+	}
+
+	if err := h.albumService.DeleteAlbum(c.UserContext(), album.ID); err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditAlbumDelete,
+		TargetType: "album",
+		TargetID:   album.ID,
+	}, album, nil)
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// GetAlbumPhotos returns a page of an album's photos
+// @Summary List album photos
+// @Tags albums
+// @Produce json
+// @Param id path string true "Album ID"
+// @Param page query int false "Page"
+// @Param limit query int false "Page size"
+// @Success 200 {object} map[string]interface{}
+// @Router /albums/{id}/photos [get]
+func (h *AlbumHandler) GetAlbumPhotos(c *fiber.Ctx) error {
+	album, err := h.loadAlbum(c, false)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.albumService.AlbumPhotos(c.UserContext(), album, c.QueryInt("page", 1), c.QueryInt("limit", services.DefaultPageSize))
+	if err != nil {
+		return err
+	}
+
+	if err := h.photoService.LocalizePhotos(c.UserContext(), page.Photos, preferredLanguages(c)); err != nil {
+		return err
+	}
+	c.Vary(fiber.HeaderAcceptLanguage)
+
+	return c.JSON(photoPageResponse(page))
+}
+
+// AddAlbumPhotos adds photos to an album
+// @Summary Add photos to an album
+// @Tags albums
+// @Accept json
+// @Produce json
+// @Param id path string true "Album ID"
+// @Param request body models.AlbumPhotosRequest true "Photos to add"
+// @Success 200 {object} map[string]interface{}
+// @Router /albums/{id}/photos [post]
+func (h *AlbumHandler) AddAlbumPhotos(c *fiber.Ctx) error {
+	album, request, err := h.albumPhotosRequest(c)
+	if err != nil {
+		return err
+	}
+
+	userID := c.Locals("userID").(string)
+	added, skipped, err := h.albumService.AddPhotos(c.UserContext(), album, request.PhotoIDs, request.Position, userID)
+	if err != nil {
+		return err
+	}
+
+	if len(added) > 0 {
+		recordAudit(c, h.auditService, &services.AuditEvent{
+			Action:     services.AuditAlbumUpdate,
+			TargetType: "album",
+			TargetID:   album.ID,
+		}, nil, fiber.Map{"added_photo_ids": added})
+	}
+
+	var addErrors []string
+	for _, photoID := range skipped {
+		addErrors = append(addErrors, fmt.Sprintf("Photo '%s' not found or not owned by you", photoID))
+	}
+
+	return c.JSON(fiber.Map{
+		"added":       len(added),
+		"photo_ids":   added,
+		"error_count": len(addErrors),
+		"errors":      addErrors,
+	})
+}
+
+// RemoveAlbumPhotos removes photos from an album
+// @Summary Remove photos from an album
+// @Tags albums
+// @Accept json
+// @Produce json
+// @Param id path string true "Album ID"
+// @Param request body models.AlbumPhotosRequest true "Photos to remove"
+// @Success 200 {object} map[string]interface{}
+// @Router /albums/{id}/photos [delete]
+func (h *AlbumHandler) RemoveAlbumPhotos(c *fiber.Ctx) error {
+	album, request, err := h.albumPhotosRequest(c)
+	if err != nil {
+		return err
+	}
+
+	removed, err := h.albumService.RemovePhotos(c.UserContext(), album, request.PhotoIDs)
+	if err != nil {
+		return err
+	}
+
+	if removed > 0 {
+		recordAudit(c, h.auditService, &services.AuditEvent{
+			Action:     services.AuditAlbumUpdate,
+			TargetType: "album",
+			TargetID:   album.ID,
+		}, fiber.Map{"removed_photo_ids": request.PhotoIDs}, nil)
+	}
+
+	return c.JSON(fiber.Map{
+		"removed": removed,
+	})
+}
+
+// ReorderAlbumPhotos changes the order of an album's photos
+// @Summary Reorder album photos
+// @Description Move the listed photos to the front of the album in the given order
+// @Tags albums
+// @Accept json
+// @Param id path string true "Album ID"
+// @Param request body models.AlbumPhotosRequest true "Photos in their new order"
+// @Success 204
+// @Router /albums/{id}/photos/order [put]
+func (h *AlbumHandler) ReorderAlbumPhotos(c *fiber.Ctx) error {
+	album, request, err := h.albumPhotosRequest(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.albumService.ReorderPhotos(c.UserContext(), album, request.PhotoIDs); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// ListAlbumShares lists who an album is shared with
+// @Summary List album shares
+// @Tags albums
+// @Produce json
+// @Param id path string true "Album ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /albums/{id}/shares [get]
+func (h *AlbumHandler) ListAlbumShares(c *fiber.Ctx) error {
+	album, err := h.loadAlbum(c, true)
+	if err != nil {
+		return err
+	}
+
+	shares, err := h.sharingService.ListSharesForAlbum(c.UserContext(), album.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  shares,
+		"total": len(shares),
+	})
+}
+
+// ShareAlbum shares an album, its photos and its sub-albums with another user
+// @Summary Share an album
+// @Tags albums
+// @Accept json
+// @Produce json
+// @Param id path string true "Album ID"
+// @Success 201 {object} services.Share
+// @Router /albums/{id}/shares [post]
+func (h *AlbumHandler) ShareAlbum(c *fiber.Ctx) error {
+	album, err := h.loadAlbum(c, true)
+	if err != nil {
+		return err
+	}
+
+	var request struct {
+		SharedWith string     `json:"shared_with"`
+		Permission string     `json:"permission"`
+		ExpiresAt  *time.Time `json:"expires_at"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	userID := c.Locals("userID").(string)
+	if request.SharedWith == userID {
+		return invalidRequest("You cannot share an album with yourself")
+	}
+
+	share := &services.Share{
+		AlbumID:    album.ID,
+		SharedBy:   userID,
+		SharedWith: request.SharedWith,
+		Permission: request.Permission,
+		ExpiresAt:  request.ExpiresAt,
+	}
+	if err := h.sharingService.ShareAlbum(c.UserContext(), share); err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditAlbumShare,
+		TargetType: "album",
+		TargetID:   album.ID,
+	}, nil, share)
+
+	return c.Status(fiber.StatusCreated).JSON(share)
+}
+
+// RevokeAlbumShare removes a share from an album
+// @Summary Revoke an album share
+// @Tags albums
+// @Param id path string true "Album ID"
+// @Param shareId path string true "Share ID"
+// @Success 204
+// @Router /albums/{id}/shares/{shareId} [delete]
+func (h *AlbumHandler) RevokeAlbumShare(c *fiber.Ctx) error {
+	album, err := h.loadAlbum(c, true)
+	if err != nil {
+		return err
+	}
+
+	if err := h.sharingService.RevokeAlbumShare(c.UserContext(), album.ID, c.Params("shareId")); err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditAlbumUnshare,
+		TargetType: "album",
+		TargetID:   album.ID,
+	}, fiber.Map{"share_id": c.Params("shareId")}, nil)
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// loadAlbum loads the album named in the path and checks that the caller owns
+// it or, unless ownerOnly is set, that it has been shared with them
+func (h *AlbumHandler) loadAlbum(c *fiber.Ctx, ownerOnly bool) (*models.Album, error) {
+	album, err := h.albumService.GetAlbum(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	userID := c.Locals("userID").(string)
+	if album.UserID == userID {
+		return album, nil
+	}
+	if ownerOnly {
+		return nil, permissionDenied("You don't have permission to modify this album")
+	}
+
+	allowed, err := h.sharingService.HasAlbumPermission(c.UserContext(), album.ID, userID, services.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, permissionDenied("You don't have permission to view this album")
+	}
+
+	return album, nil
+}
+
+// albumPhotosRequest loads an owned album and parses a photo list body
+func (h *AlbumHandler) albumPhotosRequest(c *fiber.Ctx) (*models.Album, *models.AlbumPhotosRequest, error) {
+	album, err := h.loadAlbum(c, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var request models.AlbumPhotosRequest
+	if err := c.BodyParser(&request); err != nil {
+		return nil, nil, invalidBody(err)
+	}
+	if len(request.PhotoIDs) == 0 {
+		return nil, nil, invalidField("photo_ids", "is required")
+	}
+
+	return album, &request, nil
+}
@@ -12,8 +12,8 @@ import (
 // @Produce json
 // @Param credentials body LoginRequest true "Login credentials"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
 // @Router /auth/login [post]
 func Login(c *fiber.Ctx) error {
 	// TODO: Implement actual login logic
@@ -30,8 +30,8 @@ func Login(c *fiber.Ctx) error {
 // @Produce json
 // @Param user body RegisterRequest true "User registration data"
 // @Success 201 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 409 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
 // @Router /auth/register [post]
 func Register(c *fiber.Ctx) error {
 	// TODO: Implement actual registration logic
@@ -48,8 +48,8 @@ func Register(c *fiber.Ctx) error {
 // @Produce json
 // @Param refreshToken body RefreshTokenRequest true "Refresh token"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
 // @Router /auth/refresh [post]
 func RefreshToken(c *fiber.Ctx) error {
 	// TODO: Implement actual token refresh logic
@@ -64,7 +64,7 @@ func RefreshToken(c *fiber.Ctx) error {
 // @Tags auth
 // @Security BearerAuth
 // @Success 200 {object} map[string]string
-// @Failure 401 {object} map[string]string
+// @Failure 401 {object} problem.Problem
 // @Router /auth/logout [post]
 func Logout(c *fiber.Ctx) error {
 	// TODO: Implement actual logout logic
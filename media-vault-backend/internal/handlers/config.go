@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/config"
+)
+
+// ConfigHandler shows admins the configuration the service runs with
+type ConfigHandler struct {
+	config *config.Config
+}
+
+// NewConfigHandler creates a new ConfigHandler
+func NewConfigHandler(config *config.Config) *ConfigHandler {
+	return &ConfigHandler{config: config}
+}
+
+// GetConfig returns every setting, where it came from, and whether secrets are
+// set, without their values
+// @Summary Get the configuration
+// @Description Settings with their values and sources (default, file, env or flag); secrets are redacted
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/system/config [get]
+func (h *ConfigHandler) GetConfig(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"environment": h.config.Env,
+		"settings":    h.config.Dump(),
+	})
+}
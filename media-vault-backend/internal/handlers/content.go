@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+// content describes a stored file served over HTTP
+type content struct {
+	Object      storage.Object
+	Name        string // file name for Content-Disposition
+	ContentType string
+	ETag        string // strong validator, without quotes; usually the SHA-256 of the file
+	Attachment  bool   // forced for anything but images
+	// Count, if set, is called before a response from the first byte of the
+	// file is sent, e.g. to count an access against a limit. If it fails, its
+	// error is returned instead.
+	Count func() error
+}
+
+// sendContent streams a stored file with support for conditional requests
+// (If-None-Match, If-Modified-Since) and single byte ranges (Range, If-Range).
+// Only images are shown inline: other content, such as HTML, would run on the
+// API's origin, so it is sent as an opaque attachment. It reports whether the
+// response starts at the first byte of the file, so callers can count a
+// download once even when clients resume it. The object is always closed.
+func sendContent(c *fiber.Ctx, f content) (bool, error) {
+	info := f.Object.Info()
+	size := info.Size
+	modTime := info.ModTime.UTC().Truncate(time.Second)
+	etag := ""
+	if f.ETag != "" {
+		etag = `"` + f.ETag + `"`
+	}
+
+	if !f.Attachment && !inlineImage(f.ContentType) {
+		f.Attachment, f.ContentType = true, "application/octet-stream"
+	}
+	disposition := "inline"
+	if f.Attachment {
+		disposition = "attachment"
+	}
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": f.Name}))
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	if etag != "" {
+		c.Set(fiber.HeaderETag, etag)
+	}
+	if !modTime.IsZero() {
+		c.Set(fiber.HeaderLastModified, modTime.Format(http.TimeFormat))
+	}
+
+	// Conditional GET: If-None-Match takes precedence over If-Modified-Since
+	if inm := c.Get(fiber.HeaderIfNoneMatch); inm != "" {
+		if etag != "" && etagListMatches(inm, etag) {
+			f.Object.Close()
+			return false, c.SendStatus(fiber.StatusNotModified)
+		}
+	} else if ims := c.Get(fiber.HeaderIfModifiedSince); ims != "" && !modTime.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !modTime.After(t) {
+			f.Object.Close()
+			return false, c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, f.ContentType)
+
+	rangeHeader := c.Get(fiber.HeaderRange)
+	if ifRange := c.Get(fiber.HeaderIfRange); rangeHeader != "" && ifRange != "" && !ifRangeMatches(ifRange, etag, modTime) {
+		// The client's copy is stale; send the whole file
+		rangeHeader = ""
+	}
+
+	start, length, ok := parseByteRange(rangeHeader, size)
+	if !ok {
+		f.Object.Close()
+		c.Set(fiber.HeaderContentRange, "bytes */"+strconv.FormatInt(size, 10))
+		return false, c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
+	}
+	if start == 0 && f.Count != nil {
+		if err := f.Count(); err != nil {
+			f.Object.Close()
+			return false, err
+		}
+	}
+	if length == size {
+		return true, c.SendStream(f.Object, int(size))
+	}
+
+	if _, err := f.Object.Seek(start, io.SeekStart); err != nil {
+		f.Object.Close()
+		return false, err
+	}
+	c.Status(fiber.StatusPartialContent)
+	c.Set(fiber.HeaderContentRange, "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(start+length-1, 10)+"/"+strconv.FormatInt(size, 10))
+	body := struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f.Object, length), f.Object}
+	return start == 0, c.SendStream(body, int(length))
+}
+
+// inlineImage reports whether content of this type may be shown inline. SVG
+// is an image that can run scripts, so it is not.
+func inlineImage(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml"
+}
+
+// parseByteRange parses a Range header for a file of the given size. A
+// missing, malformed or multi-range header selects the whole file; ok is
+// false only when the range cannot be satisfied.
+func parseByteRange(header string, size int64) (start, length int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, size, true
+	}
+
+	if first == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, size, true
+		}
+		if n == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, true
+	}
+	if start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, size, true
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true
+}
+
+// etagListMatches reports whether an If-None-Match header matches etag using
+// weak comparison
+func etagListMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifRangeMatches evaluates an If-Range header, which holds either a strong
+// ETag or a date
+func ifRangeMatches(header, etag string, modTime time.Time) bool {
+	if strings.HasPrefix(header, `"`) {
+		return etag != "" && header == etag
+	}
+	t, err := http.ParseTime(header)
+	return err == nil && !modTime.IsZero() && modTime.Equal(t)
+}
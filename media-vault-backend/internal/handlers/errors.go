@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// Errors of requests rejected before they reach a service. Handlers return
+// errors and the app's error handler renders them as problem details.
+var (
+	errInvalidRequest = apperr.Invalid("invalid_request", "invalid request")
+	errInvalidBody    = apperr.Invalid("invalid_body", "invalid request body")
+	errFileTooLarge   = apperr.New(apperr.KindTooLarge, "file_too_large", "file too large")
+)
+
+// invalidRequest reports a missing or malformed parameter
+func invalidRequest(message string) error {
+	return errInvalidRequest.WithMessage(message)
+}
+
+// invalidBody reports a request body that cannot be parsed
+func invalidBody(err error) error {
+	return fmt.Errorf("%w: %v", errInvalidBody, err)
+}
+
+// fileTooLarge reports an upload larger than limit bytes
+func fileTooLarge(limit int64) error {
+	return errFileTooLarge.WithMessage(fmt.Sprintf("File too large. Maximum size is %dMB", limit>>20))
+}
+
+// photoTypeNotAllowed reports an upload that is not a supported image
+func photoTypeNotAllowed() error {
+	return services.ErrPhotoTypeNotAllowed
+}
+
+// permissionDenied reports that the user may not do what message says
+func permissionDenied(message string) error {
+	return services.ErrPermissionDenied.WithMessage(message)
+}
+
+// invalidField reports a missing or invalid field of the request
+func invalidField(field, message string) error {
+	return errInvalidRequest.WithField(field, message)
+}
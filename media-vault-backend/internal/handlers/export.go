@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"bufio"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// exportRendition is the rendition name signed into export download URLs. It
+// is not a photo rendition, so an export URL cannot be replayed against
+// /media.
+const exportRendition = "export"
+
+// ExportHandler handles photo exports
+type ExportHandler struct {
+	exportService *services.ExportService
+	signer        *services.URLSigner
+	auditService  *services.AuditService
+}
+
+// NewExportHandler creates a new ExportHandler
+func NewExportHandler(exportService *services.ExportService, signer *services.URLSigner, auditService *services.AuditService) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+		signer:        signer,
+		auditService:  auditService,
+	}
+}
+
+// LimitRenditions returns a middleware applying limit to exports of
+// thumbnails, which are rendered on demand. Exports of originals are not
+// limited.
+func (h *ExportHandler) LimitRenditions(limit fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var request services.ExportRequest
+		if err := c.BodyParser(&request); err == nil && request.Rendition != "" && request.Rendition != services.RenditionOriginal {
+			return limit(c)
+		}
+		return c.Next()
+	}
+}
+
+// ExportPhotos exports photos as a zip or tar archive
+// @Summary Export photos
+// @Description Stream an archive of the selected photos, or start a background export for large selections
+// @Tags photos
+// @Accept json
+// @Produce application/zip
+// @Param request body services.ExportRequest true "Photos to export"
+// @Success 200 {file} binary
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Router /photos/export [post]
+func (h *ExportHandler) ExportPhotos(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var request services.ExportRequest
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	plan, err := h.exportService.PlanExport(c.UserContext(), userID, request)
+	if err != nil {
+		return err
+	}
+
+	photoIDs := make([]string, len(plan.Photos))
+	for i, photo := range plan.Photos {
+		photoIDs[i] = photo.ID
+	}
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoExport,
+		TargetType: "photo",
+	}, nil, fiber.Map{"format": plan.Format, "rendition": plan.Rendition, "photo_ids": photoIDs})
+
+	if request.Async || plan.Background() {
+		job, err := h.exportService.CreateJob(c.UserContext(), plan, request)
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderLocation, "/api/v1/photos/export/"+job.ID)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"job":     job,
+			"skipped": plan.Skipped,
+		})
+	}
+
+	filename := "photos-" + time.Now().UTC().Format("20060102-150405") + "." + plan.Format
+	c.Set(fiber.HeaderContentType, plan.ContentType())
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("X-Export-Count", strconv.Itoa(len(plan.Photos)))
+
+	// The archive is written straight to the connection as it is built. The
+	// Fiber context is gone by the time the stream runs, so it uses the user
+	// context, which carries the request ID and span.
+	ctx := c.UserContext()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.exportService.WriteArchive(ctx, w, plan); err != nil {
+			logging.FromContext(ctx).Error("Export failed", "user_id", userID, logging.Err(err))
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// GetExport returns the status of a background export
+// @Summary Get export status
+// @Description Return a background export and, once it is finished, a signed download URL
+// @Tags photos
+// @Produce json
+// @Param id path string true "Export ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} problem.Problem
+// @Router /photos/export/{id} [get]
+func (h *ExportHandler) GetExport(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	job, err := h.exportService.GetJob(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if job.UserID != userID {
+		return services.ErrExportNotFound
+	}
+
+	response := fiber.Map{"job": job}
+	if job.Status == services.ExportDone && job.ExpiresAt != nil {
+		expiresAt := time.Now().Add(services.DefaultSignedURLTTL).Truncate(time.Second)
+		if job.ExpiresAt.Before(expiresAt) {
+			expiresAt = *job.ExpiresAt
+		}
+		query := h.signer.Sign(services.SignedMedia{
+			PhotoID:   job.ID,
+			Rendition: exportRendition,
+			Caller:    userID,
+			ExpiresAt: expiresAt,
+		})
+		response["url"] = c.BaseURL() + "/exports/" + url.PathEscape(job.ID) + "?" + query.Encode()
+		response["url_expires_at"] = expiresAt.UTC()
+	}
+
+	return c.JSON(response)
+}
+
+// DownloadExport serves the archive of a finished export through a signed URL
+// @Summary Download an export
+// @Tags photos
+// @Produce application/zip
+// @Param id path string true "Export ID"
+// @Success 200 {file} binary
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /exports/{id} [get]
+func (h *ExportHandler) DownloadExport(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	query := url.Values{}
+	for _, name := range []string{"u", "exp", "kid", "sig"} {
+		query.Set(name, c.Query(name))
+	}
+	signed, err := h.signer.Verify(jobID, exportRendition, query)
+	if err != nil {
+		return err
+	}
+
+	job, err := h.exportService.GetJob(c.UserContext(), jobID)
+	if err != nil {
+		return err
+	}
+	if job.UserID != signed.Caller {
+		return services.ErrExportNotFound
+	}
+	obj, err := h.exportService.OpenJobArchive(c.UserContext(), job)
+	if err != nil {
+		return err
+	}
+
+	contentType := "application/zip"
+	if job.Format == services.ExportFormatTar {
+		contentType = "application/x-tar"
+	}
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	_, err = sendContent(c, content{
+		Object:      obj,
+		Name:        "photos-" + job.ID + "." + job.Format,
+		ContentType: contentType,
+		ETag:        job.ID,
+		Attachment:  true,
+	})
+	return err
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// maxVaultFileSize is the largest document that can be uploaded
+const maxVaultFileSize = 10 << 20
+
+// FileHandler handles the generic file vault
+type FileHandler struct {
+	fileService    *services.FileService
+	vaultService   *services.VaultService
+	sharingService *services.SharingService
+	auditService   *services.AuditService
+}
+
+// NewFileHandler creates a new FileHandler
+func NewFileHandler(fileService *services.FileService, vaultService *services.VaultService, sharingService *services.SharingService, auditService *services.AuditService) *FileHandler {
+	return &FileHandler{
+		fileService:    fileService,
+		vaultService:   vaultService,
+		sharingService: sharingService,
+		auditService:   auditService,
+	}
+}
+
+// ListFiles lists the files and sub-folders of a folder
+// @Summary List files
+// @Description List the files in a folder (the root folder by default) and the folders directly inside it
+// @Tags files
+// @Produce json
+// @Param path query string false "Folder, e.g. /contracts/2024"
+// @Param recursive query bool false "Include files in sub-folders"
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Router /files [get]
+func (h *FileHandler) ListFiles(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	folder := c.Query("path", services.RootFolder)
+
+	page, err := h.fileService.ListFiles(c.UserContext(), userID, folder, c.QueryBool("recursive"), c.QueryInt("page", 1), c.QueryInt("limit", services.DefaultPageSize))
+	if err != nil {
+		return err
+	}
+
+	folders, err := h.fileService.ListFolders(c.UserContext(), userID, folder)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"data":    page.Files,
+		"total":   page.Total,
+		"page":    page.Page,
+		"limit":   page.Limit,
+		"folders": folders,
+	})
+}
+
+// ListSharedFiles lists the files shared with the user
+// @Summary List files shared with me
+// @Tags files
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /files/shared [get]
+func (h *FileHandler) ListSharedFiles(c *fiber.Ctx) error {
+	files, err := h.fileService.ListSharedFiles(c.UserContext(), c.Locals("userID").(string))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  files,
+		"total": len(files),
+	})
+}
+
+// UploadFile uploads a document to the vault
+// @Summary Upload a file
+// @Description Upload a document of an allowed type into a folder
+// @Tags files
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "File to upload"
+// @Param path formData string false "Folder, e.g. /contracts/2024"
+// @Param metadata formData string false "JSON object with custom metadata"
+// @Success 201 {object} models.VaultFile
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Router /files [post]
+func (h *FileHandler) UploadFile(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return invalidField("file", "is required")
+	}
+	if fileHeader.Size > maxVaultFileSize {
+		return fileTooLarge(maxVaultFileSize)
+	}
+
+	if err := h.vaultService.CheckQuota(c.UserContext(), userID, fileHeader.Size); err != nil {
+		return err
+	}
+
+	var metadata json.RawMessage
+	if raw := c.FormValue("metadata"); raw != "" {
+		metadata = json.RawMessage(raw)
+	}
+
+	file, err := h.fileService.UploadFile(c.UserContext(), userID, fileHeader, c.FormValue("path", services.RootFolder), metadata)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditFileUpload,
+		TargetType: "file",
+		TargetID:   file.ID,
+	}, nil, file)
+
+	return c.Status(fiber.StatusCreated).JSON(file)
+}
+
+// GetFile returns a file's details
+// @Summary Get a file
+// @Tags files
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 200 {object} models.VaultFile
+// @Failure 404 {object} problem.Problem
+// @Router /files/{id} [get]
+func (h *FileHandler) GetFile(c *fiber.Ctx) error {
+	file, err := h.loadFile(c, services.PermissionView)
+	if err != nil {
+		return err
+	}
+	return c.JSON(file)
+}
+
+// DownloadFile streams a file's content
+// @Summary Download a file
+// @Tags files
+// @Produce octet-stream
+// @Param id path string true "File ID"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /files/{id}/download [get]
+func (h *FileHandler) DownloadFile(c *fiber.Ctx) error {
+	file, err := h.loadFile(c, services.PermissionDownload)
+	if err != nil {
+		return err
+	}
+
+	obj, err := h.fileService.OpenFile(c.UserContext(), file)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	_, err = sendContent(c, content{
+		Object:      obj,
+		Name:        file.Name,
+		ContentType: file.MimeType,
+		ETag:        file.Hash,
+		Attachment:  true,
+	})
+	return err
+}
+
+// UpdateFile renames or moves a file or replaces its metadata
+// @Summary Update a file
+// @Tags files
+// @Accept json
+// @Produce json
+// @Param id path string true "File ID"
+// @Param request body models.VaultFileUpdate true "New name, folder or metadata"
+// @Success 200 {object} models.VaultFile
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /files/{id} [put]
+func (h *FileHandler) UpdateFile(c *fiber.Ctx) error {
+	file, err := h.loadFile(c, "")
+	if err != nil {
+		return err
+	}
+
+	var update models.VaultFileUpdate
+	if err := c.BodyParser(&update); err != nil {
+		return invalidBody(err)
+	}
+
+	before := file
+	file, err = h.fileService.UpdateFile(c.UserContext(), file.ID, update)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditFileUpdate,
+		TargetType: "file",
+		TargetID:   file.ID,
+	}, before, file)
+
+	return c.JSON(file)
+}
+
+// MoveFolder renames or moves a folder and everything in it
+// @Summary Move a folder
+// @Tags files
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /files/folders/move [post]
+func (h *FileHandler) MoveFolder(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var request struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	moved, err := h.fileService.MoveFolder(c.UserContext(), userID, request.From, request.To)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditFolderMove,
+		TargetType: "folder",
+		TargetID:   request.From,
+	}, fiber.Map{"path": request.From}, fiber.Map{"path": request.To, "files": moved})
+
+	return c.JSON(fiber.Map{
+		"moved": moved,
+	})
+}
+
+// DeleteFile deletes a file
+// @Summary Delete a file
+// @Tags files
+// @Param id path string true "File ID"
+// @Success 204
+// @Router /files/{id} [delete]
+func (h *FileHandler) DeleteFile(c *fiber.Ctx) error {
+	file, err := h.loadFile(c, "")
+	if err != nil {
+		return err
+	}
+
+	if err := h.fileService.DeleteFile(c.UserContext(), file); err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditFileDelete,
+		TargetType: "file",
+		TargetID:   file.ID,
+	}, file, nil)
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// ListFileShares lists who a file is shared with
+// @Summary List file shares
+// @Tags files
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /files/{id}/shares [get]
+func (h *FileHandler) ListFileShares(c *fiber.Ctx) error {
+	file, err := h.loadFile(c, "")
+	if err != nil {
+		return err
+	}
+
+	shares, err := h.sharingService.ListSharesForFile(c.UserContext(), file.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  shares,
+		"total": len(shares),
+	})
+}
+
+// ShareFile shares a file with another user
+// @Summary Share a file
+// @Tags files
+// @Accept json
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 201 {object} services.Share
+// @Router /files/{id}/shares [post]
+func (h *FileHandler) ShareFile(c *fiber.Ctx) error {
+	file, err := h.loadFile(c, "")
+	if err != nil {
+		return err
+	}
+
+	var request struct {
+		SharedWith string     `json:"shared_with"`
+		Permission string     `json:"permission"`
+		ExpiresAt  *time.Time `json:"expires_at"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	userID := c.Locals("userID").(string)
+	if request.SharedWith == userID {
+		return invalidRequest("You cannot share a file with yourself")
+	}
+
+	share := &services.Share{
+		FileID:     file.ID,
+		SharedBy:   userID,
+		SharedWith: request.SharedWith,
+		Permission: request.Permission,
+		ExpiresAt:  request.ExpiresAt,
+	}
+	if err := h.sharingService.ShareFile(c.UserContext(), share); err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditFileShare,
+		TargetType: "file",
+		TargetID:   file.ID,
+	}, nil, share)
+
+	return c.Status(fiber.StatusCreated).JSON(share)
+}
+
+// RevokeFileShare removes a share from a file
+// @Summary Revoke a file share
+// @Tags files
+// @Param id path string true "File ID"
+// @Param shareId path string true "Share ID"
+// @Success 204
+// @Router /files/{id}/shares/{shareId} [delete]
+func (h *FileHandler) RevokeFileShare(c *fiber.Ctx) error {
+	file, err := h.loadFile(c, "")
+	if err != nil {
+		return err
+	}
+
+	if err := h.sharingService.RevokeFileShare(c.UserContext(), file.ID, c.Params("shareId")); err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditFileUnshare,
+		TargetType: "file",
+		TargetID:   file.ID,
+	}, fiber.Map{"share_id": c.Params("shareId")}, nil)
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// loadFile loads the file named in the path and checks that the caller may
+// access it with the given permission. An empty permission requires the
+// caller to own the file. Files the caller cannot see are reported as missing.
+func (h *FileHandler) loadFile(c *fiber.Ctx, permission string) (*models.VaultFile, error) {
+	file, err := h.fileService.GetFile(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	userID := c.Locals("userID").(string)
+	if file.UserID == userID {
+		return file, nil
+	}
+	if permission == "" {
+		return nil, services.ErrFileNotFound
+	}
+
+	allowed, err := h.sharingService.HasFilePermission(c.UserContext(), file.ID, userID, permission)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		if permission == services.PermissionDownload {
+			// The caller may still be able to view the file
+			if canView, _ := h.sharingService.HasFilePermission(c.UserContext(), file.ID, userID, services.PermissionView); canView {
+				return nil, permissionDenied("You don't have permission to download this file")
+			}
+		}
+		return nil, services.ErrFileNotFound
+	}
+
+	return file, nil
+}
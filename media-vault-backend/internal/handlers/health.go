@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// HealthHandler serves the liveness and readiness probes
+type HealthHandler struct {
+	healthService *services.HealthService
+}
+
+// NewHealthHandler creates a new HealthHandler
+func NewHealthHandler(healthService *services.HealthService) *HealthHandler {
+	return &HealthHandler{healthService: healthService}
+}
+
+// Live reports that the process is up and serving requests. It checks no
+// dependencies, so that a database outage doesn't get the pod restarted.
+// @Summary Liveness probe
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /health/live [get]
+func (h *HealthHandler) Live(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": services.HealthOK})
+}
+
+// Ready reports whether the service can handle requests: the database must be
+// reachable and migrated
+// @Summary Readiness probe
+// @Tags health
+// @Produce json
+// @Success 200 {object} services.HealthReport
+// @Failure 503 {object} services.HealthReport
+// @Router /health/ready [get]
+func (h *HealthHandler) Ready(c *fiber.Ctx) error {
+	report := h.healthService.Ready(c.UserContext())
+	return c.Status(healthStatus(report)).JSON(report)
+}
+
+// healthStatus is 503 for failed reports. Warnings still report 200 so that
+// probes and load balancers keep routing traffic.
+func healthStatus(report *services.HealthReport) int {
+	if report.Status == services.HealthFail {
+		return fiber.StatusServiceUnavailable
+	}
+	return fiber.StatusOK
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/services"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+// preferredLanguages returns the caller's language preferences. An explicit
+// ?lang= query parameter takes precedence over the Accept-Language header.
+func preferredLanguages(c *fiber.Ctx) []string {
+	if lang := utils.NormalizeLanguageTag(c.Query("lang")); lang != "" {
+		return []string{lang}
+	}
+	return utils.ParseAcceptLanguage(c.Get(fiber.HeaderAcceptLanguage))
+}
+
+// translateAndStore machine-translates a description and tags from one
+// language into others and stores the results as photo translations. Nil or
+// blank inputs are left untouched in the target languages.
+func translateAndStore(
+	ctx context.Context,
+	photoService *services.PhotoService,
+	descriptionService *services.DescriptionService,
+	photoID, from string,
+	description, tags *string,
+	to []string,
+) error {
+	translate := func(text *string) (map[string]string, error) {
+		if text == nil || strings.TrimSpace(*text) == "" {
+			return nil, nil
+		}
+		return descriptionService.Translate(ctx, *text, from, to)
+	}
+
+	descriptions, err := translate(description)
+	if err != nil {
+		return err
+	}
+	translatedTags, err := translate(tags)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range to {
+		lang := utils.NormalizeLanguageTag(target)
+		var langDescription, langTags *string
+		if text, ok := descriptions[lang]; ok {
+			langDescription = &text
+		}
+		if text, ok := translatedTags[lang]; ok {
+			langTags = &text
+		}
+		if langDescription == nil && langTags == nil {
+			continue
+		}
+
+		if _, err := photoService.UpdateDescription(ctx, photoID, lang, langDescription, langTags, "machine"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// signedMediaMaxAge is how long browsers may reuse signed media without asking
+// again, which bounds how long a revoked share keeps working
+const signedMediaMaxAge = time.Minute
+
+// MediaHandler issues and serves signed media URLs, which let browsers and
+// other clients fetch photos without a bearer token
+type MediaHandler struct {
+	photoService   *services.PhotoService
+	sharingService *services.SharingService
+	signer         *services.URLSigner
+}
+
+// NewMediaHandler creates a new MediaHandler
+func NewMediaHandler(photoService *services.PhotoService, sharingService *services.SharingService, signer *services.URLSigner) *MediaHandler {
+	return &MediaHandler{
+		photoService:   photoService,
+		sharingService: sharingService,
+		signer:         signer,
+	}
+}
+
+// CreateSignedURL returns a time-limited URL for a photo rendition
+// @Summary Create a signed URL
+// @Description Return a URL for the original or a thumbnail that works without authentication until it expires
+// @Tags photos
+// @Accept json
+// @Produce json
+// @Param id path string true "Photo ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Router /photos/{id}/signed-url [post]
+func (h *MediaHandler) CreateSignedURL(c *fiber.Ctx) error {
+	photoID := c.Params("id")
+	userID := c.Locals("userID").(string)
+
+	var request struct {
+		Rendition string `json:"rendition"`
+		ExpiresIn int    `json:"expires_in"` // seconds
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return invalidBody(err)
+		}
+	}
+	if request.Rendition == "" {
+		request.Rendition = "medium"
+	}
+	if !services.ValidRendition(request.Rendition) {
+		return fmt.Errorf("%w: %q", services.ErrInvalidRendition, request.Rendition)
+	}
+
+	ttl := services.DefaultSignedURLTTL
+	if request.ExpiresIn != 0 {
+		ttl = time.Duration(request.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > services.MaxSignedURLTTL {
+		return invalidField("expires_in", "must be between 1 and "+strconv.Itoa(int(services.MaxSignedURLTTL.Seconds()))+" seconds")
+	}
+
+	allowed, err := h.sharingService.HasPermission(c.UserContext(), photoID, userID, renditionPermission(request.Rendition))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return permissionDenied("You don't have permission to access this photo")
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	query := h.signer.Sign(services.SignedMedia{
+		PhotoID:   photoID,
+		Rendition: request.Rendition,
+		Caller:    userID,
+		ExpiresAt: expiresAt,
+	})
+
+	return c.JSON(fiber.Map{
+		"url":        c.BaseURL() + "/media/" + url.PathEscape(photoID) + "/" + request.Rendition + "?" + query.Encode(),
+		"rendition":  request.Rendition,
+		"expires_at": expiresAt.UTC(),
+	})
+}
+
+// ServeSignedMedia streams a photo rendition for a valid signed URL. The
+// caller named in the signature must still have access to the photo, so
+// revoking a share also invalidates URLs issued under it.
+// @Summary Fetch media through a signed URL
+// @Tags photos
+// @Param id path string true "Photo ID"
+// @Param rendition path string true "original, small, medium or large"
+// @Success 200
+// @Failure 403 {object} problem.Problem
+// @Failure 410 {object} problem.Problem
+// @Router /media/{id}/{rendition} [get]
+func (h *MediaHandler) ServeSignedMedia(c *fiber.Ctx) error {
+	photoID, rendition := c.Params("id"), c.Params("rendition")
+
+	query := url.Values{}
+	for _, name := range []string{"u", "exp", "kid", "sig"} {
+		query.Set(name, c.Query(name))
+	}
+	signed, err := h.signer.Verify(photoID, rendition, query)
+	if err != nil {
+		return err
+	}
+
+	allowed, err := h.sharingService.HasPermission(c.UserContext(), photoID, signed.Caller, renditionPermission(rendition))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return permissionDenied("Access to this photo has been revoked")
+	}
+
+	// Caches must not serve the bytes past the permission check above: shared
+	// caches not at all, browsers only briefly, so revoking a share stops
+	// access within signedMediaMaxAge
+	maxAge := min(time.Until(signed.ExpiresAt), signedMediaMaxAge)
+	c.Set(fiber.HeaderCacheControl, "private, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+
+	if rendition == services.RenditionOriginal {
+		photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
+		if err != nil {
+			return err
+		}
+		obj, err := h.photoService.OpenOriginal(c.UserContext(), photo)
+		if err != nil {
+			return err
+		}
+		// Like share links, only images are shown inline
+		_, err = sendContent(c, content{
+			Object:      obj,
+			Name:        photo.OriginalName,
+			ContentType: photo.MimeType,
+			ETag:        photo.Hash,
+		})
+		return err
+	}
+
+	data, contentType, err := h.photoService.GetThumbnail(c.UserContext(), photoID, rendition)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Send(data)
+}
+
+// renditionPermission is the share permission needed for a rendition:
+// originals require download access, thumbnails only view access
+func renditionPermission(rendition string) string {
+	if rendition == services.RenditionOriginal {
+		return services.PermissionDownload
+	}
+	return services.PermissionView
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/wronai/media-vault-backend/internal/problem"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// mediaTest serves signed media over the photos of a shareLinkTest
+type mediaTest struct {
+	*shareLinkTest
+	signer *services.URLSigner
+	media  *fiber.App
+}
+
+func newMediaTest(t *testing.T) *mediaTest {
+	t.Helper()
+	st := newShareLinkTest(t)
+	signer, err := services.NewURLSigner(map[string][]byte{
+		"k1": []byte(strings.Repeat("1", 32)),
+		"k2": []byte(strings.Repeat("2", 32)),
+	}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt := &mediaTest{shareLinkTest: st, signer: signer}
+	mt.media = fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	mt.media.Get("/media/:id/:rendition", NewMediaHandler(st.photos, st.sharing, signer).ServeSignedMedia)
+	return mt
+}
+
+// get fetches a rendition with the given signed query
+func (mt *mediaTest) get(t *testing.T, photoID, rendition string, query url.Values) *http.Response {
+	t.Helper()
+	resp, err := mt.media.Test(httptest.NewRequest(fiber.MethodGet, "/media/"+photoID+"/"+rendition+"?"+query.Encode(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestSignedMediaStopsAfterRevocation(t *testing.T) {
+	mt := newMediaTest(t)
+	photo := mt.upload(t, "u1")
+	share := &services.Share{PhotoID: photo.ID, SharedBy: "u1", SharedWith: "u2", Permission: services.PermissionDownload}
+	if err := mt.sharing.SharePhoto(context.Background(), share); err != nil {
+		t.Fatal(err)
+	}
+	query := mt.signer.Sign(services.SignedMedia{
+		PhotoID:   photo.ID,
+		Rendition: services.RenditionOriginal,
+		Caller:    "u2",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	resp := mt.get(t, photo.ID, services.RenditionOriginal, query)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	// Shared caches would keep serving the bytes once the share is revoked
+	cacheControl := resp.Header.Get(fiber.HeaderCacheControl)
+	maxAge, err := strconv.Atoi(strings.TrimPrefix(cacheControl, "private, max-age="))
+	if !strings.HasPrefix(cacheControl, "private, ") || err != nil || maxAge > 60 {
+		t.Errorf("Cache-Control = %q, want private for at most a minute", cacheControl)
+	}
+
+	if err := mt.sharing.RevokeShare(context.Background(), share.ID); err != nil {
+		t.Fatal(err)
+	}
+	if resp := mt.get(t, photo.ID, services.RenditionOriginal, query); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("status after revocation = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestSignedMediaServesOnlyImagesInline(t *testing.T) {
+	mt := newMediaTest(t)
+	photo := mt.upload(t, "u1")
+	query := mt.signer.Sign(services.SignedMedia{
+		PhotoID:   photo.ID,
+		Rendition: services.RenditionOriginal,
+		Caller:    "u1",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	if resp := mt.get(t, photo.ID, services.RenditionOriginal, query); !strings.HasPrefix(resp.Header.Get(fiber.HeaderContentDisposition), "inline;") {
+		t.Errorf("image Content-Disposition = %q, want inline", resp.Header.Get(fiber.HeaderContentDisposition))
+	}
+
+	if _, err := mt.db.Exec(`UPDATE photos SET mime_type = 'text/html; charset=utf-8' WHERE id = ?`, photo.ID); err != nil {
+		t.Fatal(err)
+	}
+	resp := mt.get(t, photo.ID, services.RenditionOriginal, query)
+	if got := resp.Header.Get(fiber.HeaderContentType); got != "application/octet-stream" {
+		t.Errorf("HTML Content-Type = %q, want application/octet-stream", got)
+	}
+	if got := resp.Header.Get(fiber.HeaderContentDisposition); !strings.HasPrefix(got, "attachment;") {
+		t.Errorf("HTML Content-Disposition = %q, want attachment", got)
+	}
+}
+
+func TestSignedMediaRejectsBadSignatures(t *testing.T) {
+	mt := newMediaTest(t)
+	photo := mt.upload(t, "u1")
+	other := mt.upload(t, "u1")
+	sign := func(signer *services.URLSigner, expiresAt time.Time) url.Values {
+		return signer.Sign(services.SignedMedia{PhotoID: photo.ID, Rendition: "small", Caller: "u1", ExpiresAt: expiresAt})
+	}
+	valid := sign(mt.signer, time.Now().Add(time.Hour))
+	retired, err := services.NewURLSigner(map[string][]byte{"k3": []byte(strings.Repeat("3", 32))}, "k3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := services.NewURLSigner(map[string][]byte{
+		"k1": []byte(strings.Repeat("1", 32)),
+		"k2": []byte(strings.Repeat("2", 32)),
+	}, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(name, value string) url.Values {
+		query := url.Values{}
+		for k, v := range valid {
+			query[k] = v
+		}
+		query.Set(name, value)
+		return query
+	}
+	tests := []struct {
+		name      string
+		photoID   string
+		rendition string
+		query     url.Values
+		status    int
+		code      string
+	}{
+		{"valid", photo.ID, "small", valid, 200, ""},
+		{"signed with a key still configured", photo.ID, "small", sign(rotated, time.Now().Add(time.Hour)), 200, ""},
+		{"other photo", other.ID, "small", valid, 403, services.ErrInvalidSignature.Code},
+		{"other rendition", photo.ID, "original", valid, 403, services.ErrInvalidSignature.Code},
+		{"other caller", photo.ID, "small", with("u", "u2"), 403, services.ErrInvalidSignature.Code},
+		{"extended expiry", photo.ID, "small", with("exp", strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)), 403, services.ErrInvalidSignature.Code},
+		{"forged signature", photo.ID, "small", with("sig", "AAAA"), 403, services.ErrInvalidSignature.Code},
+		{"retired key", photo.ID, "small", sign(retired, time.Now().Add(time.Hour)), 403, services.ErrInvalidSignature.Code},
+		{"expired", photo.ID, "small", sign(mt.signer, time.Now().Add(-time.Minute)), 410, services.ErrSignatureExpired.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := mt.get(t, tt.photoID, tt.rendition, tt.query)
+			var body struct {
+				Code string `json:"code"`
+			}
+			if resp.StatusCode >= 400 {
+				if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if resp.StatusCode != tt.status || body.Code != tt.code {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, body.Code, tt.status, tt.code)
+			}
+		})
+	}
+}
@@ -1,60 +1,227 @@
 package handlers
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/problem"
 	"github.com/wronai/media-vault-backend/internal/services"
+	"github.com/wronai/media-vault-backend/internal/utils"
 )
 
 type PartnerHandler struct {
-    photoService   *services.PhotoService
-    sharingService *services.SharingService
+	photoService       *services.PhotoService
+	sharingService     *services.SharingService
+	descriptionService *services.DescriptionService
+	auditService       *services.AuditService
+}
+
+func NewPartnerHandler(photoService *services.PhotoService, sharingService *services.SharingService, descriptionService *services.DescriptionService, auditService *services.AuditService) *PartnerHandler {
+	return &PartnerHandler{
+		photoService:       photoService,
+		sharingService:     sharingService,
+		descriptionService: descriptionService,
+		auditService:       auditService,
+	}
 }
 
-func NewPartnerHandler(photoService *services.PhotoService, sharingService *services.SharingService) *PartnerHandler {
-    return &PartnerHandler{
-        photoService:   photoService,
-        sharingService: sharingService,
-    }
+// photoFailure says why a photo of a batch was not updated
+type photoFailure struct {
+	PhotoID string `json:"photo_id"`
+	Code    string `json:"code"`
+	Detail  string `json:"detail"`
 }
 
 // BulkUpload handles bulk photo upload for partners
 func (h *PartnerHandler) BulkUpload(c *fiber.Ctx) error {
-    // Implementation from main.go
-    return c.SendString("Bulk upload endpoint")
+	// Implementation from main.go
+	return c.SendString("Bulk upload endpoint")
 }
 
 // GetPartnerPhotos returns photos uploaded by the partner
+// @Summary List partner photos
+// @Description List photos the partner owns or delivered, with the same filters, sorting and pagination as /photos
+// @Tags partner
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Router /partner/photos [get]
 func (h *PartnerHandler) GetPartnerPhotos(c *fiber.Ctx) error {
-    // Implementation from main.go
-    return c.SendString("Partner photos endpoint")
+	query, err := parsePhotoQuery(c)
+	if err != nil {
+		return err
+	}
+	query.UserID = c.Locals("userID").(string)
+	query.AsPartner = true
+
+	page, err := h.photoService.ListPhotos(c.UserContext(), query)
+	if err != nil {
+		return err
+	}
+
+	if err := h.photoService.LocalizePhotos(c.UserContext(), page.Photos, preferredLanguages(c)); err != nil {
+		return err
+	}
+	c.Vary(fiber.HeaderAcceptLanguage)
+
+	return c.JSON(photoPageResponse(page))
 }
 
 // BatchUpdateDescriptions updates descriptions for multiple photos
+// @Summary Batch update descriptions
+// @Description Replace or append the description and tags of many photos in one language, optionally machine-translating them into others
+// @Tags partner
+// @Accept json
+// @Produce json
+// @Param request body models.BatchUpdateRequest true "Photos and new description"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Router /partner/photos/descriptions [put]
 func (h *PartnerHandler) BatchUpdateDescriptions(c *fiber.Ctx) error {
-    // Implementation from main.go
-    return c.SendString("Batch update descriptions endpoint")
+	partnerID := c.Locals("userID").(string)
+
+	var req models.BatchUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if len(req.PhotoIDs) == 0 {
+		return invalidRequest("photo_ids is required")
+	}
+	if req.Description == "" && req.Tags == "" {
+		return invalidRequest("description or tags is required")
+	}
+
+	operation := req.Operation
+	if operation == "" {
+		operation = "replace"
+	}
+	if operation != "replace" && operation != "append" {
+		return invalidRequest("operation must be 'replace' or 'append'")
+	}
+
+	language := h.photoService.DefaultLanguage()
+	if req.Language != "" {
+		if language = utils.NormalizeLanguageTag(req.Language); language == "" {
+			return fmt.Errorf("%w: %q", utils.ErrInvalidLanguage, req.Language)
+		}
+	}
+
+	var updated []string
+	var updateErrors []string
+	var failures []photoFailure
+	// Only the problem detail is shown; unexpected errors are logged
+	fail := func(photoID string, err error) {
+		if _, ok := apperr.As(err); !ok {
+			logging.FromContext(c.UserContext()).Error("Failed to update photo description", "photo_id", photoID, logging.Err(err))
+		}
+		p := problem.From(err)
+		updateErrors = append(updateErrors, fmt.Sprintf("Photo '%s': %s", photoID, p.Detail))
+		failures = append(failures, photoFailure{PhotoID: photoID, Code: p.Code, Detail: p.Detail})
+	}
+
+	for _, photoID := range req.PhotoIDs {
+		photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
+		if err != nil {
+			fail(photoID, err)
+			continue
+		}
+		if photo.UserID != partnerID && (photo.PartnerID == nil || *photo.PartnerID != partnerID) {
+			fail(photoID, services.ErrPermissionDenied)
+			continue
+		}
+
+		// Load the current text in the target language for appending
+		if err := h.photoService.LocalizePhotos(c.UserContext(), []*models.Photo{photo}, []string{language}); err != nil {
+			fail(photoID, err)
+			continue
+		}
+
+		var description, tags *string
+		if req.Description != "" {
+			text := req.Description
+			if operation == "append" && photo.Language == language && photo.Description != nil && *photo.Description != "" {
+				text = *photo.Description + " " + text
+			}
+			description = &text
+		}
+		if req.Tags != "" {
+			text := req.Tags
+			if operation == "append" && photo.Language == language && photo.Tags != nil && *photo.Tags != "" {
+				text = *photo.Tags + "," + text
+			}
+			tags = &text
+		}
+
+		if _, err := h.photoService.UpdateDescription(c.UserContext(), photoID, language, description, tags, "user"); err != nil {
+			fail(photoID, err)
+			continue
+		}
+		before := fiber.Map{"language": language}
+		if photo.Language == language {
+			before["description"], before["tags"] = photo.Description, photo.Tags
+		}
+		after := fiber.Map{"language": language, "description": before["description"], "tags": before["tags"]}
+		if description != nil {
+			after["description"] = description
+		}
+		if tags != nil {
+			after["tags"] = tags
+		}
+		recordAudit(c, h.auditService, &services.AuditEvent{
+			Action:     services.AuditPhotoUpdate,
+			TargetType: "photo",
+			TargetID:   photoID,
+		}, before, after)
+
+		if len(req.TranslateTo) > 0 {
+			if err := translateAndStore(c.UserContext(), h.photoService, h.descriptionService, photoID, language, description, tags, req.TranslateTo); err != nil {
+				fail(photoID, err)
+				continue
+			}
+		}
+
+		updated = append(updated, photoID)
+	}
+
+	if len(updated) == 0 {
+		return errInvalidRequest.WithMessage(strings.Join(updateErrors, "; ")).WithExtra("failures", failures)
+	}
+
+	return c.JSON(fiber.Map{
+		"updated":     len(updated),
+		"photo_ids":   updated,
+		"language":    language,
+		"error_count": len(updateErrors),
+		"errors":      updateErrors,
+		"failures":    failures,
+	})
 }
 
 // BatchSharePhotos shares multiple photos with users
 func (h *PartnerHandler) BatchSharePhotos(c *fiber.Ctx) error {
-    // Implementation from main.go
-    return c.SendString("Batch share photos endpoint")
+	// Implementation from main.go
+	return c.SendString("Batch share photos endpoint")
 }
 
 // GetPhotoAnalytics returns analytics for a specific photo
 func (h *PartnerHandler) GetPhotoAnalytics(c *fiber.Ctx) error {
-    // Implementation from main.go
-    return c.SendString("Photo analytics endpoint")
+	// Implementation from main.go
+	return c.SendString("Photo analytics endpoint")
 }
 
 // GetPartnerDashboard returns dashboard data for partner
 func (h *PartnerHandler) GetPartnerDashboard(c *fiber.Ctx) error {
-    // Implementation from main.go
-    return c.SendString("Partner dashboard endpoint")
+	// Implementation from main.go
+	return c.SendString("Partner dashboard endpoint")
 }
 
 // GetPartnerAnalytics returns comprehensive analytics for partner
 func (h *PartnerHandler) GetPartnerAnalytics(c *fiber.Ctx) error {
-    // Implementation from main.go
-    return c.SendString("Partner analytics endpoint")
+	// Implementation from main.go
+	return c.SendString("Partner analytics endpoint")
 }
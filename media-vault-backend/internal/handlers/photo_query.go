@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// parsePhotoQuery builds a photo query from the request's query string.
+// Supported parameters:
+//
+//	page, limit, cursor                 offset or keyset pagination
+//	sort_by, sort_order                 e.g. sort_by=taken_at&sort_order=asc
+//	created_from, created_to            RFC 3339 timestamps or YYYY-MM-DD dates
+//	taken_from, taken_to
+//	mime_type                           comma-separated, wildcards such as image/*
+//	min_width, max_width, min_height, max_height
+//	moderation_status                   comma-separated
+//	shared                              true or false
+//	partner_id
+//	tags, tag_mode                      tag_mode=any matches any tag (default all)
+//	search                              substring match on name, descriptions and tags
+func parsePhotoQuery(c *fiber.Ctx) (services.PhotoQuery, error) {
+	q := services.PhotoQuery{
+		SortBy:           c.Query("sort_by"),
+		SortOrder:        c.Query("sort_order"),
+		Cursor:           c.Query("cursor"),
+		MimeTypes:        splitQuery(c.Query("mime_type")),
+		ModerationStatus: splitQuery(c.Query("moderation_status")),
+		PartnerID:        c.Query("partner_id"),
+		Search:           strings.TrimSpace(c.Query("search")),
+		Tags: services.TagFilter{
+			Tags:     splitQuery(c.Query("tags")),
+			MatchAll: c.Query("tag_mode", "all") != "any",
+		},
+	}
+
+	ints := []struct {
+		name string
+		dest *int
+	}{
+		{"page", &q.Page},
+		{"limit", &q.Limit},
+		{"min_width", &q.MinWidth},
+		{"max_width", &q.MaxWidth},
+		{"min_height", &q.MinHeight},
+		{"max_height", &q.MaxHeight},
+	}
+	for _, p := range ints {
+		value := c.Query(p.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return q, services.ErrInvalidPhotoQuery.WithField(p.name, "must be a non-negative integer")
+		}
+		*p.dest = n
+	}
+	if q.Page == 0 {
+		q.Page = 1
+	}
+	if c.Query("limit") != "" && q.Limit == 0 {
+		return q, services.ErrInvalidPhotoQuery.WithField("limit", fmt.Sprintf("must be between 1 and %d", services.MaxPageSize))
+	}
+
+	times := []struct {
+		name string
+		dest **time.Time
+	}{
+		{"created_from", &q.CreatedFrom},
+		{"created_to", &q.CreatedTo},
+		{"taken_from", &q.TakenFrom},
+		{"taken_to", &q.TakenTo},
+	}
+	for _, p := range times {
+		value := c.Query(p.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeParam(value)
+		if err != nil {
+			return q, services.ErrInvalidPhotoQuery.WithField(p.name, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+		}
+		*p.dest = &t
+	}
+
+	if value := c.Query("shared"); value != "" {
+		shared, err := strconv.ParseBool(value)
+		if err != nil {
+			return q, services.ErrInvalidPhotoQuery.WithField("shared", "must be true or false")
+		}
+		q.Shared = &shared
+	}
+
+	return q, q.Normalize()
+}
+
+// photoPageResponse renders a page of photos
+func photoPageResponse(page *services.PhotoPage) fiber.Map {
+	response := fiber.Map{
+		"data":  page.Photos,
+		"total": page.Total,
+		"page":  page.Page,
+		"limit": page.Limit,
+	}
+	if page.NextCursor != "" {
+		response["next_cursor"] = page.NextCursor
+	}
+	return response
+}
+
+// parseTimeParam accepts RFC 3339 timestamps and plain dates
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// splitQuery splits a comma-separated query parameter, dropping blanks
+func splitQuery(value string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
@@ -1,19 +1,33 @@
 package handlers
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/models"
 	"github.com/wronai/media-vault-backend/internal/services"
+	"github.com/wronai/media-vault-backend/internal/utils"
 )
 
 // PhotoHandler handles photo-related HTTP requests
 type PhotoHandler struct {
-	photoService *services.PhotoService
+	photoService       *services.PhotoService
+	descriptionService *services.DescriptionService
+	tagService         *services.TagService
+	sharingService     *services.SharingService
+	auditService       *services.AuditService
 }
 
 // NewPhotoHandler creates a new PhotoHandler
-func NewPhotoHandler(photoService *services.PhotoService) *PhotoHandler {
+func NewPhotoHandler(photoService *services.PhotoService, descriptionService *services.DescriptionService, tagService *services.TagService, sharingService *services.SharingService, auditService *services.AuditService) *PhotoHandler {
 	return &PhotoHandler{
-		photoService: photoService,
+		photoService:       photoService,
+		descriptionService: descriptionService,
+		tagService:         tagService,
+		sharingService:     sharingService,
+		auditService:       auditService,
 	}
 }
 
@@ -22,22 +36,24 @@ func (h *PhotoHandler) UploadPhoto(c *fiber.Ctx) error {
 	// Get the file from the form data
 	file, err := c.FormFile("photo")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "No file uploaded",
-		})
+		return invalidField("photo", "is required")
 	}
 
 	// Get user ID from context (set by auth middleware)
 	userID := c.Locals("userID").(string)
 
 	// Upload the photo
-	photo, err := h.photoService.UploadPhoto(c.Context(), userID, file, nil)
+	photo, err := h.photoService.UploadPhoto(c.UserContext(), userID, file, nil)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to upload photo: " + err.Error(),
-		})
+		return err
 	}
 
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoUpload,
+		TargetType: "photo",
+		TargetID:   photo.ID,
+	}, nil, photo)
+
 	return c.Status(fiber.StatusCreated).JSON(photo)
 }
 
@@ -45,124 +61,144 @@ func (h *PhotoHandler) UploadPhoto(c *fiber.Ctx) error {
 func (h *PhotoHandler) GetPhoto(c *fiber.Ctx) error {
 	photoID := c.Params("id")
 	if photoID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Photo ID is required",
-		})
+		return invalidRequest("Photo ID is required")
 	}
 
 	// Get photo from service
-	photo, err := h.photoService.GetPhoto(c.Context(), photoID)
+	photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Photo not found: " + err.Error(),
-		})
+		return err
 	}
 
-	// Check if user has permission to view this photo
+	// Check if user has permission to view this photo, either as the owner or
+	// through a share on the photo or on an album containing it
 	userID := c.Locals("userID").(string)
-	if photo.UserID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You don't have permission to view this photo",
-		})
+	allowed, err := h.sharingService.HasPermission(c.UserContext(), photoID, userID, services.PermissionView)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return permissionDenied("You don't have permission to view this photo")
+	}
+
+	// Serve the description and tags in the caller's preferred language
+	if err := h.photoService.LocalizePhotos(c.UserContext(), []*models.Photo{photo}, preferredLanguages(c)); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentLanguage, photo.Language)
+	c.Vary(fiber.HeaderAcceptLanguage)
+
+	if photo.TagDetails, err = h.tagService.PhotoTags(c.UserContext(), photoID); err != nil {
+		return err
 	}
 
 	return c.JSON(photo)
 }
 
-// ListPhotos handles listing photos with pagination
+// ListPhotos handles listing photos with filtering, sorting and pagination.
+// See parsePhotoQuery for the supported query parameters.
 func (h *PhotoHandler) ListPhotos(c *fiber.Ctx) error {
-	// Get pagination parameters
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 20)
+	query, err := parsePhotoQuery(c)
+	if err != nil {
+		return err
+	}
 
 	// Get user ID from context
-	userID := c.Locals("userID").(string)
+	query.UserID = c.Locals("userID").(string)
 
 	// Get photos from service
-	photos, total, err := h.photoService.ListPhotos(c.Context(), userID, page, limit)
+	page, err := h.photoService.ListPhotos(c.UserContext(), query)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch photos: " + err.Error(),
-		})
+		return err
 	}
 
-	return c.JSON(fiber.Map{
-		"data":  photos,
-		"total": total,
-		"page":  page,
-		"limit": limit,
-	})
+	if err := h.photoService.LocalizePhotos(c.UserContext(), page.Photos, preferredLanguages(c)); err != nil {
+		return err
+	}
+	c.Vary(fiber.HeaderAcceptLanguage)
+
+	return c.JSON(photoPageResponse(page))
 }
 
 // UpdatePhoto handles updating a photo's metadata
 func (h *PhotoHandler) UpdatePhoto(c *fiber.Ctx) error {
 	photoID := c.Params("id")
 	if photoID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Photo ID is required",
-		})
+		return invalidRequest("Photo ID is required")
+	}
+
+	// First get the photo to verify ownership
+	photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
+	if err != nil {
+		return err
+	}
+
+	// Verify ownership
+	userID := c.Locals("userID").(string)
+	if photo.UserID != userID {
+		return permissionDenied("You don't have permission to update this photo")
 	}
 
 	// Parse request body
 	var updates map[string]interface{}
 	if err := c.BodyParser(&updates); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body: " + err.Error(),
-		})
+		return invalidBody(err)
 	}
 
 	// Update photo
-	photo, err := h.photoService.UpdatePhoto(c.Context(), photoID, updates)
+	before := photo
+	photo, err = h.photoService.UpdatePhoto(c.UserContext(), photoID, updates)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update photo: " + err.Error(),
-		})
+		return err
 	}
 
-	// Verify ownership
-	userID := c.Locals("userID").(string)
-	if photo.UserID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You don't have permission to update this photo",
-		})
-	}
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoUpdate,
+		TargetType: "photo",
+		TargetID:   photoID,
+	}, before, photo)
 
 	return c.JSON(photo)
 }
 
-// DeletePhoto handles deleting a photo
+// DeletePhoto moves a photo to the trash, from where it can be restored until
+// the retention period has passed
+// @Summary Delete a photo
+// @Tags photos
+// @Param id path string true "Photo ID"
+// @Success 204
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /photos/{id} [delete]
 func (h *PhotoHandler) DeletePhoto(c *fiber.Ctx) error {
 	photoID := c.Params("id")
 	if photoID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Photo ID is required",
-		})
+		return invalidRequest("Photo ID is required")
 	}
 
 	// First get the photo to verify ownership
-	photo, err := h.photoService.GetPhoto(c.Context(), photoID)
+	photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Photo not found: " + err.Error(),
-		})
+		return err
 	}
 
 	// Verify ownership
 	userID := c.Locals("userID").(string)
 	if photo.UserID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You don't have permission to delete this photo",
-		})
+		return permissionDenied("You don't have permission to delete this photo")
 	}
 
-	// Delete the photo
-	err = h.photoService.DeletePhoto(c.Context(), photoID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete photo: " + err.Error(),
-		})
+	// Move the photo to the trash
+	if err := h.photoService.DeletePhoto(c.UserContext(), photoID); err != nil {
+		return err
 	}
 
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoDelete,
+		TargetType: "photo",
+		TargetID:   photoID,
+	}, photo, nil)
+
 	return c.Status(fiber.StatusNoContent).Send(nil)
 }
 
@@ -170,36 +206,32 @@ func (h *PhotoHandler) DeletePhoto(c *fiber.Ctx) error {
 func (h *PhotoHandler) GetThumbnail(c *fiber.Ctx) error {
 	photoID := c.Params("id")
 	if photoID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Photo ID is required",
-		})
+		return invalidRequest("Photo ID is required")
 	}
 
 	// First get the photo to verify ownership
-	photo, err := h.photoService.GetPhoto(c.Context(), photoID)
+	photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Photo not found: " + err.Error(),
-		})
+		return err
 	}
 
-	// Verify ownership
+	// Verify the user may view the photo
 	userID := c.Locals("userID").(string)
-	if photo.UserID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You don't have permission to view this thumbnail",
-		})
+	allowed, err := h.sharingService.HasPermission(c.UserContext(), photo.ID, userID, services.PermissionView)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return permissionDenied("You don't have permission to view this thumbnail")
 	}
 
 	// Get size parameter (optional, default to medium)
 	size := c.Query("size", "medium")
 
 	// Get thumbnail data
-	data, contentType, err := h.photoService.GetThumbnail(c.Context(), photoID, size)
+	data, contentType, err := h.photoService.GetThumbnail(c.UserContext(), photoID, size)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get thumbnail: " + err.Error(),
-		})
+		return err
 	}
 
 	// Set content type and send the image data
@@ -207,54 +239,122 @@ func (h *PhotoHandler) GetThumbnail(c *fiber.Ctx) error {
 	return c.Send(data)
 }
 
+// DownloadPhoto streams a photo's original. It supports resumable downloads
+// (Range), conditional requests against the content hash (ETag) and counts
+// each download once.
+// @Summary Download a photo
+// @Tags photos
+// @Param id path string true "Photo ID"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Success 200
+// @Success 206
+// @Success 304
+// @Failure 403 {object} problem.Problem
+// @Failure 416
+// @Router /photos/{id}/download [get]
+func (h *PhotoHandler) DownloadPhoto(c *fiber.Ctx) error {
+	photoID := c.Params("id")
+
+	photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
+	if err != nil {
+		return err
+	}
+
+	// Verify the user may download the photo
+	userID := c.Locals("userID").(string)
+	allowed, err := h.sharingService.HasPermission(c.UserContext(), photo.ID, userID, services.PermissionDownload)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return permissionDenied("You don't have permission to download this photo")
+	}
+
+	obj, err := h.photoService.OpenOriginal(c.UserContext(), photo)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	fromStart, err := sendContent(c, content{
+		Object:      obj,
+		Name:        photo.OriginalName,
+		ContentType: photo.MimeType,
+		ETag:        photo.Hash,
+		Attachment:  true,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Resumed ranges are part of a download that was already counted
+	if fromStart && c.Method() == fiber.MethodGet {
+		if err := h.photoService.RecordDownload(c.UserContext(), photo.ID); err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to record download", "photo_id", photo.ID, logging.Err(err))
+		}
+	}
+
+	return nil
+}
+
 // UpdateDescription updates a photo's description
 func (h *PhotoHandler) UpdateDescription(c *fiber.Ctx) error {
 	photoID := c.Params("id")
 	if photoID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Photo ID is required",
-		})
+		return invalidRequest("Photo ID is required")
 	}
 
 	// First get the photo to verify ownership
-	photo, err := h.photoService.GetPhoto(c.Context(), photoID)
+	photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Photo not found: " + err.Error(),
-		})
+		return err
 	}
 
 	// Verify ownership
 	userID := c.Locals("userID").(string)
 	if photo.UserID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You don't have permission to update this photo's description",
-		})
+		return permissionDenied("You don't have permission to update this photo's description")
 	}
 
-	// Parse request body
+	// Parse request body. Omitted fields are left unchanged. Language defaults
+	// to the service's default language; translate_to machine-translates the
+	// new text into further languages.
 	var request struct {
-		Description string `json:"description"`
+		Description *string  `json:"description"`
+		Tags        *string  `json:"tags"`
+		Language    string   `json:"language"`
+		TranslateTo []string `json:"translate_to"`
 	}
 	if err := c.BodyParser(&request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body: " + err.Error(),
-		})
+		return invalidBody(err)
 	}
 
-	// Update the description
-	updates := map[string]interface{}{
-		"description": request.Description,
+	language := h.photoService.DefaultLanguage()
+	if request.Language != "" {
+		if language = utils.NormalizeLanguageTag(request.Language); language == "" {
+			return fmt.Errorf("%w: %q", utils.ErrInvalidLanguage, request.Language)
+		}
 	}
 
-	// Update the photo
-	updatedPhoto, err := h.photoService.UpdatePhoto(c.Context(), photoID, updates)
+	// Update the description
+	updatedPhoto, err := h.photoService.UpdateDescription(c.UserContext(), photoID, language, request.Description, request.Tags, "user")
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update description: " + err.Error(),
-		})
+		return err
 	}
 
+	if len(request.TranslateTo) > 0 {
+		if err := translateAndStore(c.UserContext(), h.photoService, h.descriptionService, photoID, language, request.Description, request.Tags, request.TranslateTo); err != nil {
+			return err
+		}
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoUpdate,
+		TargetType: "photo",
+		TargetID:   photoID,
+	}, photo, updatedPhoto)
+
+	c.Set(fiber.HeaderContentLanguage, updatedPhoto.Language)
 	return c.JSON(updatedPhoto)
 }
 
@@ -262,50 +362,61 @@ func (h *PhotoHandler) UpdateDescription(c *fiber.Ctx) error {
 func (h *PhotoHandler) GenerateDescription(c *fiber.Ctx) error {
 	photoID := c.Params("id")
 	if photoID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Photo ID is required",
-		})
+		return invalidRequest("Photo ID is required")
 	}
 
 	// First get the photo to verify ownership
-	photo, err := h.photoService.GetPhoto(c.Context(), photoID)
+	photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Photo not found: " + err.Error(),
-		})
+		return err
 	}
 
 	// Verify ownership
 	userID := c.Locals("userID").(string)
 	if photo.UserID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You don't have permission to generate a description for this photo",
-		})
+		return permissionDenied("You don't have permission to generate a description for this photo")
 	}
 
-	// Generate the description
-	description, err := h.photoService.GenerateDescription(c.Context(), photoID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate description: " + err.Error(),
-		})
+	// Languages to generate, e.g. ?languages=en,de,pl (default language only if empty)
+	var languages []string
+	for _, lang := range strings.Split(c.Query("languages"), ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			languages = append(languages, lang)
+		}
 	}
 
-	// Update the photo with the generated description
-	updates := map[string]interface{}{
-		"description": description,
+	// Generate the description and translate it into the requested languages
+	descriptions, err := h.descriptionService.Describe(c.UserContext(), photo, languages)
+	if err != nil {
+		return err
 	}
 
-	_, err = h.photoService.UpdatePhoto(c.Context(), photoID, updates)
-	if err != nil {
-		// Log the error but don't fail the request
-		// since we still want to return the generated description
-		// Consider using a background job for this in production
-		// log.Printf("Failed to update photo with generated description: %v", err)
+	// Update the photo with the generated descriptions
+	for lang, description := range descriptions {
+		description := description
+		source := "machine"
+		if lang == h.photoService.DefaultLanguage() {
+			source = "ai"
+		}
+
+		_, err = h.photoService.UpdateDescription(c.UserContext(), photoID, lang, &description, nil, source)
+		if err != nil {
+			// Log the error but don't fail the request
+			// since we still want to return the generated description
+			logging.FromContext(c.UserContext()).Error("Failed to update photo with generated description",
+				"photo_id", photoID, "language", lang, logging.Err(err))
+		}
 	}
 
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoUpdate,
+		TargetType: "photo",
+		TargetID:   photoID,
+	}, nil, fiber.Map{"generated_descriptions": descriptions})
+
 	return c.JSON(fiber.Map{
-		"description": description,
+		"description":  descriptions[h.photoService.DefaultLanguage()],
+		"descriptions": descriptions,
 	})
 }
 
@@ -313,33 +424,25 @@ func (h *PhotoHandler) GenerateDescription(c *fiber.Ctx) error {
 func (h *PhotoHandler) GetSharedWith(c *fiber.Ctx) error {
 	photoID := c.Params("id")
 	if photoID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Photo ID is required",
-		})
+		return invalidRequest("Photo ID is required")
 	}
 
 	// First get the photo to verify ownership
-	photo, err := h.photoService.GetPhoto(c.Context(), photoID)
+	photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Photo not found: " + err.Error(),
-		})
+		return err
 	}
 
 	// Verify ownership
 	userID := c.Locals("userID").(string)
 	if photo.UserID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You don't have permission to view sharing information for this photo",
-		})
+		return permissionDenied("You don't have permission to view sharing information for this photo")
 	}
 
 	// Get the list of users the photo is shared with
-	users, err := h.photoService.GetSharedWith(c.Context(), photoID)
+	users, err := h.photoService.GetSharedWith(c.UserContext(), photoID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get shared users: " + err.Error(),
-		})
+		return err
 	}
 
 	return c.JSON(fiber.Map{
@@ -348,6 +451,69 @@ func (h *PhotoHandler) GetSharedWith(c *fiber.Ctx) error {
 	})
 }
 
+// GetTranslations lists a photo's descriptions and tags in every stored language
+func (h *PhotoHandler) GetTranslations(c *fiber.Ctx) error {
+	photoID := c.Params("id")
+	if photoID == "" {
+		return invalidRequest("Photo ID is required")
+	}
+
+	// First get the photo to verify ownership
+	photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
+	if err != nil {
+		return err
+	}
+
+	// Verify ownership
+	userID := c.Locals("userID").(string)
+	if photo.UserID != userID {
+		return permissionDenied("You don't have permission to view this photo")
+	}
+
+	translations, err := h.photoService.ListTranslations(c.UserContext(), photoID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"photo_id":         photoID,
+		"default_language": h.photoService.DefaultLanguage(),
+		"translations":     translations,
+	})
+}
+
+// DeleteTranslation removes a photo's description and tags in one language
+func (h *PhotoHandler) DeleteTranslation(c *fiber.Ctx) error {
+	photoID := c.Params("id")
+	if photoID == "" {
+		return invalidRequest("Photo ID is required")
+	}
+
+	// First get the photo to verify ownership
+	photo, err := h.photoService.GetPhoto(c.UserContext(), photoID)
+	if err != nil {
+		return err
+	}
+
+	// Verify ownership
+	userID := c.Locals("userID").(string)
+	if photo.UserID != userID {
+		return permissionDenied("You don't have permission to update this photo's description")
+	}
+
+	if err := h.photoService.DeleteTranslation(c.UserContext(), photoID, c.Params("lang")); err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoUpdate,
+		TargetType: "photo",
+		TargetID:   photoID,
+	}, fiber.Map{"translation": c.Params("lang")}, fiber.Map{"translation": nil})
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
 // RegisterRoutes registers photo-related routes
 func (h *PhotoHandler) RegisterRoutes(router fiber.Router) {
 	photoGroup := router.Group("/photos")
@@ -369,12 +535,21 @@ func (h *PhotoHandler) RegisterRoutes(router fiber.Router) {
 		
 		// Get a photo's thumbnail
 		photoGroup.Get("/:id/thumbnail", h.GetThumbnail)
+
+		// Download a photo's original
+		photoGroup.Get("/:id/download", h.DownloadPhoto)
 		
 		// Update a photo's description
 		photoGroup.Put("/:id/description", h.UpdateDescription)
 		
 		// Generate an AI description for a photo
 		photoGroup.Post("/:id/generate-description", h.GenerateDescription)
+
+		// Add or remove tags across many photos (see TagHandler)
+
+		// List or remove a photo's translated descriptions and tags
+		photoGroup.Get("/:id/translations", h.GetTranslations)
+		photoGroup.Delete("/:id/translations/:lang", h.DeleteTranslation)
 		
 		// Get the list of users a photo is shared with
 		photoGroup.Get("/:id/shared-with", h.GetSharedWith)
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// SearchHandler handles photo search requests
+type SearchHandler struct {
+	searchService *services.SearchService
+	photoService  *services.PhotoService
+}
+
+// NewSearchHandler creates a new SearchHandler
+func NewSearchHandler(searchService *services.SearchService, photoService *services.PhotoService) *SearchHandler {
+	return &SearchHandler{
+		searchService: searchService,
+		photoService:  photoService,
+	}
+}
+
+// SearchPhotos performs a full-text search over the user's photos
+// @Summary Search photos
+// @Description Full-text search over name, descriptions, tags, camera and location.
+// @Description Supports "phrases", prefix*, field:value (name, description, ai, tags, camera, location), -exclusions and OR.
+// @Tags photos
+// @Produce json
+// @Param q query string true "Search query"
+// @Param page query int false "Page number"
+// @Param limit query int false "Results per page"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 501 {object} problem.Problem
+// @Router /photos/search [get]
+func (h *SearchHandler) SearchPhotos(c *fiber.Ctx) error {
+	query := c.Query("q")
+	if query == "" {
+		return invalidRequest("Search query 'q' is required")
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	userID := c.Locals("userID").(string)
+
+	results, total, err := h.searchService.SearchPhotos(c.UserContext(), userID, query, page, limit)
+	if err != nil {
+		return err
+	}
+
+	photos := make([]*models.Photo, len(results))
+	for i, result := range results {
+		photos[i] = result.Photo
+	}
+	if err := h.photoService.LocalizePhotos(c.UserContext(), photos, preferredLanguages(c)); err != nil {
+		return err
+	}
+	c.Vary(fiber.HeaderAcceptLanguage)
+
+	return c.JSON(fiber.Map{
+		"data":  results,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+		"query": query,
+	})
+}
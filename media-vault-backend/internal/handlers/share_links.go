@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// shareLinkPasswordHeader carries the password of a protected share link
+const shareLinkPasswordHeader = "X-Share-Password"
+
+// ShareLinkHandler manages anonymous share links and serves them publicly
+type ShareLinkHandler struct {
+	sharingService *services.SharingService
+	photoService   *services.PhotoService
+	albumService   *services.AlbumService
+	auditService   *services.AuditService
+}
+
+// NewShareLinkHandler creates a new ShareLinkHandler
+func NewShareLinkHandler(sharingService *services.SharingService, photoService *services.PhotoService, albumService *services.AlbumService, auditService *services.AuditService) *ShareLinkHandler {
+	return &ShareLinkHandler{
+		sharingService: sharingService,
+		photoService:   photoService,
+		albumService:   albumService,
+		auditService:   auditService,
+	}
+}
+
+// CreateShareLink creates an anonymous link to a photo or album
+// @Summary Create a share link
+// @Description Create an unguessable link to a photo or album, optionally protected by a password, an expiry and view/download limits. The token is only returned once.
+// @Tags sharing
+// @Accept json
+// @Produce json
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Router /share-links [post]
+func (h *ShareLinkHandler) CreateShareLink(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var request struct {
+		PhotoID      string     `json:"photo_id"`
+		AlbumID      string     `json:"album_id"`
+		Permission   string     `json:"permission"`
+		Password     string     `json:"password"`
+		ExpiresAt    *time.Time `json:"expires_at"`
+		MaxViews     *int       `json:"max_views"`
+		MaxDownloads *int       `json:"max_downloads"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	// Only the owner, or the partner who delivered a photo, may share it
+	switch {
+	case request.PhotoID != "" && request.AlbumID == "":
+		photo, err := h.photoService.GetPhoto(c.UserContext(), request.PhotoID)
+		if err != nil || (photo.UserID != userID && (photo.PartnerID == nil || *photo.PartnerID != userID)) {
+			return services.ErrPhotoNotFound
+		}
+	case request.AlbumID != "" && request.PhotoID == "":
+		album, err := h.albumService.GetAlbum(c.UserContext(), request.AlbumID)
+		if err != nil || album.UserID != userID {
+			return services.ErrAlbumNotFound
+		}
+	default:
+		return invalidRequest("Exactly one of photo_id and album_id is required")
+	}
+
+	link := &services.ShareLink{
+		PhotoID:      request.PhotoID,
+		AlbumID:      request.AlbumID,
+		CreatedBy:    userID,
+		Permission:   request.Permission,
+		ExpiresAt:    request.ExpiresAt,
+		MaxViews:     request.MaxViews,
+		MaxDownloads: request.MaxDownloads,
+	}
+	if err := h.sharingService.CreateShareLink(c.UserContext(), link, request.Password); err != nil {
+		return err
+	}
+
+	// The token grants access, so it is kept out of the audit log
+	audited := *link
+	audited.Token = ""
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditShareLinkCreate,
+		TargetType: "share_link",
+		TargetID:   link.ID,
+	}, nil, audited)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"link": link,
+		"url":  c.BaseURL() + "/s/" + link.Token,
+	})
+}
+
+// ListShareLinks lists the caller's share links
+// @Summary List share links
+// @Tags sharing
+// @Produce json
+// @Param photo_id query string false "Only links to this photo"
+// @Param album_id query string false "Only links to this album"
+// @Success 200 {object} map[string]interface{}
+// @Router /share-links [get]
+func (h *ShareLinkHandler) ListShareLinks(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	links, err := h.sharingService.ListShareLinks(c.UserContext(), userID, c.Query("photo_id"), c.Query("album_id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  links,
+		"total": len(links),
+	})
+}
+
+// GetShareLink returns one of the caller's share links with its counters
+// @Summary Get a share link
+// @Tags sharing
+// @Produce json
+// @Param id path string true "Share link ID"
+// @Success 200 {object} services.ShareLink
+// @Router /share-links/{id} [get]
+func (h *ShareLinkHandler) GetShareLink(c *fiber.Ctx) error {
+	link, err := h.ownedShareLink(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(link)
+}
+
+// RevokeShareLink disables a share link
+// @Summary Revoke a share link
+// @Tags sharing
+// @Param id path string true "Share link ID"
+// @Success 204
+// @Router /share-links/{id} [delete]
+func (h *ShareLinkHandler) RevokeShareLink(c *fiber.Ctx) error {
+	link, err := h.ownedShareLink(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.sharingService.RevokeShareLink(c.UserContext(), link.ID); err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditShareLinkRevoke,
+		TargetType: "share_link",
+		TargetID:   link.ID,
+	}, link, nil)
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// OpenShareLink serves a share link without authentication. Photo links
+// return the image (as an attachment with ?download=1); album links return
+// the album and a page of its photos. Every album page and every photo served
+// from its first byte counts as an access; resumed ranges and 304s do not.
+// Passwords are sent in the X-Share-Password header or, for POST, as the
+// password form field.
+// @Summary Open a share link
+// @Tags sharing
+// @Param token path string true "Share link token"
+// @Param download query bool false "Download the photo instead of viewing it"
+// @Success 200
+// @Failure 401 {object} problem.Problem
+// @Failure 410 {object} problem.Problem
+// @Router /s/{token} [get]
+func (h *ShareLinkHandler) OpenShareLink(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	access := shareLinkAccess(c)
+	link, err := h.sharingService.ResolveShareLink(c.UserContext(), c.Params("token"), shareLinkPassword(c), access)
+	if err != nil {
+		return err
+	}
+
+	if link.PhotoID != "" {
+		photo, err := h.photoService.GetPhoto(c.UserContext(), link.PhotoID)
+		if err != nil {
+			return services.ErrPhotoNotFound
+		}
+		return h.sendPhoto(c, link, photo, access)
+	}
+
+	if access == services.AccessDownload {
+		return invalidRequest("Albums are downloaded photo by photo")
+	}
+
+	album, err := h.albumService.GetAlbum(c.UserContext(), link.AlbumID)
+	if err != nil {
+		return services.ErrAlbumNotFound
+	}
+	page, err := h.albumService.AlbumPhotos(c.UserContext(), album, c.QueryInt("page", 1), c.QueryInt("limit", services.DefaultPageSize))
+	if err != nil {
+		return err
+	}
+	if err := h.photoService.LocalizePhotos(c.UserContext(), page.Photos, preferredLanguages(c)); err != nil {
+		return err
+	}
+	if err := h.sharingService.RecordShareLinkAccess(c.UserContext(), link, access); err != nil {
+		return err
+	}
+	c.Vary(fiber.HeaderAcceptLanguage)
+
+	photos := make([]fiber.Map, len(page.Photos))
+	for i, photo := range page.Photos {
+		photos[i] = publicPhoto(photo, c.BaseURL()+"/s/"+c.Params("token")+"/photos/"+photo.ID)
+	}
+
+	children := make([]fiber.Map, len(album.Children))
+	for i, child := range album.Children {
+		children[i] = fiber.Map{"id": child.ID, "title": child.Title, "photo_count": child.PhotoCount}
+	}
+
+	return c.JSON(fiber.Map{
+		"album": fiber.Map{
+			"id":          album.ID,
+			"title":       album.Title,
+			"description": album.Description,
+			"photo_count": album.PhotoCount,
+			"children":    children,
+		},
+		"data":       photos,
+		"total":      page.Total,
+		"page":       page.Page,
+		"limit":      page.Limit,
+		"permission": link.Permission,
+		"expires_at": link.ExpiresAt,
+	})
+}
+
+// OpenShareLinkPhoto serves one photo of a shared album
+// @Summary Open a photo of a shared album
+// @Tags sharing
+// @Param token path string true "Share link token"
+// @Param photoId path string true "Photo ID"
+// @Param download query bool false "Download the photo instead of viewing it"
+// @Success 200
+// @Router /s/{token}/photos/{photoId} [get]
+func (h *ShareLinkHandler) OpenShareLinkPhoto(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	access := shareLinkAccess(c)
+	link, err := h.sharingService.ResolveShareLink(c.UserContext(), c.Params("token"), shareLinkPassword(c), access)
+	if err != nil {
+		return err
+	}
+
+	notFound := func() error {
+		return services.ErrPhotoNotFound
+	}
+	if link.AlbumID == "" {
+		if link.PhotoID != c.Params("photoId") {
+			return notFound()
+		}
+	} else {
+		album, err := h.albumService.GetAlbum(c.UserContext(), link.AlbumID)
+		if err != nil {
+			return notFound()
+		}
+		ok, err := h.albumService.ContainsPhoto(c.UserContext(), album, c.Params("photoId"))
+		if err != nil || !ok {
+			return notFound()
+		}
+	}
+
+	photo, err := h.photoService.GetPhoto(c.UserContext(), c.Params("photoId"))
+	if err != nil {
+		return notFound()
+	}
+
+	return h.sendPhoto(c, link, photo, access)
+}
+
+// sendPhoto streams a photo's original inline or as an attachment. Only
+// responses from the first byte count against the link's limits: resumed
+// ranges and 304s are part of an access that was already counted.
+func (h *ShareLinkHandler) sendPhoto(c *fiber.Ctx, link *services.ShareLink, photo *models.Photo, access string) error {
+	obj, err := h.photoService.OpenOriginal(c.UserContext(), photo)
+	if err != nil {
+		return err
+	}
+
+	f := content{
+		Object:      obj,
+		Name:        photo.OriginalName,
+		ContentType: photo.MimeType,
+		ETag:        photo.Hash,
+		Attachment:  access == services.AccessDownload,
+	}
+	if c.Method() != fiber.MethodHead {
+		f.Count = func() error {
+			return h.sharingService.RecordShareLinkAccess(c.UserContext(), link, access)
+		}
+	}
+	_, err = sendContent(c, f)
+	return err
+}
+
+// ownedShareLink loads the share link named in the path if the caller created it
+func (h *ShareLinkHandler) ownedShareLink(c *fiber.Ctx) (*services.ShareLink, error) {
+	link, err := h.sharingService.GetShareLink(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return nil, err
+	}
+	if link.CreatedBy != c.Locals("userID").(string) {
+		return nil, services.ErrShareLinkNotFound
+	}
+	return link, nil
+}
+
+// publicPhoto is the subset of a photo exposed through share links
+func publicPhoto(photo *models.Photo, url string) fiber.Map {
+	return fiber.Map{
+		"id":            photo.ID,
+		"original_name": photo.OriginalName,
+		"mime_type":     photo.MimeType,
+		"file_size":     photo.FileSize,
+		"width":         photo.Width,
+		"height":        photo.Height,
+		"description":   photo.Description,
+		"tags":          photo.Tags,
+		"taken_at":      photo.TakenAt,
+		"language":      photo.Language,
+		"url":           url,
+	}
+}
+
+func shareLinkAccess(c *fiber.Ctx) string {
+	if c.QueryBool("download") {
+		return services.AccessDownload
+	}
+	return services.AccessView
+}
+
+func shareLinkPassword(c *fiber.Ctx) string {
+	if password := c.Get(shareLinkPasswordHeader); password != "" {
+		return password
+	}
+	if c.Method() == fiber.MethodPost {
+		var body struct {
+			Password string `json:"password" form:"password"`
+		}
+		if err := c.BodyParser(&body); err == nil {
+			return body.Password
+		}
+	}
+	return ""
+}
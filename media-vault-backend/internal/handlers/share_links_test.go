@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/wronai/media-vault-backend/internal/database"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/problem"
+	"github.com/wronai/media-vault-backend/internal/services"
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+// shareLinkTest serves share links as the API does, over a fresh database
+type shareLinkTest struct {
+	app     *fiber.App
+	db      *sql.DB
+	photos  *services.PhotoService
+	sharing *services.SharingService
+	albums  *services.AlbumService
+}
+
+func newShareLinkTest(t *testing.T) *shareLinkTest {
+	t.Helper()
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := &shareLinkTest{db: db, sharing: services.NewSharingService(db)}
+	st.photos = services.NewPhotoService(db, store, "en")
+	st.albums = services.NewAlbumService(db, st.photos)
+	h := NewShareLinkHandler(st.sharing, st.photos, st.albums, nil)
+
+	st.app = fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	st.app.Get("/s/:token", h.OpenShareLink)
+	st.app.Post("/s/:token", h.OpenShareLink)
+	st.app.Get("/s/:token/photos/:photoId", h.OpenShareLinkPhoto)
+	return st
+}
+
+// upload uploads a small PNG owned by userID
+func (st *shareLinkTest) upload(t *testing.T, userID string) *models.Photo {
+	t.Helper()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="photo.png"`)
+	header.Set("Content-Type", "image/png")
+	part, err := w.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(img.Bytes())
+	w.Close()
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	photo, err := st.photos.UploadPhoto(context.Background(), userID, form.File["file"][0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return photo
+}
+
+// link creates a share link and returns its token
+func (st *shareLinkTest) link(t *testing.T, link *services.ShareLink, password string) string {
+	t.Helper()
+	if link.CreatedBy == "" {
+		link.CreatedBy = "u1"
+	}
+	if err := st.sharing.CreateShareLink(context.Background(), link, password); err != nil {
+		t.Fatal(err)
+	}
+	return link.Token
+}
+
+func (st *shareLinkTest) do(t *testing.T, req *http.Request) *http.Response {
+	t.Helper()
+	resp, err := st.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// status sends req and returns the status and, for errors, the problem code
+func (st *shareLinkTest) status(t *testing.T, req *http.Request) (int, string) {
+	t.Helper()
+	resp := st.do(t, req)
+	var body struct {
+		Code string `json:"code"`
+	}
+	if resp.StatusCode >= 400 {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("%s %s: %d without a problem body: %v", req.Method, req.URL, resp.StatusCode, err)
+		}
+	}
+	return resp.StatusCode, body.Code
+}
+
+func get(path string, headers ...string) *http.Request {
+	req := httptest.NewRequest(fiber.MethodGet, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return req
+}
+
+func TestShareLinkPassword(t *testing.T) {
+	st := newShareLinkTest(t)
+	photo := st.upload(t, "u1")
+	link := &services.ShareLink{PhotoID: photo.ID}
+	token := st.link(t, link, "open sesame")
+
+	form := func(body string) *http.Request {
+		req := httptest.NewRequest(fiber.MethodPost, "/s/"+token, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		return req
+	}
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{"no password", get("/s/" + token), 401, services.ErrPasswordRequired.Code},
+		{"wrong password", get("/s/"+token, shareLinkPasswordHeader, "open barley"), 401, services.ErrPasswordRequired.Code},
+		{"password header", get("/s/"+token, shareLinkPasswordHeader, "open sesame"), 200, ""},
+		{"password form", form("password=open+sesame"), 200, ""},
+		{"wrong password form", form("password=sesame"), 401, services.ErrPasswordRequired.Code},
+		{"photo path without password", get("/s/" + token + "/photos/" + photo.ID), 401, services.ErrPasswordRequired.Code},
+		{"photo path with password", get("/s/"+token+"/photos/"+photo.ID, shareLinkPasswordHeader, "open sesame"), 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, code := st.status(t, tt.req); status != tt.status || code != tt.code {
+				t.Errorf("got %d %q, want %d %q", status, code, tt.status, tt.code)
+			}
+		})
+	}
+
+	// Only served accesses count
+	link, err := st.sharing.GetShareLink(context.Background(), link.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.ViewCount != 3 {
+		t.Errorf("view count = %d, want 3", link.ViewCount)
+	}
+}
+
+func TestShareLinkExpiryAndRevocation(t *testing.T) {
+	st := newShareLinkTest(t)
+	photo := st.upload(t, "u1")
+	tomorrow := time.Now().Add(24 * time.Hour)
+	expiring := &services.ShareLink{PhotoID: photo.ID, ExpiresAt: &tomorrow}
+	expiringToken := st.link(t, expiring, "")
+	revoked := &services.ShareLink{PhotoID: photo.ID}
+	revokedToken := st.link(t, revoked, "")
+
+	for _, token := range []string{expiringToken, revokedToken} {
+		if status, _ := st.status(t, get("/s/"+token)); status != fiber.StatusOK {
+			t.Fatalf("status before expiry = %d, want 200", status)
+		}
+	}
+
+	if _, err := st.db.Exec(`UPDATE share_links SET expires_at = ? WHERE id = ?`, time.Now().UTC().Add(-time.Second), expiring.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.sharing.RevokeShareLink(context.Background(), revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"expired", get("/s/" + expiringToken)},
+		{"expired photo", get("/s/" + expiringToken + "/photos/" + photo.ID)},
+		{"revoked", get("/s/" + revokedToken)},
+		// A resumed download is no exception
+		{"revoked resume", get("/s/"+revokedToken, fiber.HeaderRange, "bytes=10-")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, code := st.status(t, tt.req); status != fiber.StatusGone || code != services.ErrShareLinkGone.Code {
+				t.Errorf("got %d %q, want 410 %q", status, code, services.ErrShareLinkGone.Code)
+			}
+		})
+	}
+
+	if status, code := st.status(t, get("/s/unknown-token")); status != fiber.StatusNotFound || code != services.ErrShareLinkNotFound.Code {
+		t.Errorf("unknown token: got %d %q, want 404 %q", status, code, services.ErrShareLinkNotFound.Code)
+	}
+}
+
+func TestShareLinkLimits(t *testing.T) {
+	st := newShareLinkTest(t)
+	photo := st.upload(t, "u1")
+	two, one := 2, 1
+
+	t.Run("views", func(t *testing.T) {
+		link := &services.ShareLink{PhotoID: photo.ID, MaxViews: &two}
+		path := "/s/" + st.link(t, link, "")
+		// HEAD and resumed ranges are not new views
+		for _, req := range []*http.Request{
+			get(path),
+			httptest.NewRequest(fiber.MethodHead, path, nil),
+			get(path, fiber.HeaderRange, "bytes=10-"),
+			get(path),
+		} {
+			if status, _ := st.status(t, req); status != fiber.StatusOK && status != fiber.StatusPartialContent {
+				t.Fatalf("%s %s: status = %d", req.Method, req.Header.Get(fiber.HeaderRange), status)
+			}
+		}
+		if status, code := st.status(t, get(path)); status != fiber.StatusGone || code != services.ErrShareLinkGone.Code {
+			t.Errorf("third view: got %d %q, want 410", status, code)
+		}
+		// Downloads have a separate counter
+		if status, code := st.status(t, get(path+"?download=1")); status != fiber.StatusForbidden || code != services.ErrDownloadNotAllowed.Code {
+			t.Errorf("download from a view link: got %d %q, want 403 %q", status, code, services.ErrDownloadNotAllowed.Code)
+		}
+	})
+
+	t.Run("downloads", func(t *testing.T) {
+		link := &services.ShareLink{PhotoID: photo.ID, Permission: services.PermissionDownload, MaxDownloads: &one}
+		path := "/s/" + st.link(t, link, "")
+		resp := st.do(t, get(path+"?download=1", fiber.HeaderRange, "bytes=0-9"))
+		if resp.StatusCode != fiber.StatusPartialContent {
+			t.Fatalf("download: status = %d, want 206", resp.StatusCode)
+		}
+		if !strings.HasPrefix(resp.Header.Get(fiber.HeaderContentDisposition), "attachment;") {
+			t.Errorf("Content-Disposition = %q, want attachment", resp.Header.Get(fiber.HeaderContentDisposition))
+		}
+		if status, _ := st.status(t, get(path+"?download=1", fiber.HeaderRange, "bytes=10-")); status != fiber.StatusPartialContent {
+			t.Errorf("resume: status = %d, want 206", status)
+		}
+		if status, code := st.status(t, get(path+"?download=1")); status != fiber.StatusGone || code != services.ErrShareLinkGone.Code {
+			t.Errorf("second download: got %d %q, want 410", status, code)
+		}
+		if status, _ := st.status(t, get(path)); status != fiber.StatusOK {
+			t.Errorf("view after the last download: status = %d, want 200", status)
+		}
+
+		link, err := st.sharing.GetShareLink(context.Background(), link.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.DownloadCount != 1 || link.ViewCount != 1 {
+			t.Errorf("counts = %d downloads, %d views, want 1 and 1", link.DownloadCount, link.ViewCount)
+		}
+	})
+
+	t.Run("album pages", func(t *testing.T) {
+		title := "Holidays"
+		album, err := st.albums.CreateAlbum(context.Background(), "u1", models.AlbumRequest{Title: &title})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := st.albums.AddPhotos(context.Background(), album, []string{photo.ID}, nil, "u1"); err != nil {
+			t.Fatal(err)
+		}
+		path := "/s/" + st.link(t, &services.ShareLink{AlbumID: album.ID, MaxViews: &one}, "")
+		if status, _ := st.status(t, get(path)); status != fiber.StatusOK {
+			t.Fatalf("album: status = %d, want 200", status)
+		}
+		if status, _ := st.status(t, get(path+"/photos/"+photo.ID)); status != fiber.StatusGone {
+			t.Errorf("photo after the last view: status = %d, want 410", status)
+		}
+		if status, _ := st.status(t, get(path)); status != fiber.StatusGone {
+			t.Errorf("album after the last view: status = %d, want 410", status)
+		}
+	})
+}
+
+func TestShareLinkServesOnlyImagesInline(t *testing.T) {
+	st := newShareLinkTest(t)
+	picture := st.upload(t, "u1")
+	// Stored before uploads were sniffed, or under a type that could run
+	html := st.upload(t, "u1")
+	svg := st.upload(t, "u1")
+	for id, mimeType := range map[string]string{html.ID: "text/html; charset=utf-8", svg.ID: "image/svg+xml"} {
+		if _, err := st.db.Exec(`UPDATE photos SET mime_type = ? WHERE id = ?`, mimeType, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		photo       *models.Photo
+		contentType string
+		disposition string
+	}{
+		{"image", picture, "image/png", "inline"},
+		{"html", html, "application/octet-stream", "attachment"},
+		{"svg", svg, "application/octet-stream", "attachment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := st.link(t, &services.ShareLink{PhotoID: tt.photo.ID}, "")
+			resp := st.do(t, httptest.NewRequest(fiber.MethodGet, "/s/"+token, nil))
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("status = %d, want 200", resp.StatusCode)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentType); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentDisposition); !strings.HasPrefix(got, tt.disposition+";") {
+				t.Errorf("Content-Disposition = %q, want %s", got, tt.disposition)
+			}
+		})
+	}
+}
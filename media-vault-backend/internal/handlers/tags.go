@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// TagHandler handles tag-related HTTP requests
+type TagHandler struct {
+	tagService   *services.TagService
+	auditService *services.AuditService
+}
+
+// NewTagHandler creates a new TagHandler
+func NewTagHandler(tagService *services.TagService, auditService *services.AuditService) *TagHandler {
+	return &TagHandler{
+		tagService:   tagService,
+		auditService: auditService,
+	}
+}
+
+// ListTags returns the user's tags with photo counts
+// @Summary List tags
+// @Description List the authenticated user's tags with the number of photos per tag (tag cloud)
+// @Tags tags
+// @Produce json
+// @Param q query string false "Slug prefix filter"
+// @Success 200 {object} map[string]interface{}
+// @Router /tags [get]
+func (h *TagHandler) ListTags(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	tags, err := h.tagService.ListTags(c.UserContext(), userID, c.Query("q"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  tags,
+		"total": len(tags),
+	})
+}
+
+// RenameTag renames a tag on all of the user's photos
+// @Summary Rename a tag
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param slug path string true "Tag slug"
+// @Success 200 {object} models.Tag
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /tags/{slug} [put]
+func (h *TagHandler) RenameTag(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	tag, err := h.tagService.RenameTag(c.UserContext(), userID, c.Params("slug"), request.Name)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditTagRename,
+		TargetType: "tag",
+		TargetID:   tag.Slug,
+	}, fiber.Map{"slug": c.Params("slug")}, fiber.Map{"slug": tag.Slug, "name": tag.Name})
+
+	return c.JSON(tag)
+}
+
+// MergeTags merges several tags into one
+// @Summary Merge tags
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param request body models.MergeTagsRequest true "Tags to merge"
+// @Success 200 {object} models.Tag
+// @Router /tags/merge [post]
+func (h *TagHandler) MergeTags(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var request models.MergeTagsRequest
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	tag, err := h.tagService.MergeTags(c.UserContext(), userID, request.Sources, request.Target)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditTagMerge,
+		TargetType: "tag",
+		TargetID:   tag.Slug,
+	}, fiber.Map{"sources": request.Sources}, fiber.Map{"target": tag.Slug})
+
+	return c.JSON(tag)
+}
+
+// DeleteTag removes a tag from all of the user's photos
+// @Summary Delete a tag
+// @Tags tags
+// @Param slug path string true "Tag slug"
+// @Success 204
+// @Router /tags/{slug} [delete]
+func (h *TagHandler) DeleteTag(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	if err := h.tagService.DeleteTag(c.UserContext(), userID, c.Params("slug")); err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditTagDelete,
+		TargetType: "tag",
+		TargetID:   c.Params("slug"),
+	}, fiber.Map{"slug": c.Params("slug")}, nil)
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// BatchTagPhotos adds and removes tags across many photos
+// @Summary Batch tag photos
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param request body models.BatchTagRequest true "Photos and tags"
+// @Success 200 {object} map[string]interface{}
+// @Router /photos/tags [post]
+func (h *TagHandler) BatchTagPhotos(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var request models.BatchTagRequest
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+
+	if len(request.PhotoIDs) == 0 || (len(request.Add) == 0 && len(request.Remove) == 0) {
+		return invalidRequest("photo_ids and at least one of add or remove are required")
+	}
+
+	updated, skipped, err := h.tagService.TagPhotos(c.UserContext(), userID, request.PhotoIDs, request.Add, request.Remove, services.TagSourceUser, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, photoID := range updated {
+		recordAudit(c, h.auditService, &services.AuditEvent{
+			Action:     services.AuditPhotoTag,
+			TargetType: "photo",
+			TargetID:   photoID,
+		}, fiber.Map{"removed_tags": request.Remove}, fiber.Map{"added_tags": request.Add})
+	}
+
+	var tagErrors []string
+	for _, photoID := range skipped {
+		tagErrors = append(tagErrors, fmt.Sprintf("Photo '%s' not found or not owned by you", photoID))
+	}
+
+	return c.JSON(fiber.Map{
+		"updated":     len(updated),
+		"photo_ids":   updated,
+		"error_count": len(tagErrors),
+		"errors":      tagErrors,
+	})
+}
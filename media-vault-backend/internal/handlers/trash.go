@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// TrashHandler handles the trash of deleted photos
+type TrashHandler struct {
+	trashService *services.TrashService
+	auditService *services.AuditService
+}
+
+// NewTrashHandler creates a new TrashHandler
+func NewTrashHandler(trashService *services.TrashService, auditService *services.AuditService) *TrashHandler {
+	return &TrashHandler{
+		trashService: trashService,
+		auditService: auditService,
+	}
+}
+
+// ListTrash lists the caller's deleted photos
+// @Summary List the trash
+// @Description List deleted photos, most recently deleted first, with the time each will be purged
+// @Tags trash
+// @Produce json
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Success 200 {object} services.TrashPage
+// @Router /trash [get]
+func (h *TrashHandler) ListTrash(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	page, err := h.trashService.ListTrash(c.UserContext(), userID, c.QueryInt("page", 1), c.QueryInt("limit", services.DefaultPageSize))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// RestorePhoto moves one photo out of the trash
+// @Summary Restore a photo
+// @Tags trash
+// @Param id path string true "Photo ID"
+// @Success 204
+// @Failure 404 {object} problem.Problem
+// @Router /trash/{id}/restore [post]
+func (h *TrashHandler) RestorePhoto(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	restored, _, err := h.trashService.RestorePhotos(c.UserContext(), userID, []string{c.Params("id")}, nil)
+	if err != nil {
+		return err
+	}
+	if len(restored) == 0 {
+		return services.ErrPhotoNotFound.WithMessage("photo not found in trash")
+	}
+	h.auditRestored(c, restored)
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// RestorePhotos moves many photos out of the trash
+// @Summary Restore photos
+// @Description Restore the listed photos, or every photo deleted at or after deleted_since to undo a bulk delete
+// @Tags trash
+// @Accept json
+// @Produce json
+// @Param request body object true "photo_ids or deleted_since"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Router /trash/restore [post]
+func (h *TrashHandler) RestorePhotos(c *fiber.Ctx) error {
+	var request struct {
+		PhotoIDs     []string   `json:"photo_ids"`
+		DeletedSince *time.Time `json:"deleted_since"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return invalidBody(err)
+	}
+	userID := c.Locals("userID").(string)
+	restored, skipped, err := h.trashService.RestorePhotos(c.UserContext(), userID, request.PhotoIDs, request.DeletedSince)
+	if err != nil {
+		return err
+	}
+	h.auditRestored(c, restored)
+
+	return c.JSON(fiber.Map{
+		"restored": restored,
+		"skipped":  skipped,
+	})
+}
+
+// DeletePhoto permanently deletes a photo in the trash
+// @Summary Delete a photo permanently
+// @Description Delete a photo in the trash and its stored files. This cannot be undone.
+// @Tags trash
+// @Param id path string true "Photo ID"
+// @Success 204
+// @Failure 404 {object} problem.Problem
+// @Router /trash/{id} [delete]
+func (h *TrashHandler) DeletePhoto(c *fiber.Ctx) error {
+	photo, err := h.trashService.GetTrashedPhoto(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	// Other users' trash looks empty rather than forbidden
+	if photo.UserID != c.Locals("userID").(string) {
+		return services.ErrPhotoNotFound.WithMessage("photo not found in trash")
+	}
+
+	if err := h.trashService.PurgePhoto(c.UserContext(), photo.ID); err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoPurge,
+		TargetType: "photo",
+		TargetID:   photo.ID,
+	}, photo, nil)
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// EmptyTrash permanently deletes every photo in the caller's trash
+// @Summary Empty the trash
+// @Tags trash
+// @Produce json
+// @Success 200 {object} map[string]int
+// @Router /trash [delete]
+func (h *TrashHandler) EmptyTrash(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	deleted, err := h.trashService.EmptyTrash(c.UserContext(), userID)
+	if deleted > 0 {
+		recordAudit(c, h.auditService, &services.AuditEvent{
+			Action:     services.AuditPhotoPurge,
+			TargetType: "trash",
+			TargetID:   userID,
+		}, nil, fiber.Map{"deleted": deleted})
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"deleted": deleted})
+}
+
+// auditRestored records the restore of each photo
+func (h *TrashHandler) auditRestored(c *fiber.Ctx, photoIDs []string) {
+	for _, photoID := range photoIDs {
+		recordAudit(c, h.auditService, &services.AuditEvent{
+			Action:     services.AuditPhotoRestore,
+			TargetType: "photo",
+			TargetID:   photoID,
+		}, nil, nil)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"mime/multipart"
 	"net/http"
@@ -8,10 +9,26 @@ import (
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/logging"
 	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/problem"
 	"github.com/wronai/media-vault-backend/internal/services"
+	"github.com/wronai/media-vault-backend/internal/utils"
 )
 
+// maxPhotoSize is the largest photo that can be uploaded
+const maxPhotoSize = 10 << 20
+
+// photoExtensions lists the file extensions accepted for photo uploads
+var photoExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
 // UploadHandler handles file uploads
 // @title Media Vault Upload Handler
 // @version 1.0
@@ -24,6 +41,7 @@ type UploadHandler struct {
 	vaultService       services.VaultService
 	photoService       services.PhotoService
 	descriptionService services.DescriptionService
+	auditService       *services.AuditService
 }
 
 // NewUploadHandler creates a new upload handler
@@ -31,11 +49,13 @@ func NewUploadHandler(
 	vaultService services.VaultService,
 	photoService services.PhotoService,
 	descriptionService services.DescriptionService,
+	auditService *services.AuditService,
 ) *UploadHandler {
 	return &UploadHandler{
 		vaultService:       vaultService,
 		photoService:       photoService,
 		descriptionService: descriptionService,
+		auditService:       auditService,
 	}
 }
 
@@ -49,9 +69,9 @@ func NewUploadHandler(
 // @Param description formData string false "File description"
 // @Param tags formData string false "Comma-separated list of tags"
 // @Success 200 {object} models.Photo
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /vault/upload [post]
 func (h *UploadHandler) UploadSingle(c *fiber.Ctx) error {
 	// Get user ID from context
@@ -60,36 +80,25 @@ func (h *UploadHandler) UploadSingle(c *fiber.Ctx) error {
 	// Check if the request contains a file
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "No file uploaded: " + err.Error(),
-		})
+		return invalidField("file", "is required")
 	}
 
 	// Get additional form data
 	description := c.FormValue("description", "")
-	tags := c.FormValue("tags", "")
+	tags, err := utils.ParseTags(c.FormValue("tags", ""))
+	if err != nil {
+		return err
+	}
 
 	// Check file size (max 10MB)
-	if fileHeader.Size > 10<<20 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "File too large. Maximum size is 10MB",
-		})
+	if fileHeader.Size > maxPhotoSize {
+		return fileTooLarge(maxPhotoSize)
 	}
 
 	// Check file type
 	ext := filepath.Ext(fileHeader.Filename)
-	allowedTypes := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
-		".webp": true,
-	}
-
-	if !allowedTypes[ext] {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid file type. Only JPG, JPEG, PNG, GIF, and WebP are allowed",
-		})
+	if !photoExtensions[ext] {
+		return photoTypeNotAllowed()
 	}
 
 	// Prepare metadata
@@ -97,18 +106,27 @@ func (h *UploadHandler) UploadSingle(c *fiber.Ctx) error {
 	if description != "" {
 		metadata["description"] = description
 	}
-	if tags != "" {
+	if len(tags) > 0 {
 		metadata["tags"] = tags
 	}
 
+	// Check the user's storage quota
+	if err := h.vaultService.CheckQuota(c.UserContext(), userID, fileHeader.Size); err != nil {
+		return err
+	}
+
 	// Upload the file
-	photo, err := h.photoService.UploadPhoto(c.Context(), userID, fileHeader, metadata)
+	photo, err := h.photoService.UploadPhoto(c.UserContext(), userID, fileHeader, metadata)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to upload file: " + err.Error(),
-		})
+		return err
 	}
 
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoUpload,
+		TargetType: "photo",
+		TargetID:   photo.ID,
+	}, nil, photo)
+
 	return c.Status(fiber.StatusCreated).JSON(photo)
 }
 
@@ -122,9 +140,9 @@ func (h *UploadHandler) UploadSingle(c *fiber.Ctx) error {
 // @Param description formData string false "Description for all files"
 // @Param tags formData string false "Comma-separated list of tags for all files"
 // @Success 200 {array} models.Photo
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /vault/upload/bulk [post]
 func (h *UploadHandler) BulkUpload(c *fiber.Ctx) error {
 	// Get user ID from context
@@ -133,30 +151,30 @@ func (h *UploadHandler) BulkUpload(c *fiber.Ctx) error {
 	// Parse the multipart form
 	form, err := c.MultipartForm()
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Failed to parse form: " + err.Error(),
-		})
+		return invalidBody(err)
 	}
 
 	// Get the files
 	files := form.File["files"]
 	if len(files) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "No files uploaded. Use the 'files' form field to upload multiple files.",
-		})
+		return invalidRequest("No files uploaded. Use the 'files' form field to upload multiple files.")
 	}
 
 	// Get additional form data
 	description := c.FormValue("description", "")
-	tags := c.FormValue("tags", "")
+	tags, err := utils.ParseTags(c.FormValue("tags", ""))
+	if err != nil {
+		return err
+	}
 
 	// Process each file
 	var uploadedPhotos []*models.Photo
 	var uploadErrors []string
+	quotaErrors := 0
 
 	for _, fileHeader := range files {
 		// Check file size (max 10MB)
-		if fileHeader.Size > 10<<20 {
+		if fileHeader.Size > maxPhotoSize {
 			errMsg := fmt.Sprintf("File '%s' is too large. Maximum size is 10MB", fileHeader.Filename)
 			uploadErrors = append(uploadErrors, errMsg)
 			continue
@@ -164,15 +182,7 @@ func (h *UploadHandler) BulkUpload(c *fiber.Ctx) error {
 
 		// Check file type
 		ext := filepath.Ext(fileHeader.Filename)
-		allowedTypes := map[string]bool{
-			".jpg":  true,
-			".jpeg": true,
-			".png":  true,
-			".gif":  true,
-			".webp": true,
-		}
-
-		if !allowedTypes[ext] {
+		if !photoExtensions[ext] {
 			errMsg := fmt.Sprintf("File '%s' has an unsupported type. Only JPG, JPEG, PNG, GIF, and WebP are allowed", fileHeader.Filename)
 			uploadErrors = append(uploadErrors, errMsg)
 			continue
@@ -183,18 +193,37 @@ func (h *UploadHandler) BulkUpload(c *fiber.Ctx) error {
 		if description != "" {
 			metadata["description"] = description
 		}
-		if tags != "" {
+		if len(tags) > 0 {
 			metadata["tags"] = tags
 		}
 
+		// Check the user's storage quota
+		if err := h.vaultService.CheckQuota(c.UserContext(), userID, fileHeader.Size); err != nil {
+			errMsg := fmt.Sprintf("File '%s' was not uploaded: %s", fileHeader.Filename, problem.From(err).Detail)
+			uploadErrors = append(uploadErrors, errMsg)
+			if errors.Is(err, services.ErrQuotaExceeded) {
+				quotaErrors++
+			}
+			continue
+		}
+
 		// Upload the file
-		photo, err := h.photoService.UploadPhoto(c.Context(), userID, fileHeader, metadata)
+		photo, err := h.photoService.UploadPhoto(c.UserContext(), userID, fileHeader, metadata)
 		if err != nil {
-			errMsg := fmt.Sprintf("Failed to upload file '%s': %v", fileHeader.Filename, err)
+			// Only the problem detail is shown; unexpected errors are logged
+			if _, ok := apperr.As(err); !ok {
+				logging.FromContext(c.UserContext()).Error("Failed to upload file", "file", fileHeader.Filename, logging.Err(err))
+			}
+			errMsg := fmt.Sprintf("Failed to upload file '%s': %s", fileHeader.Filename, problem.From(err).Detail)
 			uploadErrors = append(uploadErrors, errMsg)
 			continue
 		}
 
+		recordAudit(c, h.auditService, &services.AuditEvent{
+			Action:     services.AuditPhotoUpload,
+			TargetType: "photo",
+			TargetID:   photo.ID,
+		}, nil, photo)
 		uploadedPhotos = append(uploadedPhotos, photo)
 	}
 
@@ -204,9 +233,11 @@ func (h *UploadHandler) BulkUpload(c *fiber.Ctx) error {
 		if len(uploadErrors) > 0 {
 			errMsg = strings.Join(uploadErrors, "; ")
 		}
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": errMsg,
-		})
+		failed := errInvalidRequest
+		if quotaErrors == len(files) {
+			failed = services.ErrQuotaExceeded
+		}
+		return failed.WithMessage(errMsg)
 	}
 
 	// If there were some errors but some files were uploaded successfully
@@ -13,24 +13,35 @@ func NewVaultHandler(vaultService *services.VaultService) *VaultHandler {
     return &VaultHandler{vaultService: vaultService}
 }
 
-// GetVault returns the user's vault contents
-// @Summary Get vault contents
-// @Description Get the authenticated user's vault contents
+// GetVault returns an overview of the user's vault
+// @Summary Get vault overview
+// @Description Get the authenticated user's storage usage, quota and usage by MIME type and month
 // @Tags vault
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]string
+// @Failure 401 {object} problem.Problem
 // @Router /vault [get]
 func (h *VaultHandler) GetVault(c *fiber.Ctx) error {
 	// Get user ID from context (set by auth middleware)
 	userID := c.Locals("userID").(string)
 
-	// TODO: Implement actual vault retrieval logic
-	// For now, return a mock response
+	usage, err := h.vaultService.GetUsage(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+
 	return c.JSON(fiber.Map{
 		"user_id": userID,
-		"items":    []string{},
-		"quota":    "0/1024 MB",
+		"usage":   usage,
+		"quota":   quotaSummary(usage),
 	})
 }
+
+// quotaSummary formats usage for display, e.g. "12.5 MB / 1.0 GB"
+func quotaSummary(usage *services.StorageUsage) string {
+	if usage.QuotaBytes == services.Unlimited {
+		return services.FormatBytes(usage.UsedBytes) + " / unlimited"
+	}
+	return services.FormatBytes(usage.UsedBytes) + " / " + services.FormatBytes(usage.QuotaBytes)
+}
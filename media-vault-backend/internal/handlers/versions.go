@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/services"
+)
+
+// VersionHandler handles the version history of photo originals
+type VersionHandler struct {
+	photoService *services.PhotoService
+	vaultService *services.VaultService
+	auditService *services.AuditService
+}
+
+// NewVersionHandler creates a new VersionHandler
+func NewVersionHandler(photoService *services.PhotoService, vaultService *services.VaultService, auditService *services.AuditService) *VersionHandler {
+	return &VersionHandler{
+		photoService: photoService,
+		vaultService: vaultService,
+		auditService: auditService,
+	}
+}
+
+// ReplaceOriginal uploads a new version of a photo's original
+// @Summary Replace a photo's original
+// @Description Upload an edited original. Earlier versions are kept and renditions are regenerated. Only the owner and the partner who delivered the photo may upload versions, and only JPEG, PNG, GIF and WebP content is accepted, whatever the file name.
+// @Tags photos
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Photo ID"
+// @Param file formData file true "New original"
+// @Success 200 {object} models.Photo
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Router /photos/{id}/original [put]
+func (h *VersionHandler) ReplaceOriginal(c *fiber.Ctx) error {
+	photo, err := h.loadPhoto(c)
+	if err != nil {
+		return err
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return invalidField("file", "is required")
+	}
+	if fileHeader.Size > maxPhotoSize {
+		return fileTooLarge(maxPhotoSize)
+	}
+	if !photoExtensions[filepath.Ext(fileHeader.Filename)] {
+		return photoTypeNotAllowed()
+	}
+
+	// Versions are stored in full and count towards the owner's quota
+	if err := h.vaultService.CheckQuota(c.UserContext(), photo.UserID, fileHeader.Size); err != nil {
+		return err
+	}
+
+	userID := c.Locals("userID").(string)
+	before := photo
+	photo, err = h.photoService.ReplaceOriginal(c.UserContext(), photo, userID, fileHeader)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoVersionUpload,
+		TargetType: "photo",
+		TargetID:   photo.ID,
+	}, before, photo)
+
+	return c.JSON(photo)
+}
+
+// ListVersions lists the versions of a photo's original
+// @Summary List photo versions
+// @Tags photos
+// @Produce json
+// @Param id path string true "Photo ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} problem.Problem
+// @Router /photos/{id}/versions [get]
+func (h *VersionHandler) ListVersions(c *fiber.Ctx) error {
+	photo, err := h.loadPhoto(c)
+	if err != nil {
+		return err
+	}
+
+	versions, err := h.photoService.ListVersions(c.UserContext(), photo)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  versions,
+		"total": len(versions),
+	})
+}
+
+// DownloadVersion streams one version of a photo's original
+// @Summary Download a photo version
+// @Tags photos
+// @Param id path string true "Photo ID"
+// @Param version path int true "Version number"
+// @Success 200
+// @Success 206
+// @Failure 404 {object} problem.Problem
+// @Router /photos/{id}/versions/{version}/download [get]
+func (h *VersionHandler) DownloadVersion(c *fiber.Ctx) error {
+	_, version, err := h.loadVersion(c)
+	if err != nil {
+		return err
+	}
+
+	obj, err := h.photoService.OpenVersion(c.UserContext(), version)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	_, err = sendContent(c, content{
+		Object:      obj,
+		Name:        version.OriginalName,
+		ContentType: version.MimeType,
+		ETag:        version.Hash,
+		Attachment:  true,
+	})
+	return err
+}
+
+// RestoreVersion makes an earlier version the photo's current original
+// @Summary Restore a photo version
+// @Description The restored version is added as the newest version, so no history is lost
+// @Tags photos
+// @Produce json
+// @Param id path string true "Photo ID"
+// @Param version path int true "Version number"
+// @Success 200 {object} models.Photo
+// @Failure 404 {object} problem.Problem
+// @Router /photos/{id}/versions/{version}/restore [post]
+func (h *VersionHandler) RestoreVersion(c *fiber.Ctx) error {
+	photo, version, err := h.loadVersion(c)
+	if err != nil {
+		return err
+	}
+
+	userID := c.Locals("userID").(string)
+	before := photo
+	photo, err = h.photoService.RestoreVersion(c.UserContext(), photo, version.Version, userID)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(c, h.auditService, &services.AuditEvent{
+		Action:     services.AuditPhotoVersionRestore,
+		TargetType: "photo",
+		TargetID:   photo.ID,
+	}, before, photo)
+
+	return c.JSON(photo)
+}
+
+// loadPhoto loads the photo named in the path and checks that the caller
+// owns it or delivered it as a partner
+func (h *VersionHandler) loadPhoto(c *fiber.Ctx) (*models.Photo, error) {
+	photo, err := h.photoService.GetPhoto(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	userID := c.Locals("userID").(string)
+	if photo.UserID != userID && (photo.PartnerID == nil || *photo.PartnerID != userID) {
+		return nil, permissionDenied("You don't have permission to manage versions of this photo")
+	}
+
+	return photo, nil
+}
+
+// loadVersion loads the photo and version named in the path
+func (h *VersionHandler) loadVersion(c *fiber.Ctx) (*models.Photo, *models.PhotoVersion, error) {
+	photo, err := h.loadPhoto(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	number, err := strconv.Atoi(c.Params("version"))
+	if err != nil || number < 1 {
+		return nil, nil, invalidRequest(fmt.Sprintf("Invalid version %q", c.Params("version")))
+	}
+
+	version, err := h.photoService.GetVersion(c.UserContext(), photo, number)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return photo, version, nil
+}
@@ -0,0 +1,91 @@
+// Package lifecycle shuts the service down in order. Parts register a stop
+// hook as they are started; on shutdown the hooks run in reverse order, like
+// deferred calls, so that everything is stopped before what it depends on:
+// the HTTP server before the workers, the workers before the database.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/logging"
+)
+
+// StopFunc stops a part of the service, giving up when ctx expires
+type StopFunc func(ctx context.Context) error
+
+type hook struct {
+	name string
+	stop StopFunc
+}
+
+// Manager runs the stop hooks of the service
+type Manager struct {
+	mu    sync.Mutex
+	hooks []hook
+	done  bool
+}
+
+// New creates a new Manager
+func New() *Manager {
+	return &Manager{}
+}
+
+// OnStop registers stop to run at shutdown, before the hooks registered
+// earlier
+func (m *Manager) OnStop(name string, stop StopFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, stop: stop})
+}
+
+// Shutdown runs the stop hooks, the last registered first. Every hook runs
+// even if an earlier one failed or ctx has expired, so that the database is
+// closed however the drain went; the errors are returned together. Shutdown
+// runs the hooks only once.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	hooks := m.hooks
+	if m.done {
+		hooks = nil
+	}
+	m.done = true
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		start := time.Now()
+		if err := h.stop(ctx); err != nil {
+			slog.Error("Failed to stop "+h.name, "duration_ms", time.Since(start).Milliseconds(), logging.Err(err))
+			errs = append(errs, fmt.Errorf("stop %s: %w", h.name, err))
+			continue
+		}
+		slog.Info("Stopped "+h.name, "duration_ms", time.Since(start).Milliseconds())
+	}
+	return errors.Join(errs...)
+}
+
+// WaitForSignal blocks until the process is asked to stop with SIGINT or
+// SIGTERM, as Docker and Kubernetes do, or until ctx is done, and returns the
+// signal received. A second signal is not caught, so it kills the process as
+// usual if the shutdown hangs.
+func WaitForSignal(ctx context.Context) os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		return sig
+	case <-ctx.Done():
+		return nil
+	}
+}
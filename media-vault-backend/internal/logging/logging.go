@@ -0,0 +1,142 @@
+// Package logging sets up structured JSON logs. Every record carries the
+// service name, and records logged while serving a request carry its ID, so
+// that Loki can select the service's logs by label and a request's logs by
+// request_id.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Service is the value of the service field of every record
+const Service = "media-vault-api"
+
+// requestIDLocal is the Fiber local, and so the fasthttp user value, that
+// holds the request ID. It is the key Fiber's own middleware uses.
+const requestIDLocal = "requestid"
+
+type requestIDKey struct{}
+
+// Config configures the logger
+type Config struct {
+	// Level is debug, info, warn or error; info if empty
+	Level string
+	// File, if set, receives a copy of the logs, such as the file Promtail
+	// tails as the media-vault-api job
+	File string
+}
+
+// Setup makes a JSON logger writing to stderr, and to the configured file,
+// the default for both slog and the log package. The returned closer closes
+// the file.
+func Setup(config Config) (io.Closer, error) {
+	level, err := ParseLevel(config.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+	if config.File != "" {
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open log file: %w", err)
+		}
+		out, closer = io.MultiWriter(os.Stderr, file), file
+	}
+
+	slog.SetDefault(New(out, level))
+	return closer, nil
+}
+
+// New returns a JSON logger writing records of level and above to w
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: replaceAttr,
+	})
+	return slog.New(handler).With("service", Service)
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// replaceAttr writes levels in lower case, as Loki and Grafana expect them
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok {
+			a.Value = slog.StringValue(strings.ToLower(level.String()))
+		}
+	}
+	return a
+}
+
+// ParseLevel parses a level name, case-insensitively. An empty name is info.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Fatal logs msg at error level and exits, for failures during startup
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Err is the attribute of an error
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+// WithRequestID returns a copy of ctx that carries a request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the ID of the request ctx belongs to, or "". Fiber
+// request contexts carry it as set by the RequestID middleware.
+func RequestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	if id, ok := ctx.Value(requestIDLocal).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// FromContext returns the default logger with the request ID and trace ID
+// of ctx, if any
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if id := RequestIDFrom(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logger = logger.With("trace_id", sc.TraceID().String())
+	}
+	return logger
+}
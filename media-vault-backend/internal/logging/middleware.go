@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRequestIDLength bounds the request IDs accepted from clients and proxies
+const maxRequestIDLength = 128
+
+// quietRoutes are polled by probes and scrapers; their requests are logged at
+// debug level
+var quietRoutes = map[string]bool{
+	"/health":       true,
+	"/health/live":  true,
+	"/health/ready": true,
+	"/metrics":      true,
+}
+
+// RequestID gives every request an ID: the X-Request-ID sent by the client
+// or a proxy if it is well-formed, otherwise a new one. The ID is stored in
+// the "requestid" local and the user context, and echoed in the X-Request-ID
+// response header.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		c.Locals(requestIDLocal, id)
+		c.SetUserContext(WithRequestID(c.UserContext(), id))
+		c.Set(fiber.HeaderXRequestID, id)
+		return c.Next()
+	}
+}
+
+// validRequestID reports whether id is short and made of printable ASCII
+// without spaces or quotes, so that it can't forge log fields or headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog logs every request once it has been served, with its ID, trace
+// ID, route, status, latency, response size and the authenticated user. Errors returned
+// by the handlers are passed to the app's error handler first, so that the
+// logged status is the one sent; server errors are logged at error level.
+func AccessLog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		err := c.Next()
+		if err != nil {
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		route := c.Route().Path
+		if status == fiber.StatusNotFound && (route == "/" || route == "") {
+			route = "unmatched"
+		}
+
+		// Reading a streamed body would consume it, so its size is the
+		// declared length, if any
+		bytes := max(c.Response().Header.ContentLength(), 0)
+		if !c.Response().IsBodyStream() {
+			bytes = len(c.Response().Body())
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", RequestIDFrom(c.Context())),
+			slog.String("method", c.Method()),
+			slog.String("route", route),
+			slog.String("path", c.Path()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", bytes),
+			slog.String("ip", c.IP()),
+		}
+		if sc := trace.SpanContextFromContext(c.UserContext()); sc.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+		}
+		if user, ok := c.Locals("userID").(string); ok && user != "" {
+			attrs = append(attrs, slog.String("user", user))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+			if err != nil {
+				attrs = append(attrs, Err(err))
+			}
+		case quietRoutes[route]:
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(c.UserContext(), level, "request", attrs...)
+		return nil
+	}
+}
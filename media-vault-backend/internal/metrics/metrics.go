@@ -0,0 +1,279 @@
+// Package metrics exposes Prometheus metrics for the API, storage and the
+// processing pipeline. Metrics are registered with the default registry,
+// which also carries the Go runtime and process collectors.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+// Upload kinds
+const (
+	UploadPhoto   = "photo"
+	UploadVersion = "version"
+	UploadFile    = "file"
+)
+
+// Outcomes of calls to analysis services
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	OutcomeTimeout = "timeout"
+)
+
+// unmatchedRoute labels requests that matched no route, so that scanners
+// probing random paths don't create a series per path
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route and status code.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "route", "code"})
+
+	httpInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being served.",
+	})
+
+	uploadAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vault_upload_attempts_total",
+		Help: "Uploads accepted by the handlers, by kind.",
+	}, []string{"kind"})
+
+	uploadFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vault_upload_failures_total",
+		Help: "Uploads that were rejected or failed to be stored, by kind.",
+	}, []string{"kind"})
+
+	uploadBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vault_upload_bytes_total",
+		Help: "Bytes of successful uploads, by kind.",
+	}, []string{"kind"})
+
+	thumbnailDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vault_thumbnail_duration_seconds",
+		Help:    "Latency of thumbnail requests by size and whether the thumbnail was cached.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"size", "cache"})
+
+	renderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vault_render_duration_seconds",
+		Help:    "Time to decode an original and render a thumbnail, by size.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"size"})
+
+	analyzerCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vault_analyzer_requests_total",
+		Help: "Calls to analysis services by analyzer and outcome.",
+	}, []string{"analyzer", "outcome"})
+
+	analyzerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vault_analyzer_request_duration_seconds",
+		Help:    "Latency of calls to analysis services by analyzer.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"analyzer"})
+
+	storageOperations = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vault_storage_operation_duration_seconds",
+		Help:    "Latency of storage operations by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"op"})
+
+	storageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vault_storage_errors_total",
+		Help: "Failed storage operations by operation. Missing objects are not errors.",
+	}, []string{"op"})
+
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vault_rate_limited_requests_total",
+		Help: "Requests rejected by a rate limit, by policy.",
+	}, []string{"policy"})
+)
+
+// Handler serves the metrics in the Prometheus text exposition format
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+// Middleware records the count and latency of every request. Routes are
+// labeled by their pattern, such as /api/v1/photos/:id, not the request path.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		err := c.Next()
+
+		code := c.Response().StatusCode()
+		if err != nil {
+			code = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				code = e.Code
+			}
+		}
+
+		// The route of a request that matched nothing is that of the last
+		// middleware it passed, such as a group's prefix or "/", which would
+		// make every 404 look like a hit on "/"
+		route := c.Route().Path
+		if code == fiber.StatusNotFound && (route == "/" || route == "") {
+			route = unmatchedRoute
+		}
+
+		labels := prometheus.Labels{
+			"method": c.Method(),
+			"route":  route,
+			"code":   strconv.Itoa(code),
+		}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// ObserveUpload records an upload of size bytes that ended with err
+func ObserveUpload(kind string, size int64, err error) {
+	uploadAttempts.WithLabelValues(kind).Inc()
+	if err != nil {
+		uploadFailures.WithLabelValues(kind).Inc()
+		return
+	}
+	uploadBytes.WithLabelValues(kind).Add(float64(size))
+}
+
+// ObserveThumbnail records a thumbnail request that started at start
+func ObserveThumbnail(size string, cached bool, start time.Time) {
+	cache := "miss"
+	if cached {
+		cache = "hit"
+	}
+	thumbnailDuration.WithLabelValues(size, cache).Observe(time.Since(start).Seconds())
+}
+
+// ObserveRender records the rendering of a thumbnail that started at start
+func ObserveRender(size string, start time.Time) {
+	renderDuration.WithLabelValues(size).Observe(time.Since(start).Seconds())
+}
+
+// ObserveAnalyzerCall records a call to an analysis service that started at
+// start and ended with err
+func ObserveAnalyzerCall(analyzer string, start time.Time, err error) {
+	outcome := OutcomeSuccess
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+		outcome = OutcomeTimeout
+	case err != nil:
+		outcome = OutcomeError
+	}
+	analyzerCalls.WithLabelValues(analyzer, outcome).Inc()
+	analyzerDuration.WithLabelValues(analyzer).Observe(time.Since(start).Seconds())
+}
+
+// ObserveRateLimited records a request rejected by a rate limit policy
+func ObserveRateLimited(policy string) {
+	rateLimited.WithLabelValues(policy).Inc()
+}
+
+// isTimeout reports whether err is a network timeout, such as an HTTP client
+// timeout
+func isTimeout(err error) bool {
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
+
+// RegisterDB exports the connection pool statistics of db
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterDisk exports the size and usage of the filesystem holding path as
+// vault_storage_total_bytes and vault_storage_used_bytes
+func RegisterDisk(path string) {
+	prometheus.MustRegister(&diskCollector{path: path})
+}
+
+// QueueDepth returns the number of jobs of a queue in each state
+type QueueDepth func(ctx context.Context) (map[string]int, error)
+
+// RegisterJobQueue exports the depth of a background job queue as
+// vault_job_queue_depth{queue, state}
+func RegisterJobQueue(queue string, depth QueueDepth) {
+	prometheus.MustRegister(&queueCollector{queue: queue, depth: depth})
+}
+
+var (
+	diskTotalDesc = prometheus.NewDesc("vault_storage_total_bytes",
+		"Size of the filesystem holding the vault.", []string{"path"}, nil)
+	diskUsedDesc = prometheus.NewDesc("vault_storage_used_bytes",
+		"Bytes used on the filesystem holding the vault, including space reserved for root.", []string{"path"}, nil)
+	diskFreeDesc = prometheus.NewDesc("vault_storage_free_bytes",
+		"Bytes available to the service on the filesystem holding the vault.", []string{"path"}, nil)
+	queueDepthDesc = prometheus.NewDesc("vault_job_queue_depth",
+		"Background jobs by queue and state.", []string{"queue", "state"}, nil)
+)
+
+type diskCollector struct {
+	path string
+}
+
+func (c *diskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- diskTotalDesc
+	ch <- diskUsedDesc
+	ch <- diskFreeDesc
+}
+
+func (c *diskCollector) Collect(ch chan<- prometheus.Metric) {
+	free, total, err := utils.DiskSpace(c.path)
+	if err != nil {
+		slog.Error("Failed to collect disk metrics", "path", c.path, logging.Err(err))
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(diskTotalDesc, prometheus.GaugeValue, float64(total), c.path)
+	ch <- prometheus.MustNewConstMetric(diskUsedDesc, prometheus.GaugeValue, float64(total-free), c.path)
+	ch <- prometheus.MustNewConstMetric(diskFreeDesc, prometheus.GaugeValue, float64(free), c.path)
+}
+
+type queueCollector struct {
+	queue string
+	depth QueueDepth
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	depth, err := c.depth(ctx)
+	if err != nil {
+		slog.Error("Failed to collect queue depth", "queue", c.queue, logging.Err(err))
+		return
+	}
+	for state, n := range depth {
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(n), c.queue, state)
+	}
+}
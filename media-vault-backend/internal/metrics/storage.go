@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+// instrumentedStorage records the latency and errors of the operations of
+// the storage it wraps
+type instrumentedStorage struct {
+	storage.Storage
+}
+
+// InstrumentStorage wraps s so that its operations are measured
+func InstrumentStorage(s storage.Storage) storage.Storage {
+	return &instrumentedStorage{Storage: s}
+}
+
+func (s *instrumentedStorage) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	start := time.Now()
+	n, err := s.Storage.Put(ctx, key, r)
+	observeStorage("put", start, err)
+	return n, err
+}
+
+func (s *instrumentedStorage) Open(ctx context.Context, key string) (storage.Object, error) {
+	start := time.Now()
+	obj, err := s.Storage.Open(ctx, key)
+	observeStorage("open", start, err)
+	return obj, err
+}
+
+func (s *instrumentedStorage) Stat(ctx context.Context, key string) (storage.Info, error) {
+	start := time.Now()
+	info, err := s.Storage.Stat(ctx, key)
+	observeStorage("stat", start, err)
+	return info, err
+}
+
+func (s *instrumentedStorage) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := s.Storage.Delete(ctx, key)
+	observeStorage("delete", start, err)
+	return err
+}
+
+func observeStorage(op string, start time.Time, err error) {
+	storageOperations.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	// Missing objects are expected, e.g. thumbnails not generated yet, and a
+	// cancelled request is not a storage fault
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, context.Canceled) {
+		storageErrors.WithLabelValues(op).Inc()
+	}
+}
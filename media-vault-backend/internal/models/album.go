@@ -0,0 +1,45 @@
+package models
+
+import (
+    "encoding/json"
+    "time"
+)
+
+// Album kinds
+const (
+    AlbumKindManual = "manual" // membership is an ordered list of photos
+    AlbumKindSmart  = "smart"  // membership is a saved photo query
+)
+
+// Album groups photos. Albums can be nested through ParentID; smart albums
+// store a photo filter instead of an explicit member list.
+type Album struct {
+    ID           string          `json:"id" db:"id"`
+    UserID       string          `json:"user_id" db:"user_id"`
+    ParentID     *string         `json:"parent_id,omitempty" db:"parent_id"`
+    Title        string          `json:"title" db:"title"`
+    Description  *string         `json:"description,omitempty" db:"description"`
+    CoverPhotoID *string         `json:"cover_photo_id,omitempty" db:"cover_photo_id"`
+    Kind         string          `json:"kind" db:"kind"`
+    Query        json.RawMessage `json:"query,omitempty" db:"query"`
+    PhotoCount   int             `json:"photo_count"`
+    Children     []*Album        `json:"children,omitempty"`
+    CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+    UpdatedAt    time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// AlbumRequest creates or updates an album. On update, omitted fields are
+// left unchanged; an empty parent_id or cover_photo_id clears it.
+type AlbumRequest struct {
+    Title        *string         `json:"title"`
+    Description  *string         `json:"description"`
+    ParentID     *string         `json:"parent_id"`
+    CoverPhotoID *string         `json:"cover_photo_id"`
+    Query        json.RawMessage `json:"query,omitempty"` // makes the album a smart album
+}
+
+// AlbumPhotosRequest adds photos to, removes photos from, or reorders an album
+type AlbumPhotosRequest struct {
+    PhotoIDs []string `json:"photo_ids"`
+    Position *int     `json:"position,omitempty"` // insertion point when adding; appended by default
+}
@@ -35,6 +35,41 @@ type Photo struct {
     CreatedAt         time.Time  `json:"created_at" db:"created_at"`
     UpdatedAt         time.Time  `json:"updated_at" db:"updated_at"`
     ProcessedAt       *time.Time `json:"processed_at,omitempty" db:"processed_at"`
+    DeletedAt         *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+    TagDetails        []*PhotoTag `json:"tag_details,omitempty"`
+    Language          string     `json:"language,omitempty"`
+    Languages         []string   `json:"languages,omitempty"`
+}
+
+// PhotoTranslation holds a photo's description and tags in one language
+type PhotoTranslation struct {
+    PhotoID       string    `json:"photo_id" db:"photo_id"`
+    Language      string    `json:"language" db:"language"`
+    Description   *string   `json:"description,omitempty" db:"description"`
+    AIDescription *string   `json:"ai_description,omitempty" db:"ai_description"`
+    Tags          *string   `json:"tags,omitempty" db:"tags"`
+    Source        string    `json:"source" db:"source"` // "user", "ai" or "machine"
+    CreatedAt     time.Time `json:"created_at" db:"created_at"`
+    UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// PhotoVersion is one uploaded version of a photo's original. Versions are
+// numbered from 1; the highest number is the current version. Restoring an
+// older version adds a new version with the same content.
+type PhotoVersion struct {
+    PhotoID      string    `json:"photo_id" db:"photo_id"`
+    Version      int       `json:"version" db:"version"`
+    StorageKey   string    `json:"-" db:"storage_key"`
+    OriginalName string    `json:"original_name" db:"original_name"`
+    FileSize     int64     `json:"file_size" db:"file_size"`
+    MimeType     string    `json:"mime_type" db:"mime_type"`
+    Width        *int      `json:"width,omitempty" db:"width"`
+    Height       *int      `json:"height,omitempty" db:"height"`
+    Hash         string    `json:"hash" db:"hash"`
+    RestoredFrom *int      `json:"restored_from,omitempty" db:"restored_from"`
+    CreatedBy    string    `json:"created_by" db:"created_by"`
+    CreatedAt    time.Time `json:"created_at" db:"created_at"`
+    Current      bool      `json:"current"`
 }
 
 // PhotoSharing represents photo sharing permissions
@@ -81,6 +116,8 @@ type BatchUpdateRequest struct {
     Description string   `json:"description,omitempty"`
     Tags        string   `json:"tags,omitempty"`
     Operation   string   `json:"operation"`
+    Language    string   `json:"language,omitempty"`
+    TranslateTo []string `json:"translate_to,omitempty"`
 }
 
 // ShareRequest represents a photo sharing request
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Tag is a normalized tag owned by a user
+type Tag struct {
+    ID         string    `json:"id" db:"id"`
+    UserID     string    `json:"user_id" db:"user_id"`
+    Slug       string    `json:"slug" db:"slug"`
+    Name       string    `json:"name" db:"name"`
+    PhotoCount int       `json:"photo_count"`
+    CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// PhotoTag is a tag attached to a photo along with its provenance
+type PhotoTag struct {
+    Slug       string    `json:"slug" db:"slug"`
+    Name       string    `json:"name" db:"name"`
+    Source     string    `json:"source" db:"source"` // "user" or "ai"
+    Confidence *float64  `json:"confidence,omitempty" db:"confidence"`
+    CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// BatchTagRequest adds and removes tags across many photos
+type BatchTagRequest struct {
+    PhotoIDs []string `json:"photo_ids"`
+    Add      []string `json:"add,omitempty"`
+    Remove   []string `json:"remove,omitempty"`
+}
+
+// MergeTagsRequest merges several tags into one
+type MergeTagsRequest struct {
+    Sources []string `json:"sources"`
+    Target  string   `json:"target"`
+}
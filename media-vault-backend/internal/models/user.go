@@ -11,11 +11,31 @@ type User struct {
     AvatarURL *string   `json:"avatar_url,omitempty" db:"avatar_url"`
     IsAdmin   bool      `json:"is_admin" db:"is_admin"`
     IsActive  bool      `json:"is_active" db:"is_active"`
+    Roles     []string  `json:"roles"`
     LastLogin *time.Time `json:"last_login,omitempty" db:"last_login"`
     CreatedAt time.Time `json:"created_at" db:"created_at"`
     UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// CreateUserRequest is the request body for creating a user
+type CreateUserRequest struct {
+    Email             string   `json:"email"`
+    Username          string   `json:"username"`
+    FullName          string   `json:"full_name"`
+    Password          string   `json:"password"`
+    TemporaryPassword bool     `json:"temporary_password"`
+    Roles             []string `json:"roles"`
+    Enabled           *bool    `json:"enabled"`
+}
+
+// UserUpdate holds the user fields to change; nil fields are left as they are
+type UserUpdate struct {
+    Email    *string `json:"email"`
+    Username *string `json:"username"`
+    FullName *string `json:"full_name"`
+    Enabled  *bool   `json:"enabled"`
+}
+
 // UserSettings represents user preferences and settings
 type UserSettings struct {
     UserID         string    `json:"user_id" db:"user_id"`
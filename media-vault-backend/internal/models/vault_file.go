@@ -1,18 +1,34 @@
 package models
 
-import "time"
+import (
+    "encoding/json"
+    "time"
+)
 
-// VaultFile represents a file in the vault
+// VaultFile represents a file in the vault. Path is the folder holding the
+// file, e.g. "/contracts/2024"; the root folder is "/".
 type VaultFile struct {
-    ID          string    `json:"id" db:"id"`
-    UserID      string    `json:"user_id" db:"user_id"`
-    Name        string    `json:"name" db:"name"`
-    Path        string    `json:"path" db:"path"`
-    Size        int64     `json:"size" db:"size"`
-    MimeType    string    `json:"mime_type" db:"mime_type"`
-    IsPublic    bool      `json:"is_public" db:"is_public"`
-    IsEncrypted bool      `json:"is_encrypted" db:"is_encrypted"`
-    Metadata    string    `json:"metadata,omitempty" db:"metadata"`
-    CreatedAt   time.Time `json:"created_at" db:"created_at"`
-    UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+    ID          string          `json:"id" db:"id"`
+    UserID      string          `json:"user_id" db:"user_id"`
+    Name        string          `json:"name" db:"name"`
+    Path        string          `json:"path" db:"path"`
+    StorageKey  string          `json:"-" db:"storage_key"`
+    Size        int64           `json:"size" db:"size"`
+    MimeType    string          `json:"mime_type" db:"mime_type"`
+    Hash        string          `json:"hash" db:"hash"`
+    IsPublic    bool            `json:"is_public" db:"is_public"`
+    IsEncrypted bool            `json:"is_encrypted" db:"is_encrypted"`
+    KeyID       string          `json:"-" db:"key_id"`
+    WrappedKey  []byte          `json:"-" db:"wrapped_key"`
+    Metadata    json.RawMessage `json:"metadata,omitempty" db:"metadata"`
+    CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+    UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// VaultFileUpdate renames or moves a file or replaces its metadata; nil
+// fields are left unchanged
+type VaultFileUpdate struct {
+    Name     *string         `json:"name"`
+    Path     *string         `json:"path"`
+    Metadata json.RawMessage `json:"metadata"`
 }
@@ -0,0 +1,174 @@
+// Package problem renders the errors of the API as RFC 7807 problem details
+// (application/problem+json). Handlers return errors instead of writing
+// error responses; ErrorHandler, the app's error handler, turns them into
+// responses such as:
+//
+//	{
+//	  "type": "urn:media-vault:problem:photo_not_found",
+//	  "title": "Not Found",
+//	  "status": 404,
+//	  "detail": "photo not found",
+//	  "instance": "/api/v1/photos/42",
+//	  "code": "photo_not_found",
+//	  "request_id": "8f14e45f-..."
+//	}
+//
+// code identifies the error for clients; it never changes, unlike detail,
+// which is for humans. Invalid requests list their invalid fields in errors.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/logging"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// TypePrefix prefixes the code of an error to make the type of its problem
+const TypePrefix = "urn:media-vault:problem:"
+
+// CodeInternal is the code of unexpected errors, whose details are logged
+// but not shown
+const CodeInternal = "internal_error"
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      string              `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []apperr.FieldError `json:"errors,omitempty"`
+	// Extensions are more members of the object, from apperr.Error.Extra.
+	// They cannot replace the members above.
+	Extensions map[string]any `json:"-"`
+}
+
+// reserved are the members extensions cannot replace
+var reserved = map[string]bool{
+	"type": true, "title": true, "status": true, "detail": true, "instance": true,
+	"code": true, "request_id": true, "errors": true,
+}
+
+// MarshalJSON encodes p with its extension members
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	data, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+
+	var members map[string]any
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	for k, v := range p.Extensions {
+		if !reserved[k] {
+			members[k] = v
+		}
+	}
+	return json.Marshal(members)
+}
+
+// kindStatus maps the kinds of errors to HTTP status codes
+var kindStatus = map[apperr.Kind]int{
+	apperr.KindInvalid:       fiber.StatusBadRequest,
+	apperr.KindUnauthorized:  fiber.StatusUnauthorized,
+	apperr.KindForbidden:     fiber.StatusForbidden,
+	apperr.KindNotFound:      fiber.StatusNotFound,
+	apperr.KindConflict:      fiber.StatusConflict,
+	apperr.KindGone:          fiber.StatusGone,
+	apperr.KindUnsupported:   fiber.StatusUnsupportedMediaType,
+	apperr.KindTooLarge:      fiber.StatusRequestEntityTooLarge,
+	apperr.KindQuotaExceeded: fiber.StatusRequestEntityTooLarge,
+	apperr.KindRateLimited:   fiber.StatusTooManyRequests,
+	apperr.KindUnavailable:   fiber.StatusServiceUnavailable,
+	apperr.KindUpstream:      fiber.StatusBadGateway,
+}
+
+// Status returns the HTTP status code of kind
+func Status(kind apperr.Kind) int {
+	if status, ok := kindStatus[kind]; ok {
+		return status
+	}
+	return fiber.StatusInternalServerError
+}
+
+// From describes err as a problem:
+//   - an *apperr.Error in the chain of err gives the status and code, and the
+//     text of err, which wraps it with details, is the detail, less the cause
+//     of the *apperr.Error
+//   - a *fiber.Error, e.g. for an unknown route, is described by its status
+//   - any other error is an internal error, whose text is not shown since it
+//     may reveal paths, queries or other internals
+func From(err error) Problem {
+	if e, ok := apperr.As(err); ok {
+		detail := strings.Replace(err.Error(), e.Error(), e.Detail(), 1)
+		p := newProblem(Status(e.Kind), e.Code, detail, e.Fields)
+		p.Extensions = e.Extra
+		return p
+	}
+
+	if e, ok := err.(*fiber.Error); ok {
+		detail := e.Message
+		if detail == http.StatusText(e.Code) {
+			detail = ""
+		}
+		return newProblem(e.Code, statusCode(e.Code), detail, nil)
+	}
+
+	return newProblem(fiber.StatusInternalServerError, CodeInternal,
+		"An unexpected error occurred. Please retry later, or report the request ID if it persists.", nil)
+}
+
+func newProblem(status int, code, detail string, fields []apperr.FieldError) Problem {
+	return Problem{
+		Type:   TypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Errors: fields,
+	}
+}
+
+// statusCode makes the code of an HTTP status from its text, e.g.
+// method_not_allowed
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" || status == fiber.StatusInternalServerError {
+		return CodeInternal
+	}
+	text = strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text)
+	return strings.ToLower(text)
+}
+
+// ErrorHandler is the error handler of the app: it responds to the errors
+// returned by handlers and middlewares with their problem details, carrying
+// the request ID and path
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	p := From(err)
+	p.Instance = c.Path()
+	p.RequestID = logging.RequestIDFrom(c.Context())
+
+	// A failed handler may have set headers of the response it meant to send
+	c.Response().Header.Del(fiber.HeaderContentDisposition)
+	c.Response().Header.Del(fiber.HeaderContentEncoding)
+	c.Response().Header.Del(fiber.HeaderETag)
+	c.Response().Header.Del(fiber.HeaderLastModified)
+	c.Response().Header.Del(fiber.HeaderContentRange)
+	c.Response().Header.Del(fiber.HeaderCacheControl)
+	if err := c.Status(p.Status).JSON(p); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, ContentType)
+	return nil
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/metrics"
+)
+
+// ErrRateLimited is returned for requests over the limit of their policy
+var ErrRateLimited = apperr.New(apperr.KindRateLimited, "rate_limited", "Too many requests, please retry later")
+
+// KeyFunc returns the key a request is limited by
+type KeyFunc func(c *fiber.Ctx) string
+
+// ByIP limits requests by client IP address. Behind a proxy the address is
+// only the client's if the proxy is trusted to set X-Forwarded-For, and then
+// it is the hop security.ForwardedFor picks, which clients cannot choose.
+func ByIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// ByPrincipal limits requests by the authenticated user, or by IP address for
+// anonymous requests
+func ByPrincipal(c *fiber.Ctx) string {
+	if userID, ok := c.Locals("userID").(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	return ByIP(c)
+}
+
+// Limiter applies rate limit policies to requests
+type Limiter struct {
+	store Store
+}
+
+// NewLimiter creates a Limiter keeping its buckets in store
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store}
+}
+
+// Limit returns a middleware that limits requests under policy by key. The
+// limits are reported in RateLimit-* headers, and requests over the limit
+// get a 429 with Retry-After. If the store fails, requests are let through.
+func (l *Limiter) Limit(policy Policy, key KeyFunc) fiber.Handler {
+	if !policy.Enabled() {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		result, err := l.store.Take(c.UserContext(), policy.Name+":"+key(c), policy)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Rate limit store failed",
+				"policy", policy.Name, logging.Err(err))
+			return c.Next()
+		}
+
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+		c.Set("RateLimit-Policy", policy.String())
+
+		if !result.Allowed {
+			metrics.ObserveRateLimited(policy.Name)
+			c.Set(fiber.HeaderRetryAfter, ceilSeconds(result.RetryAfter))
+			return ErrRateLimited
+		}
+		return c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
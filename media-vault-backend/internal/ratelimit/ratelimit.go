@@ -0,0 +1,83 @@
+// Package ratelimit limits request rates with token buckets. Each policy
+// allows a number of requests per period to every key, such as a user or an
+// IP address, refilling continuously, so that bursts up to the limit are
+// allowed.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidPolicy is returned when a policy cannot be parsed
+var ErrInvalidPolicy = errors.New("invalid rate limit policy")
+
+// Policy allows Limit requests per Period to every key. A policy with a zero
+// limit is disabled.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// Enabled reports whether the policy limits anything
+func (p Policy) Enabled() bool {
+	return p.Limit > 0 && p.Period > 0
+}
+
+// rate is the number of tokens added per second
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// String formats the policy like the RateLimit-Policy header, e.g. "10;w=60"
+func (p Policy) String() string {
+	return fmt.Sprintf("%d;w=%d", p.Limit, int(p.Period.Seconds()))
+}
+
+// ParsePolicy parses a policy written as "<limit>/<period>", such as "10/1m",
+// or "off" to disable it
+func ParsePolicy(name, value string) (Policy, error) {
+	policy := Policy{Name: name}
+	value = strings.TrimSpace(value)
+	if value == "off" || value == "0" {
+		return policy, nil
+	}
+	limit, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return policy, fmt.Errorf("%w: %q, want <limit>/<period> such as 10/1m", ErrInvalidPolicy, value)
+	}
+	var err error
+	if policy.Limit, err = strconv.Atoi(limit); err != nil || policy.Limit < 0 {
+		return policy, fmt.Errorf("%w: invalid limit %q", ErrInvalidPolicy, limit)
+	}
+	if policy.Period, err = time.ParseDuration(period); err != nil || policy.Period < time.Second {
+		return policy, fmt.Errorf("%w: invalid period %q", ErrInvalidPolicy, period)
+	}
+	return policy, nil
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed bool
+	// Limit is the size of the bucket
+	Limit int
+	// Remaining is the number of requests left
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, if this one
+	// was not
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. The in-memory store limits each instance of the
+// service separately; a shared store limits all of them together.
+type Store interface {
+	// Take takes a token from the bucket of key under policy
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+}
@@ -0,0 +1,89 @@
+package security
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+)
+
+// ErrOriginNotAllowed is returned for preflight requests from origins the
+// policy does not allow
+var ErrOriginNotAllowed = apperr.Forbidden("origin_not_allowed", "Origin not allowed")
+
+// CORSPolicy is the CORS policy of a route group
+type CORSPolicy struct {
+	Origins       *Origins
+	AllowMethods  []string
+	AllowHeaders  []string
+	ExposeHeaders []string
+	// AllowCredentials lets browsers send cookies and authorization with
+	// requests. It cannot be combined with any origin.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// CORS returns a middleware applying policy. Allowed origins are echoed in
+// Access-Control-Allow-Origin, or * if any origin is allowed without
+// credentials. Requests from other origins get no CORS headers, so browsers
+// don't let the page read the response, and their preflights are refused
+// with a 403.
+func CORS(policy CORSPolicy) fiber.Handler {
+	if policy.Origins == nil {
+		policy.Origins = &Origins{}
+	}
+	if policy.Origins.Any() && policy.AllowCredentials {
+		// Browsers reject this, and echoing every origin instead would let
+		// any site act with the user's credentials
+		panic("security: CORS credentials cannot be allowed for any origin")
+	}
+	allowMethods := strings.Join(policy.AllowMethods, ", ")
+	allowHeaders := strings.Join(policy.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(policy.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(int(policy.MaxAge.Seconds()))
+
+	return func(c *fiber.Ctx) error {
+		// Responses differ by origin, so caches must keep them apart
+		c.Vary(fiber.HeaderOrigin)
+
+		origin := c.Get(fiber.HeaderOrigin)
+		if origin == "" {
+			return c.Next()
+		}
+		preflight := c.Method() == fiber.MethodOptions && c.Get(fiber.HeaderAccessControlRequestMethod) != ""
+		if !policy.Origins.Allows(origin) {
+			if preflight {
+				return ErrOriginNotAllowed
+			}
+			return c.Next()
+		}
+
+		if policy.Origins.Any() {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+		} else {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+		}
+		if policy.AllowCredentials {
+			c.Set(fiber.HeaderAccessControlAllowCredentials, "true")
+		}
+		if !preflight {
+			if exposeHeaders != "" {
+				c.Set(fiber.HeaderAccessControlExposeHeaders, exposeHeaders)
+			}
+			return c.Next()
+		}
+
+		c.Vary(fiber.HeaderAccessControlRequestMethod, fiber.HeaderAccessControlRequestHeaders)
+		c.Set(fiber.HeaderAccessControlAllowMethods, allowMethods)
+		if allowHeaders != "" {
+			c.Set(fiber.HeaderAccessControlAllowHeaders, allowHeaders)
+		}
+		if policy.MaxAge > 0 {
+			c.Set(fiber.HeaderAccessControlMaxAge, maxAge)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
@@ -0,0 +1,224 @@
+package security
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/wronai/media-vault-backend/internal/problem"
+)
+
+func mustParseOrigins(t *testing.T, patterns ...string) *Origins {
+	t.Helper()
+	origins, err := ParseOrigins(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return origins
+}
+
+// newCORSApp serves GET /api with the policy of the authenticated API and
+// GET /s with the policy of public share links, as the API does
+func newCORSApp(t *testing.T) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Group("/api", CORS(CORSPolicy{
+		Origins:          mustParseOrigins(t, "https://app.example.com", "https://*.example.net"),
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Content-Type", "Authorization"},
+		ExposeHeaders:    []string{"X-Request-ID", "Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})).Get("", func(c *fiber.Ctx) error {
+		return c.SendString("api")
+	})
+	app.Group("/s", CORS(CORSPolicy{
+		Origins:       mustParseOrigins(t, "*"),
+		AllowMethods:  []string{"GET", "HEAD", "POST"},
+		AllowHeaders:  []string{"Content-Type"},
+		ExposeHeaders: []string{"X-Request-ID"},
+	})).Get("", func(c *fiber.Ctx) error {
+		return c.SendString("share")
+	})
+	return app
+}
+
+func preflight(path, origin, method string) *http.Request {
+	req := httptest.NewRequest(fiber.MethodOptions, path, nil)
+	req.Header.Set(fiber.HeaderOrigin, origin)
+	req.Header.Set(fiber.HeaderAccessControlRequestMethod, method)
+	req.Header.Set(fiber.HeaderAccessControlRequestHeaders, "authorization")
+	return req
+}
+
+func simple(path, origin string) *http.Request {
+	req := httptest.NewRequest(fiber.MethodGet, path, nil)
+	if origin != "" {
+		req.Header.Set(fiber.HeaderOrigin, origin)
+	}
+	return req
+}
+
+func varies(resp *http.Response, header string) bool {
+	for _, v := range resp.Header.Values(fiber.HeaderVary) {
+		for _, name := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), header) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestCORSPreflight(t *testing.T) {
+	app := newCORSApp(t)
+
+	tests := []struct {
+		name        string
+		req         *http.Request
+		origin      string // Access-Control-Allow-Origin
+		credentials bool
+		methods     string
+		headers     string
+		maxAge      string
+	}{
+		{
+			name: "api, exact origin", req: preflight("/api", "https://app.example.com", "PUT"),
+			origin: "https://app.example.com", credentials: true,
+			methods: "GET, POST, PUT, DELETE, OPTIONS", headers: "Content-Type, Authorization", maxAge: "600",
+		},
+		{
+			name: "api, wildcard origin", req: preflight("/api", "https://a.b.example.net", "DELETE"),
+			origin: "https://a.b.example.net", credentials: true,
+			methods: "GET, POST, PUT, DELETE, OPTIONS", headers: "Content-Type, Authorization", maxAge: "600",
+		},
+		{
+			name: "public, any origin", req: preflight("/s", "https://blog.test", "POST"),
+			origin: "*", methods: "GET, HEAD, POST", headers: "Content-Type",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusNoContent {
+				t.Fatalf("status = %d, want 204", resp.StatusCode)
+			}
+			for header, want := range map[string]string{
+				fiber.HeaderAccessControlAllowOrigin:   tt.origin,
+				fiber.HeaderAccessControlAllowMethods:  tt.methods,
+				fiber.HeaderAccessControlAllowHeaders:  tt.headers,
+				fiber.HeaderAccessControlMaxAge:        tt.maxAge,
+				fiber.HeaderAccessControlExposeHeaders: "",
+			} {
+				if got := resp.Header.Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials) == "true"; got != tt.credentials {
+				t.Errorf("credentials allowed = %v, want %v", got, tt.credentials)
+			}
+			for _, header := range []string{fiber.HeaderOrigin, fiber.HeaderAccessControlRequestMethod, fiber.HeaderAccessControlRequestHeaders} {
+				if !varies(resp, header) {
+					t.Errorf("Vary %q lacks %s", resp.Header.Values(fiber.HeaderVary), header)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSPreflightFromDisallowedOrigin(t *testing.T) {
+	app := newCORSApp(t)
+
+	for _, origin := range []string{"https://evil.test", "https://example.net", "null", "https://app.example.com.evil.test"} {
+		t.Run(origin, func(t *testing.T) {
+			resp, err := app.Test(preflight("/api", origin, "DELETE"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusForbidden {
+				t.Errorf("status = %d, want 403", resp.StatusCode)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentType); got != problem.ContentType {
+				t.Errorf("Content-Type = %q, want %q", got, problem.ContentType)
+			}
+			var body problem.Problem
+			data, _ := io.ReadAll(resp.Body)
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("body %s: %v", data, err)
+			}
+			if body.Code != ErrOriginNotAllowed.Code || body.Status != fiber.StatusForbidden {
+				t.Errorf("problem = %s, want code %s", data, ErrOriginNotAllowed.Code)
+			}
+			for _, header := range []string{fiber.HeaderAccessControlAllowOrigin, fiber.HeaderAccessControlAllowCredentials, fiber.HeaderAccessControlAllowMethods} {
+				if got := resp.Header.Get(header); got != "" {
+					t.Errorf("%s = %q, want none", header, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSSimpleRequests(t *testing.T) {
+	app := newCORSApp(t)
+
+	tests := []struct {
+		name        string
+		req         *http.Request
+		origin      string // Access-Control-Allow-Origin
+		credentials bool
+		expose      string
+	}{
+		{
+			name: "api, allowed origin", req: simple("/api", "https://app.example.com"),
+			origin: "https://app.example.com", credentials: true, expose: "X-Request-ID, Retry-After",
+		},
+		// Disallowed origins are served, but browsers don't let them read
+		// the response
+		{name: "api, disallowed origin", req: simple("/api", "https://evil.test")},
+		{name: "api, no origin", req: simple("/api", "")},
+		{name: "public, any origin", req: simple("/s", "https://blog.test"), origin: "*", expose: "X-Request-ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("status = %d, want 200", resp.StatusCode)
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials) == "true"; got != tt.credentials {
+				t.Errorf("credentials allowed = %v, want %v", got, tt.credentials)
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlExposeHeaders); got != tt.expose {
+				t.Errorf("Access-Control-Expose-Headers = %q, want %q", got, tt.expose)
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowMethods); got != "" {
+				t.Errorf("Access-Control-Allow-Methods = %q on a simple request", got)
+			}
+			if !varies(resp, fiber.HeaderOrigin) {
+				t.Errorf("Vary %q lacks Origin", resp.Header.Values(fiber.HeaderVary))
+			}
+		})
+	}
+}
+
+func TestCORSRejectsCredentialsForAnyOrigin(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("CORS allowed credentials for any origin")
+		}
+	}()
+	CORS(CORSPolicy{Origins: mustParseOrigins(t, "*"), AllowCredentials: true})
+}
@@ -0,0 +1,83 @@
+package security
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cross-Origin-Resource-Policy values: who may embed a response, e.g. in an
+// <img>
+const (
+	ResourceSameOrigin  = "same-origin"
+	ResourceSameSite    = "same-site"
+	ResourceCrossOrigin = "cross-origin"
+)
+
+// APIContentSecurityPolicy is the policy of every response: they are data,
+// not documents, so nothing may load from or frame them. User content served
+// by share links and signed URLs keeps it whatever its type.
+const APIContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+// MonitorContentSecurityPolicy is the policy of the admin monitor page, which
+// loads Chart.js and its font from CDNs
+const MonitorContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; " +
+	"font-src https://fonts.gstatic.com; img-src 'self' data:; " +
+	"frame-ancestors 'none'; base-uri 'none'; form-action 'self'"
+
+// HeaderConfig configures the security headers
+type HeaderConfig struct {
+	// HSTSMaxAge, when positive, tells browsers to only use HTTPS for that
+	// long. Only enable it once the service is always reached over HTTPS.
+	HSTSMaxAge time.Duration
+	// ResourcePolicy is the Cross-Origin-Resource-Policy of responses,
+	// unless a route group sets its own with ResourcePolicy
+	ResourcePolicy string
+}
+
+// Headers returns a middleware setting the security headers of every response
+func Headers(config HeaderConfig) fiber.Handler {
+	if config.ResourcePolicy == "" {
+		config.ResourcePolicy = ResourceSameOrigin
+	}
+	hsts := ""
+	if config.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(config.HSTSMaxAge.Seconds()))
+	}
+
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		c.Set(fiber.HeaderXFrameOptions, "DENY")
+		// Share link tokens are in URLs, which must not leak to other sites
+		c.Set(fiber.HeaderReferrerPolicy, "no-referrer")
+		c.Set(fiber.HeaderContentSecurityPolicy, APIContentSecurityPolicy)
+		c.Set(fiber.HeaderCrossOriginResourcePolicy, config.ResourcePolicy)
+		if hsts != "" {
+			c.Set(fiber.HeaderStrictTransportSecurity, hsts)
+		}
+
+		return c.Next()
+	}
+}
+
+// ContentSecurityPolicy returns a middleware replacing the
+// Content-Security-Policy of a route, e.g. for an HTML page that needs
+// scripts
+func ContentSecurityPolicy(policy string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentSecurityPolicy, policy)
+		return c.Next()
+	}
+}
+
+// ResourcePolicy returns a middleware setting the Cross-Origin-Resource-Policy
+// of a route group, e.g. cross-origin for images other sites may embed
+func ResourcePolicy(policy string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCrossOriginResourcePolicy, policy)
+		return c.Next()
+	}
+}
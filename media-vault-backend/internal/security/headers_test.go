@@ -0,0 +1,57 @@
+package security
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHeadersKeepAPIPolicyForHTML(t *testing.T) {
+	app := fiber.New()
+	app.Use(Headers(HeaderConfig{HSTSMaxAge: time.Hour}))
+	// User content, such as an HTML file behind a share link
+	app.Get("/s/:token", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString("<script>alert(1)</script>")
+	})
+	app.Get("/api", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{})
+	})
+	app.Get("/admin/monitor", ContentSecurityPolicy(MonitorContentSecurityPolicy), func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString("<html></html>")
+	})
+
+	tests := []struct {
+		path   string
+		policy string
+	}{
+		{"/s/token", APIContentSecurityPolicy},
+		{"/api", APIContentSecurityPolicy},
+		{"/admin/monitor", MonitorContentSecurityPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentSecurityPolicy); got != tt.policy {
+				t.Errorf("Content-Security-Policy = %q, want %q", got, tt.policy)
+			}
+			for header, want := range map[string]string{
+				fiber.HeaderXContentTypeOptions:       "nosniff",
+				fiber.HeaderXFrameOptions:             "DENY",
+				fiber.HeaderReferrerPolicy:            "no-referrer",
+				fiber.HeaderCrossOriginResourcePolicy: ResourceSameOrigin,
+				fiber.HeaderStrictTransportSecurity:   "max-age=3600",
+			} {
+				if got := resp.Header.Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package security sets the CORS and security headers of responses. CORS
+// policies are applied per route group, so that public share links can be
+// fetched from anywhere without credentials while the authenticated API only
+// answers the origins of its own frontends. It also resolves the client IP of
+// requests that come through trusted reverse proxies.
+package security
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidOrigin is returned when an origin pattern cannot be parsed
+var ErrInvalidOrigin = errors.New("invalid origin pattern")
+
+// Origins matches the Origin of requests against a list of patterns
+type Origins struct {
+	any       bool
+	exact     map[string]bool
+	wildcards []origin
+}
+
+// origin is a parsed origin. For wildcard patterns host is the domain whose
+// subdomains match.
+type origin struct {
+	scheme string
+	host   string
+	port   string
+}
+
+// ParseOrigins parses origin patterns: an origin such as
+// https://app.example.com or http://localhost:3000, a wildcard such as
+// https://*.example.com, which matches subdomains at any depth but not
+// example.com itself, or * for any origin.
+func ParseOrigins(patterns []string) (*Origins, error) {
+	origins := &Origins{exact: map[string]bool{}}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), "/")
+		if pattern == "" {
+			continue
+		}
+		if pattern == "*" {
+			origins.any = true
+			continue
+		}
+
+		o, err := parseOrigin(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if domain, ok := strings.CutPrefix(o.host, "*."); ok {
+			if domain == "" || strings.Contains(domain, "*") || !strings.Contains(domain, ".") && domain != "localhost" {
+				return nil, fmt.Errorf("%w: %q, wildcards must be a whole subdomain such as https://*.example.com", ErrInvalidOrigin, pattern)
+			}
+			o.host = domain
+			origins.wildcards = append(origins.wildcards, o)
+			continue
+		}
+		if strings.Contains(o.host, "*") {
+			return nil, fmt.Errorf("%w: %q, wildcards must be a whole subdomain such as https://*.example.com", ErrInvalidOrigin, pattern)
+		}
+		origins.exact[o.String()] = true
+	}
+	return origins, nil
+}
+
+// Any reports whether every origin is allowed
+func (o *Origins) Any() bool {
+	return o.any
+}
+
+// Empty reports whether no origin is allowed
+func (o *Origins) Empty() bool {
+	return !o.any && len(o.exact) == 0 && len(o.wildcards) == 0
+}
+
+// Allows reports whether requests from origin are allowed
+func (o *Origins) Allows(value string) bool {
+	if o.any {
+		return true
+	}
+	req, err := parseOrigin(strings.ToLower(value))
+	if err != nil || strings.Contains(req.host, "*") {
+		return false
+	}
+	if o.exact[req.String()] {
+		return true
+	}
+	for _, w := range o.wildcards {
+		if req.scheme == w.scheme && req.port == w.port && strings.HasSuffix(req.host, "."+w.host) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOrigin parses scheme://host[:port]. Origins have no path, query or
+// user info.
+func parseOrigin(value string) (origin, error) {
+	scheme, hostport, ok := strings.Cut(value, "://")
+	if !ok || (scheme != "http" && scheme != "https") {
+		return origin{}, fmt.Errorf("%w: %q, want http:// or https:// followed by a host", ErrInvalidOrigin, value)
+	}
+	if hostport == "" || strings.ContainsAny(hostport, "/?#@ ") {
+		return origin{}, fmt.Errorf("%w: %q, want scheme://host[:port]", ErrInvalidOrigin, value)
+	}
+
+	o := origin{scheme: scheme, host: hostport}
+	// IPv6 hosts are bracketed, e.g. http://[::1]:8080
+	if i := strings.LastIndexByte(hostport, ':'); i > strings.LastIndexByte(hostport, ']') {
+		o.host, o.port = hostport[:i], hostport[i+1:]
+		if o.port == "" || strings.Trim(o.port, "0123456789") != "" {
+			return origin{}, fmt.Errorf("%w: %q has an invalid port", ErrInvalidOrigin, value)
+		}
+	}
+	// The default port is the same origin as no port
+	if scheme == "http" && o.port == "80" || scheme == "https" && o.port == "443" {
+		o.port = ""
+	}
+	if o.host == "" {
+		return origin{}, fmt.Errorf("%w: %q has no host", ErrInvalidOrigin, value)
+	}
+	return o, nil
+}
+
+func (o origin) String() string {
+	if o.port == "" {
+		return o.scheme + "://" + o.host
+	}
+	return o.scheme + "://" + o.host + ":" + o.port
+}
@@ -0,0 +1,115 @@
+package security
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOriginsAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		origin   string
+		want     bool
+	}{
+		{"exact", []string{"https://app.example.com"}, "https://app.example.com", true},
+		{"exact is case-insensitive", []string{"https://App.Example.com/"}, "HTTPS://app.example.COM", true},
+		{"other host", []string{"https://app.example.com"}, "https://admin.example.com", false},
+		{"other scheme", []string{"https://app.example.com"}, "http://app.example.com", false},
+		{"other port", []string{"http://localhost:3000"}, "http://localhost:3001", false},
+		{"missing port", []string{"http://localhost:3000"}, "http://localhost", false},
+
+		{"wildcard subdomain", []string{"https://*.example.com"}, "https://a.example.com", true},
+		{"wildcard nested subdomain", []string{"https://*.example.com"}, "https://a.b.example.com", true},
+		{"wildcard apex", []string{"https://*.example.com"}, "https://example.com", false},
+		{"wildcard suffix without dot", []string{"https://*.example.com"}, "https://evilexample.com", false},
+		{"wildcard other domain", []string{"https://*.example.com"}, "https://example.com.evil.net", false},
+		{"wildcard other scheme", []string{"https://*.example.com"}, "http://a.example.com", false},
+		{"wildcard other port", []string{"https://*.example.com"}, "https://a.example.com:8443", false},
+		{"wildcard with port", []string{"http://*.localhost:3000"}, "http://app.localhost:3000", true},
+		{"literal wildcard in origin", []string{"https://*.example.com"}, "https://*.example.com", false},
+
+		{"https default port in pattern", []string{"https://app.example.com:443"}, "https://app.example.com", true},
+		{"https default port in origin", []string{"https://app.example.com"}, "https://app.example.com:443", true},
+		{"http default port", []string{"http://localhost:80"}, "http://localhost", true},
+		{"https port on http", []string{"http://localhost"}, "http://localhost:443", false},
+		{"wildcard default port", []string{"https://*.example.com"}, "https://a.example.com:443", true},
+
+		{"IPv6", []string{"http://[::1]:8080"}, "http://[::1]:8080", true},
+		{"IPv6 other port", []string{"http://[::1]:8080"}, "http://[::1]:8081", false},
+		{"IPv6 default port", []string{"https://[::1]"}, "https://[::1]:443", true},
+		{"IPv6 other address", []string{"http://[::1]:8080"}, "http://[::2]:8080", false},
+
+		{"null", []string{"https://app.example.com"}, "null", false},
+		{"empty", []string{"https://app.example.com"}, "", false},
+		{"path", []string{"https://app.example.com"}, "https://app.example.com/path", false},
+		{"user info", []string{"https://app.example.com"}, "https://user@app.example.com", false},
+		{"invalid port", []string{"http://localhost:3000"}, "http://localhost:3000x", false},
+		{"no scheme", []string{"https://app.example.com"}, "app.example.com", false},
+		{"other scheme entirely", []string{"https://app.example.com"}, "file://app.example.com", false},
+
+		{"any", []string{"*"}, "https://anything.test", true},
+		{"any allows null", []string{"*"}, "null", true},
+		{"none", nil, "https://app.example.com", false},
+		{"one of several", []string{"https://a.example.com", "https://*.example.net"}, "https://b.example.net", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origins, err := ParseOrigins(tt.patterns)
+			if err != nil {
+				t.Fatalf("ParseOrigins(%q): %v", tt.patterns, err)
+			}
+			if got := origins.Allows(tt.origin); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOriginsRejectsMalformed(t *testing.T) {
+	for _, pattern := range []string{
+		"null",
+		"app.example.com",
+		"ftp://app.example.com",
+		"https://",
+		"https://app.example.com/path",
+		"https://app.example.com?q",
+		"https://user@app.example.com",
+		"https://app.example.com:",
+		"https://app.example.com:https",
+		"https://:443",
+		"https://*example.com",
+		"https://a.*.example.com",
+		"https://*.*.example.com",
+		"https://*.com",
+		"https://*.",
+	} {
+		t.Run(pattern, func(t *testing.T) {
+			if _, err := ParseOrigins([]string{pattern}); !errors.Is(err, ErrInvalidOrigin) {
+				t.Errorf("ParseOrigins(%q) error = %v, want ErrInvalidOrigin", pattern, err)
+			}
+		})
+	}
+}
+
+func TestOriginsAnyAndEmpty(t *testing.T) {
+	tests := []struct {
+		patterns  []string
+		any, none bool
+	}{
+		{nil, false, true},
+		{[]string{"", " "}, false, true},
+		{[]string{"*"}, true, false},
+		{[]string{"https://app.example.com"}, false, false},
+		{[]string{"https://*.example.com"}, false, false},
+	}
+	for _, tt := range tests {
+		origins, err := ParseOrigins(tt.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if origins.Any() != tt.any || origins.Empty() != tt.none {
+			t.Errorf("%q: Any() = %v, Empty() = %v, want %v, %v", tt.patterns, origins.Any(), origins.Empty(), tt.any, tt.none)
+		}
+	}
+}
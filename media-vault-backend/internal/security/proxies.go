@@ -0,0 +1,107 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrInvalidProxy is returned when a trusted proxy cannot be parsed
+var ErrInvalidProxy = errors.New("invalid trusted proxy")
+
+// ClientIPHeader is the request header ForwardedFor sets to the client IP.
+// Configure it as Fiber's ProxyHeader, with EnableIPValidation, so that
+// c.IP() returns the client IP.
+const ClientIPHeader = "X-Media-Vault-Client-IP"
+
+// Proxies matches addresses against the reverse proxies trusted to append to
+// X-Forwarded-For
+type Proxies struct {
+	networks []*net.IPNet
+}
+
+// ParseProxies parses trusted proxies given as IPs or CIDRs
+func ParseProxies(proxies []string) (*Proxies, error) {
+	p := &Proxies{}
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			p.networks = append(p.networks, network)
+			continue
+		}
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidProxy, proxy)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		p.networks = append(p.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return p, nil
+}
+
+// Trusted reports whether ip is a trusted proxy
+func (p *Proxies) Trusted(ip net.IP) bool {
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the client IP of a request received from remote with the
+// given X-Forwarded-For headers, or "" if remote is the client. Each proxy
+// appends the address it received the request from, and anything left of the
+// first trusted proxy is what the client sent, so the client is the rightmost
+// hop that is not a trusted proxy. If every hop is trusted, the client is the
+// leftmost; if a hop cannot be parsed, it is the proxy that appended it.
+func (p *Proxies) ClientIP(remote net.IP, forwardedFor []string) string {
+	if !p.Trusted(remote) {
+		return ""
+	}
+
+	var hops []string
+	for _, header := range forwardedFor {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !p.Trusted(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// ForwardedFor returns a middleware setting ClientIPHeader to the client IP
+// that proxies reported in X-Forwarded-For. Clients cannot set the header
+// themselves: it is always replaced.
+func ForwardedFor(proxies *Proxies) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := &c.Request().Header
+		header.Del(ClientIPHeader)
+
+		var forwardedFor []string
+		for _, value := range header.PeekAll(fiber.HeaderXForwardedFor) {
+			forwardedFor = append(forwardedFor, string(value))
+		}
+		if ip := proxies.ClientIP(c.Context().RemoteIP(), forwardedFor); ip != "" {
+			header.Set(ClientIPHeader, ip)
+		}
+		return c.Next()
+	}
+}
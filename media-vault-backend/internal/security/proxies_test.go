@@ -0,0 +1,101 @@
+package security
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestProxiesClientIP(t *testing.T) {
+	proxies, err := ParseProxies([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remote       string
+		forwardedFor []string
+		want         string
+	}{
+		{"untrusted remote", "203.0.113.9", []string{"198.51.100.1"}, ""},
+		{"no header", "10.0.0.1", nil, "10.0.0.1"},
+		{"one proxy", "10.0.0.1", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed leftmost", "10.0.0.1", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.0.0.1", []string{"1.2.3.4, 198.51.100.1, 10.0.0.2, 192.168.1.1"}, "198.51.100.1"},
+		{"several headers", "10.0.0.1", []string{"1.2.3.4", "198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"all trusted", "10.0.0.1", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"garbage from client", "10.0.0.1", []string{"not-an-ip, 198.51.100.1"}, "198.51.100.1"},
+		{"garbage after proxy", "10.0.0.1", []string{"198.51.100.1, not-an-ip"}, "10.0.0.1"},
+		{"garbage behind trusted hop", "10.0.0.1", []string{"198.51.100.1, bogus, 10.0.0.2"}, "10.0.0.2"},
+		{"IPv6", "fd00::1", []string{"2001:db8::1, fd00::2"}, "2001:db8::1"},
+		{"IPv4-mapped proxy", "::ffff:10.0.0.1", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := proxies.ClientIP(net.ParseIP(tt.remote), tt.forwardedFor); got != tt.want {
+				t.Errorf("ClientIP(%s, %q) = %q, want %q", tt.remote, tt.forwardedFor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProxiesRejectsMalformed(t *testing.T) {
+	for _, proxy := range []string{"proxy.internal", "10.0.0.0/33", "10.0.0", "::g"} {
+		if _, err := ParseProxies([]string{proxy}); !errors.Is(err, ErrInvalidProxy) {
+			t.Errorf("ParseProxies(%q) error = %v, want ErrInvalidProxy", proxy, err)
+		}
+	}
+}
+
+// TestForwardedForSetsIP configures Fiber as the API does behind a proxy and
+// checks that clients cannot pick their IP
+func TestForwardedForSetsIP(t *testing.T) {
+	// Requests made by app.Test come from 0.0.0.0
+	trusted := []string{"0.0.0.0"}
+	proxies, err := ParseProxies(trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{
+		ProxyHeader:             ClientIPHeader,
+		EnableIPValidation:      true,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          trusted,
+	})
+	app.Use(ForwardedFor(proxies))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(c.IP())
+	})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"proxied", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"spoofed leftmost", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"client IP header from client", map[string]string{ClientIPHeader: "1.2.3.4", "X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"not proxied", nil, "0.0.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.want {
+				t.Errorf("IP = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,691 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/models"
+)
+
+// MaxAlbumTitleLength bounds album titles
+const MaxAlbumTitleLength = 200
+
+var (
+	// ErrAlbumNotFound is returned when an album does not exist
+	ErrAlbumNotFound = apperr.NotFound("album_not_found", "album not found")
+	// ErrInvalidAlbum is returned for album changes that are not allowed
+	ErrInvalidAlbum = apperr.Invalid("invalid_album", "invalid album")
+)
+
+const albumColumns = `a.id, a.user_id, a.parent_id, a.title, a.description, a.cover_photo_id,
+	a.kind, a.query, a.created_at, a.updated_at,
+	(SELECT COUNT(*) FROM album_photos ap JOIN photos p ON p.id = ap.photo_id
+		WHERE ap.album_id = a.id AND p.deleted_at IS NULL)`
+
+// AlbumService manages albums, nested albums and smart albums
+type AlbumService struct {
+	db           *sql.DB
+	photoService *PhotoService
+}
+
+// NewAlbumService creates a new AlbumService
+func NewAlbumService(db *sql.DB, photoService *PhotoService) *AlbumService {
+	return &AlbumService{
+		db:           db,
+		photoService: photoService,
+	}
+}
+
+// CreateAlbum creates an album for the user. A request with a query creates a
+// smart album.
+func (s *AlbumService) CreateAlbum(ctx context.Context, userID string, req models.AlbumRequest) (*models.Album, error) {
+	if req.Title == nil {
+		return nil, fmt.Errorf("%w: title is required", ErrInvalidAlbum)
+	}
+	title, err := albumTitle(*req.Title)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := models.AlbumKindManual
+	var query interface{}
+	if hasQuery(req.Query) {
+		normalized, err := normalizeAlbumQuery(req.Query)
+		if err != nil {
+			return nil, err
+		}
+		kind, query = models.AlbumKindSmart, normalized
+	}
+
+	id := uuid.New().String()
+	var parentID, coverID interface{}
+	if req.ParentID != nil && *req.ParentID != "" {
+		if err := s.checkParent(ctx, userID, id, *req.ParentID); err != nil {
+			return nil, err
+		}
+		parentID = *req.ParentID
+	}
+	if req.CoverPhotoID != nil && *req.CoverPhotoID != "" {
+		if err := s.checkPhotoEligible(ctx, userID, *req.CoverPhotoID); err != nil {
+			return nil, err
+		}
+		coverID = *req.CoverPhotoID
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO albums (id, user_id, parent_id, title, description, cover_photo_id, kind, query)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, userID, parentID, title, nullString(req.Description), coverID, kind, query); err != nil {
+		return nil, err
+	}
+
+	return s.GetAlbum(ctx, id)
+}
+
+// GetAlbum returns an album with its photo count and direct sub-albums
+func (s *AlbumService) GetAlbum(ctx context.Context, id string) (*models.Album, error) {
+	album, err := s.scanAlbum(ctx, s.db.QueryRowContext(ctx, `SELECT `+albumColumns+` FROM albums a WHERE a.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrAlbumNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if album.Children, err = s.queryAlbums(ctx, `WHERE a.parent_id = ? ORDER BY a.title`, id); err != nil {
+		return nil, err
+	}
+
+	return album, nil
+}
+
+// ListAlbums lists the user's albums below parentID, or the top-level albums
+// when parentID is empty
+func (s *AlbumService) ListAlbums(ctx context.Context, userID, parentID string) ([]*models.Album, error) {
+	if parentID == "" {
+		return s.queryAlbums(ctx, `WHERE a.user_id = ? AND a.parent_id IS NULL ORDER BY a.title`, userID)
+	}
+	return s.queryAlbums(ctx, `WHERE a.user_id = ? AND a.parent_id = ? ORDER BY a.title`, userID, parentID)
+}
+
+// ListSharedAlbums lists albums other users have shared with the user
+func (s *AlbumService) ListSharedAlbums(ctx context.Context, userID string) ([]*models.Album, error) {
+	return s.queryAlbums(ctx, `
+		WHERE a.id IN (
+			SELECT album_id FROM album_sharing
+			WHERE shared_with = ? AND (expires_at IS NULL OR expires_at > ?)
+		)
+		ORDER BY a.title`, userID, time.Now().UTC())
+}
+
+// UpdateAlbum changes an album's title, description, parent, cover or, for
+// smart albums, query. Omitted fields are left unchanged.
+func (s *AlbumService) UpdateAlbum(ctx context.Context, id string, req models.AlbumRequest) (*models.Album, error) {
+	album, err := s.GetAlbum(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var sets []string
+	var args []interface{}
+
+	if req.Title != nil {
+		title, err := albumTitle(*req.Title)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, "title = ?")
+		args = append(args, title)
+	}
+	if req.Description != nil {
+		sets = append(sets, "description = ?")
+		args = append(args, nullString(req.Description))
+	}
+	if req.ParentID != nil {
+		var parentID interface{}
+		if *req.ParentID != "" {
+			if err := s.checkParent(ctx, album.UserID, id, *req.ParentID); err != nil {
+				return nil, err
+			}
+			parentID = *req.ParentID
+		}
+		sets = append(sets, "parent_id = ?")
+		args = append(args, parentID)
+	}
+	if req.CoverPhotoID != nil {
+		var coverID interface{}
+		if *req.CoverPhotoID != "" {
+			if err := s.checkPhotoEligible(ctx, album.UserID, *req.CoverPhotoID); err != nil {
+				return nil, err
+			}
+			coverID = *req.CoverPhotoID
+		}
+		sets = append(sets, "cover_photo_id = ?")
+		args = append(args, coverID)
+	}
+	if hasQuery(req.Query) {
+		if album.Kind != models.AlbumKindSmart {
+			return nil, fmt.Errorf("%w: only smart albums have a query", ErrInvalidAlbum)
+		}
+		normalized, err := normalizeAlbumQuery(req.Query)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, "query = ?")
+		args = append(args, normalized)
+	}
+
+	if len(sets) == 0 {
+		return album, nil
+	}
+
+	sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
+	args = append(args, id)
+	if _, err := s.db.ExecContext(ctx, `UPDATE albums SET `+strings.Join(sets, ", ")+` WHERE id = ?`, args...); err != nil {
+		return nil, err
+	}
+
+	return s.GetAlbum(ctx, id)
+}
+
+// DeleteAlbum deletes an album together with its sub-albums and shares. The
+// photos themselves are kept.
+func (s *AlbumService) DeleteAlbum(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM albums WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAlbumNotFound
+	}
+	return nil
+}
+
+// AlbumPhotos returns a page of an album's photos: manual albums in their
+// stored order, smart albums as their query returns them
+func (s *AlbumService) AlbumPhotos(ctx context.Context, album *models.Album, page, limit int) (*PhotoPage, error) {
+	if album.Kind == models.AlbumKindSmart {
+		q, err := albumQuery(album)
+		if err != nil {
+			return nil, err
+		}
+		q.Page, q.Limit = page, limit
+		return s.photoService.ListPhotos(ctx, q)
+	}
+
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+prefixColumns("p", photoColumns)+`
+		FROM album_photos ap
+		JOIN photos p ON p.id = ap.photo_id
+		WHERE ap.album_id = ? AND p.deleted_at IS NULL
+		ORDER BY ap.position, ap.added_at
+		LIMIT ? OFFSET ?
+	`, album.ID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &PhotoPage{Photos: []*models.Photo{}, Total: album.PhotoCount, Page: page, Limit: limit}
+	for rows.Next() {
+		photo, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Photos = append(result.Photos, photo)
+	}
+
+	return result, rows.Err()
+}
+
+// AddPhotos adds photos to a manual album at position (appended when nil).
+// Only photos the album owner owns or delivered as a partner can be added;
+// other IDs are returned as skipped. Photos already in the album are kept
+// where they are.
+func (s *AlbumService) AddPhotos(ctx context.Context, album *models.Album, photoIDs []string, position *int, addedBy string) (added, skipped []string, err error) {
+	if album.Kind != models.AlbumKindManual {
+		return nil, nil, fmt.Errorf("%w: photos cannot be added to a smart album", ErrInvalidAlbum)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	order, err := albumOrder(ctx, tx, album.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	members := make(map[string]bool, len(order))
+	for _, id := range order {
+		members[id] = true
+	}
+
+	for _, photoID := range photoIDs {
+		if members[photoID] {
+			continue
+		}
+		var ok int
+		err := tx.QueryRowContext(ctx, `
+			SELECT 1 FROM photos WHERE id = ? AND (user_id = ? OR partner_id = ?) AND deleted_at IS NULL
+		`, photoID, album.UserID, album.UserID).Scan(&ok)
+		if err == sql.ErrNoRows {
+			skipped = append(skipped, photoID)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO album_photos (album_id, photo_id, position, added_by) VALUES (?, ?, ?, ?)
+		`, album.ID, photoID, len(order)+len(added), addedBy); err != nil {
+			return nil, nil, err
+		}
+		members[photoID] = true
+		added = append(added, photoID)
+	}
+
+	if position != nil && len(added) > 0 {
+		at := *position
+		if at < 0 {
+			at = 0
+		}
+		if at > len(order) {
+			at = len(order)
+		}
+		newOrder := make([]string, 0, len(order)+len(added))
+		newOrder = append(newOrder, order[:at]...)
+		newOrder = append(newOrder, added...)
+		newOrder = append(newOrder, order[at:]...)
+		if err := writeAlbumOrder(ctx, tx, album.ID, newOrder); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := touchAlbum(ctx, tx, album.ID); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return added, skipped, nil
+}
+
+// RemovePhotos removes photos from a manual album and returns how many were
+// removed
+func (s *AlbumService) RemovePhotos(ctx context.Context, album *models.Album, photoIDs []string) (int, error) {
+	if album.Kind != models.AlbumKindManual {
+		return 0, fmt.Errorf("%w: photos cannot be removed from a smart album", ErrInvalidAlbum)
+	}
+	if len(photoIDs) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{album.ID}
+	for _, id := range photoIDs {
+		args = append(args, id)
+	}
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM album_photos WHERE album_id = ? AND photo_id IN (`+placeholders(len(photoIDs))+`)
+	`, args...)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// Keep positions dense and drop a cover that is no longer in the album
+	order, err := albumOrder(ctx, tx, album.ID)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeAlbumOrder(ctx, tx, album.ID, order); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE albums SET cover_photo_id = NULL
+		WHERE id = ? AND cover_photo_id IN (`+placeholders(len(photoIDs))+`)
+	`, args...); err != nil {
+		return 0, err
+	}
+	if err := touchAlbum(ctx, tx, album.ID); err != nil {
+		return 0, err
+	}
+
+	return int(removed), tx.Commit()
+}
+
+// ReorderPhotos moves the given photos to the front of a manual album in the
+// given order; the remaining photos keep their relative order after them
+func (s *AlbumService) ReorderPhotos(ctx context.Context, album *models.Album, photoIDs []string) error {
+	if album.Kind != models.AlbumKindManual {
+		return fmt.Errorf("%w: smart albums are ordered by their query", ErrInvalidAlbum)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	order, err := albumOrder(ctx, tx, album.ID)
+	if err != nil {
+		return err
+	}
+	members := make(map[string]bool, len(order))
+	for _, id := range order {
+		members[id] = true
+	}
+
+	newOrder := make([]string, 0, len(order))
+	placed := make(map[string]bool, len(photoIDs))
+	for _, id := range photoIDs {
+		if !members[id] {
+			return fmt.Errorf("%w: photo %s is not in the album", ErrInvalidAlbum, id)
+		}
+		if !placed[id] {
+			newOrder = append(newOrder, id)
+			placed[id] = true
+		}
+	}
+	for _, id := range order {
+		if !placed[id] {
+			newOrder = append(newOrder, id)
+		}
+	}
+
+	if err := writeAlbumOrder(ctx, tx, album.ID, newOrder); err != nil {
+		return err
+	}
+	if err := touchAlbum(ctx, tx, album.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ContainsPhoto reports whether a photo belongs to the album or to one of
+// its sub-albums, including smart albums whose query matches it
+func (s *AlbumService) ContainsPhoto(ctx context.Context, album *models.Album, photoID string) (bool, error) {
+	const tree = `
+		WITH RECURSIVE tree(id) AS (
+			SELECT ?
+			UNION
+			SELECT a.id FROM albums a JOIN tree t ON a.parent_id = t.id
+		)`
+
+	var count int
+	err := s.db.QueryRowContext(ctx, tree+`
+		SELECT COUNT(*) FROM album_photos ap JOIN tree t ON t.id = ap.album_id
+		WHERE ap.photo_id = ?
+	`, album.ID, photoID).Scan(&count)
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	smart, err := s.queryAlbums(ctx, `JOIN (`+tree+` SELECT id FROM tree) t ON t.id = a.id WHERE a.kind = ?`, album.ID, models.AlbumKindSmart)
+	if err != nil {
+		return false, err
+	}
+	for _, sub := range smart {
+		q, err := albumQuery(sub)
+		if err != nil {
+			continue
+		}
+		if ok, err := queryMatchesPhoto(ctx, s.db, q, photoID); err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+func (s *AlbumService) queryAlbums(ctx context.Context, clause string, args ...interface{}) ([]*models.Album, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+albumColumns+` FROM albums a `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	albums := []*models.Album{}
+	for rows.Next() {
+		album, err := scanAlbumRow(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Smart album counts come from their query, which needs its own statement
+	for _, album := range albums {
+		if err := s.countSmartAlbum(ctx, album); err != nil {
+			return nil, err
+		}
+	}
+
+	return albums, nil
+}
+
+func (s *AlbumService) scanAlbum(ctx context.Context, row rowScanner) (*models.Album, error) {
+	album, err := scanAlbumRow(row)
+	if err != nil {
+		return nil, err
+	}
+	return album, s.countSmartAlbum(ctx, album)
+}
+
+func (s *AlbumService) countSmartAlbum(ctx context.Context, album *models.Album) error {
+	if album.Kind != models.AlbumKindSmart {
+		return nil
+	}
+	q, err := albumQuery(album)
+	if err != nil {
+		return err
+	}
+	if err := q.Normalize(); err != nil {
+		return err
+	}
+	where, args := q.where()
+	return s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM photos WHERE `+where, args...).Scan(&album.PhotoCount)
+}
+
+// checkParent verifies that parentID is one of the user's albums and that
+// making it the parent of albumID would not create a cycle
+func (s *AlbumService) checkParent(ctx context.Context, userID, albumID, parentID string) error {
+	var ownerID string
+	err := s.db.QueryRowContext(ctx, `SELECT user_id FROM albums WHERE id = ?`, parentID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		return fmt.Errorf("%w: parent album not found", ErrInvalidAlbum)
+	}
+	if err != nil {
+		return err
+	}
+
+	var cycles int
+	err = s.db.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors(id) AS (
+			SELECT ?
+			UNION
+			SELECT a.parent_id FROM albums a JOIN ancestors anc ON a.id = anc.id
+			WHERE a.parent_id IS NOT NULL
+		)
+		SELECT COUNT(*) FROM ancestors WHERE id = ?
+	`, parentID, albumID).Scan(&cycles)
+	if err != nil {
+		return err
+	}
+	if cycles > 0 {
+		return fmt.Errorf("%w: an album cannot be nested inside itself", ErrInvalidAlbum)
+	}
+
+	return nil
+}
+
+// checkPhotoEligible verifies that the user owns or delivered the photo
+func (s *AlbumService) checkPhotoEligible(ctx context.Context, userID, photoID string) error {
+	var ok int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 1 FROM photos WHERE id = ? AND (user_id = ? OR partner_id = ?) AND deleted_at IS NULL
+	`, photoID, userID, userID).Scan(&ok)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: photo %s not found", ErrInvalidAlbum, photoID)
+	}
+	return err
+}
+
+func scanAlbumRow(row rowScanner) (*models.Album, error) {
+	var album models.Album
+	var query sql.NullString
+	if err := row.Scan(
+		&album.ID,
+		&album.UserID,
+		&album.ParentID,
+		&album.Title,
+		&album.Description,
+		&album.CoverPhotoID,
+		&album.Kind,
+		&query,
+		&album.CreatedAt,
+		&album.UpdatedAt,
+		&album.PhotoCount,
+	); err != nil {
+		return nil, err
+	}
+	if query.Valid && query.String != "" {
+		album.Query = json.RawMessage(query.String)
+	}
+	return &album, nil
+}
+
+// albumQuery decodes a smart album's query, scoped to the album owner's
+// photos, including those delivered as a partner
+func albumQuery(album *models.Album) (PhotoQuery, error) {
+	var q PhotoQuery
+	if len(album.Query) > 0 {
+		if err := json.Unmarshal(album.Query, &q); err != nil {
+			return q, fmt.Errorf("%w: %v", ErrInvalidAlbum, err)
+		}
+	}
+	q.UserID = album.UserID
+	q.AsPartner = true
+	return q, nil
+}
+
+// normalizeAlbumQuery validates a smart album query and re-encodes it
+func normalizeAlbumQuery(raw json.RawMessage) (string, error) {
+	var q PhotoQuery
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&q); err != nil {
+		return "", fmt.Errorf("%w: query: %v", ErrInvalidAlbum, err)
+	}
+	if err := q.Normalize(); err != nil {
+		return "", fmt.Errorf("%w: query: %v", ErrInvalidAlbum, err)
+	}
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func hasQuery(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null"))
+}
+
+func albumTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", fmt.Errorf("%w: title is required", ErrInvalidAlbum)
+	}
+	if len([]rune(title)) > MaxAlbumTitleLength {
+		return "", fmt.Errorf("%w: title must be at most %d characters", ErrInvalidAlbum, MaxAlbumTitleLength)
+	}
+	return title, nil
+}
+
+// albumOrder returns the album's photo IDs in order
+func albumOrder(ctx context.Context, tx *sql.Tx, albumID string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT photo_id FROM album_photos WHERE album_id = ? ORDER BY position, added_at
+	`, albumID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var order []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		order = append(order, id)
+	}
+	return order, rows.Err()
+}
+
+// writeAlbumOrder renumbers the album's photos to match order
+func writeAlbumOrder(ctx context.Context, tx *sql.Tx, albumID string, order []string) error {
+	stmt, err := tx.PrepareContext(ctx, `UPDATE album_photos SET position = ? WHERE album_id = ? AND photo_id = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, photoID := range order {
+		if _, err := stmt.ExecContext(ctx, i, albumID, photoID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func touchAlbum(ctx context.Context, tx *sql.Tx, albumID string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE albums SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, albumID)
+	return err
+}
+
+// nullString maps nil and blank strings to NULL
+func nullString(s *string) interface{} {
+	if s == nil || strings.TrimSpace(*s) == "" {
+		return nil
+	}
+	return strings.TrimSpace(*s)
+}
@@ -0,0 +1,484 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+)
+
+// Audited actions. Actions are named "<target type>.<verb>".
+const (
+	AuditPhotoUpload         = "photo.upload"
+	AuditPhotoUpdate         = "photo.update"
+	AuditPhotoDelete         = "photo.delete"
+	AuditPhotoRestore        = "photo.restore"
+	AuditPhotoPurge          = "photo.purge"
+	AuditPhotoExport         = "photo.export"
+	AuditPhotoVersionUpload  = "photo.version_upload"
+	AuditPhotoVersionRestore = "photo.version_restore"
+	AuditPhotoShare          = "photo.share"
+	AuditPhotoTag            = "photo.tag"
+	AuditAlbumCreate         = "album.create"
+	AuditAlbumUpdate         = "album.update"
+	AuditAlbumDelete         = "album.delete"
+	AuditAlbumShare          = "album.share"
+	AuditAlbumUnshare        = "album.unshare"
+	AuditFileUpload          = "file.upload"
+	AuditFileUpdate          = "file.update"
+	AuditFileDelete          = "file.delete"
+	AuditFileShare           = "file.share"
+	AuditFileUnshare         = "file.unshare"
+	AuditFolderMove          = "folder.move"
+	AuditShareLinkCreate     = "share_link.create"
+	AuditShareLinkRevoke     = "share_link.revoke"
+	AuditTagRename           = "tag.rename"
+	AuditTagMerge            = "tag.merge"
+	AuditTagDelete           = "tag.delete"
+	AuditUserCreate          = "user.create"
+	AuditUserUpdate          = "user.update"
+	AuditUserEnable          = "user.enable"
+	AuditUserDisable         = "user.disable"
+	AuditUserRoles           = "user.roles"
+	AuditUserPasswordReset   = "user.password_reset"
+	AuditUserDelete          = "user.delete"
+	AuditUserQuota           = "user.quota"
+	AuditAuditExport         = "audit.export"
+	AuditKeysRotate          = "keys.rotate"
+)
+
+// AuditSystemActor is the actor of events not caused by a request, such as
+// the scheduled trash purge
+const AuditSystemActor = "system"
+
+// MaxAuditPageSize is the largest page of audit events returned at once
+const MaxAuditPageSize = 500
+
+// ErrInvalidAuditQuery is returned for malformed audit log filters
+var ErrInvalidAuditQuery = apperr.Invalid("invalid_audit_query", "invalid audit log query")
+
+// AuditEvent is one entry in the audit log. Before and After hold the fields
+// of the target that changed, with their old and new values; creations only
+// have After and deletions only Before.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	Time       time.Time       `json:"time"`
+	ActorID    string          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	PrevHash   string          `json:"prev_hash,omitempty"`
+	Hash       string          `json:"hash,omitempty"`
+}
+
+// SetChange records the difference between before and after, which are
+// marshalled to JSON objects. Either may be nil.
+func (e *AuditEvent) SetChange(before, after interface{}) error {
+	b, err := auditFields(before)
+	if err != nil {
+		return err
+	}
+	a, err := auditFields(after)
+	if err != nil {
+		return err
+	}
+
+	if b != nil && a != nil {
+		// Keep only the fields that changed
+		for key, old := range b {
+			if value, ok := a[key]; ok && reflect.DeepEqual(old, value) {
+				delete(b, key)
+				delete(a, key)
+			}
+		}
+	}
+
+	if e.Before, err = marshalAuditFields(b); err != nil {
+		return err
+	}
+	e.After, err = marshalAuditFields(a)
+	return err
+}
+
+// AuditQuery filters the audit log. Actions may end in "*" to match a
+// prefix, e.g. "photo.*".
+type AuditQuery struct {
+	ActorID    string
+	Actions    []string
+	TargetType string
+	TargetID   string
+	RequestID  string
+	IP         string
+	From       *time.Time
+	To         *time.Time
+	Page       int
+	Limit      int
+}
+
+// AuditPage is one page of audit events, newest first
+type AuditPage struct {
+	Events []*AuditEvent `json:"data"`
+	Total  int           `json:"total"`
+	Page   int           `json:"page"`
+	Limit  int           `json:"limit"`
+}
+
+// ChainStatus is the result of verifying the audit log's hash chain
+type ChainStatus struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// AuditService records security- and data-relevant actions in the
+// append-only audit_events table. With the hash chain enabled every event
+// stores the SHA-256 of its content and of the previous event's hash, so
+// edits to or removal of earlier events are detected by VerifyChain.
+type AuditService struct {
+	db        *sql.DB
+	hashChain bool
+	mu        sync.Mutex // serializes chained inserts
+}
+
+// NewAuditService creates a new AuditService
+func NewAuditService(db *sql.DB, hashChain bool) *AuditService {
+	return &AuditService{db: db, hashChain: hashChain}
+}
+
+// Record appends an event to the audit log. The event's ID, time and hashes
+// are filled in.
+func (s *AuditService) Record(ctx context.Context, e *AuditEvent) error {
+	if e.Action == "" || e.ActorID == "" {
+		return errors.New("audit events need an actor and an action")
+	}
+	e.Time = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if s.hashChain {
+		var prev sql.NullString
+		err := tx.QueryRowContext(ctx, `
+			SELECT hash FROM audit_events WHERE hash IS NOT NULL ORDER BY id DESC LIMIT 1
+		`).Scan(&prev)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		e.PrevHash = prev.String
+		e.Hash = auditHash(e)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_events (
+			time, actor_id, action, target_type, target_id, ip, user_agent, request_id,
+			before, after, prev_hash, hash
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		e.Time,
+		e.ActorID,
+		e.Action,
+		e.TargetType,
+		nullIfEmpty(e.TargetID),
+		nullIfEmpty(e.IP),
+		nullIfEmpty(e.UserAgent),
+		nullIfEmpty(e.RequestID),
+		nullJSON(e.Before),
+		nullJSON(e.After),
+		nullIfEmpty(e.PrevHash),
+		nullIfEmpty(e.Hash),
+	)
+	if err != nil {
+		return err
+	}
+	if e.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListEvents returns one page of audit events matching the query
+func (s *AuditService) ListEvents(ctx context.Context, q AuditQuery) (*AuditPage, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxAuditPageSize {
+		q.Limit = MaxAuditPageSize
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+
+	where, args, err := q.where()
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AuditPage{Events: []*AuditEvent{}, Page: q.Page, Limit: q.Limit}
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_events WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+auditColumns+`
+		FROM audit_events
+		WHERE `+where+`
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, q.Limit, (q.Page-1)*q.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Events = append(page.Events, e)
+	}
+
+	return page, rows.Err()
+}
+
+// ExportEvents writes all events matching the query to w as newline-delimited
+// JSON, oldest first. Paging fields are ignored.
+func (s *AuditService) ExportEvents(ctx context.Context, q AuditQuery, w io.Writer) (int, error) {
+	where, args, err := q.where()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_events WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	written := 0
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return written, err
+		}
+		if err := enc.Encode(e); err != nil {
+			return written, err
+		}
+		written++
+	}
+
+	return written, rows.Err()
+}
+
+// VerifyChain recomputes the hash chain over all chained events and reports
+// the first event whose hash or link to its predecessor doesn't match
+func (s *AuditService) VerifyChain(ctx context.Context) (*ChainStatus, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_events WHERE hash IS NOT NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	status := &ChainStatus{Valid: true}
+	prev := ""
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		status.Checked++
+
+		switch {
+		case e.PrevHash != prev:
+			status.Reason = "event does not link to the previous event; events were removed or reordered"
+		case auditHash(e) != e.Hash:
+			status.Reason = "event content does not match its hash; the event was modified"
+		default:
+			prev = e.Hash
+			continue
+		}
+		status.Valid = false
+		status.BrokenAt = &e.ID
+		break
+	}
+
+	return status, rows.Err()
+}
+
+const auditColumns = `id, time, actor_id, action, target_type, target_id, ip, user_agent, request_id,
+	before, after, prev_hash, hash`
+
+// Validate checks the query's filters for consistency
+func (q *AuditQuery) Validate() error {
+	if q.From != nil && q.To != nil && q.To.Before(*q.From) {
+		return fmt.Errorf("%w: to must not be before from", ErrInvalidAuditQuery)
+	}
+	return nil
+}
+
+// where builds the WHERE clause and arguments for the query's filters
+func (q *AuditQuery) where() (string, []interface{}, error) {
+	conds := []string{"1 = 1"}
+	var args []interface{}
+
+	add := func(cond, value string) {
+		if value != "" {
+			conds = append(conds, cond)
+			args = append(args, value)
+		}
+	}
+	add("actor_id = ?", q.ActorID)
+	add("target_type = ?", q.TargetType)
+	add("target_id = ?", q.TargetID)
+	add("request_id = ?", q.RequestID)
+	add("ip = ?", q.IP)
+
+	if len(q.Actions) > 0 {
+		var actionConds []string
+		for _, action := range q.Actions {
+			if prefix, ok := strings.CutSuffix(action, "*"); ok {
+				actionConds = append(actionConds, `action LIKE ? ESCAPE '\'`)
+				args = append(args, escapeLike(prefix)+"%")
+			} else {
+				actionConds = append(actionConds, "action = ?")
+				args = append(args, action)
+			}
+		}
+		conds = append(conds, "("+strings.Join(actionConds, " OR ")+")")
+	}
+
+	if err := q.Validate(); err != nil {
+		return "", nil, err
+	}
+	if q.From != nil {
+		conds = append(conds, "time >= ?")
+		args = append(args, q.From.UTC())
+	}
+	if q.To != nil {
+		conds = append(conds, "time < ?")
+		args = append(args, q.To.UTC())
+	}
+
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// auditHash returns the hex SHA-256 of the event's previous hash and content
+func auditHash(e *AuditEvent) string {
+	content, _ := json.Marshal(struct {
+		Time       string          `json:"time"`
+		ActorID    string          `json:"actor_id"`
+		Action     string          `json:"action"`
+		TargetType string          `json:"target_type"`
+		TargetID   string          `json:"target_id"`
+		IP         string          `json:"ip"`
+		UserAgent  string          `json:"user_agent"`
+		RequestID  string          `json:"request_id"`
+		Before     json.RawMessage `json:"before"`
+		After      json.RawMessage `json:"after"`
+	}{
+		e.Time.UTC().Format(time.RFC3339Nano),
+		e.ActorID,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		e.IP,
+		e.UserAgent,
+		e.RequestID,
+		nullRaw(e.Before),
+		nullRaw(e.After),
+	})
+
+	h := sha256.New()
+	h.Write([]byte(e.PrevHash))
+	h.Write([]byte{'\n'})
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func scanAuditEvent(row rowScanner) (*AuditEvent, error) {
+	var e AuditEvent
+	var targetID, ip, userAgent, requestID, before, after, prevHash, hash sql.NullString
+	if err := row.Scan(
+		&e.ID,
+		&e.Time,
+		&e.ActorID,
+		&e.Action,
+		&e.TargetType,
+		&targetID,
+		&ip,
+		&userAgent,
+		&requestID,
+		&before,
+		&after,
+		&prevHash,
+		&hash,
+	); err != nil {
+		return nil, err
+	}
+	e.Time = e.Time.UTC()
+	e.TargetID, e.IP, e.UserAgent, e.RequestID = targetID.String, ip.String, userAgent.String, requestID.String
+	e.PrevHash, e.Hash = prevHash.String, hash.String
+	if before.Valid {
+		e.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		e.After = json.RawMessage(after.String)
+	}
+	return &e, nil
+}
+
+// auditFields marshals v to a JSON object and decodes it into a map
+func auditFields(v interface{}) (map[string]interface{}, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("audit values must be JSON objects: %w", err)
+	}
+	return fields, nil
+}
+
+func marshalAuditFields(fields map[string]interface{}) (json.RawMessage, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	return json.Marshal(fields)
+}
+
+// nullRaw maps empty JSON to null so that hashing doesn't depend on whether
+// a missing value was read back as nil or as an empty slice
+func nullRaw(data json.RawMessage) json.RawMessage {
+	if len(data) == 0 {
+		return json.RawMessage("null")
+	}
+	return data
+}
@@ -1,20 +1,123 @@
 package services
 
-// DescriptionService handles AI-generated descriptions for media
-// TODO: Implement the description service functionality
+import (
+	"context"
+	"fmt"
+	"time"
 
-// DescriptionService provides methods for generating and managing descriptions
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/metrics"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+var (
+	// ErrTranslationUnavailable is returned when a translation is requested
+	// but no translator is configured
+	ErrTranslationUnavailable = apperr.Unavailable("translation_unavailable", "translation is not available")
+	// ErrTranslationFailed is returned when the translator fails
+	ErrTranslationFailed = apperr.New(apperr.KindUpstream, "translation_failed", "translation failed")
+)
+
+// DescriptionProvider generates a description for a photo in the given language
+type DescriptionProvider interface {
+	Describe(ctx context.Context, photo *models.Photo, language string) (string, error)
+}
+
+// Translator translates text between two BCP-47 languages
+type Translator interface {
+	Translate(ctx context.Context, text, from, to string) (string, error)
+}
+
+// DescriptionService provides methods for generating and managing descriptions.
+// Descriptions are generated in the default language by the provider and then
+// passed through the translator for every other requested language.
 type DescriptionService struct {
-	// Add any dependencies here
+	provider        DescriptionProvider
+	translator      Translator
+	defaultLanguage string
 }
 
-// NewDescriptionService creates a new DescriptionService
-func NewDescriptionService() *DescriptionService {
-	return &DescriptionService{}
+// NewDescriptionService creates a new DescriptionService. A nil provider falls
+// back to a placeholder; a nil translator disables translation.
+func NewDescriptionService(provider DescriptionProvider, translator Translator, defaultLanguage string) *DescriptionService {
+	if provider == nil {
+		provider = placeholderProvider{}
+	}
+	if defaultLanguage = utils.NormalizeLanguageTag(defaultLanguage); defaultLanguage == "" {
+		defaultLanguage = utils.DefaultLanguage
+	}
+	return &DescriptionService{
+		provider:        provider,
+		translator:      translator,
+		defaultLanguage: defaultLanguage,
+	}
 }
 
 // GenerateDescription generates a description for the given content
 func (s *DescriptionService) GenerateDescription(content string) (string, error) {
 	// TODO: Implement description generation
 	return "Generated description for: " + content, nil
-}
\ No newline at end of file
+}
+
+// Describe generates a description of the photo in each of the requested
+// languages, keyed by normalized language tag. The default language is always
+// included.
+func (s *DescriptionService) Describe(ctx context.Context, photo *models.Photo, languages []string) (map[string]string, error) {
+	start := time.Now()
+	description, err := s.provider.Describe(ctx, photo, s.defaultLanguage)
+	if _, placeholder := s.provider.(placeholderProvider); !placeholder {
+		metrics.ObserveAnalyzerCall("description", start, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	translations, err := s.Translate(ctx, description, s.defaultLanguage, languages)
+	if err != nil {
+		return nil, err
+	}
+	translations[s.defaultLanguage] = description
+
+	return translations, nil
+}
+
+// Translate translates text from one language into each of the target
+// languages. Targets equal to the source language are skipped.
+func (s *DescriptionService) Translate(ctx context.Context, text, from string, to []string) (map[string]string, error) {
+	from = utils.NormalizeLanguageTag(from)
+	results := make(map[string]string)
+
+	for _, target := range to {
+		lang := utils.NormalizeLanguageTag(target)
+		if lang == "" {
+			return nil, fmt.Errorf("%w: %q", utils.ErrInvalidLanguage, target)
+		}
+		if lang == from {
+			continue
+		}
+		if _, done := results[lang]; done {
+			continue
+		}
+		if s.translator == nil {
+			return nil, ErrTranslationUnavailable
+		}
+
+		start := time.Now()
+		translated, err := s.translator.Translate(ctx, text, from, lang)
+		metrics.ObserveAnalyzerCall("translation", start, err)
+		if err != nil {
+			return nil, ErrTranslationFailed.WithCause(fmt.Errorf("translate to %s: %w", lang, err))
+		}
+		results[lang] = translated
+	}
+
+	return results, nil
+}
+
+// placeholderProvider stands in until an AI description backend is wired up
+type placeholderProvider struct{}
+
+func (placeholderProvider) Describe(ctx context.Context, photo *models.Photo, language string) (string, error) {
+	return "Generated description for photo " + photo.OriginalName, nil
+}
@@ -0,0 +1,760 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/problem"
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+// Export formats
+const (
+	ExportFormatZip = "zip"
+	ExportFormatTar = "tar"
+)
+
+// Export job states
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// Export limits. Exports above the sync limits are built by a background job.
+const (
+	MaxExportItems       = 10000
+	ExportSyncMaxItems   = 500
+	ExportSyncMaxBytes   = 1 << 30 // 1 GiB
+	ExportRetention      = 24 * time.Hour
+	exportManifestName   = "metadata.json"
+	exportQueueSize      = 100
+	exportPurgeInterval  = time.Hour
+	exportRenditionGuess = 512 << 10 // estimated thumbnail size for planning
+	// MaxRenditionExportItems caps exports of thumbnails, which are rendered
+	// on demand and charged to the render rate limit once per export
+	MaxRenditionExportItems = 500
+)
+
+var (
+	// ErrExportNotFound is returned for unknown export jobs
+	ErrExportNotFound = apperr.NotFound("export_not_found", "export not found")
+	// ErrInvalidExport is returned for export requests that cannot be served
+	ErrInvalidExport = apperr.Invalid("invalid_export", "invalid export request")
+)
+
+// ExportRequest selects the photos to export: explicit IDs, an album or a
+// filter over the caller's own photos
+type ExportRequest struct {
+	PhotoIDs        []string    `json:"photo_ids,omitempty"`
+	AlbumID         string      `json:"album_id,omitempty"`
+	Filter          *PhotoQuery `json:"filter,omitempty"`
+	Format          string      `json:"format,omitempty"`    // "zip" (default) or "tar"
+	Rendition       string      `json:"rendition,omitempty"` // "original" (default) or a thumbnail size
+	IncludeMetadata bool        `json:"include_metadata,omitempty"`
+	Async           bool        `json:"async,omitempty"` // always use a background job
+}
+
+// ExportSkip records a photo left out of an export
+type ExportSkip struct {
+	PhotoID string `json:"photo_id"`
+	Reason  string `json:"reason"`
+}
+
+// ExportPlan is a resolved export: the photos the caller may export
+type ExportPlan struct {
+	UserID          string
+	Format          string
+	Rendition       string
+	IncludeMetadata bool
+	Photos          []*models.Photo
+	Skipped         []ExportSkip
+	EstimatedBytes  int64
+}
+
+// Background reports whether the export is too large to stream directly
+func (p *ExportPlan) Background() bool {
+	return len(p.Photos) > ExportSyncMaxItems || p.EstimatedBytes > ExportSyncMaxBytes
+}
+
+// ContentType returns the MIME type of the archive
+func (p *ExportPlan) ContentType() string {
+	if p.Format == ExportFormatTar {
+		return "application/x-tar"
+	}
+	return "application/zip"
+}
+
+// ExportJob is an export built in the background
+type ExportJob struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Status      string     `json:"status"`
+	Format      string     `json:"format"`
+	PhotoCount  int        `json:"photo_count"`
+	Size        int64      `json:"size,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+
+	request    ExportRequest
+	storageKey string
+}
+
+// ExportService builds zip and tar archives of photos
+type ExportService struct {
+	db             *sql.DB
+	storage        storage.Storage
+	photoService   *PhotoService
+	albumService   *AlbumService
+	sharingService *SharingService
+	queue          chan string
+	worker         worker
+}
+
+// NewExportService creates a new ExportService. Call Start to run the
+// background export worker, and Stop to stop it.
+func NewExportService(db *sql.DB, store storage.Storage, photoService *PhotoService, albumService *AlbumService, sharingService *SharingService) *ExportService {
+	return &ExportService{
+		db:             db,
+		storage:        store,
+		photoService:   photoService,
+		albumService:   albumService,
+		sharingService: sharingService,
+		queue:          make(chan string, exportQueueSize),
+	}
+}
+
+// PlanExport resolves an export request to the photos the user may export.
+// Photos the user cannot access are listed as skipped rather than failing the
+// whole export.
+func (s *ExportService) PlanExport(ctx context.Context, userID string, req ExportRequest) (*ExportPlan, error) {
+	plan := &ExportPlan{
+		UserID:          userID,
+		Format:          strings.ToLower(req.Format),
+		Rendition:       req.Rendition,
+		IncludeMetadata: req.IncludeMetadata,
+	}
+	if plan.Format == "" {
+		plan.Format = ExportFormatZip
+	}
+	if plan.Format != ExportFormatZip && plan.Format != ExportFormatTar {
+		return nil, fmt.Errorf("%w: format must be 'zip' or 'tar'", ErrInvalidExport)
+	}
+	if plan.Rendition == "" {
+		plan.Rendition = RenditionOriginal
+	}
+	if !ValidRendition(plan.Rendition) {
+		return nil, fmt.Errorf("%w: unknown rendition %q", ErrInvalidExport, plan.Rendition)
+	}
+
+	sources := 0
+	for _, set := range []bool{len(req.PhotoIDs) > 0, req.AlbumID != "", req.Filter != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("%w: exactly one of photo_ids, album_id and filter is required", ErrInvalidExport)
+	}
+
+	var candidates []*models.Photo
+	var err error
+	switch {
+	case len(req.PhotoIDs) > 0:
+		candidates, err = s.photosByID(ctx, req.PhotoIDs, plan)
+	case req.AlbumID != "":
+		candidates, err = s.albumPhotos(ctx, userID, req.AlbumID)
+	default:
+		candidates, err = s.filteredPhotos(ctx, userID, *req.Filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	permission := PermissionDownload
+	if plan.Rendition != RenditionOriginal {
+		permission = PermissionView
+	}
+	for _, photo := range candidates {
+		allowed, err := s.sharingService.HasPermission(ctx, photo.ID, userID, permission)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			plan.Skipped = append(plan.Skipped, ExportSkip{PhotoID: photo.ID, Reason: "permission denied"})
+			continue
+		}
+		// Originals too large to render from are known by their dimensions
+		if plan.Rendition != RenditionOriginal && photo.Width != nil && photo.Height != nil &&
+			!Renderable(*photo.Width, *photo.Height) {
+			plan.Skipped = append(plan.Skipped, ExportSkip{PhotoID: photo.ID, Reason: "rendition not available"})
+			continue
+		}
+		plan.Photos = append(plan.Photos, photo)
+		if plan.Rendition == RenditionOriginal {
+			plan.EstimatedBytes += photo.FileSize
+		} else {
+			plan.EstimatedBytes += exportRenditionGuess
+		}
+	}
+
+	if len(plan.Photos) == 0 {
+		return nil, fmt.Errorf("%w: no photos to export", ErrInvalidExport)
+	}
+	if plan.Rendition != RenditionOriginal && len(plan.Photos) > MaxRenditionExportItems {
+		return nil, fmt.Errorf("%w: at most %d photos can be exported as thumbnails", ErrInvalidExport, MaxRenditionExportItems)
+	}
+	return plan, nil
+}
+
+// WriteArchive streams the plan's archive to w. Photos whose files cannot be
+// read are skipped and listed in the manifest.
+func (s *ExportService) WriteArchive(ctx context.Context, w io.Writer, plan *ExportPlan) error {
+	archive := newArchiveWriter(plan.Format, w)
+	names := make(map[string]int)
+	manifest := exportManifest{ExportedAt: time.Now().UTC(), Rendition: plan.Rendition, Skipped: plan.Skipped}
+
+	for _, photo := range plan.Photos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		name, err := s.writePhoto(ctx, archive, photo, plan.Rendition, names)
+		if err != nil {
+			var skip *exportSkipError
+			if errors.As(err, &skip) {
+				manifest.Skipped = append(manifest.Skipped, ExportSkip{PhotoID: photo.ID, Reason: skip.reason})
+				continue
+			}
+			return err
+		}
+		manifest.Photos = append(manifest.Photos, newManifestEntry(photo, name))
+	}
+
+	if plan.IncludeMetadata {
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := archive.add(exportManifestName, int64(len(data)), manifest.ExportedAt, bytes.NewReader(data), true); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// CreateJob queues a background export and returns the job
+func (s *ExportService) CreateJob(ctx context.Context, plan *ExportPlan, req ExportRequest) (*ExportJob, error) {
+	req.Format, req.Rendition = plan.Format, plan.Rendition
+	request, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &ExportJob{
+		ID:         uuid.New().String(),
+		UserID:     plan.UserID,
+		Status:     ExportPending,
+		Format:     plan.Format,
+		PhotoCount: len(plan.Photos),
+		CreatedAt:  time.Now().UTC(),
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO export_jobs (id, user_id, status, format, request, photo_count, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, job.UserID, job.Status, job.Format, string(request), job.PhotoCount, job.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.queue <- job.ID:
+	default:
+		// The worker picks up pending jobs from the database when it restarts
+		logging.FromContext(ctx).Warn("Export queue is full, the job will run later", "export_id", job.ID)
+	}
+	return job, nil
+}
+
+// GetJob retrieves an export job
+func (s *ExportService) GetJob(ctx context.Context, id string) (*ExportJob, error) {
+	var job ExportJob
+	var request string
+	var size sql.NullInt64
+	var errMsg, key sql.NullString
+	var completedAt, expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, status, format, request, photo_count, size, error, storage_key,
+			created_at, completed_at, expires_at
+		FROM export_jobs WHERE id = ?
+	`, id).Scan(&job.ID, &job.UserID, &job.Status, &job.Format, &request, &job.PhotoCount, &size,
+		&errMsg, &key, &job.CreatedAt, &completedAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job.Size, job.Error, job.storageKey = size.Int64, errMsg.String, key.String
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		job.ExpiresAt = &expiresAt.Time
+	}
+	if err := json.Unmarshal([]byte(request), &job.request); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// OpenJobArchive opens the archive of a finished export job
+func (s *ExportService) OpenJobArchive(ctx context.Context, job *ExportJob) (storage.Object, error) {
+	if job.Status != ExportDone || job.storageKey == "" || (job.ExpiresAt != nil && time.Now().After(*job.ExpiresAt)) {
+		return nil, ErrExportNotFound
+	}
+	return s.storage.Open(ctx, job.storageKey)
+}
+
+// Start runs the export worker until Stop is called or ctx is cancelled.
+// Jobs left pending or running by a previous process are picked up again, and
+// expired archives are removed periodically.
+func (s *ExportService) Start(ctx context.Context) {
+	s.worker.start(ctx, func(ctx context.Context, stop <-chan struct{}) {
+		s.requeue(ctx)
+		s.purgeExpired(ctx)
+
+		ticker := time.NewTicker(exportPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case id := <-s.queue:
+				s.runJob(ctx, id)
+			case <-ticker.C:
+				s.purgeExpired(ctx)
+				s.requeue(ctx)
+			}
+		}
+	})
+}
+
+// Stop stops the export worker, letting the job it is running finish until
+// ctx expires. A job cut short is left running and picked up again by the next
+// Start.
+func (s *ExportService) Stop(ctx context.Context) error {
+	return s.worker.shutdown(ctx)
+}
+
+func (s *ExportService) runJob(ctx context.Context, id string) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE export_jobs SET status = ? WHERE id = ? AND status IN (?, ?)
+	`, ExportRunning, id, ExportPending, ExportRunning)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to start export", "export_id", id, logging.Err(err))
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return
+	}
+
+	job, err := s.GetJob(ctx, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to load export", "export_id", id, logging.Err(err))
+		return
+	}
+
+	// Permissions are checked again when the job runs
+	key, size, err := s.buildJobArchive(ctx, job)
+	now := time.Now().UTC()
+	if err != nil && ctx.Err() != nil {
+		logging.FromContext(ctx).Warn("Export interrupted by shutdown, it resumes on restart", "export_id", id)
+		return
+	}
+	if err != nil {
+		// Clients see the stored error, so only the problem detail is kept
+		logging.FromContext(ctx).Error("Export failed", "export_id", id, logging.Err(err))
+		if _, dbErr := s.db.ExecContext(ctx, `
+			UPDATE export_jobs SET status = ?, error = ?, completed_at = ? WHERE id = ?
+		`, ExportFailed, problem.From(err).Detail, now, id); dbErr != nil {
+			logging.FromContext(ctx).Error("Failed to record export failure", "export_id", id, logging.Err(dbErr))
+		}
+		return
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE export_jobs SET status = ?, storage_key = ?, size = ?, completed_at = ?, expires_at = ? WHERE id = ?
+	`, ExportDone, key, size, now, now.Add(ExportRetention), id); err != nil {
+		logging.FromContext(ctx).Error("Failed to record export", "export_id", id, logging.Err(err))
+	}
+}
+
+func (s *ExportService) buildJobArchive(ctx context.Context, job *ExportJob) (string, int64, error) {
+	plan, err := s.PlanExport(ctx, job.UserID, job.request)
+	if err != nil {
+		return "", 0, err
+	}
+
+	key := path.Join("exports", job.UserID, job.ID+"."+plan.Format)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.WriteArchive(ctx, pw, plan))
+	}()
+
+	size, err := s.storage.Put(ctx, key, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		discardBlob(ctx, s.storage, key)
+		return "", 0, err
+	}
+	return key, size, nil
+}
+
+// QueueDepth returns the number of pending and running export jobs
+func (s *ExportService) QueueDepth(ctx context.Context) (map[string]int, error) {
+	depth := map[string]int{ExportPending: 0, ExportRunning: 0}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT status, COUNT(*) FROM export_jobs WHERE status IN (?, ?) GROUP BY status
+	`, ExportPending, ExportRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		depth[status] = count
+	}
+	return depth, rows.Err()
+}
+
+// requeue queues jobs that are waiting to run
+func (s *ExportService) requeue(ctx context.Context) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id FROM export_jobs WHERE status IN (?, ?) ORDER BY created_at
+	`, ExportPending, ExportRunning)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to load pending exports", logging.Err(err))
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		select {
+		case s.queue <- id:
+		default:
+			return
+		}
+	}
+}
+
+// purgeExpired removes expired export archives
+func (s *ExportService) purgeExpired(ctx context.Context) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, COALESCE(storage_key, '') FROM export_jobs WHERE expires_at IS NOT NULL AND expires_at < ?
+	`, time.Now().UTC())
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to load expired exports", logging.Err(err))
+		return
+	}
+	type expired struct{ id, key string }
+	var jobs []expired
+	for rows.Next() {
+		var job expired
+		if rows.Scan(&job.id, &job.key) == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	rows.Close()
+
+	for _, job := range jobs {
+		if job.key != "" {
+			if err := s.storage.Delete(ctx, job.key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				logging.FromContext(ctx).Error("Failed to delete export archive", "export_id", job.id, logging.Err(err))
+				continue
+			}
+		}
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM export_jobs WHERE id = ?`, job.id); err != nil {
+			logging.FromContext(ctx).Error("Failed to delete export", "export_id", job.id, logging.Err(err))
+		}
+	}
+}
+
+func (s *ExportService) photosByID(ctx context.Context, ids []string, plan *ExportPlan) ([]*models.Photo, error) {
+	if len(ids) > MaxExportItems {
+		return nil, fmt.Errorf("%w: at most %d photos can be exported at once", ErrInvalidExport, MaxExportItems)
+	}
+
+	seen := make(map[string]bool, len(ids))
+	var photos []*models.Photo
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		photo, err := s.photoService.GetPhoto(ctx, id)
+		if errors.Is(err, ErrPhotoNotFound) {
+			plan.Skipped = append(plan.Skipped, ExportSkip{PhotoID: id, Reason: "not found"})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, photo)
+	}
+	return photos, nil
+}
+
+func (s *ExportService) albumPhotos(ctx context.Context, userID, albumID string) ([]*models.Photo, error) {
+	allowed, err := s.sharingService.HasAlbumPermission(ctx, albumID, userID, PermissionView)
+	if errors.Is(err, ErrAlbumNotFound) || (err == nil && !allowed) {
+		return nil, fmt.Errorf("%w: album not found", ErrInvalidExport)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	album, err := s.albumService.GetAlbum(ctx, albumID)
+	if err != nil {
+		return nil, err
+	}
+
+	var photos []*models.Photo
+	for page := 1; ; page++ {
+		result, err := s.albumService.AlbumPhotos(ctx, album, page, MaxPageSize)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, result.Photos...)
+		if len(photos) > MaxExportItems {
+			return nil, fmt.Errorf("%w: at most %d photos can be exported at once", ErrInvalidExport, MaxExportItems)
+		}
+		if len(result.Photos) < MaxPageSize {
+			return photos, nil
+		}
+	}
+}
+
+func (s *ExportService) filteredPhotos(ctx context.Context, userID string, q PhotoQuery) ([]*models.Photo, error) {
+	q.UserID, q.AsPartner = userID, false
+	q.Limit, q.Page, q.Cursor = MaxPageSize, 1, ""
+	if err := q.Normalize(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+
+	var photos []*models.Photo
+	for {
+		result, err := s.photoService.ListPhotos(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, result.Photos...)
+		if len(photos) > MaxExportItems {
+			return nil, fmt.Errorf("%w: at most %d photos can be exported at once", ErrInvalidExport, MaxExportItems)
+		}
+		if result.NextCursor == "" {
+			return photos, nil
+		}
+		q.Cursor = result.NextCursor
+	}
+}
+
+// writePhoto adds one photo to the archive and returns its entry name
+func (s *ExportService) writePhoto(ctx context.Context, archive archiveWriter, photo *models.Photo, rendition string, names map[string]int) (string, error) {
+	modTime := photo.CreatedAt
+	if photo.TakenAt != nil {
+		modTime = *photo.TakenAt
+	}
+
+	if rendition == RenditionOriginal {
+		obj, err := s.photoService.OpenOriginal(ctx, photo)
+		if err != nil {
+			return "", &exportSkipError{reason: "file not found"}
+		}
+		defer obj.Close()
+
+		name := uniqueEntryName(names, photo.OriginalName)
+		return name, archive.add(name, obj.Info().Size, modTime, obj, false)
+	}
+
+	data, _, err := s.photoService.GetThumbnail(ctx, photo.ID, rendition)
+	if errors.Is(err, ErrRenditionUnavailable) || errors.Is(err, storage.ErrNotFound) {
+		return "", &exportSkipError{reason: "rendition not available"}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSuffix(photo.OriginalName, path.Ext(photo.OriginalName))
+	name := uniqueEntryName(names, base+"_"+rendition+".jpg")
+	return name, archive.add(name, int64(len(data)), modTime, bytes.NewReader(data), false)
+}
+
+type exportSkipError struct{ reason string }
+
+func (e *exportSkipError) Error() string { return e.reason }
+
+// uniqueEntryName returns a safe archive entry name, adding a counter to
+// repeated names
+func uniqueEntryName(names map[string]int, name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(name, ".")
+	if name == "" || name == exportManifestName {
+		name = "photo" + path.Ext(name)
+	}
+
+	names[name]++
+	if n := names[name]; n > 1 {
+		ext := path.Ext(name)
+		candidate := strings.TrimSuffix(name, ext) + " (" + strconv.Itoa(n) + ")" + ext
+		names[candidate]++
+		return candidate
+	}
+	return name
+}
+
+type exportManifest struct {
+	ExportedAt time.Time             `json:"exported_at"`
+	Rendition  string                `json:"rendition"`
+	Photos     []exportManifestEntry `json:"photos"`
+	Skipped    []ExportSkip          `json:"skipped,omitempty"`
+}
+
+type exportManifestEntry struct {
+	ID            string          `json:"id"`
+	File          string          `json:"file"`
+	OriginalName  string          `json:"original_name"`
+	MimeType      string          `json:"mime_type"`
+	FileSize      int64           `json:"file_size"`
+	Hash          string          `json:"hash"`
+	Width         *int            `json:"width,omitempty"`
+	Height        *int            `json:"height,omitempty"`
+	Description   *string         `json:"description,omitempty"`
+	AIDescription *string         `json:"ai_description,omitempty"`
+	Tags          []string        `json:"tags,omitempty"`
+	Location      *string         `json:"location,omitempty"`
+	CameraMake    *string         `json:"camera_make,omitempty"`
+	CameraModel   *string         `json:"camera_model,omitempty"`
+	TakenAt       *time.Time      `json:"taken_at,omitempty"`
+	Exif          json.RawMessage `json:"exif,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+func newManifestEntry(photo *models.Photo, file string) exportManifestEntry {
+	entry := exportManifestEntry{
+		ID:            photo.ID,
+		File:          file,
+		OriginalName:  photo.OriginalName,
+		MimeType:      photo.MimeType,
+		FileSize:      photo.FileSize,
+		Hash:          photo.Hash,
+		Width:         photo.Width,
+		Height:        photo.Height,
+		Description:   photo.Description,
+		AIDescription: photo.AIDescription,
+		Location:      photo.Location,
+		CameraMake:    photo.CameraMake,
+		CameraModel:   photo.CameraModel,
+		TakenAt:       photo.TakenAt,
+		CreatedAt:     photo.CreatedAt,
+	}
+	if photo.Tags != nil {
+		for _, tag := range strings.Split(*photo.Tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+	}
+	if photo.ExifData != nil && json.Valid([]byte(*photo.ExifData)) {
+		entry.Exif = json.RawMessage(*photo.ExifData)
+	}
+	return entry
+}
+
+// archiveWriter abstracts over zip and tar output
+type archiveWriter interface {
+	add(name string, size int64, modTime time.Time, r io.Reader, compress bool) error
+	Close() error
+}
+
+func newArchiveWriter(format string, w io.Writer) archiveWriter {
+	if format == ExportFormatTar {
+		return &tarArchive{tw: tar.NewWriter(w)}
+	}
+	return &zipArchive{zw: zip.NewWriter(w)}
+}
+
+type zipArchive struct{ zw *zip.Writer }
+
+func (a *zipArchive) add(name string, size int64, modTime time.Time, r io.Reader, compress bool) error {
+	// Photos are already compressed; storing them keeps exports fast
+	method := zip.Store
+	if compress {
+		method = zip.Deflate
+	}
+	w, err := a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (a *zipArchive) Close() error { return a.zw.Close() }
+
+type tarArchive struct{ tw *tar.Writer }
+
+func (a *tarArchive) add(name string, size int64, modTime time.Time, r io.Reader, _ bool) error {
+	if err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := io.CopyN(a.tw, r, size)
+	return err
+}
+
+func (a *tarArchive) Close() error { return a.tw.Close() }
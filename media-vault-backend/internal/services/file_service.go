@@ -0,0 +1,600 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/encryption"
+	"github.com/wronai/media-vault-backend/internal/metrics"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+// MaxFileNameLength is the maximum length of a file or folder name
+const MaxFileNameLength = 255
+
+// RootFolder is the top-level folder of every user's vault
+const RootFolder = "/"
+
+// DefaultAllowedFileTypes are the MIME types accepted when no allowlist is
+// configured. A "type/*" entry allows every subtype.
+var DefaultAllowedFileTypes = []string{
+	"application/pdf",
+	"text/plain",
+	"text/csv",
+	"text/markdown",
+	"application/rtf",
+	"application/msword",
+	"application/vnd.ms-excel",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"application/vnd.oasis.opendocument.text",
+	"application/vnd.oasis.opendocument.spreadsheet",
+	"image/*",
+}
+
+var (
+	// ErrFileNotFound is returned when a vault file does not exist
+	ErrFileNotFound = apperr.NotFound("file_not_found", "file not found")
+	// ErrFileExists is returned when a folder already holds a file of that name
+	ErrFileExists = apperr.Conflict("file_exists", "a file with this name already exists in the folder")
+	// ErrFileTypeNotAllowed is returned for uploads outside the allowlist
+	ErrFileTypeNotAllowed = apperr.Unsupported("file_type_not_allowed", "file type is not allowed")
+	// ErrInvalidFilePath is returned for malformed file names and folders
+	ErrInvalidFilePath = apperr.Invalid("invalid_file_path", "invalid file name or folder")
+	// ErrEncryptionUnavailable is returned when an encrypted file is read but
+	// no master keys are configured
+	ErrEncryptionUnavailable = apperr.Unavailable("encryption_unavailable", "file is encrypted but no master keys are configured")
+)
+
+// documentTypes maps extensions to the MIME type of documents that content
+// sniffing cannot tell apart, together with the type sniffing reports for
+// them. The extension is only trusted when the sniffed type agrees.
+var documentTypes = map[string]struct{ mimeType, sniffed string }{
+	".txt":  {"text/plain", "text/plain"},
+	".csv":  {"text/csv", "text/plain"},
+	".md":   {"text/markdown", "text/plain"},
+	".rtf":  {"application/rtf", "text/plain"},
+	".doc":  {"application/msword", "application/octet-stream"},
+	".xls":  {"application/vnd.ms-excel", "application/octet-stream"},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "application/zip"},
+	".odt":  {"application/vnd.oasis.opendocument.text", "application/zip"},
+	".ods":  {"application/vnd.oasis.opendocument.spreadsheet", "application/zip"},
+}
+
+// FilePage is one page of a folder listing
+type FilePage struct {
+	Files []*models.VaultFile `json:"data"`
+	Total int                 `json:"total"`
+	Page  int                 `json:"page"`
+	Limit int                 `json:"limit"`
+}
+
+const fileColumns = `id, user_id, name, path, storage_key, size, mime_type, hash,
+	is_public, is_encrypted, key_id, wrapped_key, metadata, created_at, updated_at`
+
+// FileService stores generic documents in the vault, next to photos. When a
+// key provider is configured, files are encrypted at rest with a data key of
+// their own, stored wrapped by the provider's master key.
+type FileService struct {
+	db           *sql.DB
+	storage      storage.Storage
+	allowedTypes []string
+	keys         encryption.KeyProvider
+}
+
+// NewFileService creates a new FileService. A nil allowlist means
+// DefaultAllowedFileTypes; a nil key provider stores files unencrypted.
+func NewFileService(db *sql.DB, store storage.Storage, allowedTypes []string, keys encryption.KeyProvider) *FileService {
+	if allowedTypes == nil {
+		allowedTypes = DefaultAllowedFileTypes
+	}
+	return &FileService{db: db, storage: store, allowedTypes: allowedTypes, keys: keys}
+}
+
+// ParseAllowedFileTypes parses a comma-separated list of MIME types
+func ParseAllowedFileTypes(spec string) []string {
+	var types []string
+	for _, t := range strings.Split(spec, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// UploadFile stores an uploaded document in folder. metadata, if given, must
+// be a JSON object.
+func (s *FileService) UploadFile(ctx context.Context, userID string, fileHeader *multipart.FileHeader, folder string, metadata json.RawMessage) (_ *models.VaultFile, err error) {
+	defer func() { metrics.ObserveUpload(metrics.UploadFile, fileHeader.Size, err) }()
+
+	name, err := cleanFileName(filepath.Base(fileHeader.Filename))
+	if err != nil {
+		return nil, err
+	}
+	if folder, err = CleanFolder(folder); err != nil {
+		return nil, err
+	}
+	if metadata, err = cleanFileMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mimeType, err := s.detectType(file, name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	vf := &models.VaultFile{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Path:      folder,
+		MimeType:  mimeType,
+		Metadata:  metadata,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	vf.StorageKey = path.Join("files", userID, vf.ID)
+
+	// The hash and size describe the plaintext
+	hasher := sha256.New()
+	var content io.Reader = io.TeeReader(file, hasher)
+	if s.keys != nil {
+		dataKey, wrapped, keyID, err := encryption.NewDataKey(ctx, s.keys)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = encryption.NewEncryptReader(content, dataKey); err != nil {
+			return nil, err
+		}
+		vf.IsEncrypted, vf.KeyID, vf.WrappedKey = true, keyID, wrapped
+	}
+
+	size, err := s.storage.Put(ctx, vf.StorageKey, content)
+	if err != nil {
+		return nil, err
+	}
+	if vf.IsEncrypted {
+		if size, err = encryption.PlaintextSize(size); err != nil {
+			discardBlob(ctx, s.storage, vf.StorageKey)
+			return nil, err
+		}
+	}
+	vf.Size = size
+	vf.Hash = hex.EncodeToString(hasher.Sum(nil))
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO vault_files (id, user_id, name, path, storage_key, size, mime_type, hash,
+			is_encrypted, key_id, wrapped_key, metadata, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, vf.ID, vf.UserID, vf.Name, vf.Path, vf.StorageKey, vf.Size, vf.MimeType, vf.Hash,
+		vf.IsEncrypted, nullIfEmpty(vf.KeyID), vf.WrappedKey, nullJSON(vf.Metadata), vf.CreatedAt, vf.UpdatedAt)
+	if err != nil {
+		// Don't leave an orphaned blob behind
+		discardBlob(ctx, s.storage, vf.StorageKey)
+		return nil, fileConflict(err)
+	}
+
+	return vf, nil
+}
+
+// GetFile retrieves a vault file
+func (s *FileService) GetFile(ctx context.Context, id string) (*models.VaultFile, error) {
+	vf, err := scanVaultFile(s.db.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM vault_files WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrFileNotFound
+	}
+	return vf, err
+}
+
+// ListFiles returns a page of the files in a folder, sorted by name. With
+// recursive set, files in sub-folders are included.
+func (s *FileService) ListFiles(ctx context.Context, userID, folder string, recursive bool, page, limit int) (*FilePage, error) {
+	folder, err := CleanFolder(folder)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	clause := `user_id = ? AND path = ?`
+	args := []interface{}{userID, folder}
+	if recursive && folder != RootFolder {
+		clause = `user_id = ? AND (path = ? OR substr(path, 1, ?) = ?)`
+		args = append(args, utf8.RuneCountInString(folder)+1, folder+"/")
+	} else if recursive {
+		clause = `user_id = ?`
+		args = args[:1]
+	}
+
+	result := &FilePage{Files: []*models.VaultFile{}, Page: page, Limit: limit}
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM vault_files WHERE `+clause, args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+fileColumns+` FROM vault_files WHERE `+clause+`
+		ORDER BY path, name COLLATE NOCASE
+		LIMIT ? OFFSET ?
+	`, append(args, limit, (page-1)*limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		vf, err := scanVaultFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, vf)
+	}
+
+	return result, rows.Err()
+}
+
+// ListFolders returns the names of the folders directly inside folder.
+// Folders exist as long as they hold files.
+func (s *FileService) ListFolders(ctx context.Context, userID, folder string) ([]string, error) {
+	folder, err := CleanFolder(folder)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(folder, "/") + "/"
+	// SQLite counts characters, not bytes
+	prefixLen := utf8.RuneCountInString(prefix)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT path FROM vault_files
+		WHERE user_id = ? AND length(path) > ? AND substr(path, 1, ?) = ?
+	`, userID, prefixLen, prefixLen, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	folders := []string{}
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		child, _, _ := strings.Cut(strings.TrimPrefix(p, prefix), "/")
+		if !seen[child] {
+			seen[child] = true
+			folders = append(folders, child)
+		}
+	}
+
+	return folders, rows.Err()
+}
+
+// ListSharedFiles returns the files shared with a user
+func (s *FileService) ListSharedFiles(ctx context.Context, userID string) ([]*models.VaultFile, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+prefixColumns("f", fileColumns)+`
+		FROM vault_files f
+		WHERE f.id IN (
+			SELECT file_id FROM file_sharing
+			WHERE shared_with = ? AND (expires_at IS NULL OR expires_at > ?)
+		)
+		ORDER BY f.name COLLATE NOCASE
+	`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []*models.VaultFile{}
+	for rows.Next() {
+		vf, err := scanVaultFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, vf)
+	}
+
+	return files, rows.Err()
+}
+
+// UpdateFile renames or moves a file or replaces its metadata
+func (s *FileService) UpdateFile(ctx context.Context, id string, update models.VaultFileUpdate) (*models.VaultFile, error) {
+	vf, err := s.GetFile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		if vf.Name, err = cleanFileName(*update.Name); err != nil {
+			return nil, err
+		}
+	}
+	if update.Path != nil {
+		if vf.Path, err = CleanFolder(*update.Path); err != nil {
+			return nil, err
+		}
+	}
+	if update.Metadata != nil {
+		if vf.Metadata, err = cleanFileMetadata(update.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	vf.UpdatedAt = time.Now().UTC()
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE vault_files SET name = ?, path = ?, metadata = ?, updated_at = ? WHERE id = ?
+	`, vf.Name, vf.Path, nullJSON(vf.Metadata), vf.UpdatedAt, vf.ID)
+	if err != nil {
+		return nil, fileConflict(err)
+	}
+
+	return vf, nil
+}
+
+// MoveFolder renames or moves a folder with everything in it and returns the
+// number of files moved. It fails without moving anything if a file would
+// collide with one already at the destination.
+func (s *FileService) MoveFolder(ctx context.Context, userID, from, to string) (int, error) {
+	from, err := CleanFolder(from)
+	if err != nil {
+		return 0, err
+	}
+	if to, err = CleanFolder(to); err != nil {
+		return 0, err
+	}
+	if from == RootFolder || to == from || strings.HasPrefix(to, from+"/") {
+		return 0, fmt.Errorf("%w: cannot move %s into %s", ErrInvalidFilePath, from, to)
+	}
+
+	// SQLite counts characters, not bytes
+	fromLen := utf8.RuneCountInString(from)
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE vault_files
+		SET path = ? || substr(path, ?), updated_at = ?
+		WHERE user_id = ? AND (path = ? OR substr(path, 1, ?) = ?)
+	`, to, fromLen+1, time.Now().UTC(), userID, from, fromLen+1, from+"/")
+	if err != nil {
+		return 0, fileConflict(err)
+	}
+
+	moved, err := result.RowsAffected()
+	if err == nil && moved == 0 {
+		return 0, ErrFileNotFound
+	}
+	return int(moved), err
+}
+
+// DeleteFile removes a vault file and its stored content
+func (s *FileService) DeleteFile(ctx context.Context, vf *models.VaultFile) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM vault_files WHERE id = ?`, vf.ID); err != nil {
+		return err
+	}
+	if err := s.storage.Delete(ctx, vf.StorageKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// OpenFile opens the stored content of a vault file, decrypting it if needed
+func (s *FileService) OpenFile(ctx context.Context, vf *models.VaultFile) (storage.Object, error) {
+	if vf.IsEncrypted && s.keys == nil {
+		return nil, ErrEncryptionUnavailable
+	}
+
+	obj, err := s.storage.Open(ctx, vf.StorageKey)
+	if err != nil || !vf.IsEncrypted {
+		return obj, err
+	}
+
+	dataKey, err := s.keys.UnwrapKey(ctx, vf.KeyID, vf.WrappedKey)
+	if err != nil {
+		obj.Close()
+		return nil, err
+	}
+	decrypted, err := encryption.OpenObject(obj, dataKey)
+	if err != nil {
+		obj.Close()
+		return nil, err
+	}
+	return decrypted, nil
+}
+
+// RewrapKeys re-encrypts the data keys of files wrapped with a master key
+// other than the active one and returns the number of files updated. File
+// contents are not touched, so retired master keys can be removed once this
+// has run.
+func (s *FileService) RewrapKeys(ctx context.Context) (int, error) {
+	if s.keys == nil {
+		return 0, ErrEncryptionUnavailable
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, key_id, wrapped_key FROM vault_files
+		WHERE is_encrypted = 1 AND key_id != ?
+	`, s.keys.ActiveKeyID())
+	if err != nil {
+		return 0, err
+	}
+	type wrappedKey struct {
+		fileID, keyID string
+		wrapped       []byte
+	}
+	var pending []wrappedKey
+	for rows.Next() {
+		var k wrappedKey
+		if err := rows.Scan(&k.fileID, &k.keyID, &k.wrapped); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rewrapped := 0
+	for _, k := range pending {
+		dataKey, err := s.keys.UnwrapKey(ctx, k.keyID, k.wrapped)
+		if err != nil {
+			return rewrapped, fmt.Errorf("file %s: %w", k.fileID, err)
+		}
+		wrapped, keyID, err := s.keys.WrapKey(ctx, dataKey)
+		if err != nil {
+			return rewrapped, fmt.Errorf("file %s: %w", k.fileID, err)
+		}
+		// Only replace the key we read, in case the file changed meanwhile
+		if _, err := s.db.ExecContext(ctx, `
+			UPDATE vault_files SET key_id = ?, wrapped_key = ? WHERE id = ? AND key_id = ?
+		`, keyID, wrapped, k.fileID, k.keyID); err != nil {
+			return rewrapped, err
+		}
+		rewrapped++
+	}
+
+	return rewrapped, nil
+}
+
+// detectType sniffs the MIME type of an upload and checks it against the
+// allowlist. The extension refines the sniffed type only for documents whose
+// content sniffing can't identify, such as Office files.
+func (s *FileService) detectType(file multipart.File, name string) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if err != nil {
+		mimeType = "application/octet-stream"
+	}
+	if doc, ok := documentTypes[strings.ToLower(path.Ext(name))]; ok && doc.sniffed == mimeType {
+		mimeType = doc.mimeType
+	}
+
+	for _, allowed := range s.allowedTypes {
+		if allowed == mimeType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(allowed, "*"))) {
+			return mimeType, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrFileTypeNotAllowed, mimeType)
+}
+
+// CleanFolder normalizes a folder path to the form "/a/b". Empty paths are the
+// root folder; "." and ".." segments are rejected rather than resolved.
+func CleanFolder(folder string) (string, error) {
+	var segments []string
+	for _, segment := range strings.Split(folder, "/") {
+		if segment == "" {
+			continue
+		}
+		if _, err := cleanFileName(segment); err != nil || segment != strings.TrimSpace(segment) {
+			return "", fmt.Errorf("%w: folder %q", ErrInvalidFilePath, folder)
+		}
+		segments = append(segments, segment)
+	}
+	return RootFolder + strings.Join(segments, "/"), nil
+}
+
+// cleanFileName validates a single file or folder name
+func cleanFileName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || len(name) > MaxFileNameLength ||
+		!utf8.ValidString(name) || strings.ContainsAny(name, `/\`) || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("%w: name %q", ErrInvalidFilePath, name)
+	}
+	return name, nil
+}
+
+// cleanFileMetadata checks that metadata is empty or a JSON object
+func cleanFileMetadata(metadata json.RawMessage) (json.RawMessage, error) {
+	if len(metadata) == 0 || string(metadata) == "null" {
+		return nil, nil
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(metadata, &object); err != nil {
+		return nil, fmt.Errorf("%w: metadata must be a JSON object", ErrInvalidFilePath)
+	}
+	return metadata, nil
+}
+
+// fileConflict maps unique constraint violations to ErrFileExists
+func fileConflict(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return ErrFileExists
+	}
+	return err
+}
+
+func nullJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+func scanVaultFile(row rowScanner) (*models.VaultFile, error) {
+	var vf models.VaultFile
+	var keyID, metadata sql.NullString
+	if err := row.Scan(
+		&vf.ID,
+		&vf.UserID,
+		&vf.Name,
+		&vf.Path,
+		&vf.StorageKey,
+		&vf.Size,
+		&vf.MimeType,
+		&vf.Hash,
+		&vf.IsPublic,
+		&vf.IsEncrypted,
+		&keyID,
+		&vf.WrappedKey,
+		&metadata,
+		&vf.CreatedAt,
+		&vf.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	vf.KeyID = keyID.String
+	if metadata.Valid {
+		vf.Metadata = json.RawMessage(metadata.String)
+	}
+	return &vf, nil
+}
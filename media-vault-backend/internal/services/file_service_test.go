@@ -0,0 +1,211 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/wronai/media-vault-backend/internal/database"
+	"github.com/wronai/media-vault-backend/internal/encryption"
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+func newTestFileService(t *testing.T) *FileService {
+	t.Helper()
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewFileService(db, store, nil, nil)
+}
+
+// testFileHeader makes the multipart file header of an upload of data
+func testFileHeader(t *testing.T, name, contentType string, data []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="`+name+`"`)
+	header.Set("Content-Type", contentType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	w.Close()
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["file"][0]
+}
+
+// uploadTestFile uploads a small text file named name into folder
+func uploadTestFile(t *testing.T, s *FileService, userID, folder, name string) {
+	t.Helper()
+	fileHeader := testFileHeader(t, name, "text/plain", []byte("notes"))
+	if _, err := s.UploadFile(context.Background(), userID, fileHeader, folder, nil); err != nil {
+		t.Fatalf("upload %s/%s: %v", folder, name, err)
+	}
+}
+
+func filePaths(t *testing.T, s *FileService, userID, folder string) []string {
+	t.Helper()
+	page, err := s.ListFiles(context.Background(), userID, folder, true, 1, MaxPageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, len(page.Files))
+	for i, f := range page.Files {
+		paths[i] = f.Path + "/" + f.Name
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestFileServiceMultibyteFolders(t *testing.T) {
+	s := newTestFileService(t)
+	ctx := context.Background()
+	uploadTestFile(t, s, "u1", "/Zdjęcia", "a.txt")
+	uploadTestFile(t, s, "u1", "/Zdjęcia/Łódź", "b.txt")
+	uploadTestFile(t, s, "u1", "/Zdjęcia2", "c.txt")
+	uploadTestFile(t, s, "u2", "/Zdjęcia", "d.txt")
+
+	if got, want := filePaths(t, s, "u1", "/Zdjęcia"), []string{"/Zdjęcia/a.txt", "/Zdjęcia/Łódź/b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recursive listing = %q, want %q", got, want)
+	}
+
+	folders, err := s.ListFolders(ctx, "u1", "/Zdjęcia")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Łódź"}; !reflect.DeepEqual(folders, want) {
+		t.Errorf("folders = %q, want %q", folders, want)
+	}
+
+	moved, err := s.MoveFolder(ctx, "u1", "/Zdjęcia", "/Archiwum/Wrzesień")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 2 {
+		t.Errorf("moved %d files, want 2", moved)
+	}
+	want := []string{"/Archiwum/Wrzesień/a.txt", "/Archiwum/Wrzesień/Łódź/b.txt"}
+	if got := filePaths(t, s, "u1", "/Archiwum/Wrzesień"); !reflect.DeepEqual(got, want) {
+		t.Errorf("after move = %q, want %q", got, want)
+	}
+
+	// Siblings sharing a prefix and other users' folders stay put
+	if got, want := filePaths(t, s, "u1", "/Zdjęcia2"), []string{"/Zdjęcia2/c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sibling folder = %q, want %q", got, want)
+	}
+	if got, want := filePaths(t, s, "u2", "/Zdjęcia"), []string{"/Zdjęcia/d.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("other user's folder = %q, want %q", got, want)
+	}
+
+	// Folder names must be valid UTF-8 for SQLite to count their characters
+	if _, err := CleanFolder("/Zdj\xeacia"); err == nil {
+		t.Error("folder with invalid UTF-8 accepted")
+	}
+}
+
+func testKeyProvider(t *testing.T, activeID string, ids ...string) encryption.KeyProvider {
+	t.Helper()
+	keys := map[string][]byte{}
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[len(id)-1:]), encryption.KeySize)
+	}
+	p, err := encryption.NewStaticKeyProvider(keys, activeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func readTestFile(t *testing.T, s *FileService, id string) ([]byte, error) {
+	t.Helper()
+	vf, err := s.GetFile(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := s.OpenFile(context.Background(), vf)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(obj)
+}
+
+func TestFileServiceEncryptsAndRewrapsKeys(t *testing.T) {
+	ctx := context.Background()
+	plain := newTestFileService(t)
+	s := NewFileService(plain.db, plain.storage, nil, testKeyProvider(t, "k1", "k1"))
+
+	content := bytes.Repeat([]byte("confidential "), 10000)
+	vf, err := s.UploadFile(ctx, "u1", testFileHeader(t, "notes.txt", "text/plain", content), "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vf.IsEncrypted || vf.KeyID != "k1" || vf.Size != int64(len(content)) {
+		t.Fatalf("uploaded file encrypted = %t with %q, size %d, want encrypted with k1, size %d",
+			vf.IsEncrypted, vf.KeyID, vf.Size, len(content))
+	}
+
+	// The stored blob is ciphertext, and reading it back decrypts it
+	raw, err := plain.storage.Open(ctx, vf.StorageKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := io.ReadAll(raw)
+	raw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, content[:100]) {
+		t.Error("stored blob contains the plaintext")
+	}
+	if got, err := readTestFile(t, s, vf.ID); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("read %d bytes, %v, want the %d uploaded", len(got), err, len(content))
+	}
+	if _, err := readTestFile(t, plain, vf.ID); !errors.Is(err, ErrEncryptionUnavailable) {
+		t.Errorf("read without keys: error = %v, want ErrEncryptionUnavailable", err)
+	}
+
+	// Rotate to k2, keeping k1 until keys are rewrapped
+	rotated := NewFileService(plain.db, plain.storage, nil, testKeyProvider(t, "k2", "k1", "k2"))
+	if n, err := rotated.RewrapKeys(ctx); err != nil || n != 1 {
+		t.Fatalf("RewrapKeys = %d, %v, want 1", n, err)
+	}
+	if n, err := rotated.RewrapKeys(ctx); err != nil || n != 0 {
+		t.Errorf("second RewrapKeys = %d, %v, want 0", n, err)
+	}
+	if after, err := rotated.GetFile(ctx, vf.ID); err != nil || after.KeyID != "k2" {
+		t.Fatalf("key after rewrapping = %v, %v, want k2", after, err)
+	}
+
+	// The content is untouched and k1 can be retired
+	retired := NewFileService(plain.db, plain.storage, nil, testKeyProvider(t, "k2", "k2"))
+	if got, err := readTestFile(t, retired, vf.ID); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("read after rotation %d bytes, %v, want the %d uploaded", len(got), err, len(content))
+	}
+	if _, err := readTestFile(t, s, vf.ID); !errors.Is(err, encryption.ErrUnknownKey) {
+		t.Errorf("read with only k1: error = %v, want ErrUnknownKey", err)
+	}
+	if _, err := plain.RewrapKeys(ctx); !errors.Is(err, ErrEncryptionUnavailable) {
+		t.Errorf("RewrapKeys without keys: error = %v, want ErrEncryptionUnavailable", err)
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wronai/media-vault-backend/internal/database"
+	"github.com/wronai/media-vault-backend/internal/storage"
+	"github.com/wronai/media-vault-backend/internal/tracing"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+// Health check states. A warning does not make the service unready.
+const (
+	HealthOK   = "ok"
+	HealthWarn = "warn"
+	HealthFail = "fail"
+)
+
+const (
+	// DefaultMinFreeDisk is the disk headroom below which the health check
+	// fails; it warns below twice as much
+	DefaultMinFreeDisk = 1 << 30 // 1 GiB
+	healthCheckTimeout = 5 * time.Second
+	healthProbePrefix  = "health/"
+)
+
+// HealthCheck is the result of checking one dependency
+type HealthCheck struct {
+	Name       string                 `json:"name"`
+	Status     string                 `json:"status"`
+	Message    string                 `json:"message,omitempty"`
+	DurationMS int64                  `json:"duration_ms"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// HealthReport is the overall result of a set of checks: failed if any check
+// failed, otherwise warning if any check warned
+type HealthReport struct {
+	Status    string         `json:"status"`
+	Checks    []*HealthCheck `json:"checks"`
+	CheckedAt time.Time      `json:"checked_at"`
+}
+
+// HealthConfig configures the dependencies checked by HealthService
+type HealthConfig struct {
+	// DataPath is a directory on the filesystem that holds the uploads,
+	// checked for disk headroom
+	DataPath string
+	// MinFreeDisk is the required disk headroom in bytes
+	MinFreeDisk uint64
+	// Analyzers maps the names of analysis services to their health URLs;
+	// services without a URL are not checked
+	Analyzers map[string]string
+}
+
+// HealthService checks the database, storage, disk and analysis services
+type HealthService struct {
+	db      *sql.DB
+	storage storage.Storage
+	config  HealthConfig
+	client  *http.Client
+	// draining is set once the service is shutting down
+	draining atomic.Bool
+}
+
+type healthCheckFunc func(ctx context.Context, check *HealthCheck)
+
+// NewHealthService creates a new HealthService
+func NewHealthService(db *sql.DB, store storage.Storage, config HealthConfig) *HealthService {
+	if config.MinFreeDisk == 0 {
+		config.MinFreeDisk = DefaultMinFreeDisk
+	}
+	return &HealthService{
+		db:      db,
+		storage: store,
+		config:  config,
+		client:  tracing.NewHTTPClient(healthCheckTimeout),
+	}
+}
+
+// Drain makes Ready fail from now on, so that load balancers stop sending
+// requests while the service shuts down
+func (s *HealthService) Drain() {
+	s.draining.Store(true)
+}
+
+// Ready checks what the service cannot serve requests without: the database
+// and its schema. It is cheap enough to be polled by a readiness probe, and
+// fails while the service drains.
+func (s *HealthService) Ready(ctx context.Context) *HealthReport {
+	if s.draining.Load() {
+		return &HealthReport{
+			Status: HealthFail,
+			Checks: []*HealthCheck{{
+				Name:    "shutdown",
+				Status:  HealthFail,
+				Message: "draining requests before shutdown",
+			}},
+			CheckedAt: time.Now().UTC(),
+		}
+	}
+	return s.run(ctx, map[string]healthCheckFunc{
+		"database":   s.checkDatabase,
+		"migrations": s.checkMigrations,
+	}, []string{"database", "migrations"})
+}
+
+// Check checks every dependency, including storage round trips, disk
+// headroom and the analysis services
+func (s *HealthService) Check(ctx context.Context) *HealthReport {
+	checks := map[string]healthCheckFunc{
+		"database":   s.checkDatabase,
+		"migrations": s.checkMigrations,
+		"storage":    s.checkStorage,
+		"disk":       s.checkDisk,
+	}
+	order := []string{"database", "migrations", "storage", "disk"}
+	for name, url := range s.config.Analyzers {
+		if url == "" {
+			continue
+		}
+		url := url
+		checks[name] = func(ctx context.Context, check *HealthCheck) {
+			s.checkHTTP(ctx, check, url)
+		}
+		order = append(order, name)
+	}
+	sort.Strings(order[4:])
+	return s.run(ctx, checks, order)
+}
+
+// run runs the checks concurrently, each with a timeout, and reports them in
+// the given order
+func (s *HealthService) run(ctx context.Context, checks map[string]healthCheckFunc, order []string) *HealthReport {
+	report := &HealthReport{
+		Status:    HealthOK,
+		Checks:    make([]*HealthCheck, len(order)),
+		CheckedAt: time.Now().UTC(),
+	}
+
+	var wg sync.WaitGroup
+	for i, name := range order {
+		check := &HealthCheck{Name: name, Status: HealthOK}
+		report.Checks[i] = check
+		wg.Add(1)
+		go func(fn healthCheckFunc) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			fn(ctx, check)
+			check.DurationMS = time.Since(start).Milliseconds()
+		}(checks[name])
+	}
+	wg.Wait()
+
+	for _, check := range report.Checks {
+		switch {
+		case check.Status == HealthFail:
+			report.Status = HealthFail
+		case check.Status == HealthWarn && report.Status == HealthOK:
+			report.Status = HealthWarn
+		}
+	}
+	return report
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context, check *HealthCheck) {
+	if err := s.db.PingContext(ctx); err != nil {
+		check.fail(err)
+		return
+	}
+	var one int
+	if err := s.db.QueryRowContext(ctx, `SELECT 1`).Scan(&one); err != nil {
+		check.fail(err)
+		return
+	}
+	stats := s.db.Stats()
+	check.Details = map[string]interface{}{
+		"open_connections": stats.OpenConnections,
+		"in_use":           stats.InUse,
+	}
+}
+
+func (s *HealthService) checkMigrations(ctx context.Context, check *HealthCheck) {
+	if err := database.CheckMigrations(s.db); err != nil {
+		check.fail(err)
+	}
+}
+
+// checkStorage writes, reads back and deletes a probe object
+func (s *HealthService) checkStorage(ctx context.Context, check *HealthCheck) {
+	key := healthProbePrefix + uuid.New().String()
+	payload := []byte(key)
+
+	if _, err := s.storage.Put(ctx, key, bytes.NewReader(payload)); err != nil {
+		check.fail(fmt.Errorf("write: %w", err))
+		return
+	}
+	defer func() {
+		if err := s.storage.Delete(context.Background(), key); err != nil && check.Status == HealthOK {
+			check.Status = HealthWarn
+			check.Message = "delete: " + err.Error()
+		}
+	}()
+
+	obj, err := s.storage.Open(ctx, key)
+	if err != nil {
+		check.fail(fmt.Errorf("read: %w", err))
+		return
+	}
+	defer obj.Close()
+	got, err := io.ReadAll(obj)
+	if err != nil {
+		check.fail(fmt.Errorf("read: %w", err))
+		return
+	}
+	if !bytes.Equal(got, payload) {
+		check.fail(fmt.Errorf("read back %d bytes that differ from the %d written", len(got), len(payload)))
+	}
+}
+
+func (s *HealthService) checkDisk(ctx context.Context, check *HealthCheck) {
+	if s.config.DataPath == "" {
+		check.Status = HealthWarn
+		check.Message = "no data path configured"
+		return
+	}
+	free, total, err := utils.DiskSpace(s.config.DataPath)
+	if err != nil {
+		check.fail(err)
+		return
+	}
+	check.Details = map[string]interface{}{
+		"path":           s.config.DataPath,
+		"free_bytes":     free,
+		"total_bytes":    total,
+		"min_free_bytes": s.config.MinFreeDisk,
+	}
+	switch {
+	case free < s.config.MinFreeDisk:
+		check.Status = HealthFail
+		check.Message = fmt.Sprintf("only %s free", FormatBytes(int64(free)))
+	case free < 2*s.config.MinFreeDisk:
+		check.Status = HealthWarn
+		check.Message = fmt.Sprintf("only %s free", FormatBytes(int64(free)))
+	}
+}
+
+// checkHTTP checks that an analysis service answers url. Uploads work without
+// the analyzers, so a server error or an unreachable service only warns.
+func (s *HealthService) checkHTTP(ctx context.Context, check *HealthCheck, url string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		check.fail(err)
+		return
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		check.Status = HealthWarn
+		check.Message = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	check.Details = map[string]interface{}{"status_code": resp.StatusCode}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		check.Status = HealthWarn
+		check.Message = "returned " + resp.Status
+	}
+}
+
+func (c *HealthCheck) fail(err error) {
+	c.Status = HealthFail
+	c.Message = err.Error()
+}
+
+// AnalyzerHealthURL returns the health endpoint of an analysis service at
+// baseURL, or "" if no service is configured
+func AnalyzerHealthURL(baseURL string) string {
+	if baseURL = strings.TrimRight(baseURL, "/"); baseURL == "" {
+		return ""
+	}
+	return baseURL + "/health"
+}
@@ -0,0 +1,461 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/auth"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/tracing"
+)
+
+// KeycloakConfig configures access to the Keycloak Admin REST API. The client
+// needs a service account with the realm-management roles manage-users and
+// view-realm.
+type KeycloakConfig struct {
+	URL          string
+	Realm        string
+	ClientID     string
+	ClientSecret string
+}
+
+// KeycloakUserDirectory manages users in a Keycloak realm through the Admin
+// REST API. Roles are realm roles.
+type KeycloakUserDirectory struct {
+	config KeycloakConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// keycloakUser is Keycloak's UserRepresentation
+type keycloakUser struct {
+	ID               string               `json:"id,omitempty"`
+	Username         string               `json:"username,omitempty"`
+	Email            string               `json:"email,omitempty"`
+	FirstName        *string              `json:"firstName,omitempty"`
+	LastName         *string              `json:"lastName,omitempty"`
+	Enabled          *bool                `json:"enabled,omitempty"`
+	CreatedTimestamp int64                `json:"createdTimestamp,omitempty"`
+	Credentials      []keycloakCredential `json:"credentials,omitempty"`
+}
+
+type keycloakCredential struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Temporary bool   `json:"temporary"`
+}
+
+type keycloakRole struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// NewKeycloakUserDirectory creates a directory for the realm in config
+func NewKeycloakUserDirectory(config KeycloakConfig) *KeycloakUserDirectory {
+	config.URL = strings.TrimRight(config.URL, "/")
+	return &KeycloakUserDirectory{
+		config: config,
+		client: tracing.NewHTTPClient(30 * time.Second),
+	}
+}
+
+// ListUsers returns one page of users matching the query. Keycloak cannot
+// combine a role filter with search, so role queries are filtered here.
+func (d *KeycloakUserDirectory) ListUsers(ctx context.Context, q UserQuery) (*UserPage, error) {
+	q.normalizePage()
+	page := &UserPage{Users: []*models.User{}, Page: q.Page, Limit: q.Limit}
+
+	var users []keycloakUser
+	if q.Role != "" {
+		members, err := d.roleMembers(ctx, q.Role)
+		if err != nil {
+			return nil, err
+		}
+		search := strings.ToLower(strings.TrimSpace(q.Search))
+		for _, u := range members {
+			if q.Enabled != nil && (u.Enabled == nil || *u.Enabled != *q.Enabled) {
+				continue
+			}
+			if search != "" && !strings.Contains(strings.ToLower(u.Username+" "+u.Email+" "+fullName(u)), search) {
+				continue
+			}
+			users = append(users, u)
+		}
+		sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+		page.Total = len(users)
+		start := min((q.Page-1)*q.Limit, len(users))
+		users = users[start:min(start+q.Limit, len(users))]
+	} else {
+		params := url.Values{}
+		if search := strings.TrimSpace(q.Search); search != "" {
+			params.Set("search", search)
+		}
+		if q.Enabled != nil {
+			params.Set("enabled", strconv.FormatBool(*q.Enabled))
+		}
+		if err := d.do(ctx, http.MethodGet, "/users/count?"+params.Encode(), nil, &page.Total); err != nil {
+			return nil, err
+		}
+		params.Set("first", strconv.Itoa((q.Page-1)*q.Limit))
+		params.Set("max", strconv.Itoa(q.Limit))
+		if err := d.do(ctx, http.MethodGet, "/users?"+params.Encode(), nil, &users); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, u := range users {
+		user, err := d.toUser(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, user)
+	}
+	return page, nil
+}
+
+// GetUser retrieves a user by ID
+func (d *KeycloakUserDirectory) GetUser(ctx context.Context, id string) (*models.User, error) {
+	var u keycloakUser
+	if err := d.do(ctx, http.MethodGet, "/users/"+url.PathEscape(id), nil, &u); err != nil {
+		return nil, err
+	}
+	return d.toUser(ctx, u)
+}
+
+// CreateUser creates a user in the realm and assigns their roles
+func (d *KeycloakUserDirectory) CreateUser(ctx context.Context, req models.CreateUserRequest) (*models.User, error) {
+	if err := validateNewUser(&req); err != nil {
+		return nil, err
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+	first, last := splitFullName(req.FullName)
+	u := keycloakUser{
+		Username:  req.Username,
+		Email:     req.Email,
+		FirstName: &first,
+		LastName:  &last,
+		Enabled:   &enabled,
+	}
+	if req.Password != "" {
+		u.Credentials = []keycloakCredential{{Type: "password", Value: req.Password, Temporary: req.TemporaryPassword}}
+	}
+
+	resp, err := d.request(ctx, http.MethodPost, "/users", u)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	// The new user's ID is the last segment of the Location header
+	id := path.Base(resp.Header.Get("Location"))
+	if id == "" || id == "." || id == "/" {
+		return nil, fmt.Errorf("keycloak did not return the new user's location")
+	}
+
+	if len(req.Roles) > 0 {
+		if err := d.SetRoles(ctx, id, req.Roles); err != nil {
+			return nil, err
+		}
+	}
+	return d.GetUser(ctx, id)
+}
+
+// UpdateUser changes a user's details
+func (d *KeycloakUserDirectory) UpdateUser(ctx context.Context, id string, update models.UserUpdate) (*models.User, error) {
+	if err := validateUserUpdate(&update); err != nil {
+		return nil, err
+	}
+
+	// Keycloak only changes the fields present in the representation
+	var u keycloakUser
+	if update.Username != nil {
+		u.Username = *update.Username
+	}
+	if update.Email != nil {
+		u.Email = *update.Email
+	}
+	if update.FullName != nil {
+		first, last := splitFullName(*update.FullName)
+		u.FirstName, u.LastName = &first, &last
+	}
+	if update.Enabled != nil {
+		u.Enabled = update.Enabled
+	}
+	if err := d.do(ctx, http.MethodPut, "/users/"+url.PathEscape(id), u, nil); err != nil {
+		return nil, err
+	}
+
+	return d.GetUser(ctx, id)
+}
+
+// SetRoles replaces the user's realm roles. The realm's default roles are
+// left assigned.
+func (d *KeycloakUserDirectory) SetRoles(ctx context.Context, id string, roles []string) error {
+	roles, err := cleanRoles(roles)
+	if err != nil {
+		return err
+	}
+
+	current, err := d.userRoles(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	var remove, add []keycloakRole
+	for _, role := range current {
+		if !hasRole(roles, role.Name) && role.Name != "default-roles-"+d.config.Realm {
+			remove = append(remove, role)
+		}
+	}
+	for _, name := range roles {
+		if containsRole(current, name) {
+			continue
+		}
+		var role keycloakRole
+		if err := d.do(ctx, http.MethodGet, "/roles/"+url.PathEscape(name), nil, &role); err != nil {
+			if err == ErrUserNotFound {
+				return fmt.Errorf("%w: unknown role %q", ErrInvalidUser, name)
+			}
+			return err
+		}
+		add = append(add, role)
+	}
+
+	mappings := "/users/" + url.PathEscape(id) + "/role-mappings/realm"
+	if len(remove) > 0 {
+		if err := d.do(ctx, http.MethodDelete, mappings, remove, nil); err != nil {
+			return err
+		}
+	}
+	if len(add) > 0 {
+		if err := d.do(ctx, http.MethodPost, mappings, add, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResetPassword sets a new password. Temporary passwords must be changed at
+// the next sign-in.
+func (d *KeycloakUserDirectory) ResetPassword(ctx context.Context, id, password string, temporary bool) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	return d.do(ctx, http.MethodPut, "/users/"+url.PathEscape(id)+"/reset-password", keycloakCredential{
+		Type:      "password",
+		Value:     password,
+		Temporary: temporary,
+	}, nil)
+}
+
+// DeleteUser removes a user from the realm
+func (d *KeycloakUserDirectory) DeleteUser(ctx context.Context, id string) error {
+	return d.do(ctx, http.MethodDelete, "/users/"+url.PathEscape(id), nil, nil)
+}
+
+func (d *KeycloakUserDirectory) toUser(ctx context.Context, u keycloakUser) (*models.User, error) {
+	roles, err := d.userRoles(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		ID:        u.ID,
+		Email:     u.Email,
+		Username:  u.Username,
+		FullName:  fullName(u),
+		IsActive:  u.Enabled != nil && *u.Enabled,
+		Roles:     []string{},
+		CreatedAt: time.UnixMilli(u.CreatedTimestamp).UTC(),
+	}
+	user.UpdatedAt = user.CreatedAt
+	for _, role := range roles {
+		user.Roles = append(user.Roles, role.Name)
+	}
+	sort.Strings(user.Roles)
+	user.IsAdmin = hasRole(user.Roles, auth.RoleAdmin)
+	return user, nil
+}
+
+func (d *KeycloakUserDirectory) userRoles(ctx context.Context, id string) ([]keycloakRole, error) {
+	var roles []keycloakRole
+	err := d.do(ctx, http.MethodGet, "/users/"+url.PathEscape(id)+"/role-mappings/realm", nil, &roles)
+	return roles, err
+}
+
+// roleMembers returns every user with the realm role
+func (d *KeycloakUserDirectory) roleMembers(ctx context.Context, role string) ([]keycloakUser, error) {
+	const batch = 100
+	var members []keycloakUser
+	for first := 0; ; first += batch {
+		var users []keycloakUser
+		endpoint := fmt.Sprintf("/roles/%s/users?first=%d&max=%d", url.PathEscape(role), first, batch)
+		if err := d.do(ctx, http.MethodGet, endpoint, nil, &users); err != nil {
+			if err == ErrUserNotFound {
+				return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidUser, role)
+			}
+			return nil, err
+		}
+		members = append(members, users...)
+		if len(users) < batch {
+			return members, nil
+		}
+	}
+}
+
+// do sends a request to the admin API and decodes the JSON response into out
+func (d *KeycloakUserDirectory) do(ctx context.Context, method, endpoint string, body, out interface{}) error {
+	resp, err := d.request(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// request sends a request to the admin API and maps error statuses to the
+// directory errors
+func (d *KeycloakUserDirectory) request(ctx context.Context, method, endpoint string, body interface{}) (*http.Response, error) {
+	token, err := d.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, d.config.URL+"/admin/realms/"+url.PathEscape(d.config.Realm)+endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var apiErr struct {
+		Error        string `json:"error"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+	message := apiErr.ErrorMessage
+	if message == "" {
+		message = apiErr.Error
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	case http.StatusConflict:
+		return nil, fmt.Errorf("%w: %s", ErrUserExists, message)
+	case http.StatusBadRequest:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidUser, message)
+	default:
+		return nil, fmt.Errorf("keycloak returned %s: %s", resp.Status, message)
+	}
+}
+
+// accessToken returns a service account token, fetching a new one shortly
+// before the cached one expires
+func (d *KeycloakUserDirectory) accessToken(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.token != "" && time.Now().Before(d.tokenExpiry) {
+		return d.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {d.config.ClientID},
+		"client_secret": {d.config.ClientSecret},
+	}
+	tokenURL := d.config.URL + "/realms/" + url.PathEscape(d.config.Realm) + "/protocol/openid-connect/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("keycloak token request returned %s", resp.Status)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	d.token = result.AccessToken
+	d.tokenExpiry = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - 30*time.Second)
+	return d.token, nil
+}
+
+func containsRole(roles []keycloakRole, name string) bool {
+	for _, role := range roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func fullName(u keycloakUser) string {
+	var parts []string
+	if u.FirstName != nil && *u.FirstName != "" {
+		parts = append(parts, *u.FirstName)
+	}
+	if u.LastName != nil && *u.LastName != "" {
+		parts = append(parts, *u.LastName)
+	}
+	return strings.Join(parts, " ")
+}
+
+// splitFullName splits a full name into Keycloak's first and last name at the
+// first space
+func splitFullName(name string) (first, last string) {
+	first, last, _ = strings.Cut(strings.TrimSpace(name), " ")
+	return first, strings.TrimSpace(last)
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wronai/media-vault-backend/internal/auth"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const userColumns = `id, username, email, COALESCE(full_name, ''), avatar_url, is_active, last_login, created_at, updated_at`
+
+// LocalUserDirectory keeps users in the local users table, for deployments
+// without Keycloak
+type LocalUserDirectory struct {
+	db *sql.DB
+}
+
+// NewLocalUserDirectory creates a new LocalUserDirectory
+func NewLocalUserDirectory(db *sql.DB) *LocalUserDirectory {
+	return &LocalUserDirectory{db: db}
+}
+
+// ListUsers returns one page of users matching the query
+func (d *LocalUserDirectory) ListUsers(ctx context.Context, q UserQuery) (*UserPage, error) {
+	q.normalizePage()
+
+	conds := []string{"1 = 1"}
+	var args []interface{}
+	if search := strings.TrimSpace(q.Search); search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(search)) + "%"
+		conds = append(conds, `(username LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\' OR LOWER(full_name) LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern)
+	}
+	if q.Enabled != nil {
+		conds = append(conds, "is_active = ?")
+		args = append(args, *q.Enabled)
+	}
+	if q.Role != "" {
+		conds = append(conds, "id IN (SELECT user_id FROM user_roles WHERE role = ?)")
+		args = append(args, q.Role)
+	}
+	where := strings.Join(conds, " AND ")
+
+	page := &UserPage{Users: []*models.User{}, Page: q.Page, Limit: q.Limit}
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE `+where+`
+		ORDER BY username
+		LIMIT ? OFFSET ?
+	`, append(args, q.Limit, (q.Page-1)*q.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, user := range page.Users {
+		if err := d.loadRoles(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// GetUser retrieves a user by ID
+func (d *LocalUserDirectory) GetUser(ctx context.Context, id string) (*models.User, error) {
+	user, err := scanUser(d.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := d.loadRoles(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CreateUser adds a user. Users without a password cannot sign in until one
+// is set with ResetPassword.
+func (d *LocalUserDirectory) CreateUser(ctx context.Context, req models.CreateUserRequest) (*models.User, error) {
+	if err := validateNewUser(&req); err != nil {
+		return nil, err
+	}
+	var passwordHash interface{}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash = string(hash)
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id := uuid.New().String()
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO users (id, username, email, full_name, password_hash, password_temporary, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, req.Username, req.Email, nullIfEmpty(req.FullName), passwordHash, req.TemporaryPassword, enabled, now, now); err != nil {
+		return nil, userConflict(err)
+	}
+	if err := replaceRoles(ctx, tx, id, req.Roles); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return d.GetUser(ctx, id)
+}
+
+// UpdateUser changes a user's details
+func (d *LocalUserDirectory) UpdateUser(ctx context.Context, id string, update models.UserUpdate) (*models.User, error) {
+	if err := validateUserUpdate(&update); err != nil {
+		return nil, err
+	}
+
+	sets := []string{"updated_at = ?"}
+	args := []interface{}{time.Now().UTC()}
+	if update.Username != nil {
+		sets = append(sets, "username = ?")
+		args = append(args, *update.Username)
+	}
+	if update.Email != nil {
+		sets = append(sets, "email = ?")
+		args = append(args, *update.Email)
+	}
+	if update.FullName != nil {
+		sets = append(sets, "full_name = ?")
+		args = append(args, nullIfEmpty(*update.FullName))
+	}
+	if update.Enabled != nil {
+		sets = append(sets, "is_active = ?")
+		args = append(args, *update.Enabled)
+	}
+
+	result, err := d.db.ExecContext(ctx, `UPDATE users SET `+strings.Join(sets, ", ")+` WHERE id = ?`, append(args, id)...)
+	if err != nil {
+		return nil, userConflict(err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return d.GetUser(ctx, id)
+}
+
+// SetRoles replaces the user's roles
+func (d *LocalUserDirectory) SetRoles(ctx context.Context, id string, roles []string) error {
+	roles, err := cleanRoles(roles)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE users SET updated_at = ? WHERE id = ?`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	if err := replaceRoles(ctx, tx, id, roles); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword sets a new password. Temporary passwords must be changed at
+// the next sign-in.
+func (d *LocalUserDirectory) ResetPassword(ctx context.Context, id, password string, temporary bool) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	result, err := d.db.ExecContext(ctx, `
+		UPDATE users SET password_hash = ?, password_temporary = ?, updated_at = ? WHERE id = ?
+	`, string(hash), temporary, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteUser removes a user and their roles. Their content is handled by
+// UserDataService.
+func (d *LocalUserDirectory) DeleteUser(ctx context.Context, id string) error {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (d *LocalUserDirectory) loadRoles(ctx context.Context, user *models.User) error {
+	rows, err := d.db.QueryContext(ctx, `SELECT role FROM user_roles WHERE user_id = ? ORDER BY role`, user.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	user.Roles = []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return err
+		}
+		user.Roles = append(user.Roles, role)
+	}
+	user.IsAdmin = hasRole(user.Roles, auth.RoleAdmin)
+	return rows.Err()
+}
+
+func replaceRoles(ctx context.Context, tx *sql.Tx, userID string, roles []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO user_roles (user_id, role) VALUES (?, ?)`, userID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userConflict maps unique constraint violations to ErrUserExists
+func userConflict(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return fmt.Errorf("%w: the username or email is taken", ErrUserExists)
+	}
+	return err
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var u models.User
+	if err := row.Scan(
+		&u.ID,
+		&u.Username,
+		&u.Email,
+		&u.FullName,
+		&u.AvatarURL,
+		&u.IsActive,
+		&u.LastLogin,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
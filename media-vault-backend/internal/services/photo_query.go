@@ -0,0 +1,368 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/tracing"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+// Photo listing limits
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ErrInvalidCursor is returned when a pagination cursor is malformed or was
+// issued for a different sort order
+var ErrInvalidCursor = apperr.Invalid("invalid_cursor", "invalid cursor")
+
+// ErrInvalidPhotoQuery is returned when the parameters of a photo query are
+// invalid
+var ErrInvalidPhotoQuery = apperr.Invalid("invalid_photo_query", "invalid photo query")
+
+// sortColumn describes a column photos may be sorted by. Nullable columns are
+// coalesced to a sentinel so keyset comparisons stay well defined. key, if
+// set, selects the raw value stored in cursors; DATETIME columns are read as
+// text so they compare exactly as stored.
+type sortColumn struct {
+	expr string
+	key  string
+}
+
+// photoSortColumns whitelists the sortable columns
+var photoSortColumns = map[string]sortColumn{
+	"created_at":    {expr: "created_at", key: "CAST(created_at AS TEXT)"},
+	"updated_at":    {expr: "updated_at", key: "CAST(updated_at AS TEXT)"},
+	"taken_at":      {expr: "COALESCE(taken_at, '')"},
+	"original_name": {expr: "original_name"},
+	"file_size":     {expr: "file_size"},
+	"width":         {expr: "COALESCE(width, -1)"},
+	"height":        {expr: "COALESCE(height, -1)"},
+	"view_count":    {expr: "COALESCE(view_count, 0)"},
+}
+
+// TagFilter restricts a photo listing to photos carrying the given tags
+type TagFilter struct {
+	Tags     []string `json:"tags,omitempty"`      // tag names or slugs
+	MatchAll bool     `json:"match_all,omitempty"` // require every tag (AND) instead of any of them (OR)
+}
+
+// PhotoQuery describes a filtered, sorted page of photos. It is shared by the
+// user and partner listings and, serialized as JSON, by smart albums.
+type PhotoQuery struct {
+	// UserID scopes the query to photos owned by the user, or, with AsPartner,
+	// also to photos the user delivered as a partner
+	UserID    string `json:"-"`
+	AsPartner bool   `json:"-"`
+
+	CreatedFrom *time.Time `json:"created_from,omitempty"`
+	CreatedTo   *time.Time `json:"created_to,omitempty"`
+	TakenFrom   *time.Time `json:"taken_from,omitempty"`
+	TakenTo     *time.Time `json:"taken_to,omitempty"`
+
+	MimeTypes        []string  `json:"mime_type,omitempty"` // exact types or wildcards such as "image/*"
+	MinWidth         int       `json:"min_width,omitempty"`
+	MaxWidth         int       `json:"max_width,omitempty"`
+	MinHeight        int       `json:"min_height,omitempty"`
+	MaxHeight        int       `json:"max_height,omitempty"`
+	ModerationStatus []string  `json:"moderation_status,omitempty"`
+	Shared           *bool     `json:"shared,omitempty"`
+	PartnerID        string    `json:"partner_id,omitempty"`
+	Tags             TagFilter `json:"tags,omitempty"`
+	Search           string    `json:"search,omitempty"` // substring match on name, descriptions and tags
+
+	SortBy    string `json:"sort_by,omitempty"`
+	SortOrder string `json:"sort_order,omitempty"` // "asc" or "desc"
+
+	Limit int `json:"-"`
+	// Page selects offset pagination; Cursor (from PhotoPage.NextCursor)
+	// selects keyset pagination, which stays stable while photos are added
+	Page   int    `json:"-"`
+	Cursor string `json:"-"`
+}
+
+// PhotoPage is one page of a photo listing
+type PhotoPage struct {
+	Photos     []*models.Photo
+	Total      int
+	Page       int
+	Limit      int
+	NextCursor string
+}
+
+type photoCursor struct {
+	SortBy string      `json:"s"`
+	Order  string      `json:"o"`
+	Value  interface{} `json:"v"`
+	ID     string      `json:"id"`
+}
+
+// Normalize validates the query and fills in defaults
+func (q *PhotoQuery) Normalize() error {
+	if q.SortBy == "" {
+		q.SortBy = "created_at"
+	}
+	if _, ok := photoSortColumns[q.SortBy]; !ok {
+		return ErrInvalidPhotoQuery.WithField("sort_by", fmt.Sprintf("cannot be %q", q.SortBy))
+	}
+
+	q.SortOrder = strings.ToLower(q.SortOrder)
+	if q.SortOrder == "" {
+		q.SortOrder = "desc"
+	}
+	if q.SortOrder != "asc" && q.SortOrder != "desc" {
+		return ErrInvalidPhotoQuery.WithField("sort_order", "must be 'asc' or 'desc'")
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+
+	if q.MinWidth < 0 || q.MaxWidth < 0 || q.MinHeight < 0 || q.MaxHeight < 0 {
+		return fmt.Errorf("%w: dimensions must not be negative", ErrInvalidPhotoQuery)
+	}
+	if q.CreatedFrom != nil && q.CreatedTo != nil && q.CreatedTo.Before(*q.CreatedFrom) {
+		return ErrInvalidPhotoQuery.WithField("created_to", "must not be before created_from")
+	}
+	if q.TakenFrom != nil && q.TakenTo != nil && q.TakenTo.Before(*q.TakenFrom) {
+		return ErrInvalidPhotoQuery.WithField("taken_to", "must not be before taken_from")
+	}
+
+	return nil
+}
+
+// where builds the WHERE clause and arguments for the query's filters
+func (q *PhotoQuery) where() (string, []interface{}) {
+	conds := []string{"deleted_at IS NULL"}
+	var args []interface{}
+
+	if q.AsPartner {
+		conds = append(conds, "(user_id = ? OR partner_id = ?)")
+		args = append(args, q.UserID, q.UserID)
+	} else {
+		conds = append(conds, "user_id = ?")
+		args = append(args, q.UserID)
+	}
+
+	addTime := func(cond string, t *time.Time) {
+		if t != nil {
+			conds = append(conds, cond)
+			args = append(args, t.UTC())
+		}
+	}
+	addTime("created_at >= ?", q.CreatedFrom)
+	addTime("created_at < ?", q.CreatedTo)
+	addTime("taken_at >= ?", q.TakenFrom)
+	addTime("taken_at < ?", q.TakenTo)
+
+	addInt := func(cond string, v int) {
+		if v > 0 {
+			conds = append(conds, cond)
+			args = append(args, v)
+		}
+	}
+	addInt("width >= ?", q.MinWidth)
+	addInt("width <= ?", q.MaxWidth)
+	addInt("height >= ?", q.MinHeight)
+	addInt("height <= ?", q.MaxHeight)
+
+	if len(q.MimeTypes) > 0 {
+		var mimeConds []string
+		for _, mimeType := range q.MimeTypes {
+			if strings.HasSuffix(mimeType, "/*") {
+				mimeConds = append(mimeConds, `mime_type LIKE ? ESCAPE '\'`)
+				args = append(args, escapeLike(strings.TrimSuffix(mimeType, "*"))+"%")
+			} else {
+				mimeConds = append(mimeConds, "mime_type = ?")
+				args = append(args, mimeType)
+			}
+		}
+		conds = append(conds, "("+strings.Join(mimeConds, " OR ")+")")
+	}
+
+	if len(q.ModerationStatus) > 0 {
+		conds = append(conds, "COALESCE(moderation_status, 'pending') IN ("+placeholders(len(q.ModerationStatus))+")")
+		for _, status := range q.ModerationStatus {
+			args = append(args, status)
+		}
+	}
+
+	if q.Shared != nil {
+		conds = append(conds, "COALESCE(is_shared, 0) = ?")
+		args = append(args, *q.Shared)
+	}
+
+	if q.PartnerID != "" {
+		conds = append(conds, "partner_id = ?")
+		args = append(args, q.PartnerID)
+	}
+
+	if q.Search != "" {
+		pattern := "%" + escapeLike(q.Search) + "%"
+		conds = append(conds, `(original_name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\'
+			OR ai_description LIKE ? ESCAPE '\' OR tags LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+
+	slugs := make([]interface{}, 0, len(q.Tags.Tags))
+	for _, tag := range q.Tags.Tags {
+		if slug := utils.Slugify(tag); slug != "" {
+			slugs = append(slugs, slug)
+		}
+	}
+	if len(slugs) > 0 {
+		// Photos carrying any of the tags, or all of them when MatchAll is set.
+		// Tags belong to the photo's owner.
+		cond := `id IN (
+			SELECT pt.photo_id FROM photo_tags pt
+			JOIN tags t ON t.id = pt.tag_id
+			JOIN photos tp ON tp.id = pt.photo_id AND tp.user_id = t.user_id
+			WHERE t.slug IN (` + placeholders(len(slugs)) + `)
+			GROUP BY pt.photo_id`
+		args = append(args, slugs...)
+		if q.Tags.MatchAll {
+			cond += ` HAVING COUNT(DISTINCT t.slug) = ?`
+			args = append(args, len(slugs))
+		}
+		conds = append(conds, cond+")")
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// ListPhotos returns one page of photos matching the query
+func (s *PhotoService) ListPhotos(ctx context.Context, q PhotoQuery) (_ *PhotoPage, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.ListPhotos")
+	defer func() { tracing.End(span, err) }()
+
+	if err := q.Normalize(); err != nil {
+		return nil, err
+	}
+
+	where, args := q.where()
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM photos WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	sortExpr := photoSortColumns[q.SortBy].expr
+	keyExpr := photoSortColumns[q.SortBy].key
+	if keyExpr == "" {
+		keyExpr = sortExpr
+	}
+	cmp, dir := "<", "DESC"
+	if q.SortOrder == "asc" {
+		cmp, dir = ">", "ASC"
+	}
+
+	keyset := q.Cursor != ""
+	if keyset {
+		cursor, err := decodePhotoCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.SortBy != q.SortBy || cursor.Order != q.SortOrder {
+			return nil, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidCursor)
+		}
+		where += ` AND (` + sortExpr + ` ` + cmp + ` ? OR (` + sortExpr + ` = ? AND id ` + cmp + ` ?))`
+		args = append(args, cursor.Value, cursor.Value, cursor.ID)
+	}
+
+	query := `
+		SELECT ` + photoColumns + `, ` + keyExpr + `
+		FROM photos
+		WHERE ` + where + `
+		ORDER BY ` + sortExpr + ` ` + dir + `, id ` + dir + `
+		LIMIT ?`
+	args = append(args, q.Limit)
+	if !keyset {
+		query += ` OFFSET ?`
+		args = append(args, (q.Page-1)*q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &PhotoPage{Photos: []*models.Photo{}, Total: total, Page: q.Page, Limit: q.Limit}
+	var lastKey interface{}
+	for rows.Next() {
+		var key interface{}
+		photo, err := scanPhoto(scannerWithExtra{rows, []interface{}{&key}})
+		if err != nil {
+			return nil, err
+		}
+		page.Photos = append(page.Photos, photo)
+		lastKey = key
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Photos) == q.Limit {
+		last := page.Photos[len(page.Photos)-1]
+		if b, ok := lastKey.([]byte); ok {
+			lastKey = string(b)
+		}
+		page.NextCursor = encodePhotoCursor(photoCursor{SortBy: q.SortBy, Order: q.SortOrder, Value: lastKey, ID: last.ID})
+	}
+
+	return page, nil
+}
+
+// queryMatchesPhoto reports whether a photo satisfies the query's filters
+func queryMatchesPhoto(ctx context.Context, db *sql.DB, q PhotoQuery, photoID string) (bool, error) {
+	if err := q.Normalize(); err != nil {
+		return false, err
+	}
+
+	where, args := q.where()
+	var count int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM photos WHERE id = ? AND `+where,
+		append([]interface{}{photoID}, args...)...).Scan(&count)
+	return count > 0, err
+}
+
+func encodePhotoCursor(c photoCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePhotoCursor(s string) (*photoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c photoCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	if _, ok := photoSortColumns[c.SortBy]; !ok {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// placeholders returns n comma-separated SQL placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
@@ -2,109 +2,641 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 	"mime/multipart"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/valyala/fasthttp"
+	"github.com/google/uuid"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/metrics"
 	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/storage"
+	"github.com/wronai/media-vault-backend/internal/tracing"
+	"github.com/wronai/media-vault-backend/internal/utils"
 )
 
+var (
+	// ErrPhotoNotFound is returned when a photo does not exist
+	ErrPhotoNotFound = apperr.NotFound("photo_not_found", "photo not found")
+	// ErrInvalidPhotoUpdate is returned when photo metadata cannot be updated
+	// as requested
+	ErrInvalidPhotoUpdate = apperr.Invalid("invalid_photo_update", "invalid photo update")
+	// ErrTranslationNotFound is returned when a photo has no translation in a
+	// language
+	ErrTranslationNotFound = apperr.NotFound("translation_not_found", "translation not found")
+	// ErrPhotoTypeNotAllowed is returned for uploads whose content is not a
+	// supported image, whatever their file name says
+	ErrPhotoTypeNotAllowed = ErrFileTypeNotAllowed.WithMessage("Invalid file type. Only JPG, JPEG, PNG, GIF, and WebP are allowed")
+)
+
+// photoTypes lists the sniffed content types accepted as photo originals
+var photoTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// photoColumns lists the photos columns in the order scanPhoto expects them
+const photoColumns = `id, user_id, partner_id, filename, original_name, file_path, thumbnail_path,
+	file_size, mime_type, width, height, hash, description, ai_description, tags,
+	ai_confidence, is_nsfw, nsfw_confidence, moderation_status, exif_data, location,
+	camera_make, camera_model, taken_at, is_shared, share_count, view_count,
+	created_at, updated_at, processed_at, deleted_at`
+
+// updatablePhotoFields lists the columns UpdatePhoto may change
+var updatablePhotoFields = map[string]bool{
+	"description":    true,
+	"ai_description": true,
+	"tags":           true,
+	"location":       true,
+}
+
 type PhotoService struct {
-	db *sql.DB
+	db              *sql.DB
+	storage         storage.Storage
+	defaultLanguage string
 }
 
-func NewPhotoService(db *sql.DB) *PhotoService {
-	return &PhotoService{db: db}
+// NewPhotoService creates a new PhotoService. Descriptions and tags stored on
+// the photos table are in defaultLanguage; other languages live in photo_translations.
+func NewPhotoService(db *sql.DB, store storage.Storage, defaultLanguage string) *PhotoService {
+	if defaultLanguage = utils.NormalizeLanguageTag(defaultLanguage); defaultLanguage == "" {
+		defaultLanguage = utils.DefaultLanguage
+	}
+	return &PhotoService{db: db, storage: store, defaultLanguage: defaultLanguage}
 }
 
-// UploadPhoto handles photo upload
-func (s *PhotoService) UploadPhoto(ctx context.Context, userID string, fileHeader *multipart.FileHeader, meta map[string]interface{}) (*models.Photo, error) {
-	// TODO: Implement actual file upload and database record creation
-	return &models.Photo{
-		ID:           "generated-id",
-		UserID:       userID,
-		Filename:     fileHeader.Filename,
-		OriginalName: fileHeader.Filename,
-		FileSize:     fileHeader.Size,
-		MimeType:     fileHeader.Header.Get("Content-Type"),
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}, nil
+// DefaultLanguage returns the language of the untranslated descriptions and tags
+func (s *PhotoService) DefaultLanguage() string {
+	return s.defaultLanguage
 }
 
-// GetPhoto retrieves a photo by ID
-func (s *PhotoService) GetPhoto(ctx *fasthttp.RequestCtx, photoID string) (*models.Photo, error) {
-	// TODO: Implement actual database query
-	return &models.Photo{
-		ID:           photoID,
-		UserID:       "user-id",
-		Filename:     "example.jpg",
-		OriginalName: "example.jpg",
-		FileSize:     1024,
-		MimeType:     "image/jpeg",
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}, nil
+// UploadPhoto stores an uploaded file and creates its database record.
+// Recognized metadata keys are "description" (string) and "tags" ([]string,
+// already validated).
+func (s *PhotoService) UploadPhoto(ctx context.Context, userID string, fileHeader *multipart.FileHeader, meta map[string]interface{}) (_ *models.Photo, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.UploadPhoto")
+	defer func() { tracing.End(span, err) }()
+	defer func() { metrics.ObserveUpload(metrics.UploadPhoto, fileHeader.Size, err) }()
+
+	now := time.Now().UTC()
+	photo := &models.Photo{
+		ID:               uuid.New().String(),
+		UserID:           userID,
+		OriginalName:     filepath.Base(fileHeader.Filename),
+		ModerationStatus: "pending",
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	photo.Filename = photo.ID + strings.ToLower(filepath.Ext(photo.OriginalName))
+	photo.FilePath = path.Join("originals", userID, photo.Filename)
+
+	stored, err := s.storeOriginal(ctx, photo.FilePath, fileHeader)
+	if err != nil {
+		return nil, err
+	}
+	photo.FileSize = stored.size
+	photo.MimeType = stored.mimeType
+	photo.Hash = stored.hash
+	photo.Width, photo.Height = stored.width, stored.height
+
+	if description, ok := meta["description"].(string); ok && description != "" {
+		photo.Description = &description
+	}
+	tags, _ := meta["tags"].([]string)
+
+	if err := s.insertPhoto(ctx, photo, tags); err != nil {
+		// Don't leave an orphaned blob behind
+		discardBlob(ctx, s.storage, photo.FilePath)
+		return nil, err
+	}
+
+	return s.GetPhoto(ctx, photo.ID)
 }
 
-// ListPhotos lists photos with pagination and filtering
-func (s *PhotoService) ListPhotos(ctx *fasthttp.RequestCtx, userID string, page, limit int) ([]*models.Photo, int, error) {
-	// TODO: Implement actual database query with pagination
-	return []*models.Photo{}, 0, nil
-}
-
-// UpdatePhoto updates a photo's metadata
-func (s *PhotoService) UpdatePhoto(ctx *fasthttp.RequestCtx, photoID string, updates map[string]interface{}) (*models.Photo, error) {
-	// TODO: Implement actual update logic
-	return &models.Photo{
-		ID:           photoID,
-		UserID:       "user-id",
-		Filename:     "updated.jpg",
-		OriginalName: "updated.jpg",
-		FileSize:     1024,
-		MimeType:     "image/jpeg",
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}, nil
+// discardBlob deletes a blob that nothing refers to, such as one whose record
+// could not be written. Failures only waste space, so they are logged.
+func discardBlob(ctx context.Context, store storage.Storage, key string) {
+	if err := store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logging.FromContext(ctx).Warn("Failed to delete orphaned blob", "key", key, logging.Err(err))
+	}
+}
+
+// storedOriginal describes an original written by storeOriginal
+type storedOriginal struct {
+	size          int64
+	mimeType      string
+	hash          string
+	width, height *int
+}
+
+// storeOriginal writes an uploaded original to storage under key, sniffing
+// its content type and reading its dimensions on the way. Content that is not
+// a supported image is refused, as it would be served as is.
+func (s *PhotoService) storeOriginal(ctx context.Context, key string, fileHeader *multipart.FileHeader) (*storedOriginal, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Sniff the content type from the first bytes rather than trusting the client
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	stored := &storedOriginal{mimeType: http.DetectContentType(head[:n])}
+	if !photoTypes[stored.mimeType] {
+		return nil, ErrPhotoTypeNotAllowed
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	hasher := sha256.New()
+	if stored.size, err = s.storage.Put(ctx, key, io.TeeReader(file, hasher)); err != nil {
+		return nil, err
+	}
+	stored.hash = hex.EncodeToString(hasher.Sum(nil))
+
+	if _, err := file.Seek(0, io.SeekStart); err == nil {
+		if cfg, _, err := image.DecodeConfig(file); err == nil {
+			stored.width, stored.height = &cfg.Width, &cfg.Height
+		}
+	}
+
+	return stored, nil
+}
+
+func (s *PhotoService) insertPhoto(ctx context.Context, photo *models.Photo, tags []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO photos (
+			id, user_id, partner_id, filename, original_name, file_path, file_size,
+			mime_type, width, height, hash, description, moderation_status, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		photo.ID,
+		photo.UserID,
+		photo.PartnerID,
+		photo.Filename,
+		photo.OriginalName,
+		photo.FilePath,
+		photo.FileSize,
+		photo.MimeType,
+		photo.Width,
+		photo.Height,
+		photo.Hash,
+		photo.Description,
+		photo.ModerationStatus,
+		photo.CreatedAt,
+		photo.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	if len(tags) > 0 {
+		if err := setPhotoTags(ctx, tx, photo.UserID, photo.ID, tags, TagSourceUser); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPhoto retrieves a photo by ID. Photos in the trash are not found.
+func (s *PhotoService) GetPhoto(ctx context.Context, photoID string) (_ *models.Photo, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.GetPhoto")
+	defer func() { tracing.End(span, err) }()
+
+	row := s.db.QueryRowContext(ctx, `SELECT `+photoColumns+` FROM photos WHERE id = ? AND deleted_at IS NULL`, photoID)
+	photo, err := scanPhoto(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPhotoNotFound
+		}
+		return nil, err
+	}
+	return photo, nil
+}
+
+// OpenOriginal opens the stored original of a photo for reading. The caller
+// must close the returned object.
+func (s *PhotoService) OpenOriginal(ctx context.Context, photo *models.Photo) (_ storage.Object, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.OpenOriginal")
+	defer func() { tracing.End(span, err) }()
+
+	return s.storage.Open(ctx, photo.FilePath)
 }
 
-// DeletePhoto removes a photo
-func (s *PhotoService) DeletePhoto(ctx *fasthttp.RequestCtx, photoID string) error {
-	// TODO: Implement actual delete logic
+// UpdatePhoto updates a photo's metadata. Tags may be given as a
+// comma-separated string or a list and replace the photo's current tags.
+func (s *PhotoService) UpdatePhoto(ctx context.Context, photoID string, updates map[string]interface{}) (_ *models.Photo, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.UpdatePhoto")
+	defer func() { tracing.End(span, err) }()
+
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		if !updatablePhotoFields[field] {
+			return nil, ErrInvalidPhotoUpdate.WithField(field, "cannot be updated")
+		}
+		if field != "tags" {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	if value, ok := updates["tags"]; ok {
+		tags, err := tagsFromValue(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.setTags(ctx, photoID, tags); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(fields) > 0 {
+		sets := make([]string, 0, len(fields)+1)
+		args := make([]interface{}, 0, len(fields)+1)
+		for _, field := range fields {
+			sets = append(sets, field+" = ?")
+			args = append(args, updates[field])
+		}
+		sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
+		args = append(args, photoID)
+
+		result, err := s.db.ExecContext(ctx, `UPDATE photos SET `+strings.Join(sets, ", ")+` WHERE id = ?`, args...)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return nil, ErrPhotoNotFound
+		}
+	}
+
+	return s.GetPhoto(ctx, photoID)
+}
+
+// setTags replaces a photo's user-visible tags
+func (s *PhotoService) setTags(ctx context.Context, photoID string, tags []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ownerID string
+	if err := tx.QueryRowContext(ctx, `SELECT user_id FROM photos WHERE id = ?`, photoID).Scan(&ownerID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPhotoNotFound
+		}
+		return err
+	}
+
+	if err := setPhotoTags(ctx, tx, ownerID, photoID, tags, TagSourceUser); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// tagsFromValue parses tags from a decoded JSON value: either a
+// comma-separated string or a list of strings
+func tagsFromValue(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return utils.ParseTags(v)
+	case []string:
+		return utils.ValidateTags(v)
+	case []interface{}:
+		names := make([]string, 0, len(v))
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, ErrInvalidPhotoUpdate.WithField("tags", "must be strings")
+			}
+			names = append(names, name)
+		}
+		return utils.ValidateTags(names)
+	default:
+		return nil, ErrInvalidPhotoUpdate.WithField("tags", "must be a string or a list of strings")
+	}
+}
+
+// DeletePhoto moves a photo to the trash. It disappears from listings,
+// albums, search and shares until it is restored, and is purged for good once
+// the trash retention period has passed (see TrashService).
+func (s *PhotoService) DeletePhoto(ctx context.Context, photoID string) (err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.DeletePhoto")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE photos SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL
+	`, time.Now().UTC(), photoID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrPhotoNotFound
+	}
 	return nil
 }
 
-// GetThumbnail retrieves a photo's thumbnail
-func (s *PhotoService) GetThumbnail(ctx *fasthttp.RequestCtx, photoID, size string) ([]byte, string, error) {
-	// TODO: Implement thumbnail generation/retrieval
-	return []byte{}, "image/jpeg", nil
+// UpdateDescription sets a photo's description and, optionally, its tags in
+// the given language. The default language is stored on the photo itself.
+func (s *PhotoService) UpdateDescription(ctx context.Context, photoID, language string, description, tags *string, source string) (_ *models.Photo, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.UpdateDescription")
+	defer func() { tracing.End(span, err) }()
+
+	lang := s.defaultLanguage
+	if language != "" {
+		if lang = utils.NormalizeLanguageTag(language); lang == "" {
+			return nil, fmt.Errorf("%w: %q", utils.ErrInvalidLanguage, language)
+		}
+	}
+
+	if lang == s.defaultLanguage {
+		updates := make(map[string]interface{})
+		if description != nil {
+			updates["description"] = *description
+		}
+		if tags != nil {
+			updates["tags"] = *tags
+		}
+		photo, err := s.UpdatePhoto(ctx, photoID, updates)
+		if err != nil {
+			return nil, err
+		}
+		return photo, s.LocalizePhotos(ctx, []*models.Photo{photo}, []string{lang})
+	}
+
+	if _, err := s.GetPhoto(ctx, photoID); err != nil {
+		return nil, err
+	}
+	if err := s.SaveTranslation(ctx, &models.PhotoTranslation{
+		PhotoID:     photoID,
+		Language:    lang,
+		Description: description,
+		Tags:        tags,
+		Source:      source,
+	}); err != nil {
+		return nil, err
+	}
+
+	photo, err := s.GetPhoto(ctx, photoID)
+	if err != nil {
+		return nil, err
+	}
+	return photo, s.LocalizePhotos(ctx, []*models.Photo{photo}, []string{lang})
 }
 
-// GenerateDescription generates an AI description for a photo
-func (s *PhotoService) GenerateDescription(ctx *fasthttp.RequestCtx, photoID string) (string, error) {
-	// TODO: Implement AI description generation
-	return "Generated description for photo " + photoID, nil
+// SaveTranslation creates or updates a photo translation. Nil fields keep
+// their current value.
+func (s *PhotoService) SaveTranslation(ctx context.Context, t *models.PhotoTranslation) (err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.SaveTranslation")
+	defer func() { tracing.End(span, err) }()
+
+	if t.Language = utils.NormalizeLanguageTag(t.Language); t.Language == "" {
+		return utils.ErrInvalidLanguage.WithField("language", "is required")
+	}
+	if t.Source == "" {
+		t.Source = "user"
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO photo_translations (photo_id, language, description, ai_description, tags, source)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (photo_id, language) DO UPDATE SET
+			description = COALESCE(excluded.description, photo_translations.description),
+			ai_description = COALESCE(excluded.ai_description, photo_translations.ai_description),
+			tags = COALESCE(excluded.tags, photo_translations.tags),
+			source = excluded.source,
+			updated_at = CURRENT_TIMESTAMP
+	`, t.PhotoID, t.Language, t.Description, t.AIDescription, t.Tags, t.Source)
+	return err
+}
+
+// ListTranslations returns all translations of a photo
+func (s *PhotoService) ListTranslations(ctx context.Context, photoID string) (_ []*models.PhotoTranslation, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.ListTranslations")
+	defer func() { tracing.End(span, err) }()
+
+	return s.loadTranslations(ctx, []string{photoID})
+}
+
+// DeleteTranslation removes a photo's translation in one language
+func (s *PhotoService) DeleteTranslation(ctx context.Context, photoID, language string) (err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.DeleteTranslation")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM photo_translations WHERE photo_id = ? AND language = ?
+	`, photoID, utils.NormalizeLanguageTag(language))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTranslationNotFound
+	}
+	return nil
+}
+
+// LocalizePhotos replaces each photo's description and tags with the
+// translation that best matches the preferred languages. Fields missing from
+// the chosen translation fall back to the default language.
+func (s *PhotoService) LocalizePhotos(ctx context.Context, photos []*models.Photo, preferences []string) (err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.LocalizePhotos")
+	defer func() { tracing.End(span, err) }()
+
+	if len(photos) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(photos))
+	for i, photo := range photos {
+		ids[i] = photo.ID
+	}
+	translations, err := s.loadTranslations(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byPhoto := make(map[string]map[string]*models.PhotoTranslation)
+	for _, t := range translations {
+		if byPhoto[t.PhotoID] == nil {
+			byPhoto[t.PhotoID] = make(map[string]*models.PhotoTranslation)
+		}
+		byPhoto[t.PhotoID][t.Language] = t
+	}
+
+	for _, photo := range photos {
+		available := []string{s.defaultLanguage}
+		for lang := range byPhoto[photo.ID] {
+			if lang != s.defaultLanguage {
+				available = append(available, lang)
+			}
+		}
+		sort.Strings(available[1:])
+
+		photo.Languages = available
+		photo.Language = utils.MatchLanguage(preferences, available, s.defaultLanguage)
+
+		t, ok := byPhoto[photo.ID][photo.Language]
+		if !ok || photo.Language == s.defaultLanguage {
+			continue
+		}
+		if t.Description != nil {
+			photo.Description = t.Description
+		}
+		if t.AIDescription != nil {
+			photo.AIDescription = t.AIDescription
+		}
+		if t.Tags != nil {
+			photo.Tags = t.Tags
+		}
+	}
+
+	return nil
+}
+
+func (s *PhotoService) loadTranslations(ctx context.Context, photoIDs []string) ([]*models.PhotoTranslation, error) {
+	placeholders := placeholders(len(photoIDs))
+	args := make([]interface{}, len(photoIDs))
+	for i, id := range photoIDs {
+		args[i] = id
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT photo_id, language, description, ai_description, tags, source, created_at, updated_at
+		FROM photo_translations
+		WHERE photo_id IN (`+placeholders+`)
+		ORDER BY photo_id, language
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []*models.PhotoTranslation{}
+	for rows.Next() {
+		var t models.PhotoTranslation
+		if err := rows.Scan(
+			&t.PhotoID,
+			&t.Language,
+			&t.Description,
+			&t.AIDescription,
+			&t.Tags,
+			&t.Source,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		translations = append(translations, &t)
+	}
+
+	return translations, rows.Err()
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPhoto(row rowScanner) (*models.Photo, error) {
+	var p models.Photo
+	err := row.Scan(
+		&p.ID,
+		&p.UserID,
+		&p.PartnerID,
+		&p.Filename,
+		&p.OriginalName,
+		&p.FilePath,
+		&p.ThumbnailPath,
+		&p.FileSize,
+		&p.MimeType,
+		&p.Width,
+		&p.Height,
+		&p.Hash,
+		&p.Description,
+		&p.AIDescription,
+		&p.Tags,
+		&p.AIConfidence,
+		&p.IsNSFW,
+		&p.NSFWConfidence,
+		&p.ModerationStatus,
+		&p.ExifData,
+		&p.Location,
+		&p.CameraMake,
+		&p.CameraModel,
+		&p.TakenAt,
+		&p.IsShared,
+		&p.ShareCount,
+		&p.ViewCount,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.ProcessedAt,
+		&p.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
 }
 
 // GetSharedWith gets the list of users a photo is shared with
-func (s *PhotoService) GetSharedWith(ctx *fasthttp.RequestCtx, photoID string) ([]string, error) {
+func (s *PhotoService) GetSharedWith(ctx context.Context, photoID string) ([]string, error) {
 	// TODO: Implement sharing logic
 	return []string{}, nil
 }
 
-// GetPartnerPhotos retrieves photos for a partner with pagination
-func (s *PhotoService) GetPartnerPhotos(partnerID string, page, limit int, sortBy, sortOrder, search string) ([]*models.Photo, int, error) {
-	// TODO: Implement partner photos retrieval
-	return []*models.Photo{}, 0, nil
-}
-
 // GenerateAIDescription generates AI description for a photo
 func (s *PhotoService) GenerateAIDescription(photoID string) (string, error) {
 	// TODO: Implement AI description generation
 	return "AI generated description for " + photoID, nil
 }
 
+// RecordDownload counts a download of the photo's original
+func (s *PhotoService) RecordDownload(ctx context.Context, photoID string) (err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.RecordDownload")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO photo_analytics (photo_id, downloads) VALUES (?, 1)
+		ON CONFLICT (photo_id) DO UPDATE SET downloads = COALESCE(downloads, 0) + 1
+	`, photoID)
+	return err
+}
+
 // GetPhotoAnalytics retrieves analytics for a photo
 func (s *PhotoService) GetPhotoAnalytics(photoID string) (*models.PhotoAnalytics, error) {
 	// TODO: Implement photo analytics
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"testing"
+
+	"github.com/wronai/media-vault-backend/internal/database"
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+// newTestPhotoService creates a PhotoService storing its blobs below root
+func newTestPhotoService(t *testing.T, root string) *PhotoService {
+	t.Helper()
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := storage.NewLocalStorage(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPhotoService(db, store, "en")
+}
+
+// testPNG encodes a small PNG image
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// uploadTestPhoto uploads a small PNG for userID and returns its ID
+func uploadTestPhoto(t *testing.T, s *PhotoService, userID string) string {
+	t.Helper()
+	photo, err := s.UploadPhoto(context.Background(), userID, testFileHeader(t, "photo.png", "image/png", testPNG(t)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return photo.ID
+}
+
+func TestUploadPhotoSniffsImageTypes(t *testing.T) {
+	s := newTestPhotoService(t, t.TempDir())
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	var jpg, gifData bytes.Buffer
+	if err := jpeg.Encode(&jpg, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.Encode(&gifData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The smallest lossless WebP, a 1x1 image
+	webp := []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"photo.jpg", jpg.Bytes(), "image/jpeg"},
+		{"photo.png", testPNG(t), "image/png"},
+		{"photo.gif", gifData.Bytes(), "image/gif"},
+		{"photo.webp", webp, "image/webp"},
+		// The content decides, not the name
+		{"photo.jpg", testPNG(t), "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			photo, err := s.UploadPhoto(context.Background(), "u1", testFileHeader(t, tt.name, "image/jpeg", tt.data), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if photo.MimeType != tt.want {
+				t.Errorf("MIME type = %q, want %q", photo.MimeType, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadPhotoRejectsNonImages(t *testing.T) {
+	root := t.TempDir()
+	s := newTestPhotoService(t, root)
+
+	for name, data := range map[string]string{
+		"html":  "<html><script>alert(document.cookie)</script></html>",
+		"svg":   `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`,
+		"text":  "just some notes",
+		"pdf":   "%PDF-1.7\n",
+		"empty": "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.UploadPhoto(context.Background(), "u1", testFileHeader(t, "evil.png", "image/png", []byte(data)), nil)
+			if !errors.Is(err, ErrPhotoTypeNotAllowed) {
+				t.Fatalf("error = %v, want ErrPhotoTypeNotAllowed", err)
+			}
+		})
+	}
+
+	var photos int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM photos`).Scan(&photos); err != nil {
+		t.Fatal(err)
+	}
+	blobs, _ := filepath.Glob(filepath.Join(root, "originals", "*", "*"))
+	if photos != 0 || len(blobs) != 0 {
+		t.Errorf("rejected uploads left %d photos and blobs %q", photos, blobs)
+	}
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"mime/multipart"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/metrics"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/storage"
+	"github.com/wronai/media-vault-backend/internal/tracing"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+// ErrVersionNotFound is returned when a photo has no version with the given
+// number
+var ErrVersionNotFound = apperr.NotFound("version_not_found", "photo version not found")
+
+const photoVersionColumns = `photo_id, version, storage_key, original_name, file_size, mime_type,
+	width, height, hash, restored_from, created_by, created_at`
+
+// ReplaceOriginal uploads a new version of a photo's original. Earlier
+// versions are kept and can be restored; the photo's renditions are
+// regenerated from the new original.
+func (s *PhotoService) ReplaceOriginal(ctx context.Context, photo *models.Photo, userID string, fileHeader *multipart.FileHeader) (_ *models.Photo, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.ReplaceOriginal")
+	defer func() { tracing.End(span, err) }()
+	defer func() { metrics.ObserveUpload(metrics.UploadVersion, fileHeader.Size, err) }()
+
+	// Versions get keys of their own so that every version stays readable
+	key := path.Join("originals", photo.UserID, photo.ID+"_"+uuid.New().String()+strings.ToLower(filepath.Ext(fileHeader.Filename)))
+	stored, err := s.storeOriginal(ctx, key, fileHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	version := &models.PhotoVersion{
+		PhotoID:      photo.ID,
+		StorageKey:   key,
+		OriginalName: filepath.Base(fileHeader.Filename),
+		FileSize:     stored.size,
+		MimeType:     stored.mimeType,
+		Width:        stored.width,
+		Height:       stored.height,
+		Hash:         stored.hash,
+		CreatedBy:    userID,
+	}
+	if err := s.addVersion(ctx, photo, version); err != nil {
+		// Don't leave an orphaned blob behind
+		discardBlob(ctx, s.storage, key)
+		return nil, err
+	}
+
+	s.refreshRenditions(ctx, photo)
+	return s.GetPhoto(ctx, photo.ID)
+}
+
+// RestoreVersion makes an earlier version the photo's current original by
+// adding it again as the newest version, so the history is never rewritten
+func (s *PhotoService) RestoreVersion(ctx context.Context, photo *models.Photo, number int, userID string) (_ *models.Photo, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.RestoreVersion")
+	defer func() { tracing.End(span, err) }()
+
+	old, err := s.GetVersion(ctx, photo, number)
+	if err != nil {
+		return nil, err
+	}
+	if old.Current {
+		return photo, nil
+	}
+
+	restored := *old
+	restored.RestoredFrom = &old.Version
+	restored.CreatedBy = userID
+	if err := s.addVersion(ctx, photo, &restored); err != nil {
+		return nil, err
+	}
+
+	s.refreshRenditions(ctx, photo)
+	return s.GetPhoto(ctx, photo.ID)
+}
+
+// ListVersions returns a photo's versions, newest first
+func (s *PhotoService) ListVersions(ctx context.Context, photo *models.Photo) (_ []*models.PhotoVersion, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.ListVersions")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.ensureVersions(ctx, s.db, photo.ID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+photoVersionColumns+`
+		FROM photo_versions
+		WHERE photo_id = ?
+		ORDER BY version DESC
+	`, photo.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []*models.PhotoVersion{}
+	for rows.Next() {
+		version, err := scanPhotoVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		version.Current = len(versions) == 0
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetVersion returns one version of a photo
+func (s *PhotoService) GetVersion(ctx context.Context, photo *models.Photo, number int) (_ *models.PhotoVersion, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.GetVersion")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.ensureVersions(ctx, s.db, photo.ID); err != nil {
+		return nil, err
+	}
+
+	var current bool
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+photoVersionColumns+`, version = (SELECT MAX(version) FROM photo_versions WHERE photo_id = ?)
+		FROM photo_versions
+		WHERE photo_id = ? AND version = ?
+	`, photo.ID, photo.ID, number)
+	version, err := scanPhotoVersion(scannerWithExtra{row, []interface{}{&current}})
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: version %d", ErrVersionNotFound, number)
+	}
+	if err != nil {
+		return nil, err
+	}
+	version.Current = current
+	return version, nil
+}
+
+// OpenVersion opens the stored original of a photo version for reading. The
+// caller must close the returned object.
+func (s *PhotoService) OpenVersion(ctx context.Context, version *models.PhotoVersion) (_ storage.Object, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.OpenVersion")
+	defer func() { tracing.End(span, err) }()
+
+	return s.storage.Open(ctx, version.StorageKey)
+}
+
+// addVersion records version as the photo's newest version and makes it the
+// photo's current original
+func (s *PhotoService) addVersion(ctx context.Context, photo *models.Photo, version *models.PhotoVersion) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.ensureVersions(ctx, tx, photo.ID); err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version), 0) + 1 FROM photo_versions WHERE photo_id = ?
+	`, photo.ID).Scan(&version.Version); err != nil {
+		return err
+	}
+	version.CreatedAt = time.Now().UTC()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO photo_versions (`+photoVersionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		version.PhotoID,
+		version.Version,
+		version.StorageKey,
+		version.OriginalName,
+		version.FileSize,
+		version.MimeType,
+		version.Width,
+		version.Height,
+		version.Hash,
+		version.RestoredFrom,
+		version.CreatedBy,
+		version.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE photos SET
+			file_path = ?, file_size = ?, mime_type = ?, width = ?, height = ?, hash = ?,
+			thumbnail_path = NULL, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`, version.StorageKey, version.FileSize, version.MimeType, version.Width, version.Height, version.Hash,
+		version.CreatedAt, photo.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrPhotoNotFound
+	}
+
+	return tx.Commit()
+}
+
+// execQuerier is satisfied by both *sql.DB and *sql.Tx
+type execQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// ensureVersions records the photo's current original as version 1 if the
+// photo has no versions yet, as for photos uploaded before versioning
+func (s *PhotoService) ensureVersions(ctx context.Context, db execQuerier, photoID string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO photo_versions (`+photoVersionColumns+`)
+		SELECT id, 1, file_path, original_name, file_size, mime_type, width, height, hash, NULL, user_id, created_at
+		FROM photos
+		WHERE id = ? AND NOT EXISTS (SELECT 1 FROM photo_versions WHERE photo_id = ?)
+	`, photoID, photoID)
+	return err
+}
+
+// refreshRenditions replaces the photo's stored renditions after its original
+// changed. Renditions that had been generated are generated again from the
+// new original; failures are logged, as GetThumbnail retries on demand.
+func (s *PhotoService) refreshRenditions(ctx context.Context, photo *models.Photo) {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM photo_renditions WHERE photo_id = ?`, photo.ID); err != nil {
+		logging.FromContext(ctx).Error("Failed to reset renditions", "photo_id", photo.ID, logging.Err(err))
+		return
+	}
+
+	for size := range utils.ThumbnailSizes {
+		key := thumbnailKey(photo, size)
+		if _, err := s.storage.Stat(ctx, key); err != nil {
+			continue
+		}
+		if err := s.storage.Delete(ctx, key); err != nil {
+			logging.FromContext(ctx).Error("Failed to delete rendition", "photo_id", photo.ID, "size", size, logging.Err(err))
+			continue
+		}
+		if _, _, err := s.GetThumbnail(ctx, photo.ID, size); err != nil {
+			logging.FromContext(ctx).Warn("Failed to regenerate rendition", "photo_id", photo.ID, "size", size, logging.Err(err))
+		}
+	}
+}
+
+func scanPhotoVersion(row rowScanner) (*models.PhotoVersion, error) {
+	var v models.PhotoVersion
+	err := row.Scan(
+		&v.PhotoID,
+		&v.Version,
+		&v.StorageKey,
+		&v.OriginalName,
+		&v.FileSize,
+		&v.MimeType,
+		&v.Width,
+		&v.Height,
+		&v.Hash,
+		&v.RestoredFrom,
+		&v.CreatedBy,
+		&v.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
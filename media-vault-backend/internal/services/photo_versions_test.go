@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceOriginalRejectsNonImages(t *testing.T) {
+	root := t.TempDir()
+	s := newTestPhotoService(t, root)
+	ctx := context.Background()
+	photo, err := s.GetPhoto(ctx, uploadTestPhoto(t, s, "u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A partner's file named like a photo, which share links would serve
+	html := testFileHeader(t, "photo.png", "image/png", []byte("<html><script>alert(document.cookie)</script></html>"))
+	if _, err := s.ReplaceOriginal(ctx, photo, "partner", html); !errors.Is(err, ErrPhotoTypeNotAllowed) {
+		t.Fatalf("error = %v, want ErrPhotoTypeNotAllowed", err)
+	}
+
+	after, err := s.GetPhoto(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.MimeType != "image/png" || after.Hash != photo.Hash || after.FilePath != photo.FilePath {
+		t.Errorf("original changed to %s %s (%s)", after.FilePath, after.Hash, after.MimeType)
+	}
+	versions, err := s.ListVersions(ctx, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) > 1 {
+		t.Errorf("got %d versions, want the original only", len(versions))
+	}
+	if blobs, _ := filepath.Glob(filepath.Join(root, "originals", "u1", "*")); len(blobs) != 1 {
+		t.Errorf("blobs = %q, want the original only", blobs)
+	}
+
+	// Images still replace the original
+	replaced, err := s.ReplaceOriginal(ctx, after, "partner", testFileHeader(t, "new.png", "image/png", testPNG(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced.MimeType != "image/png" {
+		t.Errorf("MIME type = %q, want image/png", replaced.MimeType)
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/metrics"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/storage"
+	"github.com/wronai/media-vault-backend/internal/tracing"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+// RenditionOriginal names the uploaded file; the other renditions are the
+// thumbnail sizes in utils.ThumbnailSizes
+const RenditionOriginal = "original"
+
+var (
+	// ErrInvalidRendition is returned for unknown rendition names
+	ErrInvalidRendition = apperr.Invalid("invalid_rendition", "invalid rendition")
+	// ErrRenditionUnavailable is returned when a thumbnail cannot be generated
+	// from the original, e.g. for formats that cannot be decoded
+	ErrRenditionUnavailable = apperr.Unsupported("rendition_unavailable", "rendition is not available for this photo")
+)
+
+// MaxRenderPixels bounds the size of the originals thumbnails are rendered
+// from. Decoding allocates memory for every pixel, and the dimensions come
+// from the uploaded file, whose header may claim far more than it holds.
+const MaxRenderPixels = 64 << 20
+
+// Renderable reports whether thumbnails can be rendered from an image of the
+// given dimensions without exceeding MaxRenderPixels
+func Renderable(width, height int) bool {
+	return width > 0 && height > 0 && int64(width)*int64(height) <= MaxRenderPixels
+}
+
+// ValidRendition reports whether name is a known rendition
+func ValidRendition(name string) bool {
+	if name == RenditionOriginal {
+		return true
+	}
+	_, ok := utils.ThumbnailSizes[name]
+	return ok
+}
+
+// GetThumbnail returns a JPEG thumbnail of the photo in the given size. The
+// thumbnail is generated on first use and kept in storage.
+func (s *PhotoService) GetThumbnail(ctx context.Context, photoID, size string) (_ []byte, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.GetThumbnail")
+	defer func() { tracing.End(span, err) }()
+
+	bound, ok := utils.ThumbnailSizes[size]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %q", ErrInvalidRendition, size)
+	}
+
+	photo, err := s.GetPhoto(ctx, photoID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	start := time.Now()
+	key := thumbnailKey(photo, size)
+	if obj, err := s.storage.Open(ctx, key); err == nil {
+		defer obj.Close()
+		data, err := io.ReadAll(obj)
+		metrics.ObserveThumbnail(size, true, start)
+		return data, "image/jpeg", err
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, "", err
+	}
+
+	original, err := s.OpenOriginal(ctx, photo)
+	if err != nil {
+		return nil, "", err
+	}
+	renderStart := time.Now()
+	img, err := decodeForRendering(original)
+	original.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := utils.GenerateThumbnail(img, utils.ThumbnailOptions{Width: bound, Height: bound})
+	if err != nil {
+		return nil, "", err
+	}
+	metrics.ObserveRender(size, renderStart)
+
+	stored, err := s.storage.Put(ctx, key, bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	// Renditions count towards the owner's storage usage
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO photo_renditions (photo_id, rendition, storage_key, size, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, photo.ID, size, key, stored, time.Now().UTC()); err != nil {
+		return nil, "", err
+	}
+	if size == "medium" {
+		if _, err := s.db.ExecContext(ctx, `UPDATE photos SET thumbnail_path = ? WHERE id = ?`, key, photo.ID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	metrics.ObserveThumbnail(size, false, start)
+	return data, "image/jpeg", nil
+}
+
+// decodeForRendering decodes an original to render thumbnails from. Images
+// over MaxRenderPixels are refused before their pixels are allocated.
+func decodeForRendering(r io.ReadSeeker) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRenditionUnavailable, err)
+	}
+	if !Renderable(cfg.Width, cfg.Height) {
+		return nil, fmt.Errorf("%w: %dx%d pixels is too large to render", ErrRenditionUnavailable, cfg.Width, cfg.Height)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRenditionUnavailable, err)
+	}
+	return img, nil
+}
+
+// thumbnailKey is the storage key of a photo's thumbnail
+func thumbnailKey(photo *models.Photo, size string) string {
+	return path.Join("thumbnails", photo.UserID, photo.ID+"_"+size+".jpg")
+}
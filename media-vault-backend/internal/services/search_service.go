@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/database"
+	"github.com/wronai/media-vault-backend/internal/models"
+)
+
+var (
+	// ErrSearchUnavailable is returned when SQLite was built without FTS5
+	ErrSearchUnavailable = apperr.Unavailable("search_unavailable", "full-text search is not available")
+	// ErrInvalidQuery is returned for search queries that cannot be parsed
+	ErrInvalidQuery = apperr.Invalid("invalid_search_query", "invalid search query")
+)
+
+// searchFields maps the field names accepted in queries ("camera:canon") to
+// photos_fts columns
+var searchFields = map[string]string{
+	"name":        "original_name",
+	"filename":    "original_name",
+	"description": "description",
+	"ai":          "ai_description",
+	"tag":         "tags",
+	"tags":        "tags",
+	"camera":      "camera",
+	"location":    "location",
+}
+
+// Highlight markers used inside SQLite; they are replaced by <mark> tags after
+// the snippet has been HTML-escaped
+const (
+	highlightStart = "\x02"
+	highlightEnd   = "\x03"
+)
+
+// SearchResult is a photo matching a search query
+type SearchResult struct {
+	Photo   *models.Photo `json:"photo"`
+	Snippet string        `json:"snippet"`
+	Rank    float64       `json:"rank"`
+}
+
+// SearchService provides full-text search over photos
+type SearchService struct {
+	db      *sql.DB
+	enabled bool
+}
+
+// NewSearchService creates a new SearchService
+func NewSearchService(db *sql.DB) *SearchService {
+	return &SearchService{
+		db:      db,
+		enabled: database.SearchEnabled(db),
+	}
+}
+
+// SearchPhotos searches the user's photos. The query supports bare words,
+// "quoted phrases", prefix* matches, field:value scoping (name, description,
+// ai, tags, camera, location), -exclusions and OR. Results are ordered by
+// relevance and carry an HTML snippet with matches wrapped in <mark>.
+func (s *SearchService) SearchPhotos(ctx context.Context, userID, query string, page, limit int) ([]*SearchResult, int, error) {
+	if !s.enabled {
+		return nil, 0, ErrSearchUnavailable
+	}
+
+	match, err := buildMatchQuery(query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM photos_fts f
+		JOIN photos p ON p.rowid = f.rowid
+		WHERE photos_fts MATCH ? AND p.user_id = ? AND p.deleted_at IS NULL
+	`, match, userID).Scan(&total); err != nil {
+		return nil, 0, searchError(err)
+	}
+
+	// bm25 weights follow the column order: original_name, description,
+	// ai_description, tags, camera, location
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+prefixColumns("p", photoColumns)+`,
+			snippet(photos_fts, -1, ?, ?, '…', 16),
+			bm25(photos_fts, 2.0, 3.0, 1.5, 4.0, 1.0, 2.0) AS score
+		FROM photos_fts f
+		JOIN photos p ON p.rowid = f.rowid
+		WHERE photos_fts MATCH ? AND p.user_id = ? AND p.deleted_at IS NULL
+		ORDER BY score, p.created_at DESC
+		LIMIT ? OFFSET ?
+	`, highlightStart, highlightEnd, match, userID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, searchError(err)
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	for rows.Next() {
+		var snippet string
+		var score float64
+		photo, err := scanPhoto(scannerWithExtra{rows, []interface{}{&snippet, &score}})
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, &SearchResult{
+			Photo:   photo,
+			Snippet: highlightSnippet(snippet),
+			Rank:    -score,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, searchError(err)
+	}
+
+	return results, total, nil
+}
+
+// buildMatchQuery translates the user-facing query syntax into an FTS5 MATCH
+// expression. Every term is quoted so FTS5 operators in user input are inert.
+// Adjacent terms are ANDed, OR joins its neighbours, and exclusions apply to
+// the whole query.
+func buildMatchQuery(query string) (string, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return "", err
+	}
+
+	var groups [][]string // ANDed groups of ORed terms
+	var excluded []string
+	pendingOr := false
+	for _, tok := range tokens {
+		if tok.or {
+			if len(groups) == 0 || pendingOr {
+				return "", fmt.Errorf("%w: OR must be between two terms", ErrInvalidQuery)
+			}
+			pendingOr = true
+			continue
+		}
+
+		term := `"` + strings.ReplaceAll(tok.text, `"`, `""`) + `"`
+		if tok.prefix {
+			term += "*"
+		}
+		if tok.field != "" {
+			column, ok := searchFields[strings.ToLower(tok.field)]
+			if !ok {
+				return "", fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, tok.field)
+			}
+			term = column + " : " + term
+		}
+
+		switch {
+		case tok.negate:
+			if pendingOr {
+				return "", fmt.Errorf("%w: cannot OR an exclusion", ErrInvalidQuery)
+			}
+			excluded = append(excluded, term)
+		case pendingOr:
+			groups[len(groups)-1] = append(groups[len(groups)-1], term)
+		default:
+			groups = append(groups, []string{term})
+		}
+		pendingOr = false
+	}
+
+	if pendingOr {
+		return "", fmt.Errorf("%w: OR must be between two terms", ErrInvalidQuery)
+	}
+	if len(groups) == 0 {
+		return "", fmt.Errorf("%w: at least one search term is required", ErrInvalidQuery)
+	}
+
+	clauses := make([]string, len(groups))
+	for i, group := range groups {
+		clauses[i] = "(" + strings.Join(group, " OR ") + ")"
+	}
+
+	match := "(" + strings.Join(clauses, " AND ") + ")"
+	for _, term := range excluded {
+		match += " NOT " + term
+	}
+	return match, nil
+}
+
+type queryToken struct {
+	text   string
+	field  string
+	prefix bool
+	negate bool
+	or     bool
+}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		var tok queryToken
+		if runes[i] == '-' {
+			tok.negate = true
+			i++
+		}
+
+		// Optional field prefix, e.g. camera:
+		start := i
+		for i < len(runes) && (unicode.IsLetter(runes[i]) || runes[i] == '_') {
+			i++
+		}
+		if i < len(runes) && runes[i] == ':' && i > start {
+			tok.field = string(runes[start:i])
+			i++
+		} else {
+			i = start
+		}
+
+		if i < len(runes) && runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated quote", ErrInvalidQuery)
+			}
+			tok.text = strings.TrimSpace(string(runes[i+1 : end]))
+			i = end + 1
+			if i < len(runes) && runes[i] == '*' {
+				tok.prefix = true
+				i++
+			}
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			tok.text = string(runes[i:end])
+			i = end
+		}
+
+		if strings.HasSuffix(tok.text, "*") {
+			tok.prefix = true
+			tok.text = strings.TrimRight(tok.text, "*")
+		}
+
+		if tok.text == "OR" && tok.field == "" && !tok.negate && !tok.prefix {
+			tokens = append(tokens, queryToken{or: true})
+			continue
+		}
+		if strings.TrimFunc(tok.text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) == "" {
+			// Nothing searchable, e.g. a lone "*" or punctuation
+			continue
+		}
+
+		tokens = append(tokens, tok)
+	}
+
+	return tokens, nil
+}
+
+// highlightSnippet HTML-escapes a snippet and turns the highlight markers into
+// <mark> tags
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightEnd, "</mark>").Replace(html.EscapeString(snippet))
+}
+
+func searchError(err error) error {
+	if strings.Contains(err.Error(), "fts5: syntax error") {
+		return fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	return err
+}
+
+// prefixColumns qualifies a comma-separated column list with a table alias
+func prefixColumns(alias, columns string) string {
+	fields := strings.Split(columns, ",")
+	for i, field := range fields {
+		fields[i] = alias + "." + strings.TrimSpace(field)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// scannerWithExtra scans a photo row followed by additional columns
+type scannerWithExtra struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (s scannerWithExtra) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/wronai/media-vault-backend/internal/tracing"
+)
+
+// Share link access kinds
+const (
+	AccessView     = "view"
+	AccessDownload = "download"
+)
+
+// MinShareLinkPasswordLength is the minimum length of a share link password
+const MinShareLinkPasswordLength = 4
+
+var (
+	// ErrShareLinkNotFound is returned for unknown share link tokens or IDs
+	ErrShareLinkNotFound = apperr.NotFound("share_link_not_found", "share link not found")
+	// ErrShareLinkGone is returned for revoked, expired or used-up links
+	ErrShareLinkGone = apperr.Gone("share_link_gone", "share link is no longer available")
+	// ErrPasswordRequired is returned when a link's password is missing or wrong
+	ErrPasswordRequired = apperr.Unauthorized("password_required", "a valid password is required")
+	// ErrDownloadNotAllowed is returned when a view-only link is used to download
+	ErrDownloadNotAllowed = apperr.Forbidden("download_not_allowed", "this link does not allow downloads")
+)
+
+// ShareLink is an anonymous link to a photo or album. The token is only
+// returned when the link is created; the database keeps its SHA-256 hash.
+type ShareLink struct {
+	ID             string     `json:"id"`
+	Token          string     `json:"token,omitempty"`
+	TokenPrefix    string     `json:"token_prefix"`
+	PhotoID        string     `json:"photo_id,omitempty"`
+	AlbumID        string     `json:"album_id,omitempty"`
+	CreatedBy      string     `json:"created_by"`
+	Permission     string     `json:"permission"` // "view" or "download"
+	HasPassword    bool       `json:"has_password"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	MaxViews       *int       `json:"max_views,omitempty"`
+	MaxDownloads   *int       `json:"max_downloads,omitempty"`
+	ViewCount      int        `json:"view_count"`
+	DownloadCount  int        `json:"download_count"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+const shareLinkColumns = `id, token_prefix, COALESCE(photo_id, ''), COALESCE(album_id, ''), created_by,
+	permission, password_hash, expires_at, max_views, max_downloads, view_count, download_count,
+	last_accessed_at, revoked_at, created_at`
+
+// CreateShareLink creates an anonymous link to a photo or album and fills in
+// link.Token. The caller is responsible for checking that link.CreatedBy may
+// share the target. An empty password leaves the link unprotected.
+func (s *SharingService) CreateShareLink(ctx context.Context, link *ShareLink, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.CreateShareLink")
+	defer func() { tracing.End(span, err) }()
+
+	if (link.PhotoID == "") == (link.AlbumID == "") {
+		return fmt.Errorf("%w: exactly one of photo_id and album_id is required", ErrInvalidShare)
+	}
+	if link.CreatedBy == "" {
+		return ErrInvalidShare.WithField("created_by", "is required")
+	}
+
+	share := Share{Permission: link.Permission, ExpiresAt: link.ExpiresAt}
+	if err := prepareShare(&share); err != nil {
+		return err
+	}
+	link.Permission, link.ExpiresAt = share.Permission, share.ExpiresAt
+
+	if (link.MaxViews != nil && *link.MaxViews < 1) || (link.MaxDownloads != nil && *link.MaxDownloads < 1) {
+		err := ErrInvalidShare
+		if link.MaxViews != nil && *link.MaxViews < 1 {
+			err = err.WithField("max_views", "must be at least 1")
+		}
+		if link.MaxDownloads != nil && *link.MaxDownloads < 1 {
+			err = err.WithField("max_downloads", "must be at least 1")
+		}
+		return err
+	}
+
+	var passwordHash interface{}
+	if password != "" {
+		if len(password) < MinShareLinkPasswordLength {
+			return ErrInvalidShare.WithField("password", fmt.Sprintf("must be at least %d characters", MinShareLinkPasswordLength))
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		passwordHash = string(hash)
+		link.HasPassword = true
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return err
+	}
+	link.ID = uuid.New().String()
+	link.Token = token
+	link.TokenPrefix = token[:8]
+	link.CreatedAt = share.CreatedAt
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO share_links (id, token_hash, token_prefix, photo_id, album_id, created_by, permission,
+			password_hash, expires_at, max_views, max_downloads, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		link.ID,
+		hashShareToken(token),
+		link.TokenPrefix,
+		nullIfEmpty(link.PhotoID),
+		nullIfEmpty(link.AlbumID),
+		link.CreatedBy,
+		link.Permission,
+		passwordHash,
+		link.ExpiresAt,
+		link.MaxViews,
+		link.MaxDownloads,
+		link.CreatedAt,
+	)
+
+	return err
+}
+
+// GetShareLink retrieves a share link by ID
+func (s *SharingService) GetShareLink(ctx context.Context, id string) (_ *ShareLink, err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.GetShareLink")
+	defer func() { tracing.End(span, err) }()
+
+	link, _, err := scanShareLink(s.db.QueryRowContext(ctx, `SELECT `+shareLinkColumns+` FROM share_links WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrShareLinkNotFound
+	}
+	return link, err
+}
+
+// ListShareLinks lists the links a user created, optionally only those for
+// one photo or album
+func (s *SharingService) ListShareLinks(ctx context.Context, createdBy, photoID, albumID string) (_ []*ShareLink, err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.ListShareLinks")
+	defer func() { tracing.End(span, err) }()
+
+	query := `SELECT ` + shareLinkColumns + ` FROM share_links WHERE created_by = ?`
+	args := []interface{}{createdBy}
+	if photoID != "" {
+		query += ` AND photo_id = ?`
+		args = append(args, photoID)
+	}
+	if albumID != "" {
+		query += ` AND album_id = ?`
+		args = append(args, albumID)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*ShareLink{}
+	for rows.Next() {
+		link, _, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// RevokeShareLink disables a link. Revoked links stay listed with their
+// counters.
+func (s *SharingService) RevokeShareLink(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.RevokeShareLink")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE share_links SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL
+	`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrShareLinkNotFound
+	}
+	return nil
+}
+
+// ResolveShareLink validates a token, password and access kind. The access
+// is neither counted nor checked against max_views and max_downloads: callers
+// do both with RecordShareLinkAccess before serving a new access, so that
+// resuming a download of a used-up link still works.
+func (s *SharingService) ResolveShareLink(ctx context.Context, token, password, access string) (_ *ShareLink, err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.ResolveShareLink")
+	defer func() { tracing.End(span, err) }()
+
+	if token == "" {
+		return nil, ErrShareLinkNotFound
+	}
+
+	link, passwordHash, err := scanShareLink(s.db.QueryRowContext(ctx, `
+		SELECT `+shareLinkColumns+` FROM share_links WHERE token_hash = ?
+	`, hashShareToken(token)))
+	if err == sql.ErrNoRows {
+		return nil, ErrShareLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if link.RevokedAt != nil || (link.ExpiresAt != nil && !link.ExpiresAt.After(now)) {
+		return nil, ErrShareLinkGone
+	}
+	if passwordHash.Valid {
+		if password == "" || bcrypt.CompareHashAndPassword([]byte(passwordHash.String), []byte(password)) != nil {
+			return nil, ErrPasswordRequired
+		}
+	}
+	if access == AccessDownload && link.Permission != PermissionDownload {
+		return nil, ErrDownloadNotAllowed
+	}
+
+	return link, nil
+}
+
+// RecordShareLinkAccess counts an access against the link's counters,
+// refusing it atomically once max_views or max_downloads is reached
+func (s *SharingService) RecordShareLinkAccess(ctx context.Context, link *ShareLink, access string) (err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.RecordShareLinkAccess")
+	defer func() { tracing.End(span, err) }()
+
+	counter, limit := "view_count", "max_views"
+	if access == AccessDownload {
+		counter, limit = "download_count", "max_downloads"
+	}
+	now := time.Now().UTC()
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE share_links
+		SET `+counter+` = `+counter+` + 1, last_accessed_at = ?
+		WHERE id = ? AND revoked_at IS NULL AND (`+limit+` IS NULL OR `+counter+` < `+limit+`)
+	`, now, link.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrShareLinkGone
+	}
+
+	if access == AccessDownload {
+		link.DownloadCount++
+	} else {
+		link.ViewCount++
+	}
+	link.LastAccessedAt = &now
+	return nil
+}
+
+func scanShareLink(row rowScanner) (*ShareLink, sql.NullString, error) {
+	var link ShareLink
+	var passwordHash sql.NullString
+	var expiresAt, lastAccessedAt, revokedAt sql.NullTime
+	var maxViews, maxDownloads sql.NullInt64
+	if err := row.Scan(
+		&link.ID,
+		&link.TokenPrefix,
+		&link.PhotoID,
+		&link.AlbumID,
+		&link.CreatedBy,
+		&link.Permission,
+		&passwordHash,
+		&expiresAt,
+		&maxViews,
+		&maxDownloads,
+		&link.ViewCount,
+		&link.DownloadCount,
+		&lastAccessedAt,
+		&revokedAt,
+		&link.CreatedAt,
+	); err != nil {
+		return nil, passwordHash, err
+	}
+
+	link.HasPassword = passwordHash.Valid
+	if expiresAt.Valid {
+		link.ExpiresAt = &expiresAt.Time
+	}
+	if lastAccessedAt.Valid {
+		link.LastAccessedAt = &lastAccessedAt.Time
+	}
+	if revokedAt.Valid {
+		link.RevokedAt = &revokedAt.Time
+	}
+	if maxViews.Valid {
+		n := int(maxViews.Int64)
+		link.MaxViews = &n
+	}
+	if maxDownloads.Valid {
+		n := int(maxDownloads.Int64)
+		link.MaxDownloads = &n
+	}
+
+	return &link, passwordHash, nil
+}
+
+// newShareToken returns 256 bits of randomness, base64url encoded
+func newShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
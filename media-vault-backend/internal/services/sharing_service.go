@@ -3,24 +3,48 @@ package services
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/tracing"
 )
 
-// Share represents a shared photo with permissions
+// Share permissions. A download share also grants view access.
+const (
+	PermissionView     = "view"
+	PermissionDownload = "download"
+)
+
+var (
+	// ErrShareNotFound is returned when a share does not exist
+	ErrShareNotFound = apperr.NotFound("share_not_found", "share not found")
+	// ErrInvalidPermission is returned for unknown share permissions
+	ErrInvalidPermission = apperr.Invalid("invalid_permission", "permission must be 'view' or 'download'")
+	// ErrPermissionDenied is returned when a user may not access something
+	// shared with others
+	ErrPermissionDenied = apperr.Forbidden("permission_denied", "you don't have permission to do this")
+	// ErrInvalidShare is returned when a share or share link is incomplete
+	// or invalid
+	ErrInvalidShare = apperr.Invalid("invalid_share", "invalid share")
+)
+
+// Share represents a shared photo, album or vault file with permissions
 type Share struct {
-	ID          string    `json:"id"`
-	PhotoID     string    `json:"photo_id"`
-	SharedBy    string    `json:"shared_by"`
-	SharedWith  string    `json:"shared_with"`
-	Permission  string    `json:"permission"` // "view" or "download"
-	ExpiresAt   time.Time `json:"expires_at,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID         string     `json:"id"`
+	PhotoID    string     `json:"photo_id,omitempty"`
+	AlbumID    string     `json:"album_id,omitempty"`
+	FileID     string     `json:"file_id,omitempty"`
+	SharedBy   string     `json:"shared_by"`
+	SharedWith string     `json:"shared_with"`
+	Permission string     `json:"permission"` // "view" or "download"
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
 
-// SharingService handles photo sharing operations
+// SharingService handles photo, album and file sharing operations
 type SharingService struct {
 	db *sql.DB
 }
@@ -33,29 +57,22 @@ func NewSharingService(db *sql.DB) *SharingService {
 }
 
 // SharePhoto shares a photo with another user
-func (s *SharingService) SharePhoto(ctx context.Context, share *Share) error {
+func (s *SharingService) SharePhoto(ctx context.Context, share *Share) (err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.SharePhoto")
+	defer func() { tracing.End(span, err) }()
+
 	// Validate input
 	if share.PhotoID == "" || share.SharedBy == "" || share.SharedWith == "" {
-		return errors.New("photo ID, shared_by, and shared_with are required")
-	}
-
-	// Set default permission if not provided
-	if share.Permission == "" {
-		share.Permission = "view"
+		return ErrInvalidShare.WithField("shared_with", "is required")
 	}
-
-	// Generate a new share ID if not provided
-	if share.ID == "" {
-		share.ID = uuid.New().String()
+	if err := prepareShare(share); err != nil {
+		return err
 	}
 
-	// Set created at time
-	share.CreatedAt = time.Now()
-
 	// Insert the share record
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO photo_shares (id, photo_id, shared_by, shared_with, permission, expires_at, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO photo_sharing (id, photo_id, shared_by, shared_with, permission, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`,
 		share.ID,
 		share.PhotoID,
@@ -69,103 +86,206 @@ func (s *SharingService) SharePhoto(ctx context.Context, share *Share) error {
 	return err
 }
 
-// GetShare retrieves a share by ID
-func (s *SharingService) GetShare(ctx context.Context, shareID string) (*Share, error) {
-	var share Share
-	err := s.db.QueryRowContext(ctx, `
-		SELECT id, photo_id, shared_by, shared_with, permission, expires_at, created_at
-		FROM photo_shares
-		WHERE id = $1
-	`, shareID).Scan(
-		&share.ID,
-		&share.PhotoID,
-		&share.SharedBy,
-		&share.SharedWith,
-		&share.Permission,
-		&share.ExpiresAt,
-		&share.CreatedAt,
+// ShareAlbum shares an album with another user. The share covers the album's
+// photos and its sub-albums.
+func (s *SharingService) ShareAlbum(ctx context.Context, share *Share) (err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.ShareAlbum")
+	defer func() { tracing.End(span, err) }()
+
+	if share.AlbumID == "" || share.SharedBy == "" || share.SharedWith == "" {
+		return ErrInvalidShare.WithField("shared_with", "is required")
+	}
+	if err := prepareShare(share); err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO album_sharing (id, album_id, shared_by, shared_with, permission, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		share.ID,
+		share.AlbumID,
+		share.SharedBy,
+		share.SharedWith,
+		share.Permission,
+		share.ExpiresAt,
+		share.CreatedAt,
 	)
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("share not found")
-		}
-		return nil, err
+	return err
+}
+
+// ShareFile shares a vault file with another user
+func (s *SharingService) ShareFile(ctx context.Context, share *Share) (err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.ShareFile")
+	defer func() { tracing.End(span, err) }()
+
+	if share.FileID == "" || share.SharedBy == "" || share.SharedWith == "" {
+		return ErrInvalidShare.WithField("shared_with", "is required")
+	}
+	if err := prepareShare(share); err != nil {
+		return err
 	}
 
-	return &share, nil
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO file_sharing (id, file_id, shared_by, shared_with, permission, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		share.ID,
+		share.FileID,
+		share.SharedBy,
+		share.SharedWith,
+		share.Permission,
+		share.ExpiresAt,
+		share.CreatedAt,
+	)
+
+	return err
+}
+
+// GetShare retrieves a photo share by ID
+func (s *SharingService) GetShare(ctx context.Context, shareID string) (_ *Share, err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.GetShare")
+	defer func() { tracing.End(span, err) }()
+
+	share, err := scanShare(s.db.QueryRowContext(ctx, `
+		SELECT id, photo_id, '', '', shared_by, shared_with, permission, expires_at, created_at
+		FROM photo_sharing
+		WHERE id = ?
+	`, shareID))
+	if err == sql.ErrNoRows {
+		return nil, ErrShareNotFound
+	}
+	return share, err
 }
 
 // ListSharesForPhoto lists all shares for a specific photo
-func (s *SharingService) ListSharesForPhoto(ctx context.Context, photoID string) ([]*Share, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, photo_id, shared_by, shared_with, permission, expires_at, created_at
-		FROM photo_shares
-		WHERE photo_id = $1
+func (s *SharingService) ListSharesForPhoto(ctx context.Context, photoID string) (_ []*Share, err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.ListSharesForPhoto")
+	defer func() { tracing.End(span, err) }()
+
+	return s.listShares(ctx, `
+		SELECT id, photo_id, '', '', shared_by, shared_with, permission, expires_at, created_at
+		FROM photo_sharing
+		WHERE photo_id = ?
+		ORDER BY created_at
 	`, photoID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+}
 
-	var shares []*Share
-	for rows.Next() {
-		var share Share
-		if err := rows.Scan(
-			&share.ID,
-			&share.PhotoID,
-			&share.SharedBy,
-			&share.SharedWith,
-			&share.Permission,
-			&share.ExpiresAt,
-			&share.CreatedAt,
-		); err != nil {
-			return nil, err
-		}
-		shares = append(shares, &share)
-	}
+// ListSharesForAlbum lists all shares for a specific album
+func (s *SharingService) ListSharesForAlbum(ctx context.Context, albumID string) (_ []*Share, err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.ListSharesForAlbum")
+	defer func() { tracing.End(span, err) }()
 
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
+	return s.listShares(ctx, `
+		SELECT id, '', album_id, '', shared_by, shared_with, permission, expires_at, created_at
+		FROM album_sharing
+		WHERE album_id = ?
+		ORDER BY created_at
+	`, albumID)
+}
 
-	return shares, nil
+// ListSharesForFile lists all shares for a specific vault file
+func (s *SharingService) ListSharesForFile(ctx context.Context, fileID string) (_ []*Share, err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.ListSharesForFile")
+	defer func() { tracing.End(span, err) }()
+
+	return s.listShares(ctx, `
+		SELECT id, '', '', file_id, shared_by, shared_with, permission, expires_at, created_at
+		FROM file_sharing
+		WHERE file_id = ?
+		ORDER BY created_at
+	`, fileID)
 }
 
-// RevokeShare removes a share
-func (s *SharingService) RevokeShare(ctx context.Context, shareID string) error {
+// RevokeShare removes a photo share
+func (s *SharingService) RevokeShare(ctx context.Context, shareID string) (err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.RevokeShare")
+	defer func() { tracing.End(span, err) }()
+
 	result, err := s.db.ExecContext(ctx, `
-		DELETE FROM photo_shares
-		WHERE id = $1
+		DELETE FROM photo_sharing
+		WHERE id = ?
 	`, shareID)
+	return shareDeleted(result, err)
+}
 
-	if err != nil {
-		return err
-	}
+// RevokeAlbumShare removes a share from an album
+func (s *SharingService) RevokeAlbumShare(ctx context.Context, albumID, shareID string) (err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.RevokeAlbumShare")
+	defer func() { tracing.End(span, err) }()
 
-	rowsAffected, err := result.RowsAffected()
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM album_sharing
+		WHERE id = ? AND album_id = ?
+	`, shareID, albumID)
+	return shareDeleted(result, err)
+}
+
+// RevokeFileShare removes a share from a vault file
+func (s *SharingService) RevokeFileShare(ctx context.Context, fileID, shareID string) (err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.RevokeFileShare")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM file_sharing
+		WHERE id = ? AND file_id = ?
+	`, shareID, fileID)
+	return shareDeleted(result, err)
+}
+
+// HasFilePermission checks if a user may access a vault file, either as its
+// owner or through an active share
+func (s *SharingService) HasFilePermission(ctx context.Context, fileID, userID, requiredPermission string) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.HasFilePermission")
+	defer func() { tracing.End(span, err) }()
+
+	var ownerID string
+	err = s.db.QueryRowContext(ctx, `SELECT user_id FROM vault_files WHERE id = ?`, fileID).Scan(&ownerID)
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return false, ErrFileNotFound
+		}
+		return false, err
+	}
+	if ownerID == userID {
+		return true, nil
 	}
 
-	if rowsAffected == 0 {
-		return errors.New("share not found")
+	granting := grantingPermissions(requiredPermission)
+	var count int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM file_sharing
+		WHERE file_id = ?
+		  AND shared_with = ?
+		  AND (expires_at IS NULL OR expires_at > ?)
+		  AND permission IN (`+placeholders(len(granting))+`)
+	`, append([]interface{}{fileID, userID, time.Now().UTC()}, granting...)...).Scan(&count)
+	if err != nil {
+		return false, err
 	}
 
-	return nil
+	return count > 0, nil
 }
 
-// HasPermission checks if a user has permission to access a photo
-func (s *SharingService) HasPermission(ctx context.Context, photoID, userID, requiredPermission string) (bool, error) {
+// HasPermission checks if a user has permission to access a photo. Access is
+// granted to the owner, through a direct share, or through a share on an
+// album containing the photo (or on one of that album's parents).
+func (s *SharingService) HasPermission(ctx context.Context, photoID, userID, requiredPermission string) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.HasPermission")
+	defer func() { tracing.End(span, err) }()
+
 	// Check if the user is the owner of the photo
 	var ownerID string
-	err := s.db.QueryRowContext(ctx, `
-		SELECT user_id FROM photos WHERE id = $1
-	`, photoID).Scan(&ownerID)
+	var partnerID sql.NullString
+	err = s.db.QueryRowContext(ctx, `
+		SELECT user_id, partner_id FROM photos WHERE id = ? AND deleted_at IS NULL
+	`, photoID).Scan(&ownerID, &partnerID)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return false, errors.New("photo not found")
+			return false, ErrPhotoNotFound
 		}
 		return false, err
 	}
@@ -175,20 +295,240 @@ func (s *SharingService) HasPermission(ctx context.Context, photoID, userID, req
 		return true, nil
 	}
 
+	granting := grantingPermissions(requiredPermission)
+	now := time.Now().UTC()
+
 	// Check for an active share
 	var count int
 	err = s.db.QueryRowContext(ctx, `
 		SELECT COUNT(*)
-		FROM photo_shares
-		WHERE photo_id = $1
-		  AND shared_with = $2
-		  AND (expires_at IS NULL OR expires_at > NOW())
-		  AND permission = $3
-	`, photoID, userID, requiredPermission).Scan(&count)
+		FROM photo_sharing
+		WHERE photo_id = ?
+		  AND shared_with = ?
+		  AND (expires_at IS NULL OR expires_at > ?)
+		  AND permission IN (`+placeholders(len(granting))+`)
+	`, append([]interface{}{photoID, userID, now}, granting...)...).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	// Check shares on albums containing the photo and on their parents
+	err = s.db.QueryRowContext(ctx, `
+		WITH RECURSIVE containing(id) AS (
+			SELECT album_id FROM album_photos WHERE photo_id = ?
+			UNION
+			SELECT a.parent_id FROM albums a JOIN containing c ON a.id = c.id
+			WHERE a.parent_id IS NOT NULL
+		)
+		SELECT COUNT(*)
+		FROM album_sharing sh
+		JOIN containing c ON c.id = sh.album_id
+		WHERE sh.shared_with = ?
+		  AND (sh.expires_at IS NULL OR sh.expires_at > ?)
+		  AND sh.permission IN (`+placeholders(len(granting))+`)
+	`, append([]interface{}{photoID, userID, now}, granting...)...).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
 
+	// Check smart albums shared with the user whose query matches the photo
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE shared(id) AS (
+			SELECT album_id FROM album_sharing
+			WHERE shared_with = ?
+			  AND (expires_at IS NULL OR expires_at > ?)
+			  AND permission IN (`+placeholders(len(granting))+`)
+			UNION
+			SELECT a.id FROM albums a JOIN shared s ON a.parent_id = s.id
+		)
+		SELECT a.user_id, a.query
+		FROM albums a
+		JOIN shared s ON s.id = a.id
+		WHERE a.kind = 'smart' AND a.user_id IN (?, ?)
+	`, append(append([]interface{}{userID, now}, granting...), ownerID, partnerID.String)...)
+	if err != nil {
+		return false, err
+	}
+	type smartAlbum struct {
+		owner string
+		query sql.NullString
+	}
+	var smart []smartAlbum
+	for rows.Next() {
+		var album smartAlbum
+		if err := rows.Scan(&album.owner, &album.query); err != nil {
+			rows.Close()
+			return false, err
+		}
+		smart = append(smart, album)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, album := range smart {
+		var q PhotoQuery
+		if album.query.Valid {
+			if err := json.Unmarshal([]byte(album.query.String), &q); err != nil {
+				continue
+			}
+		}
+		q.UserID = album.owner
+		q.AsPartner = true
+		ok, err := queryMatchesPhoto(ctx, s.db, q, photoID)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// HasAlbumPermission checks if a user may access an album, either as its
+// owner or through a share on the album or one of its parents
+func (s *SharingService) HasAlbumPermission(ctx context.Context, albumID, userID, requiredPermission string) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "SharingService.HasAlbumPermission")
+	defer func() { tracing.End(span, err) }()
+
+	var ownerID string
+	err = s.db.QueryRowContext(ctx, `SELECT user_id FROM albums WHERE id = ?`, albumID).Scan(&ownerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, ErrAlbumNotFound
+		}
+		return false, err
+	}
+	if ownerID == userID {
+		return true, nil
+	}
+
+	granting := grantingPermissions(requiredPermission)
+	var count int
+	err = s.db.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors(id) AS (
+			SELECT ?
+			UNION
+			SELECT a.parent_id FROM albums a JOIN ancestors anc ON a.id = anc.id
+			WHERE a.parent_id IS NOT NULL
+		)
+		SELECT COUNT(*)
+		FROM album_sharing sh
+		JOIN ancestors anc ON anc.id = sh.album_id
+		WHERE sh.shared_with = ?
+		  AND (sh.expires_at IS NULL OR sh.expires_at > ?)
+		  AND sh.permission IN (`+placeholders(len(granting))+`)
+	`, append([]interface{}{albumID, userID, time.Now().UTC()}, granting...)...).Scan(&count)
 	if err != nil {
 		return false, err
 	}
 
 	return count > 0, nil
-}
\ No newline at end of file
+}
+
+func (s *SharingService) listShares(ctx context.Context, query string, args ...interface{}) ([]*Share, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []*Share{}
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+// prepareShare validates the permission and fills in defaults
+func prepareShare(share *Share) error {
+	// Set default permission if not provided
+	if share.Permission == "" {
+		share.Permission = PermissionView
+	}
+	share.Permission = strings.ToLower(share.Permission)
+	if share.Permission != PermissionView && share.Permission != PermissionDownload {
+		return ErrInvalidPermission
+	}
+	if share.ExpiresAt != nil {
+		if share.ExpiresAt.Before(time.Now()) {
+			return ErrInvalidShare.WithField("expires_at", "must be in the future")
+		}
+		expires := share.ExpiresAt.UTC()
+		share.ExpiresAt = &expires
+	}
+
+	// Generate a new share ID if not provided
+	if share.ID == "" {
+		share.ID = uuid.New().String()
+	}
+
+	// Set created at time
+	share.CreatedAt = time.Now().UTC()
+	return nil
+}
+
+// grantingPermissions lists the share permissions that satisfy required
+func grantingPermissions(required string) []interface{} {
+	if required == PermissionDownload {
+		return []interface{}{PermissionDownload}
+	}
+	return []interface{}{PermissionView, PermissionDownload}
+}
+
+func scanShare(row rowScanner) (*Share, error) {
+	var share Share
+	var expiresAt sql.NullTime
+	if err := row.Scan(
+		&share.ID,
+		&share.PhotoID,
+		&share.AlbumID,
+		&share.FileID,
+		&share.SharedBy,
+		&share.SharedWith,
+		&share.Permission,
+		&expiresAt,
+		&share.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		share.ExpiresAt = &expiresAt.Time
+	}
+	return &share, nil
+}
+
+func shareDeleted(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrShareNotFound
+	}
+
+	return nil
+}
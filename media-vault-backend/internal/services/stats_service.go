@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Growth windows of the system statistics, in days
+const (
+	DefaultStatsDays = 30
+	MaxStatsDays     = 365
+)
+
+// SystemStats summarizes the whole vault for admins
+type SystemStats struct {
+	Users      UserStats      `json:"users"`
+	Photos     PhotoStats     `json:"photos"`
+	Files      FileStats      `json:"files"`
+	Storage    StorageStats   `json:"storage"`
+	Moderation map[string]int `json:"moderation"`
+	Jobs       JobStats       `json:"jobs"`
+	Growth     []GrowthPoint  `json:"growth"`
+	Since      time.Time      `json:"since"`
+	CheckedAt  time.Time      `json:"checked_at"`
+}
+
+// UserStats counts users. Registered users are those of the local directory;
+// with Keycloak only owners of content are known.
+type UserStats struct {
+	Registered  int `json:"registered"`
+	Active      int `json:"active"`
+	WithContent int `json:"with_content"`
+}
+
+// PhotoStats counts photos, including those in the trash
+type PhotoStats struct {
+	Total    int `json:"total"`
+	InTrash  int `json:"in_trash"`
+	Versions int `json:"versions"`
+	Albums   int `json:"albums"`
+}
+
+// FileStats counts vault files
+type FileStats struct {
+	Total     int `json:"total"`
+	Encrypted int `json:"encrypted"`
+}
+
+// StorageStats breaks down the bytes stored, counted like storage quotas plus
+// the export archives
+type StorageStats struct {
+	TotalBytes     int64 `json:"total_bytes"`
+	PhotoBytes     int64 `json:"photo_bytes"`
+	VersionBytes   int64 `json:"version_bytes"`
+	RenditionBytes int64 `json:"rendition_bytes"`
+	FileBytes      int64 `json:"file_bytes"`
+	ExportBytes    int64 `json:"export_bytes"`
+}
+
+// JobStats is the depth of the background job queues
+type JobStats struct {
+	ExportsPending int `json:"exports_pending"`
+	ExportsRunning int `json:"exports_running"`
+	ExportsFailed  int `json:"exports_failed"`
+}
+
+// GrowthPoint is what was added on one day (UTC)
+type GrowthPoint struct {
+	Date   string `json:"date"`
+	Users  int    `json:"users"`
+	Photos int    `json:"photos"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// StatsService computes system statistics
+type StatsService struct {
+	db *sql.DB
+}
+
+// NewStatsService creates a new StatsService
+func NewStatsService(db *sql.DB) *StatsService {
+	return &StatsService{db: db}
+}
+
+// SystemStats returns the current totals and the daily growth over the last
+// days days
+func (s *StatsService) SystemStats(ctx context.Context, days int) (*SystemStats, error) {
+	if days <= 0 {
+		days = DefaultStatsDays
+	}
+	if days > MaxStatsDays {
+		days = MaxStatsDays
+	}
+	now := time.Now().UTC()
+	stats := &SystemStats{
+		Moderation: make(map[string]int),
+		Since:      now.Truncate(24*time.Hour).AddDate(0, 0, 1-days),
+		CheckedAt:  now,
+	}
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM users WHERE is_active = 1),
+			(SELECT COUNT(*) FROM (
+				SELECT user_id FROM photos UNION SELECT user_id FROM vault_files UNION SELECT user_id FROM albums
+			)),
+			(SELECT COUNT(*) FROM photos),
+			(SELECT COUNT(*) FROM photos WHERE deleted_at IS NOT NULL),
+			(SELECT COUNT(*) FROM photo_versions v JOIN photos p ON p.id = v.photo_id WHERE `+supersededVersion+`),
+			(SELECT COUNT(*) FROM albums),
+			(SELECT COUNT(*) FROM vault_files),
+			(SELECT COUNT(*) FROM vault_files WHERE is_encrypted = 1),
+			COALESCE((SELECT SUM(file_size) FROM photos), 0),
+			COALESCE((SELECT SUM(v.file_size) FROM photo_versions v JOIN photos p ON p.id = v.photo_id WHERE `+supersededVersion+`), 0),
+			COALESCE((SELECT SUM(size) FROM photo_renditions), 0),
+			COALESCE((SELECT SUM(size) FROM vault_files), 0),
+			COALESCE((SELECT SUM(size) FROM export_jobs WHERE status = ?), 0),
+			(SELECT COUNT(*) FROM export_jobs WHERE status = ?),
+			(SELECT COUNT(*) FROM export_jobs WHERE status = ?),
+			(SELECT COUNT(*) FROM export_jobs WHERE status = ?)
+	`, ExportDone, ExportPending, ExportRunning, ExportFailed).Scan(
+		&stats.Users.Registered,
+		&stats.Users.Active,
+		&stats.Users.WithContent,
+		&stats.Photos.Total,
+		&stats.Photos.InTrash,
+		&stats.Photos.Versions,
+		&stats.Photos.Albums,
+		&stats.Files.Total,
+		&stats.Files.Encrypted,
+		&stats.Storage.PhotoBytes,
+		&stats.Storage.VersionBytes,
+		&stats.Storage.RenditionBytes,
+		&stats.Storage.FileBytes,
+		&stats.Storage.ExportBytes,
+		&stats.Jobs.ExportsPending,
+		&stats.Jobs.ExportsRunning,
+		&stats.Jobs.ExportsFailed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	stats.Storage.TotalBytes = stats.Storage.PhotoBytes + stats.Storage.VersionBytes +
+		stats.Storage.RenditionBytes + stats.Storage.FileBytes + stats.Storage.ExportBytes
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(moderation_status, 'pending'), COUNT(*) FROM photos GROUP BY 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.Moderation[status] += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if stats.Growth, err = s.growth(ctx, stats.Since, days); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// growth returns one point per day from since, including days without
+// additions
+func (s *StatsService) growth(ctx context.Context, since time.Time, days int) ([]GrowthPoint, error) {
+	points := make([]GrowthPoint, days)
+	byDate := make(map[string]*GrowthPoint, days)
+	for i := range points {
+		points[i].Date = since.AddDate(0, 0, i).Format("2006-01-02")
+		byDate[points[i].Date] = &points[i]
+	}
+
+	// Dates are compared as text, as timestamps are stored as UTC strings
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT 'users', substr(created_at, 1, 10), COUNT(*), 0 FROM users
+		WHERE created_at >= ? GROUP BY 2
+		UNION ALL
+		SELECT 'photos', substr(created_at, 1, 10), COUNT(*), SUM(file_size) FROM photos
+		WHERE created_at >= ? GROUP BY 2
+		UNION ALL
+		SELECT 'files', substr(created_at, 1, 10), COUNT(*), SUM(size) FROM vault_files
+		WHERE created_at >= ? GROUP BY 2
+	`, points[0].Date, points[0].Date, points[0].Date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind, date string
+		var count int
+		var bytes int64
+		if err := rows.Scan(&kind, &date, &count, &bytes); err != nil {
+			return nil, err
+		}
+		point, ok := byDate[date]
+		if !ok {
+			continue
+		}
+		switch kind {
+		case "users":
+			point.Users += count
+		case "photos":
+			point.Photos += count
+		case "files":
+			point.Files += count
+		}
+		point.Bytes += bytes
+	}
+	return points, rows.Err()
+}
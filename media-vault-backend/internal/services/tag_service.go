@@ -0,0 +1,427 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+var (
+	// ErrTagNotFound is returned when a tag does not exist for the user
+	ErrTagNotFound = apperr.NotFound("tag_not_found", "tag not found")
+	// ErrTagExists is returned when renaming a tag onto another existing tag
+	ErrTagExists = apperr.Conflict("tag_exists", "a tag with that name already exists; merge the tags instead")
+)
+
+// Tag sources record who attached a tag to a photo
+const (
+	TagSourceUser = "user"
+	TagSourceAI   = "ai"
+)
+
+// TagService manages normalized, per-user tags. Tags are attached to photos
+// through photo_tags; photos.tags holds a comma-separated cache of the names.
+type TagService struct {
+	db *sql.DB
+}
+
+// NewTagService creates a new TagService
+func NewTagService(db *sql.DB) *TagService {
+	return &TagService{db: db}
+}
+
+// ListTags returns the user's tags with the number of photos carrying each,
+// most used first. An optional prefix filters by slug. Photos in the trash
+// are not counted, and tags only they carry are left out until they are
+// restored; unused tags are listed so that they can be deleted.
+func (s *TagService) ListTags(ctx context.Context, userID, prefix string) ([]*models.Tag, error) {
+	query := `
+		SELECT t.id, t.user_id, t.slug, t.name, t.created_at, COUNT(p.id)
+		FROM tags t
+		LEFT JOIN photo_tags pt ON pt.tag_id = t.id
+		LEFT JOIN photos p ON p.id = pt.photo_id AND p.deleted_at IS NULL
+		WHERE t.user_id = ?`
+	args := []interface{}{userID}
+	if prefix = utils.Slugify(prefix); prefix != "" {
+		query += ` AND t.slug LIKE ? ESCAPE '\'`
+		args = append(args, escapeLike(prefix)+"%")
+	}
+	query += ` GROUP BY t.id HAVING COUNT(p.id) > 0 OR COUNT(pt.photo_id) = 0 ORDER BY COUNT(p.id) DESC, t.slug`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.UserID, &tag.Slug, &tag.Name, &tag.CreatedAt, &tag.PhotoCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// PhotoTags returns the tags attached to a photo with their provenance
+func (s *TagService) PhotoTags(ctx context.Context, photoID string) ([]*models.PhotoTag, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.slug, t.name, pt.source, pt.confidence, pt.created_at
+		FROM photo_tags pt
+		JOIN tags t ON t.id = pt.tag_id
+		WHERE pt.photo_id = ?
+		ORDER BY t.name
+	`, photoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*models.PhotoTag{}
+	for rows.Next() {
+		var tag models.PhotoTag
+		if err := rows.Scan(&tag.Slug, &tag.Name, &tag.Source, &tag.Confidence, &tag.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// RenameTag changes a tag's display name (and therefore its slug)
+func (s *TagService) RenameTag(ctx context.Context, userID, slug, name string) (*models.Tag, error) {
+	names, err := utils.ValidateTags([]string{name})
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, utils.ErrInvalidTag.WithField("name", "is required")
+	}
+	name = names[0]
+	newSlug := utils.Slugify(name)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tagID, err := findTag(ctx, tx, userID, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if newSlug != slug {
+		if _, err := findTag(ctx, tx, userID, newSlug); err == nil {
+			return nil, ErrTagExists
+		} else if err != ErrTagNotFound {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE tags SET slug = ?, name = ? WHERE id = ?`, newSlug, name, tagID); err != nil {
+		return nil, err
+	}
+	if err := refreshTagCacheForTag(ctx, tx, tagID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getTag(ctx, userID, newSlug)
+}
+
+// MergeTags moves every photo tagged with one of the source tags to the target
+// tag and deletes the sources. The target is created if it does not exist.
+func (s *TagService) MergeTags(ctx context.Context, userID string, sources []string, target string) (*models.Tag, error) {
+	names, err := utils.ValidateTags([]string{target})
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 || len(sources) == 0 {
+		return nil, fmt.Errorf("%w: sources and target are required", utils.ErrInvalidTag)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	targetID, err := ensureTag(ctx, tx, userID, names[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, source := range sources {
+		sourceID, err := findTag(ctx, tx, userID, utils.Slugify(source))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		if sourceID == targetID {
+			continue
+		}
+
+		// Keep the strongest provenance: a user tag wins over an AI suggestion
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO photo_tags (photo_id, tag_id, source, confidence, created_by, created_at)
+			SELECT photo_id, ?, source, confidence, created_by, created_at
+			FROM photo_tags WHERE tag_id = ?
+			ON CONFLICT (photo_id, tag_id) DO UPDATE SET
+				source = CASE WHEN photo_tags.source = 'user' THEN 'user' ELSE excluded.source END,
+				confidence = CASE WHEN photo_tags.source = 'user' THEN photo_tags.confidence ELSE excluded.confidence END
+		`, targetID, sourceID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id = ?`, sourceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := refreshTagCacheForTag(ctx, tx, targetID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getTag(ctx, userID, utils.Slugify(names[0]))
+}
+
+// DeleteTag removes a tag from the user's photos and deletes it
+func (s *TagService) DeleteTag(ctx context.Context, userID, slug string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tagID, err := findTag(ctx, tx, userID, slug)
+	if err != nil {
+		return err
+	}
+
+	photoIDs, err := taggedPhotoIDs(ctx, tx, tagID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id = ?`, tagID); err != nil {
+		return err
+	}
+	if err := refreshTagCache(ctx, tx, photoIDs...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TagPhotos adds and removes tags on many photos at once. Photos the user does
+// not own are skipped and returned in the second result.
+func (s *TagService) TagPhotos(ctx context.Context, userID string, photoIDs, add, remove []string, source string, confidence *float64) ([]string, []string, error) {
+	add, err := utils.ValidateTags(add)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var updated, skipped []string
+	for _, photoID := range photoIDs {
+		var ownerID string
+		err := tx.QueryRowContext(ctx, `SELECT user_id FROM photos WHERE id = ? AND deleted_at IS NULL`, photoID).Scan(&ownerID)
+		if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+			skipped = append(skipped, photoID)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, name := range add {
+			tagID, err := ensureTag(ctx, tx, userID, name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := attachTag(ctx, tx, photoID, tagID, source, confidence, userID); err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, name := range remove {
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM photo_tags
+				WHERE photo_id = ? AND tag_id IN (SELECT id FROM tags WHERE user_id = ? AND slug = ?)
+			`, photoID, userID, utils.Slugify(name)); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if err := refreshTagCache(ctx, tx, photoID); err != nil {
+			return nil, nil, err
+		}
+		updated = append(updated, photoID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return updated, skipped, nil
+}
+
+func (s *TagService) getTag(ctx context.Context, userID, slug string) (*models.Tag, error) {
+	var tag models.Tag
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.user_id, t.slug, t.name, t.created_at,
+			(SELECT COUNT(*) FROM photo_tags pt JOIN photos p ON p.id = pt.photo_id
+				WHERE pt.tag_id = t.id AND p.deleted_at IS NULL)
+		FROM tags t
+		WHERE t.user_id = ? AND t.slug = ?
+	`, userID, slug).Scan(&tag.ID, &tag.UserID, &tag.Slug, &tag.Name, &tag.CreatedAt, &tag.PhotoCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// setPhotoTags replaces a photo's tags with names. Tags that were already
+// attached keep their provenance; new ones are recorded with the given source.
+func setPhotoTags(ctx context.Context, tx *sql.Tx, userID, photoID string, names []string, source string) error {
+	keep := make([]interface{}, 0, len(names)+1)
+	keep = append(keep, photoID)
+	for _, name := range names {
+		tagID, err := ensureTag(ctx, tx, userID, name)
+		if err != nil {
+			return err
+		}
+		if err := attachTag(ctx, tx, photoID, tagID, source, nil, userID); err != nil {
+			return err
+		}
+		keep = append(keep, tagID)
+	}
+
+	query := `DELETE FROM photo_tags WHERE photo_id = ?`
+	if len(names) > 0 {
+		query += ` AND tag_id NOT IN (` + placeholders(len(names)) + `)`
+	}
+	if _, err := tx.ExecContext(ctx, query, keep...); err != nil {
+		return err
+	}
+
+	return refreshTagCache(ctx, tx, photoID)
+}
+
+// ensureTag returns the ID of the user's tag with the given name, creating it
+// if needed
+func ensureTag(ctx context.Context, tx *sql.Tx, userID, name string) (string, error) {
+	name = utils.CleanTagName(name)
+	slug := utils.Slugify(name)
+	if slug == "" {
+		return "", fmt.Errorf("%w: %q", utils.ErrInvalidTag, name)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO tags (id, user_id, slug, name) VALUES (?, ?, ?, ?)
+	`, uuid.New().String(), userID, slug, name); err != nil {
+		return "", err
+	}
+	return findTag(ctx, tx, userID, slug)
+}
+
+func findTag(ctx context.Context, tx *sql.Tx, userID, slug string) (string, error) {
+	var tagID string
+	err := tx.QueryRowContext(ctx, `SELECT id FROM tags WHERE user_id = ? AND slug = ?`, userID, slug).Scan(&tagID)
+	if err == sql.ErrNoRows {
+		return "", ErrTagNotFound
+	}
+	return tagID, err
+}
+
+// attachTag links a tag to a photo. A user tag replaces an AI suggestion for
+// the same tag, but an AI suggestion never downgrades a user tag.
+func attachTag(ctx context.Context, tx *sql.Tx, photoID, tagID, source string, confidence *float64, createdBy string) error {
+	if source == "" {
+		source = TagSourceUser
+	}
+	if source == TagSourceUser {
+		confidence = nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO photo_tags (photo_id, tag_id, source, confidence, created_by)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (photo_id, tag_id) DO UPDATE SET
+			source = CASE WHEN photo_tags.source = 'user' THEN 'user' ELSE excluded.source END,
+			confidence = CASE WHEN photo_tags.source = 'user' THEN photo_tags.confidence ELSE excluded.confidence END
+	`, photoID, tagID, source, confidence, createdBy)
+	return err
+}
+
+func taggedPhotoIDs(ctx context.Context, tx *sql.Tx, tagID string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT photo_id FROM photo_tags WHERE tag_id = ?`, tagID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func refreshTagCacheForTag(ctx context.Context, tx *sql.Tx, tagID string) error {
+	photoIDs, err := taggedPhotoIDs(ctx, tx, tagID)
+	if err != nil {
+		return err
+	}
+	return refreshTagCache(ctx, tx, photoIDs...)
+}
+
+// refreshTagCache rewrites photos.tags from photo_tags for the given photos
+func refreshTagCache(ctx context.Context, tx *sql.Tx, photoIDs ...string) error {
+	for _, photoID := range photoIDs {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE photos SET
+				tags = (
+					SELECT group_concat(name, ',') FROM (
+						SELECT t.name FROM photo_tags pt
+						JOIN tags t ON t.id = pt.tag_id
+						WHERE pt.photo_id = photos.id
+						ORDER BY t.name
+					)
+				),
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, photoID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
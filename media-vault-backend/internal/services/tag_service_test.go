@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestListTagsSkipsTrashedPhotos(t *testing.T) {
+	photos := newTestPhotoService(t, t.TempDir())
+	tags := NewTagService(photos.db)
+	ctx := context.Background()
+
+	beach := uploadTestPhoto(t, photos, "u1")
+	shoot := uploadTestPhoto(t, photos, "u1")
+	if _, _, err := tags.TagPhotos(ctx, "u1", []string{beach, shoot}, []string{"summer"}, nil, TagSourceUser, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tags.TagPhotos(ctx, "u1", []string{shoot}, []string{"wedding"}, nil, TagSourceUser, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tags.TagPhotos(ctx, "u1", []string{beach}, []string{"unused"}, nil, TagSourceUser, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tags.TagPhotos(ctx, "u1", []string{beach}, nil, []string{"unused"}, TagSourceUser, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := photos.DeletePhoto(ctx, shoot); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := tags.ListTags(ctx, "u1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, tag := range list {
+		counts[tag.Slug] = tag.PhotoCount
+	}
+	// The wedding is only in the trash; unused tags stay so they can be deleted
+	if want := map[string]int{"summer": 1, "unused": 0}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("tags = %v, want %v", counts, want)
+	}
+
+	tag, err := tags.getTag(ctx, "u1", "summer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.PhotoCount != 1 {
+		t.Errorf("summer photo count = %d, want 1", tag.PhotoCount)
+	}
+}
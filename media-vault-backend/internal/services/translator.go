@@ -0,0 +1,74 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/tracing"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+// HTTPTranslator translates text through a LibreTranslate-compatible API
+type HTTPTranslator struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewHTTPTranslator creates a translator for the service at baseURL
+func NewHTTPTranslator(baseURL, apiKey string) *HTTPTranslator {
+	return &HTTPTranslator{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  tracing.NewHTTPClient(30 * time.Second),
+	}
+}
+
+// Translate translates text from one language to another. Only the primary
+// language subtags are sent, as regional variants are not supported upstream.
+func (t *HTTPTranslator) Translate(ctx context.Context, text, from, to string) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		return text, nil
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  utils.BaseLanguage(from),
+		"target":  utils.BaseLanguage(to),
+		"format":  "text",
+		"api_key": t.apiKey,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/translate", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("translation service returned %s", resp.Status)
+	}
+
+	var result struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	return result.TranslatedText, nil
+}
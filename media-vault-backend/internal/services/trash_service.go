@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/models"
+	"github.com/wronai/media-vault-backend/internal/storage"
+	"github.com/wronai/media-vault-backend/internal/utils"
+)
+
+const (
+	// DefaultTrashRetention is how long deleted photos stay in the trash
+	DefaultTrashRetention = 30 * 24 * time.Hour
+
+	trashPurgeInterval = time.Hour
+)
+
+// ErrInvalidRestore is returned for restore requests naming no photos
+var ErrInvalidRestore = apperr.Invalid("invalid_restore", "invalid restore request")
+
+// TrashedPhoto is a photo in the trash with the time it will be purged
+type TrashedPhoto struct {
+	*models.Photo
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// TrashPage is one page of a user's trash, most recently deleted first
+type TrashPage struct {
+	Photos        []*TrashedPhoto `json:"data"`
+	Total         int             `json:"total"`
+	Page          int             `json:"page"`
+	Limit         int             `json:"limit"`
+	RetentionDays int             `json:"retention_days"`
+}
+
+// TrashService manages deleted photos: PhotoService.DeletePhoto moves photos
+// to the trash, from where they can be restored until the retention period
+// has passed. Purging removes the photo's record and its stored versions and
+// renditions. Trashed photos still count towards the owner's storage usage.
+type TrashService struct {
+	db        *sql.DB
+	storage   storage.Storage
+	retention time.Duration
+	audit     *AuditService
+	worker    worker
+}
+
+// NewTrashService creates a new TrashService. Call Start to purge expired
+// photos in the background, and Stop to stop; with an audit service, each
+// purge by the scheduler is recorded in the audit log.
+func NewTrashService(db *sql.DB, store storage.Storage, retention time.Duration, audit *AuditService) *TrashService {
+	if retention <= 0 {
+		retention = DefaultTrashRetention
+	}
+	return &TrashService{db: db, storage: store, retention: retention, audit: audit}
+}
+
+// Retention returns how long deleted photos are kept
+func (s *TrashService) Retention() time.Duration {
+	return s.retention
+}
+
+// ListTrash returns one page of the user's deleted photos
+func (s *TrashService) ListTrash(ctx context.Context, userID string, page, limit int) (*TrashPage, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	result := &TrashPage{
+		Photos:        []*TrashedPhoto{},
+		Page:          page,
+		Limit:         limit,
+		RetentionDays: int(s.retention / (24 * time.Hour)),
+	}
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM photos WHERE user_id = ? AND deleted_at IS NOT NULL
+	`, userID).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+photoColumns+`
+		FROM photos
+		WHERE user_id = ? AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id
+		LIMIT ? OFFSET ?
+	`, userID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		photo, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Photos = append(result.Photos, &TrashedPhoto{Photo: photo, PurgeAt: photo.DeletedAt.Add(s.retention)})
+	}
+
+	return result, rows.Err()
+}
+
+// GetTrashedPhoto retrieves a photo in the trash by ID
+func (s *TrashService) GetTrashedPhoto(ctx context.Context, photoID string) (*models.Photo, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+photoColumns+` FROM photos WHERE id = ? AND deleted_at IS NOT NULL`, photoID)
+	photo, err := scanPhoto(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPhotoNotFound
+		}
+		return nil, err
+	}
+	return photo, nil
+}
+
+// RestorePhotos moves the user's photos out of the trash. With no IDs, every
+// photo the user deleted at or after since is restored, which undoes a bulk
+// delete in one call. IDs that are not in the user's trash are returned as
+// skipped. Restored photos reappear in the albums and shares they were in.
+func (s *TrashService) RestorePhotos(ctx context.Context, userID string, photoIDs []string, since *time.Time) (restored, skipped []string, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if len(photoIDs) == 0 {
+		if since == nil {
+			return nil, nil, fmt.Errorf("%w: photo IDs or a deletion time are required", ErrInvalidRestore)
+		}
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id FROM photos WHERE user_id = ? AND deleted_at >= ? ORDER BY deleted_at
+		`, userID, since.UTC())
+		if err != nil {
+			return nil, nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			photoIDs = append(photoIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	restored = []string{}
+	for _, photoID := range photoIDs {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE photos SET deleted_at = NULL WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL
+		`, photoID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			skipped = append(skipped, photoID)
+			continue
+		}
+		restored = append(restored, photoID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return restored, skipped, nil
+}
+
+// PurgePhoto permanently deletes a photo in the trash, including its stored
+// versions and renditions
+func (s *TrashService) PurgePhoto(ctx context.Context, photoID string) error {
+	photo, err := s.GetTrashedPhoto(ctx, photoID)
+	if err != nil {
+		return err
+	}
+	return s.purge(ctx, photo)
+}
+
+// EmptyTrash permanently deletes all photos in the user's trash and returns
+// how many were deleted
+func (s *TrashService) EmptyTrash(ctx context.Context, userID string) (int, error) {
+	purged, err := s.purgeWhere(ctx, `user_id = ? AND deleted_at IS NOT NULL`, userID)
+	return len(purged), err
+}
+
+// PurgeExpired permanently deletes photos that have been in the trash for
+// longer than the retention period and returns how many were deleted
+func (s *TrashService) PurgeExpired(ctx context.Context) (int, error) {
+	purged, err := s.purgeWhere(ctx, `deleted_at < ?`, time.Now().UTC().Add(-s.retention))
+	if s.audit != nil {
+		for _, photo := range purged {
+			event := &AuditEvent{
+				ActorID:    AuditSystemActor,
+				Action:     AuditPhotoPurge,
+				TargetType: "photo",
+				TargetID:   photo.ID,
+			}
+			if err := event.SetChange(photo, nil); err == nil {
+				err = s.audit.Record(ctx, event)
+			}
+			if err != nil {
+				logging.FromContext(ctx).Error("Failed to audit the purge of a photo", "photo_id", photo.ID, logging.Err(err))
+			}
+		}
+	}
+	return len(purged), err
+}
+
+// Start purges expired photos now and then periodically until Stop is called
+// or ctx is cancelled
+func (s *TrashService) Start(ctx context.Context) {
+	s.worker.start(ctx, func(ctx context.Context, stop <-chan struct{}) {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			if n, err := s.PurgeExpired(ctx); err != nil {
+				logging.FromContext(ctx).Error("Failed to purge trash", logging.Err(err))
+			} else if n > 0 {
+				logging.FromContext(ctx).Info("Purged photos from the trash", "photos", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// Stop stops purging, letting a purge in progress finish until ctx expires
+func (s *TrashService) Stop(ctx context.Context) error {
+	return s.worker.shutdown(ctx)
+}
+
+// purgeWhere purges the photos matching where and returns those purged
+func (s *TrashService) purgeWhere(ctx context.Context, where string, args ...interface{}) ([]*models.Photo, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+photoColumns+` FROM photos WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	var photos []*models.Photo
+	for rows.Next() {
+		photo, err := scanPhoto(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		photos = append(photos, photo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var purged []*models.Photo
+	for _, photo := range photos {
+		if err := s.purge(ctx, photo); errors.Is(err, ErrPhotoNotFound) {
+			continue
+		} else if err != nil {
+			return purged, err
+		}
+		purged = append(purged, photo)
+	}
+	return purged, nil
+}
+
+// purge deletes the photo's record, which cascades to its shares, album
+// memberships, tags and translations, and then its stored blobs. The record
+// goes first so that a concurrent restore cannot bring back a photo whose
+// files are gone; blobs that fail to delete are only logged.
+func (s *TrashService) purge(ctx context.Context, photo *models.Photo) error {
+	keys := []string{photo.FilePath}
+	for size := range utils.ThumbnailSizes {
+		keys = append(keys, thumbnailKey(photo, size))
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT storage_key FROM photo_renditions WHERE photo_id = ?
+		UNION
+		SELECT storage_key FROM photo_versions WHERE photo_id = ?
+	`, photo.ID, photo.ID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM photos WHERE id = ? AND deleted_at IS NOT NULL`, photo.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Restored in the meantime
+		return ErrPhotoNotFound
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := s.storage.Delete(ctx, key); err != nil {
+			logging.FromContext(ctx).Error("Failed to delete a file of a purged photo", "photo_id", photo.ID, "key", key, logging.Err(err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSigningKey(b byte) []byte {
+	return []byte(strings.Repeat(string(rune(b)), minSigningKeyLength))
+}
+
+func newTestSigner(t *testing.T, keys map[string][]byte, active string) *URLSigner {
+	t.Helper()
+	signer, err := NewURLSigner(keys, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestURLSignerVerifies(t *testing.T) {
+	signer := newTestSigner(t, map[string][]byte{"k1": testSigningKey('a')}, "k1")
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	query := signer.Sign(SignedMedia{PhotoID: "p1", Rendition: "medium", Caller: "u1", ExpiresAt: expiresAt})
+
+	signed, err := signer.Verify("p1", "medium", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Caller != "u1" || !signed.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("verified %+v, want caller u1 until %s", signed, expiresAt)
+	}
+}
+
+func TestURLSignerRejectsTampering(t *testing.T) {
+	signer := newTestSigner(t, map[string][]byte{"k1": testSigningKey('a')}, "k1")
+	expiresAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		tamper func(photoID, rendition *string, query url.Values)
+	}{
+		{"other photo", func(photoID, _ *string, _ url.Values) { *photoID = "p2" }},
+		{"other rendition", func(_, rendition *string, _ url.Values) { *rendition = "original" }},
+		{"other caller", func(_, _ *string, q url.Values) { q.Set("u", "u2") }},
+		{"later expiry", func(_, _ *string, q url.Values) {
+			q.Set("exp", strconv.FormatInt(expiresAt.Add(time.Hour).Unix(), 10))
+		}},
+		{"flipped signature", func(_, _ *string, q url.Values) {
+			sig := []byte(q.Get("sig"))
+			sig[0] ^= 1
+			q.Set("sig", string(sig))
+		}},
+		{"truncated signature", func(_, _ *string, q url.Values) { q.Set("sig", q.Get("sig")[:10]) }},
+		{"no signature", func(_, _ *string, q url.Values) { q.Del("sig") }},
+		{"unknown key", func(_, _ *string, q url.Values) { q.Set("kid", "k9") }},
+		{"no key", func(_, _ *string, q url.Values) { q.Del("kid") }},
+		// Fields are separated so that they cannot slide into each other
+		{"shifted fields", func(photoID, rendition *string, _ url.Values) {
+			*photoID, *rendition = "p1\nmedium", ""
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			photoID, rendition := "p1", "medium"
+			query := signer.Sign(SignedMedia{PhotoID: photoID, Rendition: rendition, Caller: "u1", ExpiresAt: expiresAt})
+			tt.tamper(&photoID, &rendition, query)
+			if _, err := signer.Verify(photoID, rendition, query); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestURLSignerRejectsExpired(t *testing.T) {
+	signer := newTestSigner(t, map[string][]byte{"k1": testSigningKey('a')}, "k1")
+	query := signer.Sign(SignedMedia{PhotoID: "p1", Rendition: "medium", Caller: "u1", ExpiresAt: time.Now().Add(-time.Second)})
+
+	if _, err := signer.Verify("p1", "medium", query); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("error = %v, want ErrSignatureExpired", err)
+	}
+}
+
+func TestURLSignerKeyRotation(t *testing.T) {
+	media := SignedMedia{PhotoID: "p1", Rendition: "original", Caller: "u1", ExpiresAt: time.Now().Add(time.Hour)}
+	old := newTestSigner(t, map[string][]byte{"k1": testSigningKey('a')}, "k1")
+	query := old.Sign(media)
+
+	// k2 becomes active; URLs signed with k1 stay valid while it is configured
+	rotating := newTestSigner(t, map[string][]byte{"k1": testSigningKey('a'), "k2": testSigningKey('b')}, "k2")
+	if _, err := rotating.Verify("p1", "original", query); err != nil {
+		t.Errorf("URL signed with the previous key: %v", err)
+	}
+	fresh := rotating.Sign(media)
+	if fresh.Get("kid") != "k2" {
+		t.Errorf("new URLs are signed with %q, want k2", fresh.Get("kid"))
+	}
+
+	// Once k1 is removed, its URLs stop working
+	rotated := newTestSigner(t, map[string][]byte{"k2": testSigningKey('b')}, "k2")
+	if _, err := rotated.Verify("p1", "original", query); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("URL signed with a removed key: error = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := rotated.Verify("p1", "original", fresh); err != nil {
+		t.Errorf("URL signed with the active key: %v", err)
+	}
+
+	// A key ID does not carry over to another secret
+	replaced := newTestSigner(t, map[string][]byte{"k1": testSigningKey('c')}, "k1")
+	if _, err := replaced.Verify("p1", "original", query); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("URL verified under a replaced secret: error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestNewURLSignerRejectsWeakKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   map[string][]byte
+		active string
+	}{
+		{"short key", map[string][]byte{"k1": []byte("short")}, "k1"},
+		{"inactive short key", map[string][]byte{"k1": testSigningKey('a'), "k2": []byte("short")}, "k1"},
+		{"missing active key", map[string][]byte{"k1": testSigningKey('a')}, "k2"},
+		{"separator in ID", map[string][]byte{"k:1": testSigningKey('a')}, "k:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewURLSigner(tt.keys, tt.active); err == nil {
+				t.Error("NewURLSigner accepted the keys")
+			}
+		})
+	}
+}
+
+func TestParseSigningKeys(t *testing.T) {
+	keys, active, err := ParseSigningKeys(" k2:" + string(testSigningKey('b')) + ", k1:base64:" + "YWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWE=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active != "k2" {
+		t.Errorf("active key = %q, want the first, k2", active)
+	}
+	if string(keys["k1"]) != string(testSigningKey('a')) || string(keys["k2"]) != string(testSigningKey('b')) {
+		t.Errorf("keys = %q", keys)
+	}
+
+	for _, spec := range []string{"", " , ", "k1", "k1:", ":secret", "k1:base64:!!", "k1:a,k1:b"} {
+		if _, _, err := ParseSigningKeys(spec); err == nil {
+			t.Errorf("ParseSigningKeys(%q) accepted", spec)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/logging"
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+var (
+	// ErrInvalidTransfer is returned when a user's content cannot be
+	// transferred to the given user
+	ErrInvalidTransfer = apperr.Invalid("invalid_transfer", "invalid transfer")
+	// ErrUserHasContent is returned when a user who owns content is deleted
+	// without saying what becomes of it
+	ErrUserHasContent = apperr.Conflict("user_has_content", "the user owns content")
+)
+
+// UserContent counts what a user owns
+type UserContent struct {
+	Photos int `json:"photos"`
+	Albums int `json:"albums"`
+	Files  int `json:"files"`
+	Tags   int `json:"tags"`
+}
+
+// Empty reports whether the user owns nothing
+func (c *UserContent) Empty() bool {
+	return c.Photos == 0 && c.Albums == 0 && c.Files == 0 && c.Tags == 0
+}
+
+// UserDataService transfers or purges the content of users who are being
+// deleted: their photos (including the trash), albums, tags, vault files,
+// shares, share links, settings and exports
+type UserDataService struct {
+	db      *sql.DB
+	storage storage.Storage
+	trash   *TrashService
+}
+
+// NewUserDataService creates a new UserDataService
+func NewUserDataService(db *sql.DB, store storage.Storage, trash *TrashService) *UserDataService {
+	return &UserDataService{db: db, storage: store, trash: trash}
+}
+
+// CountContent returns what the user owns
+func (s *UserDataService) CountContent(ctx context.Context, userID string) (*UserContent, error) {
+	var content UserContent
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM photos WHERE user_id = ?),
+			(SELECT COUNT(*) FROM albums WHERE user_id = ?),
+			(SELECT COUNT(*) FROM vault_files WHERE user_id = ?),
+			(SELECT COUNT(*) FROM tags WHERE user_id = ?)
+	`, userID, userID, userID, userID).Scan(&content.Photos, &content.Albums, &content.Files, &content.Tags)
+	if err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// Transfer gives everything the user owns to another user. Tags are merged
+// into the recipient's tags of the same name, vault files are moved into a
+// "/transferred-<from>" folder so they can't clash with the recipient's
+// files, and shares between the two users are dropped. Shares with the old
+// user and their settings and exports are removed.
+func (s *UserDataService) Transfer(ctx context.Context, from, to string) (*UserContent, error) {
+	if from == to {
+		return nil, fmt.Errorf("%w: cannot transfer content to the same user", ErrInvalidTransfer)
+	}
+	content, err := s.CountContent(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		// Shares from the old user to the recipient are moot once they own
+		// the content; shares with the old user go with them
+		{`DELETE FROM photo_sharing WHERE shared_with = ? AND (shared_by = ? OR shared_by = ?)`, []interface{}{to, from, to}},
+		{`DELETE FROM album_sharing WHERE shared_with = ? AND (shared_by = ? OR shared_by = ?)`, []interface{}{to, from, to}},
+		{`DELETE FROM file_sharing WHERE shared_with = ? AND (shared_by = ? OR shared_by = ?)`, []interface{}{to, from, to}},
+		{`DELETE FROM photo_sharing WHERE shared_with = ?`, []interface{}{from}},
+		{`DELETE FROM album_sharing WHERE shared_with = ?`, []interface{}{from}},
+		{`DELETE FROM file_sharing WHERE shared_with = ?`, []interface{}{from}},
+		{`UPDATE photo_sharing SET shared_by = ? WHERE shared_by = ?`, []interface{}{to, from}},
+		{`UPDATE album_sharing SET shared_by = ? WHERE shared_by = ?`, []interface{}{to, from}},
+		{`UPDATE file_sharing SET shared_by = ? WHERE shared_by = ?`, []interface{}{to, from}},
+		{`UPDATE share_links SET created_by = ? WHERE created_by = ?`, []interface{}{to, from}},
+
+		{`UPDATE photos SET user_id = ?, updated_at = ? WHERE user_id = ?`, []interface{}{to, now, from}},
+		{`UPDATE photos SET partner_id = ? WHERE partner_id = ?`, []interface{}{to, from}},
+		{`UPDATE albums SET user_id = ?, updated_at = ? WHERE user_id = ?`, []interface{}{to, now, from}},
+
+		// Tags the recipient already has are merged into theirs
+		{`
+			INSERT OR IGNORE INTO photo_tags (photo_id, tag_id, source, confidence, created_by, created_at)
+			SELECT pt.photo_id, mine.id, pt.source, pt.confidence, pt.created_by, pt.created_at
+			FROM photo_tags pt
+			JOIN tags theirs ON theirs.id = pt.tag_id
+			JOIN tags mine ON mine.user_id = ? AND mine.slug = theirs.slug
+			WHERE theirs.user_id = ?
+		`, []interface{}{to, from}},
+		{`DELETE FROM tags WHERE user_id = ? AND slug IN (SELECT slug FROM tags WHERE user_id = ?)`, []interface{}{from, to}},
+		{`UPDATE tags SET user_id = ? WHERE user_id = ?`, []interface{}{to, from}},
+
+		{`
+			UPDATE vault_files
+			SET user_id = ?, path = ? || CASE WHEN path = '/' THEN '' ELSE path END, updated_at = ?
+			WHERE user_id = ?
+		`, []interface{}{to, RootFolder + "transferred-" + from, now, from}},
+
+		{`DELETE FROM user_settings WHERE user_id = ?`, []interface{}{from}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return nil, fileConflict(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.deleteExports(ctx, from)
+	return content, nil
+}
+
+// Purge permanently deletes everything the user owns, with the stored files.
+// Photos other users delivered as partners are kept but lose the link to the
+// purged partner.
+func (s *UserDataService) Purge(ctx context.Context, userID string) (*UserContent, error) {
+	content, err := s.CountContent(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Photos go through the trash so that their versions and renditions are
+	// deleted too
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE photos SET deleted_at = ? WHERE user_id = ? AND deleted_at IS NULL
+	`, time.Now().UTC(), userID); err != nil {
+		return nil, err
+	}
+	if _, err := s.trash.EmptyTrash(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT storage_key FROM vault_files WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var fileKeys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		fileKeys = append(fileKeys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`DELETE FROM vault_files WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM albums WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM tags WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM share_links WHERE created_by = ?`, []interface{}{userID}},
+		{`DELETE FROM photo_sharing WHERE shared_by = ? OR shared_with = ?`, []interface{}{userID, userID}},
+		{`DELETE FROM album_sharing WHERE shared_by = ? OR shared_with = ?`, []interface{}{userID, userID}},
+		{`DELETE FROM file_sharing WHERE shared_by = ? OR shared_with = ?`, []interface{}{userID, userID}},
+		{`UPDATE photos SET partner_id = NULL WHERE partner_id = ?`, []interface{}{userID}},
+		{`DELETE FROM user_settings WHERE user_id = ?`, []interface{}{userID}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Like the trash, the records go first and blobs that fail to delete are
+	// only logged
+	for _, key := range fileKeys {
+		if err := s.storage.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logging.FromContext(ctx).Error("Failed to delete a file of a purged user", "user_id", userID, "key", key, logging.Err(err))
+		}
+	}
+	s.deleteExports(ctx, userID)
+	return content, nil
+}
+
+// deleteExports removes the user's export jobs and archives. Failures are
+// logged; unfinished archives also expire on their own.
+func (s *UserDataService) deleteExports(ctx context.Context, userID string) {
+	rows, err := s.db.QueryContext(ctx, `SELECT COALESCE(storage_key, '') FROM export_jobs WHERE user_id = ?`, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to list exports of a user", "user_id", userID, logging.Err(err))
+		return
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if rows.Scan(&key) == nil && key != "" {
+			keys = append(keys, key)
+		}
+	}
+	rows.Close()
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM export_jobs WHERE user_id = ?`, userID); err != nil {
+		logging.FromContext(ctx).Error("Failed to delete exports of a user", "user_id", userID, logging.Err(err))
+		return
+	}
+	for _, key := range keys {
+		if err := s.storage.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logging.FromContext(ctx).Error("Failed to delete an export of a user", "user_id", userID, "key", key, logging.Err(err))
+		}
+	}
+}
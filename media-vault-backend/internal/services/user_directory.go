@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+	"github.com/wronai/media-vault-backend/internal/models"
+)
+
+// MinPasswordLength is the shortest password accepted for new and reset
+// passwords
+const MinPasswordLength = 8
+
+var (
+	// ErrUserNotFound is returned when the directory has no user with the
+	// given ID
+	ErrUserNotFound = apperr.NotFound("user_not_found", "user not found")
+	// ErrUserExists is returned when the username or email is already taken
+	ErrUserExists = apperr.Conflict("user_exists", "user already exists")
+	// ErrInvalidUser is returned for invalid user details
+	ErrInvalidUser = apperr.Invalid("invalid_user", "invalid user")
+)
+
+// UserQuery filters and pages the users of a directory
+type UserQuery struct {
+	// Search matches the username, email or full name
+	Search  string
+	Enabled *bool
+	Role    string
+	Page    int
+	Limit   int
+}
+
+// UserPage is one page of users, ordered by username
+type UserPage struct {
+	Users []*models.User `json:"data"`
+	Total int            `json:"total"`
+	Page  int            `json:"page"`
+	Limit int            `json:"limit"`
+}
+
+// UserDirectory manages the accounts that can sign in. The IDs it assigns are
+// the user IDs that photos, albums and files are stored under.
+type UserDirectory interface {
+	ListUsers(ctx context.Context, q UserQuery) (*UserPage, error)
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	CreateUser(ctx context.Context, req models.CreateUserRequest) (*models.User, error)
+	UpdateUser(ctx context.Context, id string, update models.UserUpdate) (*models.User, error)
+	// SetRoles replaces the user's roles
+	SetRoles(ctx context.Context, id string, roles []string) error
+	ResetPassword(ctx context.Context, id, password string, temporary bool) error
+	DeleteUser(ctx context.Context, id string) error
+}
+
+// normalizePage applies the default and maximum page size
+func (q *UserQuery) normalizePage() {
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+}
+
+// validateNewUser checks and normalizes the details of a new user
+func validateNewUser(req *models.CreateUserRequest) error {
+	var err error
+	if req.Username, err = cleanUsername(req.Username); err != nil {
+		return err
+	}
+	if req.Email, err = cleanEmail(req.Email); err != nil {
+		return err
+	}
+	req.FullName = strings.TrimSpace(req.FullName)
+	if req.Password != "" {
+		if err := validatePassword(req.Password); err != nil {
+			return err
+		}
+	}
+	req.Roles, err = cleanRoles(req.Roles)
+	return err
+}
+
+// validateUserUpdate checks and normalizes a user update
+func validateUserUpdate(update *models.UserUpdate) error {
+	if update.Username != nil {
+		username, err := cleanUsername(*update.Username)
+		if err != nil {
+			return err
+		}
+		update.Username = &username
+	}
+	if update.Email != nil {
+		email, err := cleanEmail(*update.Email)
+		if err != nil {
+			return err
+		}
+		update.Email = &email
+	}
+	if update.FullName != nil {
+		fullName := strings.TrimSpace(*update.FullName)
+		update.FullName = &fullName
+	}
+	return nil
+}
+
+func cleanUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if username == "" || len(username) > 255 || strings.IndexFunc(username, unicode.IsSpace) >= 0 {
+		return "", fmt.Errorf("%w: username %q", ErrInvalidUser, username)
+	}
+	return username, nil
+}
+
+func cleanEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return "", fmt.Errorf("%w: email %q", ErrInvalidUser, email)
+	}
+	return email, nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("%w: passwords must be at least %d characters", ErrInvalidUser, MinPasswordLength)
+	}
+	return nil
+}
+
+// cleanRoles trims and deduplicates role names
+func cleanRoles(roles []string) ([]string, error) {
+	cleaned := []string{}
+	seen := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		role = strings.TrimSpace(role)
+		if role == "" || strings.IndexFunc(role, unicode.IsSpace) >= 0 {
+			return nil, fmt.Errorf("%w: role %q", ErrInvalidUser, role)
+		}
+		if !seen[role] {
+			seen[role] = true
+			cleaned = append(cleaned, role)
+		}
+	}
+	return cleaned, nil
+}
+
+// hasRole reports whether roles contains role
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -1,15 +1,239 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+)
+
+// Unlimited is the quota value that disables the storage limit
+const Unlimited int64 = 0
+
+var (
+	// ErrQuotaExceeded is returned when an upload would exceed the user's quota
+	ErrQuotaExceeded = apperr.QuotaExceeded("quota_exceeded", "storage quota exceeded")
+	// ErrInvalidQuota is returned for negative quotas
+	ErrInvalidQuota = apperr.Invalid("invalid_quota", "invalid storage quota")
 )
 
+// UsageBucket is the storage used by one MIME type or month
+type UsageBucket struct {
+	Key   string `json:"key"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// StorageUsage describes how much of their quota a user has used: photo
+// originals, their earlier versions and renditions (counted with the photo
+// they belong to) and vault files.
+type StorageUsage struct {
+	UserID         string        `json:"user_id"`
+	Files          int           `json:"files"`
+	UsedBytes      int64         `json:"used_bytes"`
+	OriginalBytes  int64         `json:"original_bytes"`
+	VersionBytes   int64         `json:"version_bytes"`
+	RenditionBytes int64         `json:"rendition_bytes"`
+	FileBytes      int64         `json:"file_bytes"`
+	QuotaBytes     int64         `json:"quota_bytes"` // 0 means unlimited
+	QuotaIsDefault bool          `json:"quota_is_default"`
+	RemainingBytes *int64        `json:"remaining_bytes,omitempty"`
+	ByMimeType     []UsageBucket `json:"by_mime_type"`
+	ByMonth        []UsageBucket `json:"by_month"`
+}
+
+// supersededVersion matches photo_versions rows v of photos p whose content is
+// stored in addition to the current original. Restored versions share the
+// content of the version they restore, so they are never counted twice.
+const supersededVersion = `v.restored_from IS NULL AND v.storage_key != p.file_path`
+
+// VaultService tracks storage usage and enforces per-user quotas
 type VaultService struct {
-    db *sql.DB
+	db           *sql.DB
+	defaultQuota int64
+}
+
+// NewVaultService creates a new VaultService. defaultQuota applies to users
+// without a quota of their own; 0 means unlimited.
+func NewVaultService(db *sql.DB, defaultQuota int64) *VaultService {
+	return &VaultService{db: db, defaultQuota: defaultQuota}
+}
+
+// GetQuota returns the user's quota in bytes and whether it is the default
+func (s *VaultService) GetQuota(ctx context.Context, userID string) (int64, bool, error) {
+	var quota sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT storage_quota FROM user_settings WHERE user_id = ?
+	`, userID).Scan(&quota)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, false, err
+	}
+	if !quota.Valid {
+		return s.defaultQuota, true, nil
+	}
+	return quota.Int64, false, nil
+}
+
+// SetQuota sets the user's quota in bytes. A nil quota restores the default.
+func (s *VaultService) SetQuota(ctx context.Context, userID string, quota *int64) error {
+	if quota != nil && *quota < 0 {
+		return fmt.Errorf("%w: quota must not be negative", ErrInvalidQuota)
+	}
+
+	var value interface{}
+	if quota != nil {
+		value = *quota
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_settings (user_id, storage_quota, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET storage_quota = excluded.storage_quota, updated_at = excluded.updated_at
+	`, userID, value, time.Now().UTC(), time.Now().UTC())
+	return err
 }
 
-func NewVaultService(db *sql.DB) *VaultService {
-    return &VaultService{db: db}
+// UsedBytes returns the bytes stored for the user's photos, earlier photo
+// versions, renditions and vault files
+func (s *VaultService) UsedBytes(ctx context.Context, userID string) (int64, error) {
+	var used int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE((SELECT SUM(file_size) FROM photos WHERE user_id = ?), 0) +
+			COALESCE((SELECT SUM(v.file_size) FROM photo_versions v JOIN photos p ON p.id = v.photo_id
+				WHERE p.user_id = ? AND `+supersededVersion+`), 0) +
+			COALESCE((SELECT SUM(r.size) FROM photo_renditions r JOIN photos p ON p.id = r.photo_id WHERE p.user_id = ?), 0) +
+			COALESCE((SELECT SUM(size) FROM vault_files WHERE user_id = ?), 0)
+	`, userID, userID, userID, userID).Scan(&used)
+	return used, err
 }
 
-// Add your VaultService methods here
+// CheckQuota returns ErrQuotaExceeded if storing size more bytes would take
+// the user over their quota. Concurrent uploads are checked independently, so
+// they can overshoot the quota by at most one upload each.
+func (s *VaultService) CheckQuota(ctx context.Context, userID string, size int64) error {
+	quota, _, err := s.GetQuota(ctx, userID)
+	if err != nil || quota == Unlimited {
+		return err
+	}
+
+	used, err := s.UsedBytes(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if used+size > quota {
+		return fmt.Errorf("%w: %s used of %s, upload needs %s",
+			ErrQuotaExceeded, FormatBytes(used), FormatBytes(quota), FormatBytes(size))
+	}
+	return nil
+}
+
+// GetUsage returns the user's storage usage broken down by MIME type and by
+// upload month
+func (s *VaultService) GetUsage(ctx context.Context, userID string) (*StorageUsage, error) {
+	usage := &StorageUsage{UserID: userID, ByMimeType: []UsageBucket{}, ByMonth: []UsageBucket{}}
+
+	var err error
+	if usage.QuotaBytes, usage.QuotaIsDefault, err = s.GetQuota(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT 0, p.mime_type, substr(p.created_at, 1, 7), COUNT(*), SUM(p.file_size),
+			COALESCE(SUM(v.size), 0), COALESCE(SUM(r.size), 0)
+		FROM photos p
+		LEFT JOIN (
+			SELECT v.photo_id, SUM(v.file_size) AS size
+			FROM photo_versions v JOIN photos p ON p.id = v.photo_id
+			WHERE `+supersededVersion+`
+			GROUP BY v.photo_id
+		) v ON v.photo_id = p.id
+		LEFT JOIN (
+			SELECT photo_id, SUM(size) AS size FROM photo_renditions GROUP BY photo_id
+		) r ON r.photo_id = p.id
+		WHERE p.user_id = ?
+		GROUP BY 2, 3
+		UNION ALL
+		SELECT 1, mime_type, substr(created_at, 1, 7), COUNT(*), SUM(size), 0, 0
+		FROM vault_files
+		WHERE user_id = ?
+		GROUP BY 2, 3
+	`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byMime := make(map[string]*UsageBucket)
+	byMonth := make(map[string]*UsageBucket)
+	for rows.Next() {
+		var isFile bool
+		var mimeType, month string
+		var files int
+		var stored, versions, renditions int64
+		if err := rows.Scan(&isFile, &mimeType, &month, &files, &stored, &versions, &renditions); err != nil {
+			return nil, err
+		}
+
+		usage.Files += files
+		if isFile {
+			usage.FileBytes += stored
+		} else {
+			usage.OriginalBytes += stored
+		}
+		usage.VersionBytes += versions
+		usage.RenditionBytes += renditions
+		addUsage(byMime, mimeType, files, stored+versions+renditions)
+		addUsage(byMonth, month, files, stored+versions+renditions)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	usage.UsedBytes = usage.OriginalBytes + usage.VersionBytes + usage.RenditionBytes + usage.FileBytes
+	if usage.QuotaBytes != Unlimited {
+		remaining := max(usage.QuotaBytes-usage.UsedBytes, 0)
+		usage.RemainingBytes = &remaining
+	}
+
+	for _, bucket := range byMime {
+		usage.ByMimeType = append(usage.ByMimeType, *bucket)
+	}
+	sort.Slice(usage.ByMimeType, func(i, j int) bool {
+		return usage.ByMimeType[i].Bytes > usage.ByMimeType[j].Bytes
+	})
+	for _, bucket := range byMonth {
+		usage.ByMonth = append(usage.ByMonth, *bucket)
+	}
+	sort.Slice(usage.ByMonth, func(i, j int) bool {
+		return usage.ByMonth[i].Key < usage.ByMonth[j].Key
+	})
+
+	return usage, nil
+}
+
+func addUsage(buckets map[string]*UsageBucket, key string, files int, bytes int64) {
+	bucket, ok := buckets[key]
+	if !ok {
+		bucket = &UsageBucket{Key: key}
+		buckets[key] = bucket
+	}
+	bucket.Files += files
+	bucket.Bytes += bytes
+}
+
+// FormatBytes formats a byte count for messages, e.g. "12.5 MB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// worker runs a background loop that can be stopped gracefully: the loop is
+// asked to stop, finishes what it is doing and returns, and only if that
+// takes too long is its context cancelled
+type worker struct {
+	mu     sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+// start runs loop in the background. loop must return once stop is closed or
+// ctx is cancelled, and should pass ctx to the work it does.
+func (w *worker) start(ctx context.Context, loop func(ctx context.Context, stop <-chan struct{})) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.stop, w.done = make(chan struct{}), make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		loop(ctx, stop)
+	}(w.stop, w.done)
+}
+
+// shutdown stops the loop and waits for it to return. If ctx expires first,
+// the work in progress is cancelled and ctx's error returned once the loop
+// has returned.
+func (w *worker) shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	stop, done, cancel := w.stop, w.done, w.cancel
+	w.stop = nil
+	w.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+
+	close(stop)
+	defer cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/wronai/media-vault-backend/internal/storage"
+)
+
+// tracedStorage records a span for every operation of the storage it wraps
+type tracedStorage struct {
+	storage.Storage
+}
+
+// InstrumentStorage wraps s so that its operations are traced
+func InstrumentStorage(s storage.Storage) storage.Storage {
+	return &tracedStorage{Storage: s}
+}
+
+func (s *tracedStorage) Put(ctx context.Context, key string, r io.Reader) (n int64, err error) {
+	ctx, span := startStorage(ctx, "put", key)
+	defer func() {
+		span.SetAttributes(attribute.Int64("storage.bytes", n))
+		endStorage(span, err)
+	}()
+	return s.Storage.Put(ctx, key, r)
+}
+
+func (s *tracedStorage) Open(ctx context.Context, key string) (obj storage.Object, err error) {
+	ctx, span := startStorage(ctx, "open", key)
+	defer func() { endStorage(span, err) }()
+	return s.Storage.Open(ctx, key)
+}
+
+func (s *tracedStorage) Stat(ctx context.Context, key string) (info storage.Info, err error) {
+	ctx, span := startStorage(ctx, "stat", key)
+	defer func() { endStorage(span, err) }()
+	return s.Storage.Stat(ctx, key)
+}
+
+func (s *tracedStorage) Delete(ctx context.Context, key string) (err error) {
+	ctx, span := startStorage(ctx, "delete", key)
+	defer func() { endStorage(span, err) }()
+	return s.Storage.Delete(ctx, key)
+}
+
+func startStorage(ctx context.Context, op, key string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "storage."+op, trace.WithAttributes(
+		attribute.String("storage.operation", op),
+		attribute.String("storage.key", key),
+	))
+}
+
+// endStorage ends a storage span. Missing objects are expected, e.g.
+// thumbnails not generated yet, so they are not errors.
+func endStorage(span trace.Span, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		span.SetAttributes(attribute.Bool("storage.not_found", true))
+		err = nil
+	}
+	End(span, err)
+}
@@ -0,0 +1,312 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/wronai/media-vault-backend/internal/database"
+	"github.com/wronai/media-vault-backend/internal/services"
+	"github.com/wronai/media-vault-backend/internal/storage"
+	"github.com/wronai/media-vault-backend/internal/tracing"
+)
+
+// setupInMemory installs a tracer provider that records spans in memory as
+// they end, and the W3C trace context propagator. Both are restored when the
+// test ends.
+func setupInMemory(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	previousProvider := otel.GetTracerProvider()
+	previousPropagator := otel.GetTextMapPropagator()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter
+}
+
+func findSpan(spans tracetest.SpanStubs, name string) (tracetest.SpanStub, bool) {
+	for _, s := range spans {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return tracetest.SpanStub{}, false
+}
+
+func attr(s tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// descendsFrom reports whether s is a descendant of ancestor
+func descendsFrom(spans tracetest.SpanStubs, s, ancestor tracetest.SpanStub) bool {
+	byID := make(map[trace.SpanID]tracetest.SpanStub, len(spans))
+	for _, span := range spans {
+		byID[span.SpanContext.SpanID()] = span
+	}
+	for s.Parent.IsValid() {
+		if s.Parent.SpanID() == ancestor.SpanContext.SpanID() {
+			return true
+		}
+		parent, ok := byID[s.Parent.SpanID()]
+		if !ok {
+			return false
+		}
+		s = parent
+	}
+	return false
+}
+
+func TestMiddlewareNamesSpanAfterRoute(t *testing.T) {
+	exporter := setupInMemory(t)
+
+	app := fiber.New()
+	app.Use(tracing.Middleware())
+	app.Get("/photos/:id", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "down")
+	})
+
+	tests := []struct {
+		path     string
+		name     string
+		route    string
+		status   int64
+		failed   bool
+		traceID  string
+		parentID string
+	}{
+		{path: "/photos/42", name: "GET /photos/:id", route: "/photos/:id", status: 204},
+		{path: "/fail", name: "GET /fail", route: "/fail", status: 503, failed: true},
+		// Unknown routes keep the method as their name, so that span names
+		// stay few
+		{path: "/nothing", name: "GET", status: 404},
+		{
+			path: "/photos/7", name: "GET /photos/:id", route: "/photos/:id", status: 204,
+			traceID: "4bf92f3577b34da6a3ce929d0e0e4736", parentID: "00f067aa0ba902b7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			exporter.Reset()
+			req := httptest.NewRequest(fiber.MethodGet, tt.path, nil)
+			if tt.traceID != "" {
+				req.Header.Set("traceparent", "00-"+tt.traceID+"-"+tt.parentID+"-01")
+			}
+			if _, err := app.Test(req); err != nil {
+				t.Fatal(err)
+			}
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name != tt.name {
+				t.Errorf("name = %q, want %q", span.Name, tt.name)
+			}
+			if span.SpanKind != trace.SpanKindServer {
+				t.Errorf("kind = %v, want server", span.SpanKind)
+			}
+			if v, _ := attr(span, semconv.HTTPResponseStatusCodeKey); v.AsInt64() != tt.status {
+				t.Errorf("status = %d, want %d", v.AsInt64(), tt.status)
+			}
+			if v, _ := attr(span, semconv.HTTPRouteKey); v.AsString() != tt.route {
+				t.Errorf("route = %q, want %q", v.AsString(), tt.route)
+			}
+			if failed := span.Status.Code == codes.Error; failed != tt.failed {
+				t.Errorf("status code = %v, want failed %v", span.Status.Code, tt.failed)
+			}
+			if tt.traceID != "" {
+				if got := span.SpanContext.TraceID().String(); got != tt.traceID {
+					t.Errorf("trace ID = %s, want the caller's %s", got, tt.traceID)
+				}
+				if got := span.Parent.SpanID().String(); got != tt.parentID {
+					t.Errorf("parent = %s, want the caller's %s", got, tt.parentID)
+				}
+			}
+		})
+	}
+}
+
+func TestChildSpansNestUnderRequest(t *testing.T) {
+	exporter := setupInMemory(t)
+
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	local, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	photoService := services.NewPhotoService(db, tracing.InstrumentStorage(local), "en")
+	photoID := uploadTestPhoto(t, photoService)
+
+	app := fiber.New()
+	app.Use(tracing.Middleware())
+	app.Get("/photos/:id/thumbnail", func(c *fiber.Ctx) error {
+		data, contentType, err := photoService.GetThumbnail(c.UserContext(), c.Params("id"), "small")
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		return c.Send(data)
+	})
+
+	exporter.Reset()
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/photos/"+photoID+"/thumbnail", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	spans := exporter.GetSpans()
+	server, ok := findSpan(spans, "GET /photos/:id/thumbnail")
+	if !ok {
+		t.Fatalf("no server span in %d spans", len(spans))
+	}
+	service, ok := findSpan(spans, "PhotoService.GetThumbnail")
+	if !ok {
+		t.Fatal("no PhotoService.GetThumbnail span")
+	}
+	if service.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Error("service span is not a child of the server span")
+	}
+
+	var sqlSpans, storageSpans int
+	for _, s := range spans {
+		if s.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Errorf("span %q is in another trace", s.Name)
+		}
+		if v, ok := attr(s, semconv.DBSystemKey); ok && v.AsString() == semconv.DBSystemSqlite.Value.AsString() {
+			sqlSpans++
+			if !descendsFrom(spans, s, service) {
+				t.Errorf("SQL span %q does not descend from the service span", s.Name)
+			}
+		}
+		if _, ok := attr(s, "storage.operation"); ok {
+			storageSpans++
+			if !descendsFrom(spans, s, service) {
+				t.Errorf("storage span %q does not descend from the service span", s.Name)
+			}
+		}
+	}
+	if sqlSpans == 0 {
+		t.Error("no SQL spans")
+	}
+	if storageSpans == 0 {
+		t.Error("no storage spans")
+	}
+}
+
+func TestNewHTTPClientInjectsTraceparent(t *testing.T) {
+	exporter := setupInMemory(t)
+
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	ctx, span := tracing.Start(context.Background(), "DescriptionService.Translate")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tracing.NewHTTPClient(5 * time.Second).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	span.End()
+
+	traceparent := <-received
+	carrier := propagation.MapCarrier{"traceparent": traceparent}
+	remote := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	if !remote.IsValid() {
+		t.Fatalf("traceparent %q is not valid", traceparent)
+	}
+	if remote.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("traceparent trace ID = %s, want %s", remote.TraceID(), span.SpanContext().TraceID())
+	}
+
+	// The header names the client span, a child of the caller's span
+	var client tracetest.SpanStub
+	for _, s := range exporter.GetSpans() {
+		if s.SpanKind == trace.SpanKindClient {
+			client = s
+		}
+	}
+	if client.SpanContext.SpanID() != remote.SpanID() {
+		t.Errorf("traceparent span ID = %s, want the client span's %s", remote.SpanID(), client.SpanContext.SpanID())
+	}
+	if client.Parent.SpanID() != span.SpanContext().SpanID() {
+		t.Error("client span is not a child of the caller's span")
+	}
+}
+
+// uploadTestPhoto uploads a small PNG and returns its ID
+func uploadTestPhoto(t *testing.T, photoService *services.PhotoService) string {
+	t.Helper()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="photo.png"`)
+	header.Set("Content-Type", "image/png")
+	part, err := w.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(img.Bytes())
+	w.Close()
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	photo, err := photoService.UploadPhoto(context.Background(), "u1", form.File["file"][0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return photo.ID
+}
@@ -0,0 +1,8 @@
+package utils
+
+import "errors"
+
+// DiskSpace is not supported on Windows
+func DiskSpace(path string) (free, total uint64, err error) {
+	return 0, 0, errors.New("disk space is not supported on windows")
+}
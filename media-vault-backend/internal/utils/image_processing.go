@@ -11,12 +11,6 @@ func ProcessImage(r io.Reader) (image.Image, error) {
     return nil, nil
 }
 
-// GenerateThumbnail generates a thumbnail for the given image
-func GenerateThumbnail(img image.Image, width, height int) (image.Image, error) {
-    // Implementation for thumbnail generation
-    return nil, nil
-}
-
 // ConvertImage converts an image to the specified format
 func ConvertImage(img image.Image, format string) ([]byte, error) {
     // Implementation for image conversion
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+)
+
+// DefaultLanguage is the language photo descriptions are stored in when no
+// other default is configured
+const DefaultLanguage = "en"
+
+// ErrInvalidLanguage is returned for malformed language tags
+var ErrInvalidLanguage = apperr.Invalid("invalid_language", "invalid language tag")
+
+// NormalizeLanguageTag canonicalizes a BCP-47 language tag, e.g. "EN_us" becomes
+// "en-US". It returns an empty string if the tag is malformed.
+func NormalizeLanguageTag(tag string) string {
+	tag = strings.TrimSpace(strings.ReplaceAll(tag, "_", "-"))
+	if tag == "" {
+		return ""
+	}
+
+	subtags := strings.Split(tag, "-")
+	for i, subtag := range subtags {
+		if len(subtag) == 0 || len(subtag) > 8 || !isAlphanumeric(subtag) {
+			return ""
+		}
+
+		switch {
+		case i == 0:
+			// Primary language subtag: 2-3 letters (or 5-8 for registered languages)
+			if !isAlpha(subtag) || len(subtag) == 1 || len(subtag) == 4 {
+				return ""
+			}
+			subtags[i] = strings.ToLower(subtag)
+		case len(subtag) == 4 && isAlpha(subtag):
+			// Script subtag, e.g. "Latn"
+			subtags[i] = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		case len(subtag) == 2 && isAlpha(subtag), len(subtag) == 3 && isDigits(subtag):
+			// Region subtag, e.g. "US" or "419"
+			subtags[i] = strings.ToUpper(subtag)
+		default:
+			subtags[i] = strings.ToLower(subtag)
+		}
+	}
+
+	return strings.Join(subtags, "-")
+}
+
+// BaseLanguage returns the primary language subtag of a tag ("pt-BR" -> "pt")
+func BaseLanguage(tag string) string {
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// ParseAcceptLanguage parses an Accept-Language header into normalized language
+// tags ordered by preference. Wildcards and tags with q=0 are skipped.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var entries []weighted
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := NormalizeLanguageTag(fields[0])
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		seen[tag] = true
+		entries = append(entries, weighted{tag: tag, q: q})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].q > entries[j].q
+	})
+
+	tags := make([]string, len(entries))
+	for i, e := range entries {
+		tags[i] = e.tag
+	}
+	return tags
+}
+
+// MatchLanguage returns the available language that best satisfies the
+// preferences. An exact match wins, then a match on the base language
+// ("de-AT" accepts "de" or "de-DE"). If nothing matches, fallback is returned.
+func MatchLanguage(preferences, available []string, fallback string) string {
+	for _, pref := range preferences {
+		for _, lang := range available {
+			if strings.EqualFold(pref, lang) {
+				return lang
+			}
+		}
+
+		base := BaseLanguage(pref)
+		for _, lang := range available {
+			if strings.EqualFold(base, lang) {
+				return lang
+			}
+		}
+		for _, lang := range available {
+			if strings.EqualFold(base, BaseLanguage(lang)) {
+				return lang
+			}
+		}
+	}
+
+	return fallback
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/wronai/media-vault-backend/internal/apperr"
+)
+
+const (
+	// MaxTagLength is the maximum length of a tag name in characters
+	MaxTagLength = 64
+	// MaxTagsPerPhoto is the maximum number of tags a single photo can carry
+	MaxTagsPerPhoto = 50
+)
+
+// ErrInvalidTag is returned for tag names and lists that cannot be used
+var ErrInvalidTag = apperr.Invalid("invalid_tag", "invalid tag")
+
+// Slugify turns a tag name into its normalized slug: lowercase letters and
+// digits separated by single dashes, e.g. " Sunset  Beach!" becomes "sunset-beach"
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// CleanTagName trims a tag name and collapses internal whitespace
+func CleanTagName(name string) string {
+	return strings.Join(strings.Fields(strings.TrimPrefix(strings.TrimSpace(name), "#")), " ")
+}
+
+// ParseTags splits a comma-separated tag list, validates each tag and drops
+// duplicates (by slug). Empty entries are ignored.
+func ParseTags(input string) ([]string, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+	return ValidateTags(strings.Split(input, ","))
+}
+
+// ValidateTags cleans and validates a list of tag names, dropping empty
+// entries and duplicates (by slug)
+func ValidateTags(names []string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = CleanTagName(name)
+		if name == "" {
+			continue
+		}
+		if len([]rune(name)) > MaxTagLength {
+			return nil, fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidTag, name, MaxTagLength)
+		}
+
+		slug := Slugify(name)
+		if slug == "" {
+			return nil, fmt.Errorf("%w: %q must contain letters or digits", ErrInvalidTag, name)
+		}
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		tags = append(tags, name)
+	}
+
+	if len(tags) > MaxTagsPerPhoto {
+		return nil, fmt.Errorf("%w: too many tags: %d (maximum is %d)", ErrInvalidTag, len(tags), MaxTagsPerPhoto)
+	}
+	return tags, nil
+}
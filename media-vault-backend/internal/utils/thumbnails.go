@@ -1,6 +1,24 @@
 package utils
 
-import "image"
+import (
+    "bytes"
+    "errors"
+    "image"
+    "image/jpeg"
+    "image/png"
+
+    "golang.org/x/image/draw"
+)
+
+// DefaultThumbnailQuality is the JPEG quality used when none is given
+const DefaultThumbnailQuality = 85
+
+// ThumbnailSizes maps thumbnail size names to their bounding box in pixels
+var ThumbnailSizes = map[string]int{
+    "small":  256,
+    "medium": 800,
+    "large":  1600,
+}
 
 // ThumbnailOptions contains options for thumbnail generation
 type ThumbnailOptions struct {
@@ -10,14 +28,64 @@ type ThumbnailOptions struct {
     Format  string
 }
 
-// GenerateThumbnail generates a thumbnail for the given image
+// GenerateThumbnail generates a thumbnail for the given image. The image is
+// scaled to fit within Width x Height, keeping its aspect ratio, and is never
+// enlarged. Format is "jpeg" (the default) or "png".
 func GenerateThumbnail(img image.Image, opts ThumbnailOptions) ([]byte, error) {
-    // Implementation for thumbnail generation
-    return nil, nil
+    if opts.Width <= 0 || opts.Height <= 0 {
+        return nil, errors.New("thumbnail width and height must be positive")
+    }
+
+    bounds := img.Bounds()
+    width, height := bounds.Dx(), bounds.Dy()
+    if width == 0 || height == 0 {
+        return nil, errors.New("image is empty")
+    }
+
+    scale := float64(opts.Width) / float64(width)
+    if s := float64(opts.Height) / float64(height); s < scale {
+        scale = s
+    }
+    if scale < 1 {
+        width = max(1, int(float64(width)*scale+0.5))
+        height = max(1, int(float64(height)*scale+0.5))
+    }
+
+    dst := image.NewRGBA(image.Rect(0, 0, width, height))
+    op := draw.Src
+    if opts.Format != "png" {
+        // JPEG has no alpha channel; flatten transparency onto white
+        draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+        op = draw.Over
+    }
+    draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, op, nil)
+
+    var buf bytes.Buffer
+    switch opts.Format {
+    case "png":
+        if err := png.Encode(&buf, dst); err != nil {
+            return nil, err
+        }
+    case "", "jpeg", "jpg":
+        quality := opts.Quality
+        if quality <= 0 || quality > 100 {
+            quality = DefaultThumbnailQuality
+        }
+        if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality}); err != nil {
+            return nil, err
+        }
+    default:
+        return nil, errors.New("unsupported thumbnail format: " + opts.Format)
+    }
+
+    return buf.Bytes(), nil
 }
 
 // GenerateThumbnailFromBytes generates a thumbnail from image bytes
 func GenerateThumbnailFromBytes(data []byte, opts ThumbnailOptions) ([]byte, error) {
-    // Implementation for thumbnail generation from bytes
-    return nil, nil
+    img, _, err := image.Decode(bytes.NewReader(data))
+    if err != nil {
+        return nil, err
+    }
+    return GenerateThumbnail(img, opts)
 }